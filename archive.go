@@ -0,0 +1,143 @@
+package exec
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// ArchiveOptions configures Archive.
+type ArchiveOptions struct {
+	// CompressLogs gzips every log file in the archive.
+	CompressLogs bool
+}
+
+// Archive writes a tarball to w that contains everything needed to
+// understand what a group has been doing, for attaching to bug reports:
+//
+//	definition.json   the current configuration of the group
+//	snapshots.json    the snapshots of the group
+//	runs.json         the run history of the group
+//	logs/             the captured output of the group's commands
+func (g *Groups) Archive(groupName string, w io.Writer, opts ArchiveOptions) error {
+	grp := g.getGroup(groupName)
+	if grp == nil {
+		return errors.Errorf("group %s not found", groupName)
+	}
+	tx, err := g.db.Begin()
+	if err != nil {
+		return errors.Wrap(err, "starting transaction")
+	}
+	def, err := g.buildSnapshotTx(tx, groupName, grp)
+	_ = tx.Rollback() // Read only.
+	if err != nil {
+		return errors.Wrap(err, "getting group definition")
+	}
+	snaps, err := g.Snapshots(groupName)
+	if err != nil {
+		return errors.Wrap(err, "getting snapshots")
+	}
+	runs, err := g.Runs(groupName)
+	if err != nil {
+		return errors.Wrap(err, "getting runs")
+	}
+	var (
+		tw  = tar.NewWriter(w)
+		now = g.clock.Now()
+	)
+	for _, entry := range []struct {
+		name string
+		v    interface{}
+	}{
+		{name: "definition.json", v: def},
+		{name: "snapshots.json", v: snaps},
+		{name: "runs.json", v: runs},
+	} {
+		data, err := json.MarshalIndent(entry.v, "", "  ")
+		if err != nil {
+			return errors.Wrap(err, "encoding "+entry.name)
+		}
+		if err := writeTarFile(tw, entry.name, now, data); err != nil {
+			return err
+		}
+	}
+	if err := g.archiveLogs(tw, groupName, opts.CompressLogs); err != nil {
+		return errors.Wrap(err, "archiving logs")
+	}
+	return errors.Wrap(tw.Close(), "closing tar writer")
+}
+
+// archiveLogs adds the log files of a group to a tarball.
+func (g *Groups) archiveLogs(tw *tar.Writer, groupName string, compress bool) error {
+	infos, err := ioutil.ReadDir(filepath.Join(g.root, groupName))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+	for _, info := range infos {
+		if info.IsDir() || !isLogFile(info.Name()) {
+			continue
+		}
+		data, err := ioutil.ReadFile(filepath.Join(g.root, groupName, info.Name()))
+		if err != nil {
+			return err
+		}
+		name := filepath.ToSlash(filepath.Join("logs", info.Name()))
+
+		if compress {
+			if data, err = gzipBytes(data); err != nil {
+				return errors.Wrap(err, "compressing "+info.Name())
+			}
+			name += ".gz"
+		}
+		if err := writeTarFile(tw, name, info.ModTime(), data); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// isLogFile returns true if name is the name of a file that output is captured to.
+func isLogFile(name string) bool {
+	return strings.HasSuffix(name, ".stdout") || strings.HasSuffix(name, ".stderr")
+}
+
+// writeTarFile writes a regular file to a tarball.
+func writeTarFile(tw *tar.Writer, name string, modTime time.Time, data []byte) error {
+	if err := tw.WriteHeader(&tar.Header{
+		Name:    name,
+		Mode:    0644,
+		Size:    int64(len(data)),
+		ModTime: modTime,
+	}); err != nil {
+		return errors.Wrap(err, "writing tar header for "+name)
+	}
+	_, err := tw.Write(data)
+	return errors.Wrap(err, "writing "+name)
+}
+
+// gzipBytes compresses data with gzip.
+func gzipBytes(data []byte) ([]byte, error) {
+	var (
+		buf = &bytes.Buffer{}
+		zw  = gzip.NewWriter(buf)
+	)
+	if _, err := zw.Write(data); err != nil {
+		return nil, err
+	}
+	if err := zw.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
@@ -0,0 +1,75 @@
+package exec_test
+
+import (
+	"archive/tar"
+	"bytes"
+	"io"
+	"os"
+	osexec "os/exec"
+	"path/filepath"
+	"testing"
+
+	"github.com/scgolang/exec"
+)
+
+func TestGroupsArchive(t *testing.T) {
+	var (
+		groupName = "echofoo"
+		root      = filepath.Join("testdata", "."+t.Name())
+	)
+	_ = os.RemoveAll(root)
+
+	var (
+		gs  = newTestGroups(t, root)
+		cmd = osexec.Command("echo", "foo")
+		buf = &bytes.Buffer{}
+	)
+	if err := gs.Create(groupName, cmd); err != nil {
+		t.Fatal(err)
+	}
+	if err := gs.Wait(groupName); err != nil {
+		t.Fatal(err)
+	}
+	if err := gs.Archive(groupName, buf, exec.ArchiveOptions{CompressLogs: true}); err != nil {
+		t.Fatal(err)
+	}
+	cid, ok := gs.CmdID(groupName, cmd)
+	if !ok {
+		t.Fatal("expected command to have an instance ID")
+	}
+	var (
+		names = map[string]bool{}
+		tr    = tar.NewReader(buf)
+	)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		names[hdr.Name] = true
+	}
+	for _, name := range []string{
+		"definition.json",
+		"snapshots.json",
+		"runs.json",
+		"logs/" + cid + ".stdout.gz",
+		"logs/" + cid + ".stderr.gz",
+	} {
+		if !names[name] {
+			t.Fatalf("expected archive to contain %s, got %v", name, names)
+		}
+	}
+	runs, err := gs.Runs(groupName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected, got := 1, len(runs); expected != got {
+		t.Fatalf("expected %d runs, got %d", expected, got)
+	}
+	if expected, got := exec.StateExited, runs[0].State; expected != got {
+		t.Fatalf("expected state %s, got %s", expected, got)
+	}
+}
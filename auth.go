@@ -0,0 +1,347 @@
+package exec
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"io"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// Role decides what a client of the control servers is allowed to do.
+// Roles are ordered, so a client is allowed to do everything the roles below its own allow.
+type Role int
+
+// Roles.
+const (
+	// RoleReadOnly can look at the groups, for example with HealthHandler and DebugHandler.
+	RoleReadOnly Role = iota + 1
+
+	// RoleOperator can also change the groups and their commands.
+	RoleOperator
+)
+
+// roleNames maps roles to their names.
+var roleNames = map[Role]string{
+	RoleReadOnly: "read-only",
+	RoleOperator: "operator",
+}
+
+// String returns the name of the role.
+func (r Role) String() string {
+	if name, ok := roleNames[r]; ok {
+		return name
+	}
+	return "none"
+}
+
+// MarshalText encodes the role as its name.
+func (r Role) MarshalText() ([]byte, error) {
+	return []byte(r.String()), nil
+}
+
+// Client is a client of the control servers that was authenticated by an Authenticator.
+type Client struct {
+	Name string
+	Role Role
+}
+
+// Authenticator authenticates the clients of the HTTP control servers, by
+// bearer token or by TLS client certificate, and checks their role.
+// Without it a handler such as DebugHandler serves anyone who can reach it.
+type Authenticator struct {
+	// tokens maps the SHA-256 hash of a token to its client,
+	// so that looking tokens up does not depend on how much of them matches.
+	// certs maps the common name of a client certificate to its client.
+	tokens map[[sha256.Size]byte]Client
+	certs  map[string]Client
+	mu     sync.RWMutex
+
+	clock Clock
+
+	// rate is how many requests a second each client can make on average,
+	// and burst how many it can make at once. Zero rate means there is no limit.
+	rate    float64
+	burst   int
+	buckets map[string]*tokenBucket
+	limitMu sync.Mutex
+
+	// audit, if not nil, receives an AuditRecord for every mutating request.
+	audit   io.Writer
+	auditMu sync.Mutex
+}
+
+// AuthOption configures an Authenticator.
+type AuthOption func(*Authenticator) error
+
+// WithAuthClock sets the clock that rate limits and audit records use.
+func WithAuthClock(clock Clock) AuthOption {
+	return func(a *Authenticator) error {
+		a.clock = clock
+		return nil
+	}
+}
+
+// WithRateLimit limits each client to perSecond requests a second on average,
+// and at most burst requests at once. Requests over the limit are answered
+// with status 429 and a Retry-After header. Clients are told apart by name.
+func WithRateLimit(perSecond float64, burst int) AuthOption {
+	return func(a *Authenticator) error {
+		if perSecond <= 0 || burst < 1 {
+			return errors.Errorf("rate limit must be positive, got %v a second with bursts of %d", perSecond, burst)
+		}
+		a.rate, a.burst = perSecond, burst
+		return nil
+	}
+}
+
+// WithAuditLog writes an AuditRecord as a line of JSON to w for every request
+// that could change the groups, that is every request with a method other
+// than GET, HEAD, and OPTIONS, including those that were refused.
+func WithAuditLog(w io.Writer) AuthOption {
+	return func(a *Authenticator) error {
+		a.audit = w
+		return nil
+	}
+}
+
+// NewAuthenticator creates an authenticator that does not know any clients.
+func NewAuthenticator(opts ...AuthOption) (*Authenticator, error) {
+	a := &Authenticator{
+		tokens:  map[[sha256.Size]byte]Client{},
+		certs:   map[string]Client{},
+		clock:   realClock{},
+		buckets: map[string]*tokenBucket{},
+	}
+	for _, opt := range opts {
+		if err := opt(a); err != nil {
+			return nil, err
+		}
+	}
+	return a, nil
+}
+
+// AddToken lets client authenticate with an "Authorization: Bearer <token>" header.
+func (a *Authenticator) AddToken(token string, client Client) error {
+	if token == "" {
+		return errors.New("token must not be empty")
+	}
+	if err := client.validate(); err != nil {
+		return err
+	}
+	a.mu.Lock()
+	a.tokens[sha256.Sum256([]byte(token))] = client
+	a.mu.Unlock()
+	return nil
+}
+
+// AddCertificate lets client authenticate with a TLS client certificate
+// that has the provided common name. The certificate must be verified by
+// the server, see AuthTLSConfig.
+func (a *Authenticator) AddCertificate(commonName string, client Client) error {
+	if commonName == "" {
+		return errors.New("common name must not be empty")
+	}
+	if err := client.validate(); err != nil {
+		return err
+	}
+	a.mu.Lock()
+	a.certs[commonName] = client
+	a.mu.Unlock()
+	return nil
+}
+
+// validate returns an error if the client does not have a name and a role.
+func (c Client) validate() error {
+	if c.Name == "" {
+		return errors.New("client must have a name")
+	}
+	if c.Role != RoleReadOnly && c.Role != RoleOperator {
+		return errors.Errorf("unknown role %d", c.Role)
+	}
+	return nil
+}
+
+// Authenticate returns the client that made a request.
+// A bearer token takes precedence over a client certificate.
+// It returns false if the request was not made by a known client.
+func (a *Authenticator) Authenticate(r *http.Request) (Client, bool) {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+
+	if auth := r.Header.Get("Authorization"); auth != "" {
+		const prefix = "bearer "
+		if len(auth) <= len(prefix) || !strings.EqualFold(auth[:len(prefix)], prefix) {
+			return Client{}, false
+		}
+		client, ok := a.tokens[sha256.Sum256([]byte(auth[len(prefix):]))]
+		return client, ok
+	}
+	if r.TLS == nil || len(r.TLS.VerifiedChains) == 0 || len(r.TLS.VerifiedChains[0]) == 0 {
+		return Client{}, false
+	}
+	client, ok := a.certs[r.TLS.VerifiedChains[0][0].Subject.CommonName]
+	return client, ok
+}
+
+// Require returns a handler that serves requests with h if they were made by
+// a client with at least the provided role. It responds with status 401 to
+// requests from unknown clients, 403 to clients without the role, and 429
+// to clients over their rate limit, see WithRateLimit.
+// h can get the client from the context of the request, see ClientFromContext.
+func (a *Authenticator) Require(role Role, h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var (
+			client, ok = a.Authenticate(r)
+			rec        = &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+		)
+		if isMutating(r.Method) {
+			defer func() { a.record(client, r, rec.status) }()
+		}
+		if !ok {
+			rec.Header().Set("WWW-Authenticate", "Bearer")
+			http.Error(rec, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		if client.Role < role {
+			http.Error(rec, "forbidden", http.StatusForbidden)
+			return
+		}
+		if wait, ok := a.allow(client.Name); !ok {
+			rec.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(wait.Seconds()))))
+			http.Error(rec, "too many requests", http.StatusTooManyRequests)
+			return
+		}
+		h.ServeHTTP(rec, r.WithContext(context.WithValue(r.Context(), clientKey{}, client)))
+	})
+}
+
+// tokenBucket is the rate limit of a client.
+type tokenBucket struct {
+	tokens float64
+	last   time.Time
+}
+
+// allow takes a request from the rate limit of a client. If the client is over
+// its limit it returns false and how long until it can make another request.
+func (a *Authenticator) allow(name string) (time.Duration, bool) {
+	if a.rate == 0 {
+		return 0, true
+	}
+	a.limitMu.Lock()
+	defer a.limitMu.Unlock()
+
+	now := a.clock.Now()
+
+	b, ok := a.buckets[name]
+	if !ok {
+		b = &tokenBucket{tokens: float64(a.burst), last: now}
+		a.buckets[name] = b
+	}
+	b.tokens = math.Min(float64(a.burst), b.tokens+now.Sub(b.last).Seconds()*a.rate)
+	b.last = now
+
+	if b.tokens < 1 {
+		return time.Duration((1 - b.tokens) / a.rate * float64(time.Second)), false
+	}
+	b.tokens--
+	return 0, true
+}
+
+// AuditRecord is a request that could change the groups, see WithAuditLog.
+type AuditRecord struct {
+	Time time.Time `json:"time"`
+
+	// Client and Role are empty if the client was not authenticated.
+	Client string `json:"client,omitempty"`
+	Role   Role   `json:"role,omitempty"`
+
+	Method string `json:"method"`
+	Path   string `json:"path"`
+	Status int    `json:"status"`
+}
+
+// record writes the audit record of a request.
+func (a *Authenticator) record(client Client, r *http.Request, status int) {
+	if a.audit == nil {
+		return
+	}
+	data, err := json.Marshal(AuditRecord{
+		Time:   a.clock.Now(),
+		Client: client.Name,
+		Role:   client.Role,
+		Method: r.Method,
+		Path:   r.URL.Path,
+		Status: status,
+	})
+	if err != nil {
+		return // Can not happen, as every field can be encoded.
+	}
+	a.auditMu.Lock()
+	_, _ = a.audit.Write(append(data, '\n')) // Best effort.
+	a.auditMu.Unlock()
+}
+
+// isMutating returns true if a request with the provided method could change the groups.
+func isMutating(method string) bool {
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions:
+		return false
+	}
+	return true
+}
+
+// statusRecorder is a ResponseWriter that remembers the status of the response.
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+}
+
+// WriteHeader records the status and writes it.
+func (r *statusRecorder) WriteHeader(status int) {
+	r.status = status
+	r.ResponseWriter.WriteHeader(status)
+}
+
+// Flush sends what has been written so far to the client, if the wrapped ResponseWriter can,
+// so that streamed responses are not held back by authentication.
+func (r *statusRecorder) Flush() {
+	if f, ok := r.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// Unwrap returns the wrapped ResponseWriter, see http.ResponseController.
+func (r *statusRecorder) Unwrap() http.ResponseWriter {
+	return r.ResponseWriter
+}
+
+// clientKey is the context key of the client of a request.
+type clientKey struct{}
+
+// ClientFromContext returns the client of a request that was served by a handler
+// returned by Require. It returns false if the request was not authenticated.
+func ClientFromContext(ctx context.Context) (Client, bool) {
+	client, ok := ctx.Value(clientKey{}).(Client)
+	return client, ok
+}
+
+// AuthTLSConfig returns a TLS configuration for a control server that
+// verifies the certificates of clients against clientCAs, see AddCertificate.
+// Clients without a certificate can still connect and authenticate with a token.
+func AuthTLSConfig(clientCAs *x509.CertPool) *tls.Config {
+	return &tls.Config{
+		ClientAuth: tls.VerifyClientCertIfGiven,
+		ClientCAs:  clientCAs,
+		MinVersion: tls.VersionTLS12,
+	}
+}
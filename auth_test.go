@@ -0,0 +1,178 @@
+package exec_test
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/scgolang/exec"
+	"github.com/scgolang/exec/exectest"
+)
+
+func TestAuthenticator(t *testing.T) {
+	a, err := exec.NewAuthenticator()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := a.AddToken("s3cret", exec.Client{Name: "dashboard", Role: exec.RoleReadOnly}); err != nil {
+		t.Fatal(err)
+	}
+	if err := a.AddCertificate("deployer", exec.Client{Name: "deployer", Role: exec.RoleOperator}); err != nil {
+		t.Fatal(err)
+	}
+	if err := a.AddToken("", exec.Client{Name: "nobody", Role: exec.RoleReadOnly}); err == nil {
+		t.Fatal("expected an empty token to be rejected")
+	}
+	if err := a.AddToken("x", exec.Client{Name: "nobody"}); err == nil {
+		t.Fatal("expected a client without a role to be rejected")
+	}
+	var (
+		served  string
+		handler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			client, _ := exec.ClientFromContext(r.Context())
+			served = client.Name
+		})
+		read    = a.Require(exec.RoleReadOnly, handler)
+		operate = a.Require(exec.RoleOperator, handler)
+	)
+	for _, tc := range []struct {
+		handler http.Handler
+		auth    string
+		cn      string
+		status  int
+		served  string
+	}{
+		{handler: read, status: http.StatusUnauthorized},
+		{handler: read, auth: "Bearer wrong", status: http.StatusUnauthorized},
+		{handler: read, auth: "Basic s3cret", status: http.StatusUnauthorized},
+		{handler: read, auth: "Bearer s3cret", status: http.StatusOK, served: "dashboard"},
+		{handler: operate, auth: "bearer s3cret", status: http.StatusForbidden},
+		{handler: operate, cn: "deployer", status: http.StatusOK, served: "deployer"},
+		{handler: operate, cn: "stranger", status: http.StatusUnauthorized},
+	} {
+		served = ""
+
+		req := httptest.NewRequest("POST", "/", nil)
+		if tc.auth != "" {
+			req.Header.Set("Authorization", tc.auth)
+		}
+		if tc.cn != "" {
+			cert := &x509.Certificate{Subject: pkix.Name{CommonName: tc.cn}}
+			req.TLS = &tls.ConnectionState{VerifiedChains: [][]*x509.Certificate{{cert}}}
+		}
+		rec := httptest.NewRecorder()
+		tc.handler.ServeHTTP(rec, req)
+
+		if expected, got := tc.status, rec.Code; expected != got {
+			t.Fatalf("%q %q: expected status %d, got %d", tc.auth, tc.cn, expected, got)
+		}
+		if expected, got := tc.served, served; expected != got {
+			t.Fatalf("%q %q: expected to serve %q, got %q", tc.auth, tc.cn, expected, got)
+		}
+	}
+}
+
+func TestAuthenticatorRateLimitAudit(t *testing.T) {
+	var (
+		audit bytes.Buffer
+		clock = exectest.NewClock(time.Unix(0, 0))
+	)
+	a, err := exec.NewAuthenticator(exec.WithAuthClock(clock), exec.WithRateLimit(1, 2), exec.WithAuditLog(&audit))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := a.AddToken("s3cret", exec.Client{Name: "deployer", Role: exec.RoleOperator}); err != nil {
+		t.Fatal(err)
+	}
+	handler := a.Require(exec.RoleOperator, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusAccepted)
+	}))
+	serve := func(method, token string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, "/groups/synths", nil)
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		return rec
+	}
+	for i, expected := range []int{http.StatusAccepted, http.StatusAccepted, http.StatusTooManyRequests} {
+		if got := serve("POST", "s3cret").Code; expected != got {
+			t.Fatalf("request %d: expected status %d, got %d", i, expected, got)
+		}
+	}
+	if expected, got := "1", serve("GET", "s3cret").Header().Get("Retry-After"); expected != got {
+		t.Fatalf("expected Retry-After %s, got %s", expected, got)
+	}
+	clock.Advance(time.Second)
+
+	if expected, got := http.StatusAccepted, serve("DELETE", "s3cret").Code; expected != got {
+		t.Fatalf("expected status %d, got %d", expected, got)
+	}
+	if expected, got := http.StatusUnauthorized, serve("POST", "").Code; expected != got {
+		t.Fatalf("expected status %d, got %d", expected, got)
+	}
+	lines := strings.Split(strings.TrimSpace(audit.String()), "\n")
+	if expected, got := 5, len(lines); expected != got {
+		t.Fatalf("expected %d audit records, got %d:\n%s", expected, got, audit.String())
+	}
+	if expected, got := `{"time":"1970-01-01T00:00:01Z","client":"deployer","role":"operator","method":"DELETE","path":"/groups/synths","status":202}`, lines[3]; expected != got {
+		t.Fatalf("expected %s, got %s", expected, got)
+	}
+	if expected, got := `{"time":"1970-01-01T00:00:01Z","method":"POST","path":"/groups/synths","status":401}`, lines[4]; expected != got {
+		t.Fatalf("expected %s, got %s", expected, got)
+	}
+	if _, err := exec.NewAuthenticator(exec.WithRateLimit(0, 1)); err == nil {
+		t.Fatal("expected an error, got nil")
+	}
+}
+
+func TestAuthenticatorRequireFlushes(t *testing.T) {
+	a, err := exec.NewAuthenticator()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := a.AddToken("s3cret", exec.Client{Name: "follower", Role: exec.RoleReadOnly}); err != nil {
+		t.Fatal(err)
+	}
+	release := make(chan struct{})
+
+	// The handler holds the response open after the first line, like an output stream does.
+	srv := httptest.NewServer(a.Require(exec.RoleReadOnly, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte("first\n"))
+		if f, ok := w.(http.Flusher); ok {
+			f.Flush()
+		}
+		<-release
+	})))
+	defer srv.Close()
+	defer close(release)
+
+	req, err := http.NewRequest(http.MethodGet, srv.URL, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("Authorization", "Bearer s3cret")
+
+	client := &http.Client{Timeout: 5 * time.Second}
+	resp, err := client.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = resp.Body.Close() }() // Best effort.
+
+	line, err := bufio.NewReader(resp.Body).ReadString('\n')
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected, got := "first\n", line; expected != got {
+		t.Fatalf("expected %q, got %q", expected, got)
+	}
+}
@@ -0,0 +1,210 @@
+package exec
+
+import (
+	"context"
+	"database/sql"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+
+	"github.com/pkg/errors"
+)
+
+// BinaryAction is what happens when the executable of a command changes,
+// see DetectBinaryChange.
+type BinaryAction int
+
+// Binary actions.
+const (
+	// BinaryIgnore does not watch the executable. It is the default.
+	BinaryIgnore BinaryAction = iota
+
+	// BinaryNotify only sends an EventBinary event to WatchBinaryChanges.
+	BinaryNotify
+
+	// BinaryRestart also gracefully restarts the command, so that it runs the new executable.
+	BinaryRestart
+)
+
+// binaryWatcher reports when the executable of a command changes.
+type binaryWatcher struct {
+	fw *fileWatcher
+
+	// sum is the SHA-256 of the executable that the command was started
+	// from, or that it was last reported to have changed to.
+	sum string
+}
+
+// DetectBinaryChange watches the executable of a command, with symbolic links
+// resolved, so that a new deploy of it can be acted on. When its contents
+// change, an EventBinary event is sent to WatchBinaryChanges and, if action
+// is BinaryRestart, the command is gracefully restarted like RestartOnChange
+// does. Writes that leave the contents as they were are not reported.
+// BinaryIgnore stops watching. The setting is persisted with the group.
+func (g *Groups) DetectBinaryChange(groupName string, cmd *exec.Cmd, action BinaryAction) error {
+	if g.getGroup(groupName) == nil {
+		return errors.Errorf("group %s not found", groupName)
+	}
+	if action < BinaryIgnore || action > BinaryRestart {
+		return errors.Errorf("unknown binary action %d", action)
+	}
+	commandID, err := g.cmdID(groupName, cmd)
+	if err != nil {
+		return errors.Wrap(err, "getting command ID")
+	}
+	tx, err := g.db.Begin()
+	if err != nil {
+		return errors.Wrap(err, "starting transaction")
+	}
+	if err := g.setCmdBinaryActionTx(tx, groupName, commandID, action); err != nil {
+		_ = tx.Rollback()
+		return err
+	}
+	if err := tx.Commit(); err != nil {
+		return errors.Wrap(err, "committing transaction")
+	}
+	return g.detectBinaryChange(groupName, commandID, cmd, action)
+}
+
+// WatchBinaryChanges returns a channel that receives an EventBinary event
+// every time the executable of a command of any group changes, see
+// DetectBinaryChange. The channel is closed when ctx is done.
+// Events are dropped for receivers that fall too far behind.
+func (g *Groups) WatchBinaryChanges(ctx context.Context) <-chan Event {
+	ch := make(chan Event, watchBufferSize)
+
+	g.binaryMu.Lock()
+	g.binaryWatchers[ch] = struct{}{}
+	g.binaryMu.Unlock()
+
+	go func() {
+		<-ctx.Done()
+		g.binaryMu.Lock()
+		delete(g.binaryWatchers, ch)
+		close(ch)
+		g.binaryMu.Unlock()
+	}()
+	return ch
+}
+
+// detectBinaryChange replaces the watcher of the executable of a command.
+func (g *Groups) detectBinaryChange(groupName, commandID string, cmd *exec.Cmd, action BinaryAction) error {
+	g.unwatchBinaries(groupName, commandID)
+
+	if action == BinaryIgnore {
+		return nil
+	}
+	path := cmd.Path
+	if resolved, err := filepath.EvalSymlinks(path); err == nil {
+		path = resolved
+	}
+	sum, err := g.binaryHashes.sum(path)
+	if err != nil {
+		return errors.Wrap(err, "hashing executable")
+	}
+	bw := &binaryWatcher{sum: sum}
+
+	fw, err := newFileWatcher(filepath.Dir(path), []string{path}, g.clock, func() {
+		g.binaryChanged(groupName, commandID, path, bw, action)
+	})
+	if err != nil {
+		return errors.Wrap(err, "watching executable")
+	}
+	bw.fw = fw
+
+	g.binaryMu.Lock()
+	if g.binaryDetectors[groupName] == nil {
+		g.binaryDetectors[groupName] = map[string]*binaryWatcher{}
+	}
+	g.binaryDetectors[groupName][commandID] = bw
+	g.binaryMu.Unlock()
+
+	return nil
+}
+
+// binaryChanged reports that the executable of a command was written to,
+// if its contents changed, and restarts the command if the action says so.
+func (g *Groups) binaryChanged(groupName, commandID, path string, bw *binaryWatcher, action BinaryAction) {
+	sum, err := g.binaryHashes.sum(path)
+	if err != nil {
+		return // Removed or being replaced, there is another event once it is in place.
+	}
+	g.binaryMu.Lock()
+	changed := sum != bw.sum
+	bw.sum = sum
+	g.binaryMu.Unlock()
+
+	if !changed {
+		return
+	}
+	var pid int
+	if grp := g.getGroup(groupName); grp != nil {
+		if cmd := grp.lookup(commandID); cmd != nil {
+			pid = grp.pid(cmd)
+		}
+	}
+	event := NewBinaryEvent(groupName, commandID, pid, path, sum, action == BinaryRestart, g.clock.Now())
+
+	g.binaryMu.Lock()
+	for ch := range g.binaryWatchers {
+		select {
+		case ch <- event:
+		default:
+		}
+	}
+	g.binaryMu.Unlock()
+
+	if action != BinaryRestart {
+		return
+	}
+	if err := g.restart(groupName, commandID); err != nil {
+		g.logf("restarting command %s in group %s after its executable changed: %s", commandID, groupName, err)
+	}
+}
+
+// unwatchBinaries closes the executable watchers of the commands with the provided IDs.
+// If no command IDs are provided then all the executable watchers in the group are closed.
+func (g *Groups) unwatchBinaries(groupName string, commandIDs ...string) {
+	g.binaryMu.Lock()
+	defer g.binaryMu.Unlock()
+
+	watchers := g.binaryDetectors[groupName]
+	if len(commandIDs) == 0 {
+		delete(g.binaryDetectors, groupName)
+	} else {
+		m := map[string]*binaryWatcher{}
+		for _, commandID := range commandIDs {
+			if bw, ok := watchers[commandID]; ok {
+				m[commandID] = bw
+				delete(watchers, commandID)
+			}
+		}
+		watchers = m
+	}
+	for _, bw := range watchers {
+		_ = bw.fw.Close() // Best effort.
+	}
+}
+
+// setCmdBinaryActionTx sets what happens when the executable of a command
+// changes, or deletes the setting if action is BinaryIgnore.
+func (g *Groups) setCmdBinaryActionTx(tx *sql.Tx, groupName, commandID string, action BinaryAction) error {
+	if action == BinaryIgnore {
+		_, err := g.exec(tx, deleteCommandSetting, groupName, commandID, settingBinaryAction)
+		return errors.Wrap(err, settingBinaryAction)
+	}
+	return g.setCmdSettingTx(tx, groupName, commandID, settingBinaryAction, strconv.Itoa(int(action)))
+}
+
+// restoreBinaryChange starts watching the executable of a command from its settings, if it has one.
+func (g *Groups) restoreBinaryChange(groupName, commandID string, cmd *exec.Cmd, settings map[string]string) error {
+	value, ok := settings[settingBinaryAction]
+	if !ok {
+		return nil
+	}
+	action, err := strconv.Atoi(value)
+	if err != nil {
+		return errors.Wrap(err, "parsing binary action")
+	}
+	return g.detectBinaryChange(groupName, commandID, cmd, BinaryAction(action))
+}
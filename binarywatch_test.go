@@ -0,0 +1,91 @@
+package exec_test
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	osexec "os/exec"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/scgolang/exec"
+)
+
+func TestGroupsDetectBinaryChange(t *testing.T) {
+	var (
+		groupName = "deployed"
+		root      = filepath.Join("testdata", "."+t.Name())
+	)
+	_ = os.RemoveAll(root)
+
+	var (
+		gs          = newTestGroups(t, root)
+		ctx, cancel = context.WithCancel(context.Background())
+	)
+	defer cancel()
+
+	binary, err := filepath.Abs(filepath.Join(root, "worker"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	deploy := func(script string) {
+		tmp := binary + ".new"
+		if err := ioutil.WriteFile(tmp, []byte("#!/bin/sh\n"+script+"\n"), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.Rename(tmp, binary); err != nil {
+			t.Fatal(err)
+		}
+	}
+	deploy("sleep 10")
+
+	cmd := osexec.Command(binary)
+	if err := gs.Create(groupName, cmd); err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = gs.Remove(groupName) }()
+
+	commandID, ok := gs.CmdID(groupName, cmd)
+	if !ok {
+		t.Fatal("command not found")
+	}
+	binaries := gs.WatchBinaryChanges(ctx)
+
+	changes, err := gs.Watch(ctx, groupName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := gs.DetectBinaryChange(groupName, cmd, exec.BinaryRestart); err != nil {
+		t.Fatal(err)
+	}
+	deploy("sleep 11")
+
+	select {
+	case <-time.After(5 * time.Second):
+		t.Fatal("timeout waiting for the executable to change")
+	case e := <-binaries:
+		if expected, got := exec.EventBinary, e.Kind; expected != got {
+			t.Fatalf("expected kind %s, got %s", expected, got)
+		}
+		if expected, got := commandID, e.CommandID; expected != got {
+			t.Fatalf("expected command %s, got %s", expected, got)
+		}
+		if e.Binary == nil || !e.Binary.Restarted || len(e.Binary.SHA256) != 64 {
+			t.Fatalf("unexpected payload %+v", e.Binary)
+		}
+	}
+	for _, expected := range []exec.State{exec.StateRestarting, exec.StateRunning} {
+		select {
+		case <-time.After(5 * time.Second):
+			t.Fatalf("timeout waiting for %s", expected)
+		case change := <-changes:
+			if got := change.To; expected != got {
+				t.Fatalf("expected state %s, got %s", expected, got)
+			}
+		}
+	}
+	if err := gs.DetectBinaryChange(groupName, cmd, exec.BinaryAction(42)); err == nil {
+		t.Fatal("expected an unknown action to be rejected")
+	}
+}
@@ -0,0 +1,159 @@
+package exec
+
+import (
+	"context"
+	"os/exec"
+	"reflect"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// CommandPolicies are the policies of a command, see CommandSpec.
+type CommandPolicies struct {
+	// Priority is the priority of the command, see SetPriority.
+	Priority int `json:"priority,omitempty"`
+
+	// Conditions have to hold before the command is started, see SetStartConditions.
+	Conditions []Condition `json:"conditions,omitempty"`
+
+	// Setup and Teardown, if not empty, are the arguments of the hooks
+	// of the command, see SetHooks. The first argument is the program.
+	Setup    []string `json:"setup,omitempty"`
+	Teardown []string `json:"teardown,omitempty"`
+
+	// Restart, if not nil, restarts the command when it exits, see SetRestartPolicy.
+	Restart *RestartPolicy `json:"restart,omitempty"`
+}
+
+// Validate returns an error if a command can not be built from the spec.
+func (s CommandSpec) Validate() error {
+	if s.Path == "" {
+		return errors.New("command has no path")
+	}
+	if len(s.Args) == 0 {
+		return errors.New("command has no args, the first of which must be the program")
+	}
+	for _, kv := range s.Env {
+		if !strings.Contains(kv, "=") {
+			return errors.Errorf("environment variable %q is not key=value", kv)
+		}
+	}
+	if s.ReloadSignal < 0 {
+		return errors.Errorf("invalid reload signal %d", s.ReloadSignal)
+	}
+	if s.Jail < 0 {
+		return errors.Errorf("invalid jail %d", s.Jail)
+	}
+	if s.DeathSignal < 0 {
+		return errors.Errorf("invalid death signal %d", s.DeathSignal)
+	}
+	if p := s.Policies; p != nil {
+		for _, c := range p.Conditions {
+			if err := c.validate(); err != nil {
+				return err
+			}
+		}
+		for _, hook := range [][]string{p.Setup, p.Teardown} {
+			if len(hook) > 0 && hook[0] == "" {
+				return errors.New("hook has no program")
+			}
+		}
+		if p.Restart != nil {
+			if err := p.Restart.validate(); err != nil {
+				return err
+			}
+		}
+	}
+	for _, probe := range s.Probes {
+		if probe == nil {
+			return errors.New("probe must not be nil")
+		}
+	}
+	if s.Limits != nil {
+		if err := s.Limits.validate(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Build validates the spec and returns its command, which is configured in g
+// with the policies, probes, and limits of the spec, replacing the ones it
+// had before, so it can be passed to Create or CreateOrOpen.
+// A command with more than one probe is ready when it passes all of them.
+// Since resource limits apply to every command of a group, Build returns an
+// error if the group already has limits that differ from the spec's.
+// The name, labels, watch list, and reload signal of the spec are set on the
+// command once it is stored, by Apply.
+func (s CommandSpec) Build(g *Groups, groupName string) (*exec.Cmd, error) {
+	if err := s.Validate(); err != nil {
+		return nil, errors.Wrap(err, "validating command spec")
+	}
+	cmd := s.Cmd()
+
+	if s.Limits != nil {
+		current := g.ResourceLimits(groupName)
+
+		if !current.isZero() && !reflect.DeepEqual(current, *s.Limits) {
+			return nil, errors.Errorf("group %s already has resource limits %+v", groupName, current)
+		}
+		if err := g.SetResourceLimits(groupName, *s.Limits); err != nil {
+			return nil, errors.Wrap(err, "setting resource limits")
+		}
+	}
+	p := CommandPolicies{}
+	if s.Policies != nil {
+		p = *s.Policies
+	}
+	if err := g.SetPriority(groupName, cmd, p.Priority); err != nil {
+		return nil, errors.Wrap(err, "setting priority")
+	}
+	if err := g.SetStartConditions(groupName, cmd, p.Conditions...); err != nil {
+		return nil, errors.Wrap(err, "setting start conditions")
+	}
+	if err := g.SetHooks(groupName, cmd, Hooks{Setup: hookCmd(p.Setup), Teardown: hookCmd(p.Teardown)}); err != nil {
+		return nil, errors.Wrap(err, "setting hooks")
+	}
+	restart := RestartPolicy{}
+	if p.Restart != nil {
+		restart = *p.Restart
+	}
+	if err := g.SetRestartPolicy(groupName, cmd, restart); err != nil {
+		return nil, errors.Wrap(err, "setting restart policy")
+	}
+	if err := g.SetReadinessProbe(groupName, cmd, allProbes(s.Probes)); err != nil {
+		return nil, errors.Wrap(err, "setting readiness probe")
+	}
+	return cmd, nil
+}
+
+// hookCmd returns the command of a hook with the provided args,
+// or nil if there are none.
+func hookCmd(args []string) *exec.Cmd {
+	if len(args) == 0 {
+		return nil
+	}
+	return exec.Command(args[0], args[1:]...)
+}
+
+// allProbes returns a probe that passes when all of probes do,
+// or nil if there are none.
+func allProbes(probes []Probe) Probe {
+	switch len(probes) {
+	case 0:
+		return nil
+	case 1:
+		return probes[0]
+	}
+	probes = append([]Probe{}, probes...)
+
+	return ProbeFunc(func(ctx context.Context, cmd *exec.Cmd) error {
+		for _, probe := range probes {
+			if err := probe.Probe(ctx, cmd); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
@@ -0,0 +1,69 @@
+package exec_test
+
+import (
+	"context"
+	"os"
+	osexec "os/exec"
+	"path/filepath"
+	"testing"
+
+	"github.com/scgolang/exec"
+)
+
+func TestCommandSpecValidate(t *testing.T) {
+	for _, spec := range []exec.CommandSpec{
+		{Args: []string{"sleep", "1"}},
+		{Path: "/bin/sleep"},
+		{Path: "/bin/sleep", Args: []string{"sleep", "1"}, Env: []string{"NOVALUE"}},
+		{Path: "/bin/sleep", Args: []string{"sleep", "1"}, Policies: &exec.CommandPolicies{Conditions: []exec.Condition{{}}}},
+		{Path: "/bin/sleep", Args: []string{"sleep", "1"}, Probes: []exec.Probe{nil}},
+		{Path: "/bin/sleep", Args: []string{"sleep", "1"}, Limits: &exec.ResourceLimits{MemoryMax: -1}},
+	} {
+		if err := spec.Validate(); err == nil {
+			t.Fatalf("expected an error for %+v, got nil", spec)
+		}
+	}
+}
+
+func TestCommandSpecBuild(t *testing.T) {
+	var (
+		groupName = "built"
+		root      = filepath.Join("testdata", "."+t.Name())
+	)
+	_ = os.RemoveAll(root)
+
+	gs := newTestGroups(t, root)
+	absRoot, err := filepath.Abs(root)
+	if err != nil {
+		t.Fatal(err)
+	}
+	path, err := osexec.LookPath("sleep")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var (
+		setup = filepath.Join(absRoot, "setup")
+		probe = exec.ProbeFunc(func(ctx context.Context, cmd *osexec.Cmd) error { return nil })
+	)
+	cmd, err := exec.CommandSpec{
+		Path:     path,
+		Args:     []string{"sleep", "10"},
+		Env:      []string{"BUILT=1"},
+		Policies: &exec.CommandPolicies{Priority: 2, Setup: []string{"touch", setup}},
+		Probes:   []exec.Probe{probe, probe},
+	}.Build(gs, groupName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := gs.Create(groupName, cmd); err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = gs.Remove(groupName) }()
+
+	if _, err := os.Stat(setup); err != nil {
+		t.Fatalf("expected the setup hook to have run: %s", err)
+	}
+	if _, err := (exec.CommandSpec{Path: path}).Build(gs, groupName); err == nil {
+		t.Fatal("expected an error, got nil")
+	}
+}
@@ -0,0 +1,238 @@
+package exec
+
+import (
+	"os/exec"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// CapacityStats are statistics about the limit on running processes, see SetMaxRunning.
+type CapacityStats struct {
+	// Max is the limit, zero if there is none, and Running the number of processes running.
+	Max     int
+	Running int
+
+	// Queued is the number of starts waiting for a process to exit.
+	Queued int
+
+	// Waits is how many starts have had to wait, WaitTime is how long they
+	// waited in total, and MaxWaitTime is the longest any of them waited.
+	Waits       int64
+	WaitTime    time.Duration
+	MaxWaitTime time.Duration
+}
+
+// capacity limits how many processes run at once across all groups.
+// Starts that have to wait are admitted in order of priority, and in the
+// order they arrived among starts with the same priority.
+type capacity struct {
+	stats   CapacityStats
+	clock   Clock
+	waiters []*waiter
+	seq     int64
+
+	// surge has the commands that may start over the limit, see Replace.
+	surge map[*exec.Cmd]struct{}
+
+	mu sync.Mutex
+}
+
+// waiter is a start that is waiting for capacity.
+type waiter struct {
+	priority int
+	seq      int64
+	admitted chan struct{}
+}
+
+// newCapacity creates a capacity without a limit.
+func newCapacity(clock Clock) *capacity {
+	return &capacity{clock: clock, surge: map[*exec.Cmd]struct{}{}}
+}
+
+// setMax sets the limit, admitting starts that are waiting if it is raised.
+func (c *capacity) setMax(n int) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.stats.Max = n
+	c.admit()
+}
+
+// acquire waits until another process can run, unless cmd is allowed to surge.
+// Starts with a higher priority are admitted first.
+func (c *capacity) acquire(cmd *exec.Cmd, priority int) {
+	c.mu.Lock()
+
+	_, surge := c.surge[cmd]
+	delete(c.surge, cmd)
+
+	if surge || !c.full() {
+		c.stats.Running++
+		c.mu.Unlock()
+		return
+	}
+	var (
+		start = c.clock.Now()
+		w     = &waiter{priority: priority, seq: c.seq, admitted: make(chan struct{})}
+	)
+	c.seq++
+	c.waiters = append(c.waiters, w)
+	c.stats.Queued++
+	c.mu.Unlock()
+
+	<-w.admitted
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	waited := c.clock.Now().Sub(start)
+	c.stats.Waits++
+	c.stats.WaitTime += waited
+	if waited > c.stats.MaxWaitTime {
+		c.stats.MaxWaitTime = waited
+	}
+}
+
+// claim counts a process that is already running, even if that exceeds the limit.
+func (c *capacity) claim() {
+	c.mu.Lock()
+	c.stats.Running++
+	c.mu.Unlock()
+}
+
+// release makes room for another process.
+func (c *capacity) release() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.stats.Running--
+	c.admit()
+}
+
+// admit admits waiting starts, best first, while there is capacity. c.mu must be held.
+func (c *capacity) admit() {
+	for len(c.waiters) > 0 && !c.full() {
+		best := 0
+		for i, w := range c.waiters {
+			if b := c.waiters[best]; w.priority > b.priority || (w.priority == b.priority && w.seq < b.seq) {
+				best = i
+			}
+		}
+		w := c.waiters[best]
+		c.waiters = append(c.waiters[:best], c.waiters[best+1:]...)
+		c.stats.Queued--
+		c.stats.Running++
+		close(w.admitted)
+	}
+}
+
+// full returns true if no more processes can run. c.mu must be held.
+func (c *capacity) full() bool {
+	return c.stats.Max > 0 && c.stats.Running >= c.stats.Max
+}
+
+// allowSurge lets cmd start even if the limit has been reached.
+// It returns a func that takes the permission back if cmd did not start.
+func (c *capacity) allowSurge(cmd *exec.Cmd) func() {
+	c.mu.Lock()
+	c.surge[cmd] = struct{}{}
+	c.mu.Unlock()
+
+	return func() {
+		c.mu.Lock()
+		delete(c.surge, cmd)
+		c.mu.Unlock()
+	}
+}
+
+// SetMaxRunning sets how many processes can run at the same time across all
+// groups. Starts beyond it wait until a process exits, and are admitted in
+// order of priority, see SetPriority. This includes starts by Create and Open,
+// which hold a database transaction while they wait.
+// Replace can run one process over the limit while the new command becomes
+// ready, since the old one keeps running until then.
+// Zero, the default, means there is no limit.
+func (g *Groups) SetMaxRunning(n int) error {
+	if n < 0 {
+		return errors.Errorf("maximum running processes must not be negative, got %d", n)
+	}
+	g.capacity.setMax(n)
+	return nil
+}
+
+// CapacityStats returns statistics about the limit on running processes.
+func (g *Groups) CapacityStats() CapacityStats {
+	g.capacity.mu.Lock()
+	defer g.capacity.mu.Unlock()
+	return g.capacity.stats
+}
+
+// SetPriority sets the priority of a command in a group, which decides the
+// order that starts waiting for capacity are admitted in, see SetMaxRunning.
+// Commands with a higher priority start first. The default priority is zero.
+// Priorities are set by definition, and like readiness probes they are not
+// persisted, so they must be set every time a Groups is created.
+func (g *Groups) SetPriority(groupName string, cmd *exec.Cmd, priority int) error {
+	commandID, err := GetCmdID(cmd)
+	if err != nil {
+		return errors.Wrap(err, "getting command ID")
+	}
+	g.prioritiesMu.Lock()
+	defer g.prioritiesMu.Unlock()
+
+	if g.priorities[groupName] == nil {
+		g.priorities[groupName] = map[string]int{}
+	}
+	if priority == 0 {
+		delete(g.priorities[groupName], commandID)
+	} else {
+		g.priorities[groupName][commandID] = priority
+	}
+	return nil
+}
+
+// priority returns the priority of a command in a group.
+func (g *Groups) priority(groupName string, cmd *exec.Cmd) int {
+	commandID, err := GetCmdID(cmd)
+	if err != nil {
+		return 0
+	}
+	g.prioritiesMu.Lock()
+	defer g.prioritiesMu.Unlock()
+	return g.priorities[groupName][commandID]
+}
+
+// cappedExecer is an Execer that starts processes within the capacity of Groups.
+type cappedExecer struct {
+	execer   Execer
+	capacity *capacity
+	priority func(cmd *exec.Cmd) int
+}
+
+// Start waits for capacity and starts cmd.
+func (e cappedExecer) Start(cmd *exec.Cmd) (Process, error) {
+	e.capacity.acquire(cmd, e.priority(cmd))
+
+	proc, err := e.execer.Start(cmd)
+	if err != nil {
+		e.capacity.release()
+		return nil, err
+	}
+	return &cappedProcess{Process: proc, capacity: e.capacity}, nil
+}
+
+// cappedProcess is a process that releases its capacity once it has been waited for.
+type cappedProcess struct {
+	Process
+	capacity *capacity
+	once     sync.Once
+}
+
+// Wait waits for the process to exit and releases its capacity.
+func (p *cappedProcess) Wait() error {
+	err := p.Process.Wait()
+	p.once.Do(p.capacity.release)
+	return err
+}
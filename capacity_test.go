@@ -0,0 +1,112 @@
+package exec_test
+
+import (
+	"io/ioutil"
+	"os"
+	osexec "os/exec"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/scgolang/exec"
+)
+
+func TestGroupsMaxRunning(t *testing.T) {
+	var (
+		root = filepath.Join("testdata", "."+t.Name())
+		wait = 300 * time.Millisecond
+	)
+	_ = os.RemoveAll(root)
+
+	gs, err := exec.New(root, exec.WithMaxRunning(1))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _, _ = gs.Remove("first"), gs.Remove("second") }() // Best effort.
+
+	if err := gs.Create("first", osexec.Command("sleep", "0.3")); err != nil {
+		t.Fatal(err)
+	}
+	created := make(chan error, 1)
+	go func() {
+		created <- gs.Create("second", osexec.Command("sleep", "0.1"))
+	}()
+	deadline := time.Now().Add(time.Second)
+	for gs.CapacityStats().Queued == 0 {
+		if time.Now().After(deadline) {
+			t.Fatal("expected the second start to be queued")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if err := <-created; err != nil {
+		t.Fatal(err)
+	}
+	stats := gs.CapacityStats()
+	if expected, got := 1, stats.Max; expected != got {
+		t.Fatalf("expected max %d, got %d", expected, got)
+	}
+	if expected, got := int64(1), stats.Waits; expected != got {
+		t.Fatalf("expected %d wait, got %d", expected, got)
+	}
+	if expected, got := 0, stats.Queued; expected != got {
+		t.Fatalf("expected %d queued, got %d", expected, got)
+	}
+	if stats.WaitTime < wait/2 || stats.MaxWaitTime != stats.WaitTime {
+		t.Fatalf("expected to wait about %s, got %+v", wait, stats)
+	}
+	if err := gs.Wait("second"); err != nil {
+		t.Fatal(err)
+	}
+	if expected, got := 0, gs.CapacityStats().Running; expected != got {
+		t.Fatalf("expected %d running, got %d", expected, got)
+	}
+	if err := gs.SetMaxRunning(-1); err == nil {
+		t.Fatal("expected an error, got nil")
+	}
+}
+
+func TestGroupsPriority(t *testing.T) {
+	root := filepath.Join("testdata", "."+t.Name())
+	_ = os.RemoveAll(root)
+
+	gs, err := exec.New(root, exec.WithMaxRunning(1))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _, _ = gs.Remove("hold"), gs.Remove("work") }() // Best effort.
+
+	if err := gs.SetStartConcurrency(2); err != nil {
+		t.Fatal(err)
+	}
+	order, err := filepath.Abs(filepath.Join(root, "order"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var (
+		batch    = osexec.Command("sh", "-c", "echo batch >> "+order)
+		critical = osexec.Command("sh", "-c", "echo critical >> "+order)
+	)
+	if err := gs.SetPriority("work", critical, 10); err != nil {
+		t.Fatal(err)
+	}
+	if err := gs.Create("hold", osexec.Command("sleep", "0.3")); err != nil {
+		t.Fatal(err)
+	}
+	// Both starts queue behind hold, and critical is admitted first even if it queued last.
+	if err := gs.Create("work", batch, critical); err != nil {
+		t.Fatal(err)
+	}
+	if err := gs.Wait("work"); err != nil {
+		t.Fatal(err)
+	}
+	data, err := ioutil.ReadFile(order)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected, got := "critical\nbatch\n", string(data); expected != got {
+		t.Fatalf("expected start order %q, got %q", expected, got)
+	}
+	if expected, got := int64(2), gs.CapacityStats().Waits; expected != got {
+		t.Fatalf("expected %d waits, got %d", expected, got)
+	}
+}
@@ -0,0 +1,301 @@
+package exec
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+
+	"github.com/pkg/errors"
+)
+
+// DefaultCgroupMount is where the cgroup filesystem is usually mounted.
+const DefaultCgroupMount = "/sys/fs/cgroup"
+
+// cpuPeriod is the period, in microseconds, that CPU limits are enforced over.
+const cpuPeriod = 100000
+
+// ResourceLimits limit the resources that each command of a group can use,
+// with cgroups, see SetResourceLimits. Zero values mean there is no limit.
+type ResourceLimits struct {
+	// MemoryMax is how many bytes of memory a command can use.
+	MemoryMax int64 `json:"memory_max,omitempty"`
+
+	// CPUMax is how many CPUs a command can keep busy, for example 0.5 for half of one.
+	CPUMax float64 `json:"cpu_max,omitempty"`
+
+	// IO limits the throughput of a command on block devices.
+	IO []IOLimit `json:"io,omitempty"`
+}
+
+// IOLimit limits the throughput of a command on a block device.
+// Zero values mean there is no limit.
+type IOLimit struct {
+	// Device is the number of the block device, as major:minor, for example 8:0.
+	Device string `json:"device"`
+
+	ReadBPS   int64 `json:"read_bps,omitempty"`
+	WriteBPS  int64 `json:"write_bps,omitempty"`
+	ReadIOPS  int64 `json:"read_iops,omitempty"`
+	WriteIOPS int64 `json:"write_iops,omitempty"`
+}
+
+// isZero returns true if the limits do not limit anything.
+func (l ResourceLimits) isZero() bool {
+	return l.MemoryMax == 0 && l.CPUMax == 0 && len(l.IO) == 0
+}
+
+// validate returns an error if the limits can not be applied.
+func (l ResourceLimits) validate() error {
+	if l.MemoryMax < 0 || l.CPUMax < 0 {
+		return errors.Errorf("resource limits must not be negative, got %+v", l)
+	}
+	for _, io := range l.IO {
+		var major, minor int
+		if n, err := fmt.Sscanf(io.Device, "%d:%d", &major, &minor); err != nil || n != 2 {
+			return errors.Errorf("device must be major:minor, got %q", io.Device)
+		}
+		if io.ReadBPS < 0 || io.WriteBPS < 0 || io.ReadIOPS < 0 || io.WriteIOPS < 0 {
+			return errors.Errorf("io limits of device %s must not be negative", io.Device)
+		}
+	}
+	return nil
+}
+
+// CgroupVersion returns 2 if the cgroup filesystem mounted at mount is the
+// unified hierarchy of cgroups v2, 1 if it has a hierarchy of cgroups v1 for
+// each controller, and 0 if there is no cgroup filesystem at mount.
+// Hosts with both use cgroups v1 for resource limits.
+func CgroupVersion(mount string) int {
+	if _, err := os.Stat(filepath.Join(mount, "cgroup.controllers")); err == nil {
+		return 2
+	}
+	if _, err := os.Stat(filepath.Join(mount, "memory")); err == nil {
+		return 1
+	}
+	return 0
+}
+
+// SetResourceLimits sets the limits of each command of a group, which apply
+// to the commands that are started after it is set. Every command gets a
+// cgroup of its own, <parent>/<group>/<instance ID>, see WithCgroups.
+// Limits are kept in memory. Zero limits remove the limits of the group.
+func (g *Groups) SetResourceLimits(groupName string, limits ResourceLimits) error {
+	if err := limits.validate(); err != nil {
+		return err
+	}
+	if !limits.isZero() {
+		if g.cgroupParent == "" {
+			return errors.New("cgroups are not configured, see WithCgroups")
+		}
+		if CgroupVersion(g.cgroupMount) == 0 {
+			return errors.Errorf("no cgroup filesystem at %s", g.cgroupMount)
+		}
+	}
+	g.cgroupsMu.Lock()
+	defer g.cgroupsMu.Unlock()
+
+	if limits.isZero() {
+		delete(g.resourceLimits, groupName)
+		return nil
+	}
+	g.resourceLimits[groupName] = limits
+	return nil
+}
+
+// ResourceLimits returns the limits of each command of a group.
+func (g *Groups) ResourceLimits(groupName string) ResourceLimits {
+	g.cgroupsMu.Lock()
+	defer g.cgroupsMu.Unlock()
+	return g.resourceLimits[groupName]
+}
+
+// cgroupFile is a file of a cgroup that a limit is written to.
+type cgroupFile struct {
+	// controller is the cgroups v1 controller of the file.
+	controller string
+	name       string
+	lines      []string
+}
+
+// cgroupFiles returns the files that limits are written to, for a cgroup of the provided version.
+func cgroupFiles(limits ResourceLimits, version int) []cgroupFile {
+	files := []cgroupFile{}
+
+	if limits.MemoryMax > 0 {
+		name := "memory.max"
+		if version == 1 {
+			name = "memory.limit_in_bytes"
+		}
+		files = append(files, cgroupFile{controller: "memory", name: name, lines: []string{strconv.FormatInt(limits.MemoryMax, 10)}})
+	}
+	if limits.CPUMax > 0 {
+		quota := strconv.FormatInt(int64(limits.CPUMax*cpuPeriod), 10)
+
+		if version == 1 {
+			files = append(files,
+				cgroupFile{controller: "cpu", name: "cpu.cfs_period_us", lines: []string{strconv.Itoa(cpuPeriod)}},
+				cgroupFile{controller: "cpu", name: "cpu.cfs_quota_us", lines: []string{quota}},
+			)
+		} else {
+			files = append(files, cgroupFile{controller: "cpu", name: "cpu.max", lines: []string{quota + " " + strconv.Itoa(cpuPeriod)}})
+		}
+	}
+	if len(limits.IO) == 0 {
+		return files
+	}
+	if version == 1 {
+		for _, f := range []struct {
+			name  string
+			value func(IOLimit) int64
+		}{
+			{"blkio.throttle.read_bps_device", func(l IOLimit) int64 { return l.ReadBPS }},
+			{"blkio.throttle.write_bps_device", func(l IOLimit) int64 { return l.WriteBPS }},
+			{"blkio.throttle.read_iops_device", func(l IOLimit) int64 { return l.ReadIOPS }},
+			{"blkio.throttle.write_iops_device", func(l IOLimit) int64 { return l.WriteIOPS }},
+		} {
+			file := cgroupFile{controller: "blkio", name: f.name}
+			for _, l := range limits.IO {
+				if v := f.value(l); v > 0 {
+					file.lines = append(file.lines, l.Device+" "+strconv.FormatInt(v, 10))
+				}
+			}
+			if len(file.lines) > 0 {
+				files = append(files, file)
+			}
+		}
+		return files
+	}
+	file := cgroupFile{controller: "io", name: "io.max"}
+	for _, l := range limits.IO {
+		line := l.Device
+		for _, kv := range []struct {
+			key   string
+			value int64
+		}{{"rbps", l.ReadBPS}, {"wbps", l.WriteBPS}, {"riops", l.ReadIOPS}, {"wiops", l.WriteIOPS}} {
+			if kv.value > 0 {
+				line += " " + kv.key + "=" + strconv.FormatInt(kv.value, 10)
+			}
+		}
+		file.lines = append(file.lines, line)
+	}
+	return append(files, file)
+}
+
+// cgroupControllers returns the controllers that the files are written with, in order.
+func cgroupControllers(files []cgroupFile) []string {
+	controllers := []string{}
+	for _, f := range files {
+		if len(controllers) == 0 || controllers[len(controllers)-1] != f.controller {
+			controllers = append(controllers, f.controller)
+		}
+	}
+	return controllers
+}
+
+// cgroupDirs returns the directories of the cgroup of a command, one for each
+// controller with cgroups v1, and the version of the cgroups. It returns no
+// directories if the group does not have resource limits.
+func (g *Groups) cgroupDirs(groupName, commandID string) ([]string, ResourceLimits, int) {
+	limits := g.ResourceLimits(groupName)
+	if limits.isZero() {
+		return nil, limits, 0
+	}
+	version := CgroupVersion(g.cgroupMount)
+	if version == 2 {
+		return []string{filepath.Join(g.cgroupMount, g.cgroupParent, groupName, commandID)}, limits, version
+	}
+	dirs := []string{}
+	for _, controller := range cgroupControllers(cgroupFiles(limits, version)) {
+		dirs = append(dirs, filepath.Join(g.cgroupMount, controller, g.cgroupParent, groupName, commandID))
+	}
+	return dirs, limits, version
+}
+
+// prepareCgroup creates the cgroup of a command and writes the limits of its group to it.
+func (g *Groups) prepareCgroup(groupName, commandID string) error {
+	dirs, limits, version := g.cgroupDirs(groupName, commandID)
+	if len(dirs) == 0 {
+		return nil
+	}
+	files := cgroupFiles(limits, version)
+
+	if version == 2 {
+		// The controllers have to be enabled for the children of the parent and group cgroups.
+		enable := "+" + strings.Join(cgroupControllers(files), " +")
+		for _, dir := range []string{filepath.Join(g.cgroupMount, g.cgroupParent), filepath.Join(g.cgroupMount, g.cgroupParent, groupName)} {
+			if err := os.MkdirAll(dir, DirPerms); err != nil {
+				return errors.Wrap(err, "creating cgroup")
+			}
+			if err := writeCgroupFile(dir, "cgroup.subtree_control", enable); err != nil {
+				return err
+			}
+		}
+		if err := os.MkdirAll(dirs[0], DirPerms); err != nil {
+			return errors.Wrap(err, "creating cgroup")
+		}
+		for _, f := range files {
+			if err := writeCgroupFile(dirs[0], f.name, f.lines...); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	for _, f := range files {
+		dir := filepath.Join(g.cgroupMount, f.controller, g.cgroupParent, groupName, commandID)
+		if err := os.MkdirAll(dir, DirPerms); err != nil {
+			return errors.Wrap(err, "creating cgroup")
+		}
+		if err := writeCgroupFile(dir, f.name, f.lines...); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// enterCgroup moves the process of a command that was just started into its
+// cgroup, see prepareCgroup. If it can not, it kills the process rather than
+// leave it running without its limits.
+func (g *Groups) enterCgroup(grp *Group, cmd *exec.Cmd, groupName, commandID string) error {
+	dirs, _, _ := g.cgroupDirs(groupName, commandID)
+
+	for _, dir := range dirs {
+		if err := writeCgroupFile(dir, "cgroup.procs", strconv.Itoa(grp.pid(cmd))); err != nil {
+			_ = grp.signal(cmd, os.Kill) // Best effort.
+			return errors.Wrap(err, "moving child process into its cgroup")
+		}
+	}
+	g.recordOOMBaseline(groupName, commandID)
+	return nil
+}
+
+// removeCgroup removes the cgroup of a command, if it has one.
+// Cgroups that still have processes are left alone.
+func (g *Groups) removeCgroup(groupName, commandID string) {
+	dirs, _, _ := g.cgroupDirs(groupName, commandID)
+
+	for _, dir := range dirs {
+		if err := os.Remove(dir); err != nil && !os.IsNotExist(err) && !errors.Is(err, syscall.EBUSY) {
+			g.logf("removing cgroup %s: %s", dir, err)
+		}
+	}
+}
+
+// writeCgroupFile writes lines to a file of a cgroup. Every line is written
+// on its own, since the kernel only reads one setting from each write.
+func writeCgroupFile(dir, name string, lines ...string) error {
+	f, err := os.OpenFile(filepath.Join(dir, name), os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0644)
+	if err != nil {
+		return errors.Wrap(err, "opening "+name)
+	}
+	for _, line := range lines {
+		if _, err := f.Write([]byte(line + "\n")); err != nil {
+			_ = f.Close()
+			return errors.Wrap(err, "writing "+name)
+		}
+	}
+	return errors.Wrap(f.Close(), "closing "+name)
+}
@@ -0,0 +1,197 @@
+package exec_test
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	osexec "os/exec"
+	"path/filepath"
+	"strconv"
+	"testing"
+
+	"github.com/scgolang/exec"
+)
+
+func TestGroupsResourceLimits(t *testing.T) {
+	limits := exec.ResourceLimits{
+		MemoryMax: 1 << 20,
+		CPUMax:    0.5,
+		IO:        []exec.IOLimit{{Device: "8:0", ReadBPS: 1024, WriteIOPS: 10}},
+	}
+	for _, tc := range []struct {
+		version int
+		files   map[string]string
+	}{
+		{
+			version: 2,
+			files: map[string]string{
+				"memory.max": "1048576\n",
+				"cpu.max":    "50000 100000\n",
+				"io.max":     "8:0 rbps=1024 wiops=10\n",
+			},
+		},
+		{
+			version: 1,
+			files: map[string]string{
+				"memory/memory.limit_in_bytes":           "1048576\n",
+				"cpu/cpu.cfs_quota_us":                   "50000\n",
+				"cpu/cpu.cfs_period_us":                  "100000\n",
+				"blkio/blkio.throttle.read_bps_device":   "8:0 1024\n",
+				"blkio/blkio.throttle.write_iops_device": "8:0 10\n",
+			},
+		},
+	} {
+		var (
+			groupName = "limited"
+			root      = filepath.Join("testdata", "."+t.Name()+strconv.Itoa(tc.version))
+			mount     = filepath.Join(root, "cgroup")
+		)
+		_ = os.RemoveAll(root)
+
+		// A fake cgroup filesystem of the version.
+		if err := os.MkdirAll(filepath.Join(mount, "memory"), exec.DirPerms); err != nil {
+			t.Fatal(err)
+		}
+		if tc.version == 2 {
+			if err := ioutil.WriteFile(filepath.Join(mount, "cgroup.controllers"), []byte("cpu io memory\n"), 0644); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if expected, got := tc.version, exec.CgroupVersion(mount); expected != got {
+			t.Fatalf("expected cgroups v%d, got v%d", expected, got)
+		}
+		gs, err := exec.New(filepath.Join(root, "groups"), exec.WithCgroups(mount, "exec"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer func() { _ = gs.Remove(groupName) }() // Best effort.
+
+		if err := gs.SetResourceLimits(groupName, limits); err != nil {
+			t.Fatal(err)
+		}
+		if err := gs.Create(groupName, osexec.Command("sleep", "10")); err != nil {
+			t.Fatal(err)
+		}
+		statuses, err := gs.Statuses(groupName)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for id, status := range statuses {
+			for name, expected := range tc.files {
+				dir, file := filepath.Split(name)
+				data, err := ioutil.ReadFile(filepath.Join(mount, dir, "exec", groupName, id, file))
+				if err != nil {
+					t.Fatal(err)
+				}
+				if got := string(data); expected != got {
+					t.Fatalf("expected %s to be %q, got %q", name, expected, got)
+				}
+				data, err = ioutil.ReadFile(filepath.Join(mount, dir, "exec", groupName, id, "cgroup.procs"))
+				if err != nil {
+					t.Fatal(err)
+				}
+				if expected, got := strconv.Itoa(status.PID)+"\n", string(data); expected != got {
+					t.Fatalf("expected the process to be in the cgroup, got %q", got)
+				}
+			}
+		}
+		if tc.version == 2 {
+			data, err := ioutil.ReadFile(filepath.Join(mount, "exec", "cgroup.subtree_control"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if expected, got := "+memory +cpu +io\n", string(data); expected != got {
+				t.Fatalf("expected controllers %q to be enabled, got %q", expected, got)
+			}
+		}
+	}
+}
+
+func TestGroupsResourceLimitsErrors(t *testing.T) {
+	root := filepath.Join("testdata", "."+t.Name())
+	_ = os.RemoveAll(root)
+
+	gs := newTestGroups(t, root)
+
+	if err := gs.SetResourceLimits("limited", exec.ResourceLimits{MemoryMax: 1 << 20}); err == nil {
+		t.Fatal("expected an error setting limits without cgroups, got nil")
+	}
+	if err := gs.SetResourceLimits("limited", exec.ResourceLimits{}); err != nil {
+		t.Fatal(err)
+	}
+	gs, err := exec.New(filepath.Join(root, "groups"), exec.WithCgroups(filepath.Join(root, "nope"), "exec"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := gs.SetResourceLimits("limited", exec.ResourceLimits{MemoryMax: 1 << 20}); err == nil {
+		t.Fatal("expected an error setting limits without a cgroup filesystem, got nil")
+	}
+	if err := gs.SetResourceLimits("limited", exec.ResourceLimits{IO: []exec.IOLimit{{Device: "sda"}}}); err == nil {
+		t.Fatal("expected an error setting limits of a device that is not major:minor, got nil")
+	}
+}
+
+func TestGroupsOOMKilled(t *testing.T) {
+	var (
+		groupName = "hungry"
+		root      = filepath.Join("testdata", "."+t.Name())
+		mount     = filepath.Join(root, "cgroup")
+	)
+	_ = os.RemoveAll(root)
+
+	if err := os.MkdirAll(mount, exec.DirPerms); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(mount, "cgroup.controllers"), []byte("memory\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	gs, err := exec.New(filepath.Join(root, "groups"), exec.WithCgroups(mount, "exec"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = gs.Remove(groupName) }() // Best effort.
+
+	if err := gs.SetResourceLimits(groupName, exec.ResourceLimits{MemoryMax: 1 << 20}); err != nil {
+		t.Fatal(err)
+	}
+	// The command kills itself the way the OOM killer would, once its memory events say so.
+	cmd := osexec.Command("sh", "-c", "sleep 0.2; kill -KILL $$")
+
+	if err := gs.Create(groupName, cmd); err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	changes, err := gs.Watch(ctx, groupName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	id, _ := gs.CmdID(groupName, cmd)
+	if err := ioutil.WriteFile(filepath.Join(mount, "exec", groupName, id, "memory.events"), []byte("oom 1\noom_kill 1\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	err = gs.Wait(groupName)
+	if !exec.IsOOMKilled(err) {
+		t.Fatalf("expected the command to be killed by the OOM killer, got %v", err)
+	}
+	for change := range changes {
+		if change.To != exec.StateFailed {
+			continue
+		}
+		if event := exec.NewStateEvent(change); !event.State.OOMKilled {
+			t.Fatalf("expected the event to say the command was OOM killed, got %+v", event.State)
+		}
+		break
+	}
+	runs, err := gs.Runs(groupName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected, got := 1, len(runs); expected != got {
+		t.Fatalf("expected %d runs, got %d", expected, got)
+	}
+	if !runs[0].OOMKilled {
+		t.Fatalf("expected the run to say the command was OOM killed, got %+v", runs[0])
+	}
+}
@@ -0,0 +1,38 @@
+package exec
+
+import (
+	"context"
+	"time"
+)
+
+// Clock tells the time and waits for durations to pass.
+// Groups use a Clock for timeouts, probe intervals, and timestamps,
+// so that code using them can be tested without real sleeps.
+type Clock interface {
+	Now() time.Time
+	After(d time.Duration) <-chan time.Time
+}
+
+// realClock is the Clock that uses the time package.
+type realClock struct{}
+
+// Now returns the current time.
+func (realClock) Now() time.Time { return time.Now() }
+
+// After waits for d to pass and then sends the current time on the returned channel.
+func (realClock) After(d time.Duration) <-chan time.Time { return time.After(d) }
+
+// withClockTimeout returns a context that is cancelled when d has passed on clock,
+// or when the returned cancel func is called.
+func withClockTimeout(ctx context.Context, clock Clock, d time.Duration) (context.Context, context.CancelFunc) {
+	ctx, cancel := context.WithCancel(ctx)
+
+	go func() {
+		select {
+		case <-clock.After(d):
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+	return ctx, cancel
+}
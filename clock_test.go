@@ -0,0 +1,50 @@
+package exec_test
+
+import (
+	osexec "os/exec"
+	"testing"
+	"time"
+
+	"github.com/scgolang/exec"
+	"github.com/scgolang/exec/exectest"
+)
+
+func TestGroupClock(t *testing.T) {
+	var (
+		clock = exectest.NewClock(time.Unix(0, 0))
+		g     = exec.NewGroup(exec.WithGroupClock(clock))
+		cmd   = osexec.Command("sleep", "10")
+		errch = make(chan error, 1)
+	)
+	if err := g.Start(cmd); err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = g.Remove() }() // Best effort.
+
+	go func() { errch <- g.Wait(time.Hour) }()
+
+	for clock.Waiters() == 0 {
+		time.Sleep(time.Millisecond)
+	}
+	clock.Advance(time.Hour)
+
+	select {
+	case err := <-errch:
+		if err == nil {
+			t.Fatal("expected a timeout error, got nil")
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("expected Wait to time out when the clock advanced")
+	}
+	if expected, got := time.Hour, g.Statuses()[getInstanceID(g, cmd, t)].Uptime; expected != got {
+		t.Fatalf("expected uptime %s, got %s", expected, got)
+	}
+}
+
+func getInstanceID(g *exec.Group, cmd *osexec.Cmd, t *testing.T) string {
+	id, ok := g.ID(cmd)
+	if !ok {
+		t.Fatal("expected command to have an instance ID")
+	}
+	return id
+}
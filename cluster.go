@@ -0,0 +1,895 @@
+package exec
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// DefaultHeartbeatTimeout is how long a Coordinator waits for a heartbeat
+// from an agent before it marks the agent as stale.
+const DefaultHeartbeatTimeout = 30 * time.Second
+
+// AgentStatus is the state of the open groups of an agent.
+type AgentStatus struct {
+	Agent string `json:"agent"`
+
+	// Groups maps group name to the status of each command of the group, keyed by instance ID.
+	Groups map[string]map[string]Status `json:"groups"`
+}
+
+// Agent serves the Groups of a host to a Coordinator, which runs groups
+// across several hosts, see Agent.Handler.
+type Agent struct {
+	name   string
+	groups *Groups
+}
+
+// NewAgent creates an agent with the provided name that serves g.
+func NewAgent(name string, g *Groups) *Agent {
+	return &Agent{name: name, groups: g}
+}
+
+// Status returns the state of the open groups of the agent.
+func (a *Agent) Status() AgentStatus {
+	status := AgentStatus{Agent: a.name, Groups: map[string]map[string]Status{}}
+
+	for _, groupName := range a.groups.groupNames() {
+		if statuses, err := a.groups.Statuses(groupName); err == nil {
+			status.Groups[groupName] = statuses
+		}
+	}
+	return status
+}
+
+// Handler returns the HTTP handler that a Coordinator talks to:
+//
+//	GET    /status                                 responds with the AgentStatus as JSON.
+//	PUT    /groups/<group>                         applies the GroupSpec in the JSON body, see Apply.
+//	DELETE /groups/<group>                         removes the group.
+//	GET    /groups/<group>/commands/<id>/logs/<fd> responds with the logs of a command, see Groups.Logs.
+//	GET    /groups/<group>/commands/<id>/follow    streams the output of a command, see Coordinator.Follow.
+//
+// The requests are authenticated with auth, and need RoleOperator to change
+// the groups and RoleReadOnly otherwise. If auth is nil the requests that
+// change the groups are refused with status 403.
+func (a *Agent) Handler(auth *Authenticator) http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/status", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		writeJSON(w, a.Status())
+	})
+	mux.HandleFunc("/groups/", func(w http.ResponseWriter, r *http.Request) {
+		groupName := strings.TrimPrefix(r.URL.Path, "/groups/")
+		if i := strings.Index(groupName, "/"); i > 0 {
+			a.serveOutput(w, r, groupName[:i], groupName[i+1:])
+			return
+		}
+		if groupName == "" {
+			http.NotFound(w, r)
+			return
+		}
+		switch r.Method {
+		default:
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		case http.MethodPut:
+			var spec GroupSpec
+			if err := json.NewDecoder(r.Body).Decode(&spec); err != nil {
+				http.Error(w, "decoding group definition: "+err.Error(), http.StatusBadRequest)
+				return
+			}
+			spec.Group = groupName
+
+			if err := a.groups.Apply(spec); err != nil {
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+				return
+			}
+			w.WriteHeader(http.StatusNoContent)
+		case http.MethodDelete:
+			if a.groups.getGroup(groupName) == nil {
+				http.Error(w, "group "+groupName+" not found", http.StatusNotFound)
+				return
+			}
+			if err := a.groups.Remove(groupName); err != nil {
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+				return
+			}
+			w.WriteHeader(http.StatusNoContent)
+		}
+	})
+	return protect(auth, mux)
+}
+
+// serveOutput serves the log files and the output stream of a command.
+// path is the part of the URL path after the name of the group.
+func (a *Agent) serveOutput(w http.ResponseWriter, r *http.Request, groupName, path string) {
+	parts := strings.Split(path, "/")
+	if len(parts) < 3 || parts[0] != "commands" || (parts[2] == "logs") != (len(parts) == 4) || (parts[2] != "logs" && parts[2] != "follow") {
+		http.NotFound(w, r)
+		return
+	}
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	grp := a.groups.getGroup(groupName)
+	if grp == nil {
+		http.Error(w, "group "+groupName+" not found", http.StatusNotFound)
+		return
+	}
+	cmd := grp.lookup(parts[1])
+	if cmd == nil {
+		http.Error(w, "command "+parts[1]+" not found in group "+groupName, http.StatusNotFound)
+		return
+	}
+	if parts[2] == "follow" {
+		a.follow(w, r, groupName, parts[1], cmd)
+		return
+	}
+	fd, err := strconv.Atoi(parts[3])
+	if err != nil {
+		http.Error(w, "parsing fd: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	rc, err := a.groups.openLogs(groupName, cmd, fd)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	defer func() { _ = rc.Close() }() // Best effort.
+
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	_, _ = io.Copy(w, rc) // Best effort.
+}
+
+// follow streams the output of a command as events, one JSON object a line,
+// until the client goes away. Lines that the client does not keep up with
+// are dropped, so that a slow client does not hold up the command.
+func (a *Agent) follow(w http.ResponseWriter, r *http.Request, groupName, commandID string, cmd *exec.Cmd) {
+	sub, err := a.groups.Subscribe(groupName, cmd, SubscribeOptions{Backpressure: BackpressureDrop})
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusNotImplemented)
+		return
+	}
+	defer func() { _ = sub.Close() }() // Best effort.
+
+	w.Header().Set("Content-Type", "application/x-ndjson")
+	w.WriteHeader(http.StatusOK)
+	flush(w)
+
+	enc := json.NewEncoder(w)
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case line, ok := <-sub.Lines:
+			if !ok {
+				return
+			}
+			if err := enc.Encode(NewOutputEvent(groupName, commandID, line, a.groups.clock.Now())); err != nil {
+				return
+			}
+			flush(w)
+		}
+	}
+}
+
+// flush sends what has been written to w so far to the client, if w can.
+func flush(w io.Writer) {
+	if f, ok := w.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// Heartbeat reports the status of the agent to a coordinator every interval,
+// starting now, until ctx is done, see Coordinator.Handler. The coordinator
+// can tell the agent to remove groups that were moved to other agents while
+// this one was stale, which the agent does. Failed heartbeats are logged and
+// tried again after interval. It returns the error of ctx.
+func (a *Agent) Heartbeat(ctx context.Context, coordinatorURL, token string, interval time.Duration) error {
+	conn := agentConn{url: strings.TrimRight(coordinatorURL, "/"), token: token}
+
+	for {
+		var resp HeartbeatResponse
+		if err := doJSON(ctx, http.DefaultClient, conn, http.MethodPost, "/heartbeat", a.Status(), &resp); err != nil {
+			a.groups.logf("sending heartbeat of agent %s: %s", a.name, err)
+		}
+		for _, groupName := range resp.Remove {
+			if a.groups.getGroup(groupName) == nil {
+				continue
+			}
+			if err := a.groups.Remove(groupName); err != nil {
+				a.groups.logf("removing group %s that moved away from agent %s: %s", groupName, a.name, err)
+			}
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-a.groups.clock.After(interval):
+		}
+	}
+}
+
+// protect authenticates the requests for h with auth.
+// Requests that could change the groups need RoleOperator, others RoleReadOnly.
+// If auth is nil the requests that could change the groups are refused,
+// since anyone who can reach h could run any command otherwise.
+func protect(auth *Authenticator, h http.Handler) http.Handler {
+	if auth == nil {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if isMutating(r.Method) {
+				http.Error(w, "changing the groups needs an authenticator", http.StatusForbidden)
+				return
+			}
+			h.ServeHTTP(w, r)
+		})
+	}
+	var (
+		read  = auth.Require(RoleReadOnly, h)
+		write = auth.Require(RoleOperator, h)
+	)
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if isMutating(r.Method) {
+			write.ServeHTTP(w, r)
+			return
+		}
+		read.ServeHTTP(w, r)
+	})
+}
+
+// writeJSON responds with v encoded as JSON.
+func writeJSON(w http.ResponseWriter, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(v) // Best effort.
+}
+
+// ClusterStatus is the state of the agents of a Coordinator.
+type ClusterStatus struct {
+	// Agents has the status of every agent that could be reached, sorted by name.
+	Agents []AgentStatus `json:"agents"`
+
+	// Errors maps the name of every agent that could not be reached to why.
+	Errors map[string]string `json:"errors,omitempty"`
+
+	// Placements maps the name of every group that was placed to the agent it was placed on.
+	Placements map[string]string `json:"placements"`
+
+	// Stale has the agents that have not sent a heartbeat for longer than
+	// the heartbeat timeout, sorted, see WithHeartbeatTimeout.
+	Stale []string `json:"stale,omitempty"`
+}
+
+// HeartbeatResponse is the response of a coordinator to the heartbeat of an agent.
+type HeartbeatResponse struct {
+	// Remove has the groups that the agent runs but that are placed on another agent.
+	Remove []string `json:"remove,omitempty"`
+}
+
+// Coordinator runs groups across the hosts of a cluster, by placing them on
+// the agents of the hosts, see NewAgent. It talks to the agents over HTTP.
+// Placements are kept in memory.
+type Coordinator struct {
+	client   *http.Client
+	clock    Clock
+	timeout  time.Duration
+	failover bool
+
+	// agents maps agent name to how to reach it.
+	// placements maps group name to where it was placed.
+	agents     map[string]agentConn
+	placements map[string]placement
+
+	// lastSeen maps agent name to when it last sent a heartbeat, or was added,
+	// and stale has the agents that CheckAgents found to be stale.
+	lastSeen map[string]time.Time
+	stale    map[string]struct{}
+
+	mu sync.Mutex
+}
+
+// CoordinatorOption configures a Coordinator.
+type CoordinatorOption func(*Coordinator) error
+
+// WithCoordinatorClock sets the clock that a coordinator times heartbeats with.
+func WithCoordinatorClock(clock Clock) CoordinatorOption {
+	return func(c *Coordinator) error {
+		c.clock = clock
+		return nil
+	}
+}
+
+// WithHeartbeatTimeout sets how long a coordinator waits for a heartbeat from
+// an agent before it marks the agent as stale. The default is DefaultHeartbeatTimeout.
+func WithHeartbeatTimeout(d time.Duration) CoordinatorOption {
+	return func(c *Coordinator) error {
+		if d <= 0 {
+			return errors.Errorf("heartbeat timeout must be positive, got %s", d)
+		}
+		c.timeout = d
+		return nil
+	}
+}
+
+// WithFailover makes a coordinator place the groups of agents that become
+// stale on other agents, see CheckAgents.
+func WithFailover() CoordinatorOption {
+	return func(c *Coordinator) error {
+		c.failover = true
+		return nil
+	}
+}
+
+// agentConn is how a coordinator reaches an agent.
+type agentConn struct {
+	url   string
+	token string
+}
+
+// placement is a group that was placed on an agent.
+type placement struct {
+	agent string
+	spec  GroupSpec
+}
+
+// NewCoordinator creates a coordinator without agents that uses client to
+// talk to them, or http.DefaultClient if client is nil.
+func NewCoordinator(client *http.Client, opts ...CoordinatorOption) (*Coordinator, error) {
+	if client == nil {
+		client = http.DefaultClient
+	}
+	c := &Coordinator{
+		client:     client,
+		clock:      realClock{},
+		timeout:    DefaultHeartbeatTimeout,
+		agents:     map[string]agentConn{},
+		placements: map[string]placement{},
+		lastSeen:   map[string]time.Time{},
+		stale:      map[string]struct{}{},
+	}
+	for _, opt := range opts {
+		if err := opt(c); err != nil {
+			return nil, err
+		}
+	}
+	return c, nil
+}
+
+// AddAgent adds the agent with the provided name, whose handler is served at
+// baseURL. If token is not empty it is sent to the agent as a bearer token.
+func (c *Coordinator) AddAgent(name, baseURL, token string) error {
+	if name == "" {
+		return errors.New("agent name must not be empty")
+	}
+	if _, err := url.Parse(baseURL); err != nil {
+		return errors.Wrap(err, "parsing agent URL")
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if _, ok := c.agents[name]; ok {
+		return errors.Errorf("agent %s already exists", name)
+	}
+	c.agents[name] = agentConn{url: strings.TrimRight(baseURL, "/"), token: token}
+	c.lastSeen[name] = c.clock.Now()
+	return nil
+}
+
+// Agents returns the names of the agents, sorted.
+func (c *Coordinator) Agents() []string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	names := make([]string, 0, len(c.agents))
+	for name := range c.agents {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Place runs a group on an agent by applying its definition there, see Apply.
+// A group that has been placed can be placed on the same agent again to
+// change it, but it must be removed with Unplace before it can move to another agent.
+func (c *Coordinator) Place(ctx context.Context, agent string, spec GroupSpec) error {
+	if spec.Group == "" {
+		return errors.New("definition does not name a group")
+	}
+	if spec.Version == 0 {
+		spec.Version = DefinitionVersion
+	}
+	c.mu.Lock()
+	conn, ok := c.agents[agent]
+	p, placed := c.placements[spec.Group]
+	c.mu.Unlock()
+
+	if !ok {
+		return errors.Errorf("agent %s not found", agent)
+	}
+	if placed && p.agent != agent {
+		return errors.Errorf("group %s is placed on agent %s", spec.Group, p.agent)
+	}
+	return c.place(ctx, agent, conn, spec)
+}
+
+// place applies the definition of a group on an agent and records where it was placed.
+func (c *Coordinator) place(ctx context.Context, agent string, conn agentConn, spec GroupSpec) error {
+	if err := c.do(ctx, conn, http.MethodPut, "/groups/"+url.PathEscape(spec.Group), spec, nil); err != nil {
+		return errors.Wrapf(err, "placing group %s on agent %s", spec.Group, agent)
+	}
+	c.mu.Lock()
+	c.placements[spec.Group] = placement{agent: agent, spec: spec}
+	c.mu.Unlock()
+	return nil
+}
+
+// Unplace removes a group from the agent it was placed on.
+func (c *Coordinator) Unplace(ctx context.Context, groupName string) error {
+	c.mu.Lock()
+	p, ok := c.placements[groupName]
+	conn := c.agents[p.agent]
+	c.mu.Unlock()
+
+	if !ok {
+		return errors.Errorf("group %s is not placed", groupName)
+	}
+	if err := c.do(ctx, conn, http.MethodDelete, "/groups/"+url.PathEscape(groupName), nil, nil); err != nil {
+		return errors.Wrapf(err, "removing group %s from agent %s", groupName, p.agent)
+	}
+	c.mu.Lock()
+	delete(c.placements, groupName)
+	c.mu.Unlock()
+	return nil
+}
+
+// Status asks every agent for its status. Agents that can not be reached
+// are reported in the Errors of the status rather than failing it.
+func (c *Coordinator) Status(ctx context.Context) ClusterStatus {
+	c.mu.Lock()
+	var (
+		agents = make(map[string]agentConn, len(c.agents))
+		status = ClusterStatus{Agents: []AgentStatus{}, Placements: map[string]string{}}
+	)
+	for name, conn := range c.agents {
+		agents[name] = conn
+	}
+	for groupName, p := range c.placements {
+		status.Placements[groupName] = p.agent
+	}
+	for name := range c.stale {
+		status.Stale = append(status.Stale, name)
+	}
+	c.mu.Unlock()
+
+	sort.Strings(status.Stale)
+
+	for _, name := range c.Agents() {
+		conn, ok := agents[name]
+		if !ok {
+			continue // Added since.
+		}
+		var as AgentStatus
+		if err := c.do(ctx, conn, http.MethodGet, "/status", nil, &as); err != nil {
+			if status.Errors == nil {
+				status.Errors = map[string]string{}
+			}
+			status.Errors[name] = err.Error()
+			continue
+		}
+		as.Agent = name
+		status.Agents = append(status.Agents, as)
+	}
+	return status
+}
+
+// Heartbeat records that an agent is alive and reported status, and returns
+// the groups that the agent should remove because they are placed on another
+// agent, for example because they were moved while the agent was stale.
+// Agents send heartbeats with Agent.Heartbeat, which calls this through Handler.
+func (c *Coordinator) Heartbeat(status AgentStatus) (HeartbeatResponse, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if _, ok := c.agents[status.Agent]; !ok {
+		return HeartbeatResponse{}, errors.Errorf("agent %s not found", status.Agent)
+	}
+	c.lastSeen[status.Agent] = c.clock.Now()
+	delete(c.stale, status.Agent)
+
+	resp := HeartbeatResponse{}
+	for groupName := range status.Groups {
+		if p, ok := c.placements[groupName]; ok && p.agent != status.Agent {
+			resp.Remove = append(resp.Remove, groupName)
+		}
+	}
+	sort.Strings(resp.Remove)
+	return resp, nil
+}
+
+// CheckAgents marks the agents that have not sent a heartbeat within the
+// heartbeat timeout as stale, and returns them. With WithFailover, the groups
+// that were placed on stale agents are placed on the agent that is not stale
+// and has the fewest groups. A group that can not be moved stays placed
+// where it was, so that it is tried again by the next check.
+func (c *Coordinator) CheckAgents(ctx context.Context) ([]string, error) {
+	c.mu.Lock()
+	var (
+		now   = c.clock.Now()
+		stale = []string{}
+	)
+	for name, last := range c.lastSeen {
+		if now.Sub(last) > c.timeout {
+			c.stale[name] = struct{}{}
+		}
+	}
+	for name := range c.stale {
+		stale = append(stale, name)
+	}
+	sort.Strings(stale)
+
+	moves := []placement{}
+	if c.failover {
+		for _, p := range c.placements {
+			if _, ok := c.stale[p.agent]; ok {
+				moves = append(moves, p)
+			}
+		}
+		sort.Slice(moves, func(i, j int) bool { return moves[i].spec.Group < moves[j].spec.Group })
+	}
+	c.mu.Unlock()
+
+	for _, p := range moves {
+		agent, conn, ok := c.leastPlaced()
+		if !ok {
+			return stale, errors.Errorf("no agent to move group %s to", p.spec.Group)
+		}
+		if err := c.place(ctx, agent, conn, p.spec); err != nil {
+			return stale, err
+		}
+	}
+	return stale, nil
+}
+
+// leastPlaced returns the agent that is not stale and has the fewest groups.
+func (c *Coordinator) leastPlaced() (string, agentConn, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	counts := map[string]int{}
+	for _, p := range c.placements {
+		counts[p.agent]++
+	}
+	best := ""
+	for name := range c.agents {
+		if _, ok := c.stale[name]; ok {
+			continue
+		}
+		if best == "" || counts[name] < counts[best] || (counts[name] == counts[best] && name < best) {
+			best = name
+		}
+	}
+	return best, c.agents[best], best != ""
+}
+
+// Run checks the agents every half heartbeat timeout until ctx is done, see
+// CheckAgents, and returns the error of ctx.
+func (c *Coordinator) Run(ctx context.Context) error {
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-c.clock.After(c.timeout / 2):
+		}
+		_, _ = c.CheckAgents(ctx) // Groups that could not be moved are tried again.
+	}
+}
+
+// Logs returns the logs of a command of a group, from the agent the group is
+// placed on, see Groups.Logs. Pass 1 to get stdout and 2 to get stderr.
+// Calling code is expected to close the io.ReadCloser that is returned.
+func (c *Coordinator) Logs(ctx context.Context, groupName, commandID string, fd int) (io.ReadCloser, error) {
+	return c.output(ctx, groupName, commandID, "logs/"+strconv.Itoa(fd))
+}
+
+// Follow streams the output of a command of a group from the agent the group
+// is placed on, as events with one JSON object a line, see ParseEvent.
+// The stream starts with the output that is written after Follow is called,
+// and ends when ctx is done or the agent goes away.
+// The agents must have been created with WithOutputStreaming.
+// Calling code is expected to close the io.ReadCloser that is returned.
+func (c *Coordinator) Follow(ctx context.Context, groupName, commandID string) (io.ReadCloser, error) {
+	return c.output(ctx, groupName, commandID, "follow")
+}
+
+// output requests output of a command from the agent its group is placed on.
+func (c *Coordinator) output(ctx context.Context, groupName, commandID, path string) (io.ReadCloser, error) {
+	c.mu.Lock()
+	p, ok := c.placements[groupName]
+	conn := c.agents[p.agent]
+	c.mu.Unlock()
+
+	if !ok {
+		return nil, errors.Errorf("group %s is not placed", groupName)
+	}
+	resp, err := send(ctx, c.client, conn, http.MethodGet, "/groups/"+url.PathEscape(groupName)+"/commands/"+url.PathEscape(commandID)+"/"+path, nil)
+	if err != nil {
+		return nil, errors.Wrapf(err, "getting output of group %s from agent %s", groupName, p.agent)
+	}
+	return resp.Body, nil
+}
+
+// MirrorLogs follows the output of every command of the groups that have been
+// placed, and appends it to a file for each command in dir, named
+// <group>/<command ID>.jsonl, as events with one JSON object a line, until ctx
+// is done. It looks for new commands, and for streams that ended, every half
+// heartbeat timeout, so output that is written while a stream is reconnected
+// is not mirrored. It returns the error of ctx.
+func (c *Coordinator) MirrorLogs(ctx context.Context, dir string) error {
+	var (
+		following = map[string]struct{}{}
+		mu        sync.Mutex
+		wg        sync.WaitGroup
+	)
+	defer wg.Wait()
+
+	for {
+		status := c.Status(ctx)
+
+		for _, as := range status.Agents {
+			for groupName, statuses := range as.Groups {
+				if status.Placements[groupName] != as.Agent {
+					continue
+				}
+				for commandID := range statuses {
+					key := groupName + "/" + commandID
+
+					mu.Lock()
+					_, ok := following[key]
+					following[key] = struct{}{}
+					mu.Unlock()
+
+					if ok {
+						continue
+					}
+					wg.Add(1)
+					go func(groupName, commandID string) {
+						defer wg.Done()
+						_ = c.mirror(ctx, dir, groupName, commandID) // Tried again by the next look.
+
+						mu.Lock()
+						delete(following, groupName+"/"+commandID)
+						mu.Unlock()
+					}(groupName, commandID)
+				}
+			}
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-c.clock.After(c.timeout / 2):
+		}
+	}
+}
+
+// mirror appends the output of a command to its file in dir, until the stream ends.
+func (c *Coordinator) mirror(ctx context.Context, dir, groupName, commandID string) error {
+	rc, err := c.Follow(ctx, groupName, commandID)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = rc.Close() }() // Best effort.
+
+	if err := os.MkdirAll(filepath.Join(dir, groupName), DirPerms); err != nil {
+		return errors.Wrap(err, "creating mirror directory")
+	}
+	f, err := os.OpenFile(filepath.Join(dir, groupName, commandID+".jsonl"), os.O_WRONLY|os.O_CREATE|os.O_APPEND, LogPerms)
+	if err != nil {
+		return errors.Wrap(err, "opening mirror file")
+	}
+	if _, err := io.Copy(f, rc); err != nil {
+		_ = f.Close()
+		return errors.Wrap(err, "mirroring output")
+	}
+	return f.Close()
+}
+
+// do sends a request to an agent, see doJSON.
+func (c *Coordinator) do(ctx context.Context, conn agentConn, method, path string, in, out interface{}) error {
+	return doJSON(ctx, c.client, conn, method, path, in, out)
+}
+
+// doJSON sends a request to the server of conn, with in encoded as JSON as its body
+// if it is not nil, and decodes the JSON response into out if it is not nil.
+func doJSON(ctx context.Context, client *http.Client, conn agentConn, method, path string, in, out interface{}) error {
+	resp, err := send(ctx, client, conn, method, path, in)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = resp.Body.Close() }() // Best effort.
+
+	if out == nil {
+		return nil
+	}
+	return errors.Wrap(json.NewDecoder(resp.Body).Decode(out), "decoding response")
+}
+
+// send sends a request to the server of conn, with in encoded as JSON as its body
+// if it is not nil. It returns an error if the response does not have a 2xx status.
+// Calling code is expected to close the body of the response.
+func send(ctx context.Context, client *http.Client, conn agentConn, method, path string, in interface{}) (*http.Response, error) {
+	var body bytes.Buffer
+	if in != nil {
+		if err := json.NewEncoder(&body).Encode(in); err != nil {
+			return nil, errors.Wrap(err, "encoding request")
+		}
+	}
+	req, err := http.NewRequest(method, conn.url+path, &body)
+	if err != nil {
+		return nil, err
+	}
+	req = req.WithContext(ctx)
+
+	if in != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	if conn.token != "" {
+		req.Header.Set("Authorization", "Bearer "+conn.token)
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		msg, _ := ioutil.ReadAll(resp.Body)
+		_ = resp.Body.Close() // Best effort.
+		return nil, errors.Errorf("%s %s: %s: %s", method, path, resp.Status, strings.TrimSpace(string(msg)))
+	}
+	return resp, nil
+}
+
+// Handler returns an HTTP handler for the cluster:
+//
+//	GET    /status                                 responds with the ClusterStatus as JSON.
+//	PUT    /agents/<agent>/groups/<group>          places the GroupSpec in the JSON body on an agent.
+//	DELETE /groups/<group>                         removes a group from its agent.
+//	POST   /heartbeat                              records the AgentStatus in the JSON body, see Heartbeat.
+//	GET    /groups/<group>/commands/<id>/logs/<fd> responds with a log file from the agent, see Logs.
+//	GET    /groups/<group>/commands/<id>/follow    streams the output of a command, see Follow.
+//
+// The requests are authenticated with auth, and need RoleOperator to change
+// the groups and RoleReadOnly otherwise. Heartbeats must be sent by a client
+// named after the agent. If auth is nil the requests that change the groups,
+// heartbeats included, are refused with status 403.
+func (c *Coordinator) Handler(auth *Authenticator) http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/heartbeat", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		var status AgentStatus
+		if err := json.NewDecoder(r.Body).Decode(&status); err != nil {
+			http.Error(w, "decoding agent status: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+		if client, ok := ClientFromContext(r.Context()); ok && client.Name != status.Agent {
+			http.Error(w, "client "+client.Name+" can not send heartbeats of agent "+status.Agent, http.StatusForbidden)
+			return
+		}
+		resp, err := c.Heartbeat(status)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusNotFound)
+			return
+		}
+		writeJSON(w, resp)
+	})
+	mux.HandleFunc("/status", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		writeJSON(w, c.Status(r.Context()))
+	})
+	mux.HandleFunc("/agents/", func(w http.ResponseWriter, r *http.Request) {
+		parts := strings.Split(strings.TrimPrefix(r.URL.Path, "/agents/"), "/")
+		if len(parts) != 3 || parts[1] != "groups" || parts[2] == "" {
+			http.NotFound(w, r)
+			return
+		}
+		if r.Method != http.MethodPut {
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		var spec GroupSpec
+		if err := json.NewDecoder(r.Body).Decode(&spec); err != nil {
+			http.Error(w, "decoding group definition: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+		spec.Group = parts[2]
+
+		if err := c.Place(r.Context(), parts[0], spec); err != nil {
+			http.Error(w, err.Error(), http.StatusBadGateway)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	})
+	mux.HandleFunc("/groups/", func(w http.ResponseWriter, r *http.Request) {
+		groupName := strings.TrimPrefix(r.URL.Path, "/groups/")
+		if i := strings.Index(groupName, "/"); i > 0 {
+			c.proxyOutput(w, r, groupName[:i], groupName[i+1:])
+			return
+		}
+		if groupName == "" {
+			http.NotFound(w, r)
+			return
+		}
+		if r.Method != http.MethodDelete {
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		if err := c.Unplace(r.Context(), groupName); err != nil {
+			http.Error(w, err.Error(), http.StatusBadGateway)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	})
+	return protect(auth, mux)
+}
+
+// proxyOutput serves the output of a command from the agent its group is placed on.
+// path is the part of the URL path after the name of the group.
+func (c *Coordinator) proxyOutput(w http.ResponseWriter, r *http.Request, groupName, path string) {
+	parts := strings.Split(path, "/")
+	if len(parts) < 3 || parts[0] != "commands" {
+		http.NotFound(w, r)
+		return
+	}
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	rc, err := c.output(r.Context(), groupName, parts[1], strings.Join(parts[2:], "/"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadGateway)
+		return
+	}
+	defer func() { _ = rc.Close() }() // Best effort.
+
+	if parts[2] == "follow" {
+		w.Header().Set("Content-Type", "application/x-ndjson")
+	} else {
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	}
+	w.WriteHeader(http.StatusOK)
+	flush(w)
+
+	buf := make([]byte, 32*1024)
+	for {
+		n, err := rc.Read(buf)
+		if n > 0 {
+			if _, err := w.Write(buf[:n]); err != nil {
+				return
+			}
+			flush(w)
+		}
+		if err != nil {
+			return
+		}
+	}
+}
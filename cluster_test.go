@@ -0,0 +1,402 @@
+package exec_test
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	osexec "os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/scgolang/exec"
+	"github.com/scgolang/exec/exectest"
+)
+
+func TestCoordinator(t *testing.T) {
+	var (
+		groupName = "sleepers"
+		root      = filepath.Join("testdata", "."+t.Name())
+		ctx       = context.Background()
+		agents    = map[string]*exec.Groups{}
+	)
+	_ = os.RemoveAll(root)
+
+	coord, err := exec.NewCoordinator(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.MkdirAll(root, exec.DirPerms); err != nil {
+		t.Fatal(err)
+	}
+	sleep, err := osexec.LookPath("sleep")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{"a", "b"} {
+		gs := newTestGroups(t, filepath.Join(root, name))
+		defer func() { _ = gs.Remove(groupName) }() // Best effort.
+
+		auth, err := exec.NewAuthenticator()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := auth.AddToken("token-"+name, exec.Client{Name: "coordinator", Role: exec.RoleOperator}); err != nil {
+			t.Fatal(err)
+		}
+		srv := httptest.NewServer(exec.NewAgent(name, gs).Handler(auth))
+		defer srv.Close()
+
+		if err := coord.AddAgent(name, srv.URL, "token-"+name); err != nil {
+			t.Fatal(err)
+		}
+		agents[name] = gs
+	}
+	gone := httptest.NewServer(http.NotFoundHandler())
+	gone.Close()
+
+	if err := coord.AddAgent("gone", gone.URL, ""); err != nil {
+		t.Fatal(err)
+	}
+	spec := exec.GroupSpec{
+		Group:    groupName,
+		Commands: []exec.CommandSpec{{Path: sleep, Args: []string{"sleep", "10"}}},
+	}
+	if err := coord.Place(ctx, "b", spec); err != nil {
+		t.Fatal(err)
+	}
+	if err := coord.Place(ctx, "a", spec); err == nil {
+		t.Fatal("expected an error placing a group on a second agent, got nil")
+	}
+	if cmds, _ := agents["a"].Commands(groupName); len(cmds) != 0 {
+		t.Fatalf("expected no commands on agent a, got %d", len(cmds))
+	}
+	status := coord.Status(ctx)
+
+	if expected, got := "b", status.Placements[groupName]; expected != got {
+		t.Fatalf("expected %s to be placed on %s, got %s", groupName, expected, got)
+	}
+	if _, ok := status.Errors["gone"]; !ok || len(status.Errors) != 1 {
+		t.Fatalf("expected agent gone to be unreachable, got %+v", status.Errors)
+	}
+	if expected, got := 2, len(status.Agents); expected != got {
+		t.Fatalf("expected %d agents, got %d", expected, got)
+	}
+	statuses := status.Agents[1].Groups[groupName]
+	if expected, got := 1, len(statuses); expected != got {
+		t.Fatalf("expected %d commands on agent b, got %d", expected, got)
+	}
+	for _, s := range statuses {
+		if expected, got := exec.StateRunning, s.State; expected != got {
+			t.Fatalf("expected state %s, got %s", expected, got)
+		}
+	}
+	// Without an authenticator the coordinator's own API does not change anything.
+	noAuth := httptest.NewServer(coord.Handler(nil))
+	defer noAuth.Close()
+
+	req, err := http.NewRequest(http.MethodDelete, noAuth.URL+"/groups/"+groupName, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_ = resp.Body.Close()
+
+	if expected, got := http.StatusForbidden, resp.StatusCode; expected != got {
+		t.Fatalf("expected status %d, got %d", expected, got)
+	}
+	// With one it places and removes groups too.
+	auth, err := exec.NewAuthenticator()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := auth.AddToken("token-operator", exec.Client{Name: "operator", Role: exec.RoleOperator}); err != nil {
+		t.Fatal(err)
+	}
+	srv := httptest.NewServer(coord.Handler(auth))
+	defer srv.Close()
+
+	if req, err = http.NewRequest(http.MethodDelete, srv.URL+"/groups/"+groupName, nil); err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("Authorization", "Bearer token-operator")
+
+	if resp, err = http.DefaultClient.Do(req); err != nil {
+		t.Fatal(err)
+	}
+	_ = resp.Body.Close()
+
+	if expected, got := http.StatusNoContent, resp.StatusCode; expected != got {
+		t.Fatalf("expected status %d, got %d", expected, got)
+	}
+	if cmds, _ := agents["b"].Commands(groupName); len(cmds) != 0 {
+		t.Fatalf("expected no commands on agent b, got %d", len(cmds))
+	}
+	body := `{"commands": [{"path": "` + sleep + `", "args": ["sleep", "11"]}]}`
+	if req, err = http.NewRequest(http.MethodPost, srv.URL+"/agents/a/groups/"+groupName, strings.NewReader(body)); err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("Authorization", "Bearer token-operator")
+
+	if resp, err = http.DefaultClient.Do(req); err != nil {
+		t.Fatal(err)
+	}
+	_ = resp.Body.Close()
+
+	if expected, got := http.StatusMethodNotAllowed, resp.StatusCode; expected != got {
+		t.Fatalf("expected status %d, got %d", expected, got)
+	}
+	req, err = http.NewRequest(http.MethodPut, srv.URL+"/agents/a/groups/"+groupName, strings.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("Authorization", "Bearer token-operator")
+
+	if resp, err = http.DefaultClient.Do(req); err != nil {
+		t.Fatal(err)
+	}
+	_ = resp.Body.Close()
+
+	if expected, got := http.StatusNoContent, resp.StatusCode; expected != got {
+		t.Fatalf("expected status %d, got %d", expected, got)
+	}
+	if cmds, _ := agents["a"].Commands(groupName); len(cmds) != 1 {
+		t.Fatalf("expected 1 command on agent a, got %d", len(cmds))
+	}
+}
+
+func TestCoordinatorFailover(t *testing.T) {
+	var (
+		groupName = "sleepers"
+		root      = filepath.Join("testdata", "."+t.Name())
+		ctx       = context.Background()
+		clock     = exectest.NewClock(time.Unix(0, 0))
+		agents    = map[string]*exec.Agent{}
+		groups    = map[string]*exec.Groups{}
+	)
+	_ = os.RemoveAll(root)
+
+	coord, err := exec.NewCoordinator(nil, exec.WithCoordinatorClock(clock), exec.WithHeartbeatTimeout(10*time.Second), exec.WithFailover())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.MkdirAll(root, exec.DirPerms); err != nil {
+		t.Fatal(err)
+	}
+	sleep, err := osexec.LookPath("sleep")
+	if err != nil {
+		t.Fatal(err)
+	}
+	auth, err := exec.NewAuthenticator()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := auth.AddToken("token-coordinator", exec.Client{Name: "coordinator", Role: exec.RoleOperator}); err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{"a", "b"} {
+		gs := newTestGroups(t, filepath.Join(root, name))
+		defer func() { _ = gs.Remove(groupName) }() // Best effort.
+
+		if err := auth.AddToken("token-"+name, exec.Client{Name: name, Role: exec.RoleOperator}); err != nil {
+			t.Fatal(err)
+		}
+		agent := exec.NewAgent(name, gs)
+		srv := httptest.NewServer(agent.Handler(auth))
+		defer srv.Close()
+
+		if err := coord.AddAgent(name, srv.URL, "token-coordinator"); err != nil {
+			t.Fatal(err)
+		}
+		agents[name], groups[name] = agent, gs
+	}
+	spec := exec.GroupSpec{
+		Group:    groupName,
+		Commands: []exec.CommandSpec{{Path: sleep, Args: []string{"sleep", "10"}}},
+	}
+	if err := coord.Place(ctx, "a", spec); err != nil {
+		t.Fatal(err)
+	}
+	// Agent b keeps sending heartbeats while agent a does not.
+	clock.Advance(11 * time.Second)
+
+	if _, err := coord.Heartbeat(agents["b"].Status()); err != nil {
+		t.Fatal(err)
+	}
+	stale, err := coord.CheckAgents(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected, got := "a", strings.Join(stale, ","); expected != got {
+		t.Fatalf("expected stale agents %s, got %s", expected, got)
+	}
+	status := coord.Status(ctx)
+
+	if expected, got := "b", status.Placements[groupName]; expected != got {
+		t.Fatalf("expected %s to be moved to %s, got %s", groupName, expected, got)
+	}
+	if expected, got := "a", strings.Join(status.Stale, ","); expected != got {
+		t.Fatalf("expected stale agents %s, got %s", expected, got)
+	}
+	if cmds, _ := groups["b"].Commands(groupName); len(cmds) != 1 {
+		t.Fatalf("expected 1 command on agent b, got %d", len(cmds))
+	}
+	// When agent a comes back it is told to remove the group that moved away.
+	srv := httptest.NewServer(coord.Handler(auth))
+	defer srv.Close()
+
+	hbCtx, cancel := context.WithCancel(ctx)
+	done := make(chan error, 1)
+	go func() { done <- agents["a"].Heartbeat(hbCtx, srv.URL, "token-a", 10*time.Millisecond) }()
+
+	for deadline := time.Now().Add(5 * time.Second); ; time.Sleep(10 * time.Millisecond) {
+		if cmds, _ := groups["a"].Commands(groupName); len(cmds) == 0 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("expected agent a to remove the group that moved away")
+		}
+	}
+	cancel()
+
+	if expected, got := context.Canceled, <-done; expected != got {
+		t.Fatalf("expected error %v, got %v", expected, got)
+	}
+	if status := coord.Status(ctx); len(status.Stale) != 0 {
+		t.Fatalf("expected no stale agents, got %v", status.Stale)
+	}
+}
+
+func TestCoordinatorLogs(t *testing.T) {
+	var (
+		groupName = "tickers"
+		root      = filepath.Join("testdata", "."+t.Name())
+		ctx       = context.Background()
+	)
+	_ = os.RemoveAll(root)
+
+	if err := os.MkdirAll(root, exec.DirPerms); err != nil {
+		t.Fatal(err)
+	}
+	gs, err := exec.New(filepath.Join(root, "a"), exec.WithOutputStreaming())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = gs.Remove(groupName) }() // Best effort.
+
+	// Streams are flushed through authentication too.
+	auth, err := exec.NewAuthenticator()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := auth.AddToken("token-coordinator", exec.Client{Name: "coordinator", Role: exec.RoleOperator}); err != nil {
+		t.Fatal(err)
+	}
+	if err := auth.AddToken("token-viewer", exec.Client{Name: "viewer", Role: exec.RoleReadOnly}); err != nil {
+		t.Fatal(err)
+	}
+	agentSrv := httptest.NewServer(exec.NewAgent("a", gs).Handler(auth))
+	defer agentSrv.Close()
+
+	coord, err := exec.NewCoordinator(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := coord.AddAgent("a", agentSrv.URL, "token-coordinator"); err != nil {
+		t.Fatal(err)
+	}
+	sh, err := osexec.LookPath("sh")
+	if err != nil {
+		t.Fatal(err)
+	}
+	spec := exec.GroupSpec{
+		Group:    groupName,
+		Commands: []exec.CommandSpec{{Path: sh, Args: []string{"sh", "-c", "while true; do echo tick; sleep 0.05; done"}}},
+	}
+	if err := coord.Place(ctx, "a", spec); err != nil {
+		t.Fatal(err)
+	}
+	var commandID string
+	for id := range coord.Status(ctx).Agents[0].Groups[groupName] {
+		commandID = id
+	}
+	// Follow through the coordinator's own API.
+	srv := httptest.NewServer(coord.Handler(auth))
+	defer srv.Close()
+
+	req, err := http.NewRequest(http.MethodGet, srv.URL+"/groups/"+groupName+"/commands/"+commandID+"/follow", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("Authorization", "Bearer token-viewer")
+
+	client := &http.Client{Timeout: 5 * time.Second}
+	resp, err := client.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = resp.Body.Close() }() // Best effort.
+
+	if expected, got := http.StatusOK, resp.StatusCode; expected != got {
+		t.Fatalf("expected status %d, got %d", expected, got)
+	}
+	line, err := bufio.NewReader(resp.Body).ReadBytes('\n')
+	if err != nil {
+		t.Fatal(err)
+	}
+	event, err := exec.ParseEvent(line)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if event.Output == nil || event.Output.Line != "tick" || event.CommandID != commandID {
+		t.Fatalf("expected a tick from %s, got %s", commandID, line)
+	}
+	rc, err := coord.Logs(ctx, groupName, commandID, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	logs, err := ioutil.ReadAll(rc)
+	_ = rc.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(string(logs), "tick\n") {
+		t.Fatalf("expected the log file to start with a tick, got %q", logs)
+	}
+	if _, err := coord.Logs(ctx, "nope", commandID, 1); err == nil {
+		t.Fatal("expected an error getting the logs of a group that is not placed, got nil")
+	}
+	// Mirror the output centrally.
+	var (
+		mirrorDir         = filepath.Join(root, "mirror")
+		mirrorCtx, cancel = context.WithCancel(ctx)
+		done              = make(chan error, 1)
+	)
+	go func() { done <- coord.MirrorLogs(mirrorCtx, mirrorDir) }()
+
+	for deadline := time.Now().Add(5 * time.Second); ; time.Sleep(10 * time.Millisecond) {
+		data, _ := ioutil.ReadFile(filepath.Join(mirrorDir, groupName, commandID+".jsonl"))
+		if i := bytes.IndexByte(data, '\n'); i > 0 {
+			if _, err := exec.ParseEvent(data[:i]); err != nil {
+				t.Fatal(err)
+			}
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("expected the output to be mirrored")
+		}
+	}
+	cancel()
+
+	if expected, got := context.Canceled, <-done; expected != got {
+		t.Fatalf("expected error %v, got %v", expected, got)
+	}
+}
@@ -0,0 +1,158 @@
+package exec
+
+import (
+	"context"
+	"os/exec"
+	"sync"
+	"sync/atomic"
+
+	"github.com/pkg/errors"
+)
+
+// DefaultStartConcurrency is the number of commands that are started at
+// the same time when a group is created or opened.
+const DefaultStartConcurrency = 1
+
+// SetStartConcurrency sets how many commands Create and Open start at the
+// same time. With a concurrency greater than one, commands are added to the
+// group in the order that they finish starting.
+func (g *Groups) SetStartConcurrency(n int) error {
+	if n < 1 {
+		return errors.Errorf("start concurrency must be at least 1, got %d", n)
+	}
+	g.limitsMu.Lock()
+	g.startConcurrency = n
+	g.limitsMu.Unlock()
+	return nil
+}
+
+// SetCaptureConcurrency sets how many commands can have their output written
+// to their log files at the same time. Output of other commands stays in its
+// pipe until a slot is free.
+// Zero, the default, means there is no limit.
+// Commands that are already running are not affected.
+func (g *Groups) SetCaptureConcurrency(n int) error {
+	if n < 0 {
+		return errors.Errorf("capture concurrency must not be negative, got %d", n)
+	}
+	g.limitsMu.Lock()
+	defer g.limitsMu.Unlock()
+
+	if n == 0 {
+		g.captureSlots = nil
+		return nil
+	}
+	g.captureSlots = make(chan struct{}, n)
+	return nil
+}
+
+// limits returns the start concurrency and the capture slots.
+func (g *Groups) limits() (int, chan struct{}) {
+	g.limitsMu.Lock()
+	defer g.limitsMu.Unlock()
+
+	if g.startConcurrency < 1 {
+		return DefaultStartConcurrency, g.captureSlots
+	}
+	return g.startConcurrency, g.captureSlots
+}
+
+// startAll starts each of cmds in grp with the instance ID at the same index in ids,
+// starting no more than the start concurrency at the same time, in the order
+// of their dependencies, see SetDependencies. A command counts as started
+// once it passes its readiness probe, see SetReadinessProbe, and the commands
+// after one that does not are not started.
+// It waits for every command to start before returning the first error, if any.
+func (g *Groups) startAll(ctx context.Context, groupName string, grp *Group, cmds []*exec.Cmd, ids []string) error {
+	order, deps, err := g.startOrder(groupName, cmds)
+	if err != nil {
+		return err
+	}
+	var (
+		n, _     = g.limits()
+		sem      = make(chan struct{}, n)
+		errs     = make([]error, len(cmds))
+		launched = make([]bool, len(cmds))
+		done     = make([]chan struct{}, len(cmds))
+		wg       sync.WaitGroup
+
+		// unready is set once a command has not become ready,
+		// so that the commands after it, which can depend on it, are not started.
+		unready int32
+	)
+	for i := range done {
+		done[i] = make(chan struct{})
+	}
+	for _, i := range order {
+		sem <- struct{}{}
+		wg.Add(1)
+
+		go func(i int, cmd *exec.Cmd) {
+			defer func() {
+				close(done[i])
+				<-sem
+				wg.Done()
+			}()
+			// Dependencies are earlier in the order, so they already have a slot.
+			for _, j := range deps[i] {
+				<-done[j]
+			}
+			if atomic.LoadInt32(&unready) != 0 {
+				return
+			}
+			if errs[i] = ctx.Err(); errs[i] != nil {
+				atomic.StoreInt32(&unready, 1)
+				return
+			}
+			if errs[i] = g.start(cmd, groupName, grp, nil, ids[i]); errs[i] != nil {
+				return
+			}
+			launched[i] = true
+
+			if errs[i] = g.startReady(ctx, groupName, grp, cmd); errs[i] != nil {
+				atomic.StoreInt32(&unready, 1)
+			}
+		}(i, cmds[i])
+	}
+	wg.Wait()
+
+	var (
+		started = []*exec.Cmd{}
+		failed  error
+	)
+	for i, err := range errs {
+		if launched[i] {
+			started = append(started, cmds[i])
+		}
+		if err != nil && failed == nil {
+			failed = errors.Wrap(err, "starting command")
+		}
+	}
+	if failed != nil {
+		return g.abortStart(groupName, grp, started, failed)
+	}
+	return nil
+}
+
+// startReady waits for cmd, which has just started, to pass its readiness probe.
+func (g *Groups) startReady(ctx context.Context, groupName string, grp *Group, cmd *exec.Cmd) error {
+	hash, err := GetCmdID(cmd)
+	if err != nil {
+		return errors.Wrap(err, "getting command ID")
+	}
+	timeout := g.timeouts().Ready
+	return errors.Wrap(grp.waitReady(ctx, g.readinessProbe(groupName, hash), cmd, timeout), "waiting for command to be ready")
+}
+
+// abortStart stops commands that an operation which failed with err started
+// in grp, so that no process keeps running that the rolled back transaction
+// does not record. It returns err.
+func (g *Groups) abortStart(groupName string, grp *Group, cmds []*exec.Cmd, err error) error {
+	if len(cmds) == 0 {
+		return err
+	}
+	if serr := grp.RemoveTimeout(g.timeouts().Remove, cmds...); serr != nil {
+		g.logf("stopping commands started in group %s before %s: %s", groupName, err, serr)
+	}
+	return err
+}
@@ -0,0 +1,49 @@
+package exec_test
+
+import (
+	"os"
+	osexec "os/exec"
+	"path/filepath"
+	"strconv"
+	"testing"
+)
+
+func TestGroupsStartConcurrency(t *testing.T) {
+	var (
+		groupName = "sleepers"
+		root      = filepath.Join("testdata", "."+t.Name())
+	)
+	_ = os.RemoveAll(root)
+
+	gs := newTestGroups(t, root)
+	defer func() { _ = gs.Remove(groupName) }() // Best effort.
+
+	if err := gs.SetStartConcurrency(0); err == nil {
+		t.Fatal("expected an error, got nil")
+	}
+	if err := gs.SetCaptureConcurrency(-1); err == nil {
+		t.Fatal("expected an error, got nil")
+	}
+	if err := gs.SetStartConcurrency(4); err != nil {
+		t.Fatal(err)
+	}
+	if err := gs.SetCaptureConcurrency(2); err != nil {
+		t.Fatal(err)
+	}
+	cmds := []*osexec.Cmd{}
+	for i := 0; i < 10; i++ {
+		cmds = append(cmds, osexec.Command("sleep", "10."+strconv.Itoa(i)))
+	}
+	if err := gs.Create(groupName, cmds...); err != nil {
+		t.Fatal(err)
+	}
+	running, _ := gs.Commands(groupName)
+	if expected, got := len(cmds), len(running); expected != got {
+		t.Fatalf("expected %d commands, got %d", expected, got)
+	}
+	for i, cmd := range cmds {
+		if cmd.Process == nil {
+			t.Fatalf("expected command %d to be started", i)
+		}
+	}
+}
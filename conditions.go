@@ -0,0 +1,157 @@
+package exec
+
+import (
+	"context"
+	"os"
+	"os/exec"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// conditionInterval is the time between checks of the start conditions of a command.
+const conditionInterval = 250 * time.Millisecond
+
+// Condition is something outside of a command that has to hold before the
+// command is started, see SetStartConditions. Exactly one of its fields is set.
+type Condition struct {
+	// FileExists is the path of a file that has to exist.
+	FileExists string `json:"file_exists,omitempty"`
+
+	// TCPAddr is a host:port that has to accept connections.
+	TCPAddr string `json:"tcp_addr,omitempty"`
+
+	// HTTPGet is a URL that has to respond to a GET with status 200.
+	HTTPGet string `json:"http_get,omitempty"`
+
+	// GroupRunning is the name of a group that has to be open
+	// with at least one of its commands running.
+	GroupRunning string `json:"group_running,omitempty"`
+}
+
+// validate returns an error unless exactly one field of the condition is set.
+func (c Condition) validate() error {
+	set := 0
+	for _, field := range []string{c.FileExists, c.TCPAddr, c.HTTPGet, c.GroupRunning} {
+		if field != "" {
+			set++
+		}
+	}
+	if set != 1 {
+		return errors.Errorf("condition %+v must have exactly one field set", c)
+	}
+	return nil
+}
+
+// String describes the condition.
+func (c Condition) String() string {
+	switch {
+	case c.FileExists != "":
+		return "file " + c.FileExists + " exists"
+	case c.TCPAddr != "":
+		return c.TCPAddr + " accepts connections"
+	case c.HTTPGet != "":
+		return c.HTTPGet + " responds with 200"
+	default:
+		return "group " + c.GroupRunning + " is running"
+	}
+}
+
+// SetStartConditions sets the conditions that have to hold before a command
+// is started by Create, Open, or a restart. They are checked until they all
+// hold, and the start fails if they do not within Timeouts.Conditions.
+// Calling it with no conditions removes them.
+// Like readiness probes, conditions are not persisted and must be set every
+// time a Groups is created, before the command is started.
+func (g *Groups) SetStartConditions(groupName string, cmd *exec.Cmd, conds ...Condition) error {
+	for _, c := range conds {
+		if err := c.validate(); err != nil {
+			return err
+		}
+	}
+	commandID, err := GetCmdID(cmd)
+	if err != nil {
+		return errors.Wrap(err, "getting command ID")
+	}
+	g.probesMu.Lock()
+	defer g.probesMu.Unlock()
+
+	if g.conditions[groupName] == nil {
+		g.conditions[groupName] = map[string][]Condition{}
+	}
+	if len(conds) == 0 {
+		delete(g.conditions[groupName], commandID)
+	} else {
+		g.conditions[groupName][commandID] = append([]Condition{}, conds...)
+	}
+	return nil
+}
+
+// startConditions returns the start conditions of the first of the provided
+// command IDs that has any.
+func (g *Groups) startConditions(groupName string, commandIDs ...string) []Condition {
+	g.probesMu.Lock()
+	defer g.probesMu.Unlock()
+
+	for _, commandID := range commandIDs {
+		if conds, ok := g.conditions[groupName][commandID]; ok {
+			return conds
+		}
+	}
+	return nil
+}
+
+// waitConditions waits for the start conditions of cmd to hold.
+func (g *Groups) waitConditions(groupName string, cmd *exec.Cmd) error {
+	hash, err := GetCmdID(cmd)
+	if err != nil {
+		return errors.Wrap(err, "getting command ID")
+	}
+	conds := g.startConditions(groupName, hash)
+	if len(conds) == 0 {
+		return nil
+	}
+	timeout := g.timeouts().Conditions
+
+	ctx, cancel := withClockTimeout(context.Background(), g.clock, timeout)
+	defer cancel()
+
+	for _, c := range conds {
+		for {
+			err := g.checkCondition(ctx, c)
+			if err == nil {
+				break
+			}
+			select {
+			case <-ctx.Done():
+				return errors.Wrapf(err, "waiting for %s: timeout after %s", c, timeout)
+			case <-g.clock.After(conditionInterval):
+			}
+		}
+	}
+	return nil
+}
+
+// checkCondition returns nil if c holds.
+func (g *Groups) checkCondition(ctx context.Context, c Condition) error {
+	switch {
+	case c.FileExists != "":
+		_, err := os.Stat(c.FileExists)
+		return err
+	case c.TCPAddr != "":
+		return dialTCP(ctx, c.TCPAddr)
+	case c.HTTPGet != "":
+		return httpGet(ctx, c.HTTPGet)
+	default:
+		grp := g.getGroup(c.GroupRunning)
+		if grp == nil {
+			return errors.Errorf("group %s is not open", c.GroupRunning)
+		}
+		for _, status := range grp.Statuses() {
+			if status.State == StateRunning {
+				return nil
+			}
+		}
+		return errors.Errorf("group %s has no running commands", c.GroupRunning)
+	}
+}
@@ -0,0 +1,70 @@
+package exec_test
+
+import (
+	"io/ioutil"
+	"net"
+	"os"
+	osexec "os/exec"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/scgolang/exec"
+)
+
+func TestGroupsStartConditions(t *testing.T) {
+	var (
+		groupName = "waiter"
+		root      = filepath.Join("testdata", "."+t.Name())
+		flag      = filepath.Join(root, "ready")
+	)
+	_ = os.RemoveAll(root)
+
+	gs := newTestGroups(t, root)
+	cmd := osexec.Command("sleep", "10")
+
+	if err := gs.SetStartConditions(groupName, cmd, exec.Condition{FileExists: flag}); err != nil {
+		t.Fatal(err)
+	}
+	created := make(chan error, 1)
+	go func() { created <- gs.Create(groupName, cmd) }()
+
+	select {
+	case err := <-created:
+		t.Fatalf("expected Create to wait for %s, got %v", flag, err)
+	case <-time.After(500 * time.Millisecond):
+	}
+	if err := ioutil.WriteFile(flag, nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case err := <-created:
+		if err != nil {
+			t.Fatal(err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("timeout waiting for Create")
+	}
+	defer func() { _ = gs.Remove(groupName) }()
+
+	// A port that nothing listens on.
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := l.Addr().String()
+	_ = l.Close()
+
+	gs.SetTimeouts(exec.Timeouts{Conditions: 300 * time.Millisecond})
+	other := osexec.Command("sleep", "9")
+
+	if err := gs.SetStartConditions(groupName, other, exec.Condition{TCPAddr: addr}, exec.Condition{GroupRunning: groupName}); err != nil {
+		t.Fatal(err)
+	}
+	if err := gs.Create(groupName, other); err == nil {
+		t.Fatalf("expected an error since nothing listens on %s", addr)
+	}
+	if err := gs.SetStartConditions(groupName, other, exec.Condition{}); err == nil {
+		t.Fatal("expected an error for an empty condition")
+	}
+}
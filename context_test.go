@@ -0,0 +1,105 @@
+package exec_test
+
+import (
+	"context"
+	"os"
+	osexec "os/exec"
+	"path/filepath"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/scgolang/exec"
+)
+
+func TestGroupStartContext(t *testing.T) {
+	var (
+		g           = exec.NewGroup()
+		ctx, cancel = context.WithCancel(context.Background())
+	)
+	if err := g.StartContext(ctx, osexec.Command("sleep", "10")); err != nil {
+		t.Fatal(err)
+	}
+	cancel()
+
+	waitCtx, waitCancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer waitCancel()
+
+	err := g.WaitContext(waitCtx)
+	if _, ok := err.(exec.CmdError); !ok {
+		t.Fatalf("expected the command to be killed, got %v", err)
+	}
+	if err := g.StartContext(ctx, osexec.Command("sleep", "10")); err != context.Canceled {
+		t.Fatalf("expected %s, got %v", context.Canceled, err)
+	}
+}
+
+func TestGroupsCreateContext(t *testing.T) {
+	var (
+		groupName = "cancelled"
+		root      = filepath.Join("testdata", "."+t.Name())
+	)
+	_ = os.RemoveAll(root)
+
+	gs, err := exec.New(root, exec.WithDBFile("groups.db"), exec.WithTimeouts(exec.Timeouts{Ready: time.Minute}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	cmd := osexec.Command("sleep", "10")
+
+	if err := gs.SetReadinessProbe(groupName, cmd, gs.LogProbe(groupName, regexp.MustCompile("never"))); err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+	defer cancel()
+
+	start := time.Now()
+	if err := gs.CreateContext(ctx, groupName, cmd); err == nil {
+		_ = gs.Remove(groupName)
+		t.Fatal("expected an error")
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Fatalf("expected CreateContext to give up when ctx was done, took %s", elapsed)
+	}
+	if _, ok := gs.Commands(groupName); ok {
+		t.Fatal("expected the group not to be created")
+	}
+	cmds, err := gs.OpenContext(context.Background(), groupName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected, got := 0, len(cmds); expected != got {
+		t.Fatalf("expected %d stored commands, got %d", expected, got)
+	}
+}
+
+func TestGroupsWaitContext(t *testing.T) {
+	var (
+		groupName = "waited"
+		root      = filepath.Join("testdata", "."+t.Name())
+	)
+	_ = os.RemoveAll(root)
+
+	var (
+		gs  = newTestGroups(t, root)
+		cmd = osexec.Command("sleep", "10")
+	)
+	if err := gs.Create(groupName, cmd); err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+
+	if err := gs.WaitContext(ctx, groupName); err != context.DeadlineExceeded {
+		t.Fatalf("expected %s, got %v", context.DeadlineExceeded, err)
+	}
+	closeCtx, closeCancel := context.WithCancel(context.Background())
+	closeCancel()
+
+	if err := gs.CloseContext(closeCtx, groupName); err != context.Canceled {
+		t.Fatalf("expected %s, got %v", context.Canceled, err)
+	}
+	if cmd.ProcessState == nil {
+		t.Fatal("expected the command to be killed")
+	}
+}
@@ -0,0 +1,164 @@
+package exec
+
+import (
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// CoreDumps returns the paths of the core files that a command dumped,
+// oldest first, see WithCoreDumps. They are in the directory of the group,
+// next to the log files of the command, named <instance ID>.core.<pid>.
+func (g *Groups) CoreDumps(groupName string, cmd *exec.Cmd) ([]string, error) {
+	commandID, err := g.cmdID(groupName, cmd)
+	if err != nil {
+		return nil, errors.Wrap(err, "getting command ID")
+	}
+	paths, err := filepath.Glob(filepath.Join(g.root, groupName, commandID+".core.*"))
+	if err != nil {
+		return nil, err
+	}
+	infos := map[string]time.Time{}
+	for _, path := range paths {
+		if info, err := os.Stat(path); err == nil {
+			infos[path] = info.ModTime()
+		}
+	}
+	sort.Slice(paths, func(i, j int) bool { return infos[paths[i]].Before(infos[paths[j]]) })
+	return paths, nil
+}
+
+// allowCoreDumps raises the core file size limit of the process of a command
+// that was just started to its hard limit, if core dumps are enabled.
+func (g *Groups) allowCoreDumps(grp *Group, cmd *exec.Cmd, groupName string) {
+	if !g.coreDumps {
+		return
+	}
+	if err := setCoreLimit(grp.pid(cmd)); err != nil {
+		g.logf("allowing core dumps of %s in group %s: %s", cmd.Path, groupName, err)
+	}
+}
+
+// collectCore moves the core file that a command dumped, if it dumped one,
+// into the directory of its group, see CoreDumps. Core files that the kernel
+// pipes to a program, see core(5), can not be collected.
+func (g *Groups) collectCore(groupName, commandID string, cmd *exec.Cmd, pid int, started time.Time, err error) {
+	if !g.coreDumps || !coreDumped(err) {
+		return
+	}
+	pattern, err := corePattern()
+	if err != nil {
+		g.logf("reading core pattern: %s", err)
+		return
+	}
+	if strings.HasPrefix(pattern, "|") {
+		g.logf("core dump of %s in group %s was piped to %s", commandID, groupName, strings.TrimPrefix(pattern, "|"))
+		return
+	}
+	glob := corePatternGlob(pattern, pid)
+
+	if !filepath.IsAbs(glob) {
+		// Core files are dumped in the working directory of the process.
+		dir, err := filepath.Abs(cmd.Dir)
+		if err != nil {
+			g.logf("finding core dump of %s in group %s: %s", commandID, groupName, err)
+			return
+		}
+		glob = filepath.Join(dir, glob)
+	}
+	paths, err := filepath.Glob(glob)
+	if err != nil {
+		g.logf("finding core dump of %s in group %s: %s", commandID, groupName, err)
+		return
+	}
+	var (
+		core     string
+		modified time.Time
+	)
+	for _, path := range paths {
+		info, err := os.Stat(path)
+		if err != nil || info.IsDir() || info.ModTime().Before(started.Add(-time.Second)) {
+			continue // Not dumped by this process.
+		}
+		if core == "" || info.ModTime().After(modified) {
+			core, modified = path, info.ModTime()
+		}
+	}
+	if core == "" {
+		g.logf("core dump of %s in group %s not found at %s", commandID, groupName, glob)
+		return
+	}
+	dst := filepath.Join(g.root, groupName, commandID+".core."+strconv.Itoa(pid))
+	if err := moveFile(core, dst); err != nil {
+		g.logf("collecting core dump %s: %s", core, err)
+	}
+}
+
+// corePatternGlob returns a glob that matches the core files of the process with
+// the provided ID, named after pattern, see core(5). Specifiers that depend on
+// more than the process ID match anything.
+func corePatternGlob(pattern string, pid int) string {
+	var (
+		glob strings.Builder
+		p    = strconv.Itoa(pid)
+	)
+	for i := 0; i < len(pattern); i++ {
+		if pattern[i] != '%' || i == len(pattern)-1 {
+			glob.WriteByte(pattern[i])
+			continue
+		}
+		i++
+		switch pattern[i] {
+		case '%':
+			glob.WriteByte('%')
+		case 'p', 'P':
+			glob.WriteString(p)
+		default:
+			glob.WriteByte('*')
+		}
+	}
+	return glob.String()
+}
+
+// coreDumped returns true if err is the error of a command that dumped core.
+func coreDumped(err error) bool {
+	ee, ok := errors.Cause(err).(*exec.ExitError)
+	if !ok {
+		return false
+	}
+	ws, ok := ee.Sys().(syscall.WaitStatus)
+	return ok && ws.CoreDump()
+}
+
+// moveFile moves a file, copying it if it is on another file system.
+func moveFile(src, dst string) error {
+	if err := os.Rename(src, dst); err == nil {
+		return nil
+	}
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = in.Close() }() // Best effort.
+
+	out, err := os.OpenFile(dst, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, in); err != nil {
+		_ = out.Close()
+		return err
+	}
+	if err := out.Close(); err != nil {
+		return err
+	}
+	return os.Remove(src)
+}
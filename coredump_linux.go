@@ -0,0 +1,46 @@
+//go:build linux
+// +build linux
+
+package exec
+
+import (
+	"io/ioutil"
+	"strings"
+	"syscall"
+	"unsafe"
+)
+
+// coreDumpsSupported is true if the core dumps of commands can be collected, see WithCoreDumps.
+const coreDumpsSupported = true
+
+// setCoreLimit raises the soft core file size limit of a process to its hard
+// limit, which does not need privileges, with prlimit(2).
+func setCoreLimit(pid int) error {
+	var lim syscall.Rlimit
+	if _, _, errno := syscall.RawSyscall6(syscall.SYS_PRLIMIT64, uintptr(pid), syscall.RLIMIT_CORE, 0, uintptr(unsafe.Pointer(&lim)), 0, 0); errno != 0 {
+		return errno
+	}
+	lim.Cur = lim.Max
+
+	if _, _, errno := syscall.RawSyscall6(syscall.SYS_PRLIMIT64, uintptr(pid), syscall.RLIMIT_CORE, uintptr(unsafe.Pointer(&lim)), 0, 0, 0); errno != 0 {
+		return errno
+	}
+	return nil
+}
+
+// corePattern returns how the kernel names core files, see core(5).
+// Without %p in the pattern, core_uses_pid makes the kernel append the process ID.
+func corePattern() (string, error) {
+	data, err := ioutil.ReadFile("/proc/sys/kernel/core_pattern")
+	if err != nil {
+		return "", err
+	}
+	pattern := strings.TrimSpace(string(data))
+
+	if usesPid, err := ioutil.ReadFile("/proc/sys/kernel/core_uses_pid"); err == nil && strings.TrimSpace(string(usesPid)) == "1" {
+		if !strings.HasPrefix(pattern, "|") && !strings.Contains(pattern, "%p") {
+			pattern += ".%p"
+		}
+	}
+	return pattern, nil
+}
@@ -0,0 +1,69 @@
+package exec_test
+
+import (
+	"io/ioutil"
+	"os"
+	osexec "os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/scgolang/exec"
+)
+
+func TestGroupsCoreDumps(t *testing.T) {
+	pattern, err := ioutil.ReadFile("/proc/sys/kernel/core_pattern")
+	if err != nil {
+		t.Skip(err)
+	}
+	if strings.HasPrefix(string(pattern), "|") {
+		t.Skip("core dumps are piped to " + strings.TrimSpace(string(pattern[1:])))
+	}
+	var (
+		groupName = "crashing"
+		root      = filepath.Join("testdata", "."+t.Name())
+		dir       = filepath.Join(root, "cwd")
+	)
+	_ = os.RemoveAll(root)
+
+	if err := os.MkdirAll(dir, exec.DirPerms); err != nil {
+		t.Fatal(err)
+	}
+	gs, err := exec.New(filepath.Join(root, "groups"), exec.WithCoreDumps())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = gs.Remove(groupName) }() // Best effort.
+
+	// The command waits for its core file size limit to be raised before it crashes.
+	cmd := osexec.Command("sh", "-c", "sleep 0.2; kill -SEGV $$")
+	cmd.Dir = dir
+
+	if err := gs.Create(groupName, cmd); err != nil {
+		t.Fatal(err)
+	}
+	if err := gs.Wait(groupName); err == nil {
+		t.Fatal("expected the command to fail")
+	}
+	cores, err := gs.CoreDumps(groupName, cmd)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected, got := 1, len(cores); expected != got {
+		t.Skipf("expected %d core dump, got %d (core dumps may be disabled on this host)", expected, got)
+	}
+	groupDir, err := filepath.Abs(filepath.Join(root, "groups", groupName))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected, got := groupDir, filepath.Dir(cores[0]); expected != got {
+		t.Fatalf("expected the core dump in %s, got %s", expected, got)
+	}
+	leftover, err := filepath.Glob(filepath.Join(dir, "core*"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected, got := 0, len(leftover); expected != got {
+		t.Fatalf("expected %d core files left in the working directory, got %v", expected, leftover)
+	}
+}
@@ -0,0 +1,19 @@
+//go:build !linux
+// +build !linux
+
+package exec
+
+import "github.com/pkg/errors"
+
+// coreDumpsSupported is true if the core dumps of commands can be collected, see WithCoreDumps.
+const coreDumpsSupported = false
+
+// setCoreLimit returns an error, since core dumps are only collected on Linux.
+func setCoreLimit(pid int) error {
+	return errors.New("core dumps are only supported on linux")
+}
+
+// corePattern returns an error, since core dumps are only collected on Linux.
+func corePattern() (string, error) {
+	return "", errors.New("core dumps are only supported on linux")
+}
@@ -0,0 +1,41 @@
+//go:build linux
+// +build linux
+
+package exec
+
+import (
+	"io/ioutil"
+	"strconv"
+	"strings"
+)
+
+// processCPUTicks returns the CPU time that the process with the provided ID
+// has used in user and system mode, in clock ticks.
+// It returns false if the process can not be found.
+func processCPUTicks(pid int) (uint64, bool) {
+	data, err := ioutil.ReadFile("/proc/" + strconv.Itoa(pid) + "/stat")
+	if err != nil {
+		return 0, false
+	}
+	// The command name is in parentheses and can contain spaces,
+	// so the fields are counted from after it.
+	stat := string(data)
+	paren := strings.LastIndexByte(stat, ')')
+	if paren < 0 {
+		return 0, false
+	}
+	// utime and stime are the 14th and 15th fields, the state is the 3rd.
+	fields := strings.Fields(stat[paren+1:])
+	if len(fields) < 13 {
+		return 0, false
+	}
+	utime, err := strconv.ParseUint(fields[11], 10, 64)
+	if err != nil {
+		return 0, false
+	}
+	stime, err := strconv.ParseUint(fields[12], 10, 64)
+	if err != nil {
+		return 0, false
+	}
+	return utime + stime, true
+}
@@ -0,0 +1,9 @@
+//go:build !linux
+// +build !linux
+
+package exec
+
+// processCPUTicks returns false, since CPU time is only sampled on Linux.
+func processCPUTicks(pid int) (uint64, bool) {
+	return 0, false
+}
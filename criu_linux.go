@@ -0,0 +1,120 @@
+//go:build linux
+// +build linux
+
+package exec
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// CRIUPath is the criu binary used by Checkpoint and Restore.
+var CRIUPath = "criu"
+
+// checkpointDir returns the directory that holds the checkpoint images of a command.
+func (g *Groups) checkpointDir(groupName, commandID string) string {
+	return filepath.Join(g.root, groupName, "checkpoints", commandID)
+}
+
+// Checkpoint dumps the process tree of a running command to disk with CRIU,
+// so that it can be brought back later with Restore, possibly after a reboot.
+// If leaveRunning is false the process stops running once it has been dumped.
+//
+// This is experimental: criu must be installed and the calling process needs
+// the privileges criu requires (usually root or CAP_CHECKPOINT_RESTORE).
+// Because the output of commands is captured through pipes, criu has to be
+// configured to treat those pipes as external, for example in criu.conf.
+func (g *Groups) Checkpoint(groupName string, cmd *exec.Cmd, leaveRunning bool) error {
+	grp := g.getGroup(groupName)
+	if grp == nil {
+		return errors.Errorf("group %s not found", groupName)
+	}
+	commandID, err := g.cmdID(groupName, cmd)
+	if err != nil {
+		return errors.Wrap(err, "getting command ID")
+	}
+	running := grp.lookup(commandID)
+	if running == nil {
+		return errors.Errorf("command %s not found in group %s", commandID, groupName)
+	}
+	// Checkpoints are keyed by definition rather than instance,
+	// so that Restore can find them after a reboot.
+	hash, err := GetCmdID(cmd)
+	if err != nil {
+		return errors.Wrap(err, "getting command ID")
+	}
+	dir := g.checkpointDir(groupName, hash)
+
+	if err := os.RemoveAll(dir); err != nil {
+		return errors.Wrap(err, "removing old checkpoint")
+	}
+	if err := os.MkdirAll(dir, g.dirPerms); err != nil {
+		return errors.Wrap(err, "creating checkpoint directory")
+	}
+	args := []string{
+		"dump",
+		"--tree", strconv.Itoa(grp.pid(running)),
+		"--images-dir", dir,
+		"--shell-job",
+	}
+	if leaveRunning {
+		args = append(args, "--leave-running")
+	} else {
+		// Retired before the dump, since the process exits once it is dumped.
+		grp.retire(running)
+	}
+	if err := runCRIU(args...); err != nil {
+		if !leaveRunning {
+			grp.unretire(running) // criu resumes the process if the dump fails.
+		}
+		return errors.Wrap(err, "dumping process")
+	}
+	if !leaveRunning {
+		if exited, ok := grp.exitedChan(running); ok {
+			<-exited
+		}
+		grp.drop(running)
+	}
+	return nil
+}
+
+// Restore restores a command from the images written by Checkpoint.
+// The restored process tree is a child of a criu process that is started
+// as a new command in the group, so the group supervises it and captures
+// its output like any other command. The returned command is that criu process.
+func (g *Groups) Restore(groupName string, cmd *exec.Cmd) (*exec.Cmd, error) {
+	grp := g.getGroup(groupName)
+	if grp == nil {
+		return nil, errors.Errorf("group %s not found", groupName)
+	}
+	commandID, err := GetCmdID(cmd)
+	if err != nil {
+		return nil, errors.Wrap(err, "getting command ID")
+	}
+	dir := g.checkpointDir(groupName, commandID)
+
+	if _, err := os.Stat(dir); err != nil {
+		return nil, errors.Wrap(err, "finding checkpoint")
+	}
+	restore := exec.Command(CRIUPath, "restore", "--images-dir", dir, "--shell-job")
+
+	if err := g.start(restore, groupName, grp, nil, ""); err != nil {
+		return nil, errors.Wrap(err, "starting criu restore")
+	}
+	return restore, nil
+}
+
+// runCRIU runs criu with the provided arguments.
+func runCRIU(args ...string) error {
+	out, err := exec.Command(CRIUPath, args...).CombinedOutput()
+	if err != nil {
+		return errors.Wrap(err, fmt.Sprintf("criu %s: %s", args[0], strings.TrimSpace(string(out))))
+	}
+	return nil
+}
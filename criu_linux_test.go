@@ -0,0 +1,38 @@
+package exec_test
+
+import (
+	"os"
+	osexec "os/exec"
+	"path/filepath"
+	"testing"
+
+	"github.com/scgolang/exec"
+)
+
+func TestGroupsCheckpointFails(t *testing.T) {
+	var (
+		groupName = "dumped"
+		root      = filepath.Join("testdata", "."+t.Name())
+	)
+	_ = os.RemoveAll(root)
+
+	criuPath := exec.CRIUPath
+	exec.CRIUPath = "false" // Every dump fails.
+	defer func() { exec.CRIUPath = criuPath }()
+
+	gs := newTestGroups(t, root)
+	cmd := osexec.Command("sleep", "0.2")
+
+	if err := gs.Create(groupName, cmd); err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = gs.Remove(groupName) }()
+
+	if err := gs.Checkpoint(groupName, cmd, false); err == nil {
+		t.Fatal("expected an error, got nil")
+	}
+	// The command was not dumped, so its exit is still reported.
+	if err := gs.Wait(groupName); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,20 @@
+//go:build !linux
+// +build !linux
+
+package exec
+
+import (
+	"os/exec"
+
+	"github.com/pkg/errors"
+)
+
+// Checkpoint is only supported on Linux.
+func (g *Groups) Checkpoint(groupName string, cmd *exec.Cmd, leaveRunning bool) error {
+	return errors.New("checkpoint is only supported on linux")
+}
+
+// Restore is only supported on Linux.
+func (g *Groups) Restore(groupName string, cmd *exec.Cmd) (*exec.Cmd, error) {
+	return nil, errors.New("restore is only supported on linux")
+}
@@ -0,0 +1,23 @@
+package exec
+
+import (
+	"os/exec"
+	"syscall"
+)
+
+// SetDeathSignal makes the process of cmd get sig, usually SIGTERM or
+// SIGKILL, if the manager exits without stopping it, for example because it
+// crashed, so that no process outlives a manager that it can not run without.
+// Like jails, death signals are kept when a command is stored, so they are
+// set again when the group is opened. Zero leaves cmd as it is, and only
+// Linux supports other signals.
+//
+// The kernel sends the signal when the thread that started the process
+// exits, which for Go programs is when the manager exits, unless the
+// command was started by a goroutine that locked its OS thread and exited,
+// or when the manager replaces itself with exec, so Reexec refuses to hand
+// off commands with a death signal.
+// Detached commands can not have a death signal, see WithDetach.
+func SetDeathSignal(cmd *exec.Cmd, sig syscall.Signal) error {
+	return setCmdDeathSignal(cmd, sig)
+}
@@ -0,0 +1,31 @@
+//go:build linux
+// +build linux
+
+package exec
+
+import (
+	"os/exec"
+	"syscall"
+)
+
+// cmdDeathSignal returns the signal that the process of cmd gets when the
+// manager exits, or zero if it does not get one.
+func cmdDeathSignal(cmd *exec.Cmd) syscall.Signal {
+	if cmd.SysProcAttr == nil {
+		return 0
+	}
+	return cmd.SysProcAttr.Pdeathsig
+}
+
+// setCmdDeathSignal makes the process of cmd get sig when the manager exits,
+// with PR_SET_PDEATHSIG. Zero leaves cmd as it is.
+func setCmdDeathSignal(cmd *exec.Cmd, sig syscall.Signal) error {
+	if sig == 0 {
+		return nil
+	}
+	if cmd.SysProcAttr == nil {
+		cmd.SysProcAttr = &syscall.SysProcAttr{}
+	}
+	cmd.SysProcAttr.Pdeathsig = sig
+	return nil
+}
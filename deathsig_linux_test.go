@@ -0,0 +1,57 @@
+package exec_test
+
+import (
+	"os"
+	osexec "os/exec"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"testing"
+
+	"github.com/scgolang/exec"
+)
+
+func TestGroupsDeathSignal(t *testing.T) {
+	var (
+		groupName = "coupled"
+		root      = filepath.Join("testdata", "."+t.Name())
+	)
+	_ = os.RemoveAll(root)
+
+	gs := newTestGroups(t, root)
+	cmd := osexec.Command("sleep", "10")
+
+	if err := exec.SetDeathSignal(cmd, syscall.SIGKILL); err != nil {
+		t.Fatal(err)
+	}
+	if err := gs.Create(groupName, cmd); err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = gs.Remove(groupName) }()
+
+	// Exec would kill the command, so it can not be handed off.
+	if err := gs.Reexec("/nonexistent", nil); err == nil || !strings.Contains(err.Error(), "death signal") {
+		t.Fatalf("expected an error about the death signal, got %v", err)
+	}
+	_ = gs.Close(groupName) // The sleep is killed.
+
+	cmds, err := gs.Open(groupName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(cmds) != 1 || cmds[0].SysProcAttr == nil || cmds[0].SysProcAttr.Pdeathsig != syscall.SIGKILL {
+		t.Fatalf("expected the opened command to keep its death signal, got %+v", cmds)
+	}
+	// Detached commands outlive the manager, so they can not have a death signal.
+	detached, err := exec.New(filepath.Join(root, "detached"), exec.WithDetach())
+	if err != nil {
+		t.Fatal(err)
+	}
+	other := osexec.Command("sleep", "9")
+	if err := exec.SetDeathSignal(other, syscall.SIGTERM); err != nil {
+		t.Fatal(err)
+	}
+	if err := detached.Create(groupName, other); err == nil {
+		t.Fatal("expected an error, got nil")
+	}
+}
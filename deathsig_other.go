@@ -0,0 +1,25 @@
+//go:build !linux
+// +build !linux
+
+package exec
+
+import (
+	"os/exec"
+	"syscall"
+
+	"github.com/pkg/errors"
+)
+
+// cmdDeathSignal returns zero, since only Linux has parent death signals.
+func cmdDeathSignal(cmd *exec.Cmd) syscall.Signal {
+	return 0
+}
+
+// setCmdDeathSignal returns an error unless sig is zero,
+// since only Linux has parent death signals.
+func setCmdDeathSignal(cmd *exec.Cmd, sig syscall.Signal) error {
+	if sig == 0 {
+		return nil
+	}
+	return errors.New("parent death signals are only supported on linux")
+}
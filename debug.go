@@ -0,0 +1,145 @@
+package exec
+
+import (
+	"encoding/json"
+	"net/http"
+	"runtime"
+	"runtime/pprof"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// maxCPUProfile is the longest CPU profile that DebugHandler records.
+const maxCPUProfile = 60 * time.Second
+
+// Diagnostics are runtime statistics of the process that runs Groups,
+// alongside counts of what Groups is supervising, so that a leak in the
+// capture or supervision machinery can be told apart from a growing workload.
+type Diagnostics struct {
+	Goroutines  int    `json:"goroutines"`
+	HeapAlloc   uint64 `json:"heap_alloc"`
+	HeapObjects uint64 `json:"heap_objects"`
+	HeapSys     uint64 `json:"heap_sys"`
+	NumGC       uint32 `json:"num_gc"`
+
+	// Groups is the number of open groups and Commands the number of commands in them.
+	Groups   int `json:"groups"`
+	Commands int `json:"commands"`
+
+	// Captures is the number of output streams being copied to log files,
+	// two for every command that is running.
+	Captures int `json:"captures"`
+
+	// RunsQueued is the number of state changes waiting to be recorded in the run history.
+	RunsQueued int `json:"runs_queued"`
+
+	// JobsQueued is the number of jobs waiting to run, see Enqueue.
+	JobsQueued int `json:"jobs_queued"`
+}
+
+// Diagnostics returns runtime statistics of the process and of the groups.
+// It reads the memory statistics of the runtime, which stops the world briefly.
+func (g *Groups) Diagnostics() Diagnostics {
+	var mem runtime.MemStats
+	runtime.ReadMemStats(&mem)
+
+	d := Diagnostics{
+		Goroutines:  runtime.NumGoroutine(),
+		HeapAlloc:   mem.HeapAlloc,
+		HeapObjects: mem.HeapObjects,
+		HeapSys:     mem.HeapSys,
+		NumGC:       mem.NumGC,
+		RunsQueued:  len(g.runs),
+		JobsQueued:  g.jobs.queued(),
+	}
+	g.groupsMu.RLock()
+	for _, grp := range g.groups {
+		d.Groups++
+		d.Commands += len(grp.Commands())
+	}
+	g.groupsMu.RUnlock()
+
+	g.captureHealth.mu.Lock()
+	d.Captures = g.captureHealth.active
+	g.captureHealth.mu.Unlock()
+
+	return d
+}
+
+// DebugOptions configure the handler returned by DebugHandler.
+type DebugOptions struct {
+	// Profiles serves the profiles of the runtime, see DebugHandler.
+	Profiles bool
+}
+
+// DebugHandler returns an HTTP handler for diagnosing Groups in production,
+// meant to be mounted on a server at /debug/.
+// /debug/exec responds with Diagnostics as JSON.
+// If opts.Profiles is true, /debug/pprof/<name> serves the runtime profile
+// with that name, e.g. goroutine or heap, in the format read by go tool pprof,
+// or as text with ?debug=1, and /debug/pprof/profile records a CPU profile
+// for ?seconds=N, 30 by default.
+// Profiles are served with runtime/pprof rather than net/http/pprof, so
+// that importing this package does not register handlers on http.DefaultServeMux.
+func (g *Groups) DebugHandler(opts DebugOptions) http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/debug/exec", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(g.Diagnostics()) // Best effort.
+	})
+	if opts.Profiles {
+		mux.HandleFunc("/debug/pprof/", serveProfile)
+	}
+	return mux
+}
+
+// serveProfile serves a runtime profile, see DebugHandler.
+func serveProfile(w http.ResponseWriter, r *http.Request) {
+	name := strings.TrimPrefix(r.URL.Path, "/debug/pprof/")
+	if name == "profile" {
+		serveCPUProfile(w, r)
+		return
+	}
+	profile := pprof.Lookup(name)
+	if profile == nil {
+		http.Error(w, "unknown profile "+name, http.StatusNotFound)
+		return
+	}
+	debug, _ := strconv.Atoi(r.FormValue("debug"))
+	if debug == 0 {
+		w.Header().Set("Content-Type", "application/octet-stream")
+	} else {
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	}
+	_ = profile.WriteTo(w, debug) // Best effort.
+}
+
+// serveCPUProfile records a CPU profile and serves it.
+func serveCPUProfile(w http.ResponseWriter, r *http.Request) {
+	d := 30 * time.Second
+	if s := r.FormValue("seconds"); s != "" {
+		secs, err := strconv.Atoi(s)
+		if err != nil || secs <= 0 {
+			http.Error(w, "seconds must be a positive integer", http.StatusBadRequest)
+			return
+		}
+		d = time.Duration(secs) * time.Second
+	}
+	if d > maxCPUProfile {
+		d = maxCPUProfile
+	}
+	w.Header().Set("Content-Type", "application/octet-stream")
+	if err := pprof.StartCPUProfile(w); err != nil {
+		http.Error(w, "starting CPU profile: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	t := time.NewTimer(d)
+	defer t.Stop()
+
+	select {
+	case <-t.C:
+	case <-r.Context().Done():
+	}
+	pprof.StopCPUProfile()
+}
@@ -0,0 +1,62 @@
+package exec_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	osexec "os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/scgolang/exec"
+)
+
+func TestGroupsDebugHandler(t *testing.T) {
+	var (
+		groupName = "sleepers"
+		root      = filepath.Join("testdata", "."+t.Name())
+	)
+	_ = os.RemoveAll(root)
+
+	gs := newTestGroups(t, root)
+	defer func() { _ = gs.Remove(groupName) }() // Best effort.
+
+	if err := gs.Create(groupName, osexec.Command("sleep", "10"), osexec.Command("sleep", "11")); err != nil {
+		t.Fatal(err)
+	}
+	handler := gs.DebugHandler(exec.DebugOptions{Profiles: true})
+
+	rec := serveDebug(handler, "/debug/exec", http.StatusOK, t)
+	var d exec.Diagnostics
+	if err := json.NewDecoder(rec.Body).Decode(&d); err != nil {
+		t.Fatal(err)
+	}
+	if expected, got := 1, d.Groups; expected != got {
+		t.Fatalf("expected %d groups, got %d", expected, got)
+	}
+	if expected, got := 2, d.Commands; expected != got {
+		t.Fatalf("expected %d commands, got %d", expected, got)
+	}
+	if d.Goroutines == 0 {
+		t.Fatal("expected goroutines to be counted")
+	}
+	rec = serveDebug(handler, "/debug/pprof/goroutine?debug=1", http.StatusOK, t)
+	if !strings.Contains(rec.Body.String(), "goroutine profile") {
+		t.Fatalf("expected a goroutine profile, got %q", rec.Body.String())
+	}
+	serveDebug(handler, "/debug/pprof/nope", http.StatusNotFound, t)
+	serveDebug(handler, "/debug/pprof/profile?seconds=x", http.StatusBadRequest, t)
+	serveDebug(gs.DebugHandler(exec.DebugOptions{}), "/debug/pprof/heap", http.StatusNotFound, t)
+}
+
+func serveDebug(handler http.Handler, target string, status int, t *testing.T) *httptest.ResponseRecorder {
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest("GET", target, nil))
+
+	if expected, got := status, rec.Code; expected != got {
+		t.Fatalf("expected status %d for %s, got %d", expected, target, got)
+	}
+	return rec
+}
@@ -0,0 +1,227 @@
+package exec
+
+import (
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"os/exec"
+	"strconv"
+	"syscall"
+
+	"github.com/pkg/errors"
+)
+
+// DefinitionVersion is the version of the group definitions written by Export.
+const DefinitionVersion = 1
+
+// Format is an encoding of group definitions.
+type Format string
+
+// Group definition formats.
+const (
+	FormatJSON Format = "json"
+	FormatYAML Format = "yaml"
+)
+
+// GroupSpec is the declarative definition of a group, see Export.
+type GroupSpec struct {
+	Version int    `json:"version"`
+	Group   string `json:"group"`
+
+	// Quota is the quota of the group, nil if it does not have one.
+	Quota *Quota `json:"quota,omitempty"`
+
+	Commands []CommandSpec `json:"commands"`
+}
+
+// Export writes the definition of the commands stored with a group to w,
+// in a format that Import reads back. The group does not have to be open.
+// Environments are written in the clear, even if they are encrypted at rest.
+func (g *Groups) Export(groupName string, format Format, w io.Writer) error {
+	tx, err := g.db.Begin()
+	if err != nil {
+		return errors.Wrap(err, "starting transaction")
+	}
+	defer func() { _ = tx.Rollback() }() // Read only.
+
+	stored, err := g.getStoredSpecsTx(tx, groupName)
+	if err != nil {
+		return err
+	}
+	spec := GroupSpec{
+		Version:  DefinitionVersion,
+		Group:    groupName,
+		Commands: make([]CommandSpec, len(stored)),
+	}
+	for i, ss := range stored {
+		spec.Commands[i] = ss.spec
+	}
+	q, err := g.getQuotaTx(tx, groupName)
+	if err != nil {
+		return err
+	}
+	if q != (Quota{}) {
+		spec.Quota = &q
+	}
+	var data []byte
+
+	switch format {
+	default:
+		return errors.Errorf("unknown format %s", format)
+	case FormatJSON:
+		if data, err = json.MarshalIndent(spec, "", "\t"); err != nil {
+			return errors.Wrap(err, "encoding definition")
+		}
+		data = append(data, '\n')
+	case FormatYAML:
+		if data, err = encodeYAML(spec); err != nil {
+			return errors.Wrap(err, "encoding definition")
+		}
+	}
+	_, err = w.Write(data)
+	return err
+}
+
+// Import reads a group definition that was written by Export.
+// It does not change anything, see Apply.
+func Import(r io.Reader, format Format) (GroupSpec, error) {
+	data, err := ioutil.ReadAll(r)
+	if err != nil {
+		return GroupSpec{}, errors.Wrap(err, "reading definition")
+	}
+	switch format {
+	default:
+		return GroupSpec{}, errors.Errorf("unknown format %s", format)
+	case FormatJSON:
+	case FormatYAML:
+		if data, err = yamlToJSON(data); err != nil {
+			return GroupSpec{}, errors.Wrap(err, "decoding YAML")
+		}
+	}
+	var spec GroupSpec
+	if err := json.Unmarshal(data, &spec); err != nil {
+		return GroupSpec{}, errors.Wrap(err, "decoding definition")
+	}
+	if spec.Version < 1 || spec.Version > DefinitionVersion {
+		return GroupSpec{}, errors.Errorf("unsupported definition version %d", spec.Version)
+	}
+	if spec.Group == "" {
+		return GroupSpec{}, errors.New("definition does not name a group")
+	}
+	return spec, nil
+}
+
+// Apply makes a group match its definition: it sets the quota of the group,
+// creates or opens it with the commands of spec, see CreateOrOpen, and then
+// sets the names, labels, watch lists, reload signals, jails, and death signals of the commands,
+// and stops or starts them as spec says.
+// Apply is not atomic, but applying the same definition again is safe,
+// so a definition that failed to apply can be applied again.
+func (g *Groups) Apply(spec GroupSpec) error {
+	q := Quota{}
+	if spec.Quota != nil {
+		q = *spec.Quota
+	}
+	if err := g.SetQuota(spec.Group, q); err != nil {
+		return errors.Wrap(err, "setting quota")
+	}
+	cmds := make([]*exec.Cmd, len(spec.Commands))
+	for i, cs := range spec.Commands {
+		cmds[i] = cs.Cmd()
+
+		if err := setCmdJail(cmds[i], cs.Jail); err != nil {
+			return err
+		}
+		if err := setCmdDeathSignal(cmds[i], syscall.Signal(cs.DeathSignal)); err != nil {
+			return err
+		}
+	}
+	if _, err := g.CreateOrOpen(spec.Group, cmds...); err != nil {
+		return err
+	}
+	ids, err := g.applySettings(spec)
+	if err != nil {
+		return err
+	}
+	grp := g.getGroup(spec.Group)
+
+	for i, cs := range spec.Commands {
+		running := grp.lookup(ids[i])
+
+		switch {
+		case cs.Stopped && running != nil:
+			if err := g.StopCommand(spec.Group, ids[i]); err != nil {
+				return errors.Wrapf(err, "stopping %s", ids[i])
+			}
+		case !cs.Stopped && running == nil:
+			if _, err := g.StartCommand(spec.Group, ids[i]); err != nil {
+				return errors.Wrapf(err, "starting %s", ids[i])
+			}
+		case running != nil:
+			if err := g.watchFiles(spec.Group, running, cs.Watch); err != nil {
+				return errors.Wrap(err, "watching command files")
+			}
+		}
+	}
+	return nil
+}
+
+// applySettings stores the settings and watch lists of the commands of spec,
+// which must be stored with the group. It returns the instance ID of each command.
+func (g *Groups) applySettings(spec GroupSpec) ([]string, error) {
+	tx, err := g.db.Begin()
+	if err != nil {
+		return nil, errors.Wrap(err, "starting transaction")
+	}
+	defer func() { _ = tx.Rollback() }() // Does nothing after Commit.
+
+	stored, err := g.getStoredSpecsTx(tx, spec.Group)
+	if err != nil {
+		return nil, err
+	}
+	// Names are cleared first, so that names can move between identical commands.
+	for _, ss := range stored {
+		if _, err := g.exec(tx, deleteCommandSetting, spec.Group, ss.id, settingName); err != nil {
+			return nil, errors.Wrap(err, settingName)
+		}
+	}
+	ids := make([]string, len(spec.Commands))
+
+	for i, cs := range spec.Commands {
+		hash, err := GetCmdID(cs.Cmd())
+		if err != nil {
+			return nil, errors.Wrap(err, "getting command ID")
+		}
+		ss := findStoredSpec(stored, func(ss *storedSpec) bool { return ss.hash == hash })
+		if ss == nil {
+			return nil, errors.Errorf("command %s is not stored with group %s", hash, spec.Group)
+		}
+		ss.used, ids[i] = true, ss.id
+
+		if cs.Name != "" {
+			if err := g.setCmdNameTx(tx, spec.Group, ss.id, cs.Name); err != nil {
+				return nil, err
+			}
+		}
+		if err := g.setCmdLabelsTx(tx, spec.Group, ss.id, cs.Labels); err != nil {
+			return nil, err
+		}
+		if err := g.setCmdWatchTx(tx, spec.Group, ss.id, cs.Watch); err != nil {
+			return nil, err
+		}
+		if cs.ReloadSignal == 0 {
+			if _, err := g.exec(tx, deleteCommandSetting, spec.Group, ss.id, settingReloadSignal); err != nil {
+				return nil, errors.Wrap(err, settingReloadSignal)
+			}
+		} else if err := g.setCmdSettingTx(tx, spec.Group, ss.id, settingReloadSignal, strconv.Itoa(cs.ReloadSignal)); err != nil {
+			return nil, err
+		}
+		if err := g.setCmdJailTx(tx, spec.Group, ss.id, cs.Jail); err != nil {
+			return nil, err
+		}
+		if err := g.setCmdDeathSignalTx(tx, spec.Group, ss.id, syscall.Signal(cs.DeathSignal)); err != nil {
+			return nil, err
+		}
+	}
+	return ids, errors.Wrap(tx.Commit(), "committing transaction")
+}
@@ -0,0 +1,179 @@
+package exec_test
+
+import (
+	"bytes"
+	"os"
+	osexec "os/exec"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"syscall"
+	"testing"
+
+	"github.com/scgolang/exec"
+)
+
+func TestGroupsExportApply(t *testing.T) {
+	var (
+		groupName = "sleepers"
+		root      = filepath.Join("testdata", "."+t.Name())
+	)
+	_ = os.RemoveAll(root)
+
+	gs := newTestGroups(t, root)
+	defer func() { _ = gs.Remove(groupName) }() // Best effort.
+
+	var (
+		a = osexec.Command("sleep", "10")
+		b = osexec.Command("sleep", "11")
+	)
+	b.Env = []string{"GREETING=hello world"}
+
+	if err := gs.SetQuota(groupName, exec.Quota{MaxCommands: 3}); err != nil {
+		t.Fatal(err)
+	}
+	if err := gs.Create(groupName, a, b); err != nil {
+		t.Fatal(err)
+	}
+	aID, _ := gs.CmdID(groupName, a)
+	bID, _ := gs.CmdID(groupName, b)
+
+	if err := gs.SetCommandName(groupName, aID, "web"); err != nil {
+		t.Fatal(err)
+	}
+	if err := gs.SetCommandLabels(groupName, aID, map[string]string{"team": "audio", "tier": "1"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := gs.SetReloadSignal(groupName, a, syscall.SIGHUP); err != nil {
+		t.Fatal(err)
+	}
+	if err := gs.StopCommand(groupName, bID); err != nil {
+		t.Fatal(err)
+	}
+	for _, format := range []exec.Format{exec.FormatJSON, exec.FormatYAML} {
+		copyName := "copy-" + string(format)
+		defer func() { _ = gs.Remove(copyName) }() // Best effort.
+
+		var exported bytes.Buffer
+		if err := gs.Export(groupName, format, &exported); err != nil {
+			t.Fatal(err)
+		}
+		spec, err := exec.Import(bytes.NewReader(exported.Bytes()), format)
+		if err != nil {
+			t.Fatalf("importing %s: %s\n%s", format, err, exported.String())
+		}
+		spec.Group = copyName
+
+		// Applying twice must be the same as applying once.
+		for i := 0; i < 2; i++ {
+			if err := gs.Apply(spec); err != nil {
+				t.Fatal(err)
+			}
+		}
+		var copied bytes.Buffer
+		if err := gs.Export(copyName, format, &copied); err != nil {
+			t.Fatal(err)
+		}
+		if expected, got := strings.Replace(exported.String(), groupName, copyName, 1), copied.String(); expected != got {
+			t.Fatalf("expected\n%s\ngot\n%s", expected, got)
+		}
+		cmds, _ := gs.Commands(copyName)
+		if expected, got := 1, len(cmds); expected != got {
+			t.Fatalf("expected %d running commands, got %d", expected, got)
+		}
+		id, _ := gs.CmdID(copyName, cmds[0])
+		labels, err := gs.CommandLabels(copyName, id)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if expected, got := "audio", labels["team"]; expected != got {
+			t.Fatalf("expected team %s, got %s", expected, got)
+		}
+	}
+}
+
+func TestImportYAML(t *testing.T) {
+	spec, err := exec.Import(strings.NewReader(`
+# A hand written definition.
+version: 1
+group: 'sleepers'
+quota:
+  max_replicas: 2
+commands:
+- name: web   # Serves requests.
+  path: /bin/sleep
+  args:
+    - sleep
+    - "10"
+  labels: {}
+- path: /bin/sleep
+  args: ["sleep", "11"]
+`), exec.FormatYAML)
+	if err == nil {
+		t.Fatalf("expected flow sequences to be rejected, got %+v", spec)
+	}
+	if spec, err = exec.Import(strings.NewReader(`
+# A hand written definition.
+version: 1
+group: 'sleepers'
+quota:
+  max_replicas: 2
+commands:
+- name: web   # Serves requests.
+  path: /bin/sleep
+  args:
+    - sleep
+    - "10"
+  labels: {}
+- path: /bin/sleep
+  args:
+  - sleep
+  - "11"
+  stopped: true
+`), exec.FormatYAML); err != nil {
+		t.Fatal(err)
+	}
+	if expected, got := "sleepers", spec.Group; expected != got {
+		t.Fatalf("expected group %s, got %s", expected, got)
+	}
+	if spec.Quota == nil || spec.Quota.MaxReplicas != 2 {
+		t.Fatalf("expected a quota of 2 replicas, got %+v", spec.Quota)
+	}
+	if expected, got := 2, len(spec.Commands); expected != got {
+		t.Fatalf("expected %d commands, got %d", expected, got)
+	}
+	if expected, got := "web", spec.Commands[0].Name; expected != got {
+		t.Fatalf("expected name %s, got %s", expected, got)
+	}
+	if expected, got := "10", spec.Commands[0].Args[1]; expected != got {
+		t.Fatalf("expected arg %s, got %s", expected, got)
+	}
+	if !spec.Commands[1].Stopped {
+		t.Fatal("expected the second command to be stopped")
+	}
+	if _, err := exec.Import(strings.NewReader(`{"version": 2, "group": "sleepers"}`), exec.FormatJSON); err == nil {
+		t.Fatal("expected an unsupported version to be rejected")
+	}
+}
+
+func TestGroupsApplyJail(t *testing.T) {
+	if runtime.GOOS == "freebsd" {
+		t.Skip("jails are supported, see TestGroupsJail")
+	}
+	var (
+		groupName = "jailed"
+		root      = filepath.Join("testdata", "."+t.Name())
+	)
+	_ = os.RemoveAll(root)
+
+	gs := newTestGroups(t, root)
+	defer func() { _ = gs.Remove(groupName) }() // Best effort.
+
+	spec := exec.GroupSpec{
+		Group:    groupName,
+		Commands: []exec.CommandSpec{{Path: "/bin/sleep", Args: []string{"sleep", "10"}, Jail: 1}},
+	}
+	if err := gs.Apply(spec); err == nil {
+		t.Fatal("expected an error applying a jail where there are no jails, got nil")
+	}
+}
@@ -0,0 +1,101 @@
+package exec
+
+import (
+	"os/exec"
+
+	"github.com/pkg/errors"
+)
+
+// SetDependencies declares that a command depends on other commands of its
+// group. When Create or Open start a command together with the commands it
+// depends on, it is only started once they have all started and passed their
+// readiness probes, see SetReadinessProbe, and it is not started at all if
+// one of them fails to. Commands are started in an order that respects their
+// dependencies, and otherwise in the order they were provided in.
+// Dependencies on commands that are not started with the command are ignored.
+// Commands also depend on the commands whose outputs they reference, see SetOutput.
+// Calling it with no dependencies removes them.
+// Like readiness probes, dependencies are not persisted and must be set every
+// time a Groups is created, before the command is started.
+func (g *Groups) SetDependencies(groupName string, cmd *exec.Cmd, deps ...*exec.Cmd) error {
+	commandID, err := GetCmdID(cmd)
+	if err != nil {
+		return errors.Wrap(err, "getting command ID")
+	}
+	hashes := make([]string, len(deps))
+	for i, dep := range deps {
+		if hashes[i], err = GetCmdID(dep); err != nil {
+			return errors.Wrap(err, "getting dependency ID")
+		}
+		if hashes[i] == commandID {
+			return errors.New("command can not depend on itself")
+		}
+	}
+	g.probesMu.Lock()
+	defer g.probesMu.Unlock()
+
+	if g.dependencies[groupName] == nil {
+		g.dependencies[groupName] = map[string][]string{}
+	}
+	if len(hashes) == 0 {
+		delete(g.dependencies[groupName], commandID)
+	} else {
+		g.dependencies[groupName][commandID] = hashes
+	}
+	return nil
+}
+
+// startOrder returns the order that cmds are started in, as indexes of cmds,
+// and the indexes of the commands that each of cmds depends on.
+// It returns an error if the dependencies have a cycle.
+func (g *Groups) startOrder(groupName string, cmds []*exec.Cmd) ([]int, [][]int, error) {
+	var (
+		deps   = make([][]int, len(cmds))
+		byHash = map[string][]int{}
+		hashes = make([]string, len(cmds))
+	)
+	for i, cmd := range cmds {
+		hash, err := GetCmdID(cmd)
+		if err != nil {
+			return nil, nil, errors.Wrap(err, "getting command ID")
+		}
+		hashes[i] = hash
+		byHash[hash] = append(byHash[hash], i)
+	}
+	g.probesMu.Lock()
+	for i, hash := range hashes {
+		for _, dep := range append(g.dependencies[groupName][hash], g.outputDeps(groupName, cmds[i])...) {
+			deps[i] = append(deps[i], byHash[dep]...)
+		}
+	}
+	g.probesMu.Unlock()
+
+	var (
+		order = make([]int, 0, len(cmds))
+		state = make([]int, len(cmds)) // 0 not visited, 1 visiting, 2 ordered.
+		visit func(i int) error
+	)
+	visit = func(i int) error {
+		switch state[i] {
+		case 1:
+			return errors.Errorf("dependencies of %s have a cycle", cmds[i].Path)
+		case 2:
+			return nil
+		}
+		state[i] = 1
+		for _, j := range deps[i] {
+			if err := visit(j); err != nil {
+				return err
+			}
+		}
+		state[i] = 2
+		order = append(order, i)
+		return nil
+	}
+	for i := range cmds {
+		if err := visit(i); err != nil {
+			return nil, nil, err
+		}
+	}
+	return order, deps, nil
+}
@@ -0,0 +1,70 @@
+package exec_test
+
+import (
+	"os"
+	osexec "os/exec"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/scgolang/exec"
+)
+
+func TestGroupsSetDependencies(t *testing.T) {
+	var (
+		groupName = "ordered"
+		root      = filepath.Join("testdata", "."+t.Name())
+	)
+	_ = os.RemoveAll(root)
+
+	gs, err := exec.New(root, exec.WithDBFile("groups.db"), exec.WithStartConcurrency(2))
+	if err != nil {
+		t.Fatal(err)
+	}
+	marker, err := filepath.Abs(filepath.Join(root, "marker"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var (
+		server    = osexec.Command("sh", "-c", "sleep 0.3; touch "+marker+"; sleep 10")
+		dependent = osexec.Command("sh", "-c", "test -f "+marker+" && sleep 10")
+	)
+	if err := gs.SetReadinessProbe(groupName, server, exec.FileProbe(marker)); err != nil {
+		t.Fatal(err)
+	}
+	if err := gs.SetDependencies(groupName, dependent, server); err != nil {
+		t.Fatal(err)
+	}
+	// The dependent is provided first, and could start at the same time as the server.
+	if err := gs.Create(groupName, dependent, server); err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = gs.Remove(groupName) }()
+
+	time.Sleep(100 * time.Millisecond)
+
+	statuses, err := gs.Statuses(groupName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	dependentID, _ := gs.CmdID(groupName, dependent)
+	if expected, got := exec.StateRunning, statuses[dependentID].State; expected != got {
+		t.Fatalf("expected the dependent command to be started once the server was ready, got %s", got)
+	}
+	var (
+		a = osexec.Command("sleep", "10")
+		b = osexec.Command("sleep", "11")
+	)
+	if err := gs.SetDependencies("cycle", a, b); err != nil {
+		t.Fatal(err)
+	}
+	if err := gs.SetDependencies("cycle", b, a); err != nil {
+		t.Fatal(err)
+	}
+	if err := gs.Create("cycle", a, b); err == nil {
+		t.Fatal("expected a dependency cycle to be rejected")
+	}
+	if err := gs.SetDependencies("cycle", a, a); err == nil {
+		t.Fatal("expected a command depending on itself to be rejected")
+	}
+}
@@ -0,0 +1,115 @@
+package exec
+
+import (
+	"database/sql"
+	"fmt"
+	"os"
+	"os/exec"
+	"strconv"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// detachedPollInterval is how often the process of a command that was adopted
+// by Open is checked for having exited, since it can not be waited for.
+const detachedPollInterval = 250 * time.Millisecond
+
+var getGroupPIDs = newQuery("getting group process IDs", `
+SELECT	instance_id, process_id
+FROM	processes
+WHERE	group_name = ? AND process_id > 0`)
+
+// detachCmd prepares cmd to be started detached: in a session of its own,
+// so that it does not get the signals of the terminal of the manager, and
+// writing straight to its log files, so that its output does not depend on
+// the manager being around to capture it. The output of detached commands
+// is not streamed, counted, or written as JSON lines.
+// The returned func closes the copies of the log files held by the manager,
+// and must be called once cmd has started.
+func (g *Groups) detachCmd(cmd *exec.Cmd, groupName, commandID string) (func(), error) {
+	if cmd.Stdout != nil || cmd.Stderr != nil {
+		return nil, errors.New("output already set")
+	}
+	if cmdDeathSignal(cmd) != 0 {
+		return nil, errors.New("a detached command can not have a death signal")
+	}
+	if err := setSession(cmd); err != nil {
+		return nil, err
+	}
+	stdout, err := g.openLog(groupName, fmt.Sprintf("%s.stdout", commandID))
+	if err != nil {
+		return nil, errors.Wrap(err, "creating new process stdout file")
+	}
+	stderr, err := g.openLog(groupName, fmt.Sprintf("%s.stderr", commandID))
+	if err != nil {
+		_ = stdout.Close()
+		return nil, errors.Wrap(err, "creating new process stderr file")
+	}
+	cmd.Stdout, cmd.Stderr = stdout, stderr
+
+	return func() { _, _ = stdout.Close(), stderr.Close() }, nil
+}
+
+// adoptDetachedTx adds the commands of a group whose detached processes are
+// still running to grp, and returns the commands that have to be started.
+// A process is only adopted if it is running the command, as far as the
+// platform can tell: on Linux its arguments have to match the command's,
+// elsewhere it only has to exist.
+func (g *Groups) adoptDetachedTx(tx *sql.Tx, groupName string, grp *Group, cmds []*exec.Cmd, ids []string) ([]*exec.Cmd, []string, error) {
+	pids, err := g.getGroupValuesTx(tx, getGroupPIDs, groupName, nil)
+	if err != nil {
+		return nil, nil, err
+	}
+	var (
+		start    = []*exec.Cmd{}
+		startIDs = []string{}
+	)
+	for i, cmd := range cmds {
+		var pid int
+		if len(pids[ids[i]]) > 0 {
+			if pid, err = strconv.Atoi(pids[ids[i]][0]); err != nil {
+				return nil, nil, errors.Wrap(err, "parsing process ID")
+			}
+		}
+		if pid == 0 || !processRunning(pid, cmd) {
+			start, startIDs = append(start, cmd), append(startIDs, ids[i])
+			continue
+		}
+		proc, err := os.FindProcess(pid)
+		if err != nil {
+			return nil, nil, errors.Wrap(err, "finding process")
+		}
+		cmd.Process = proc
+
+		// Like the processes handed off by Reexec, adopted processes count against the capacity without waiting for it.
+		g.capacity.claim()
+		grp.adopt(cmd, ids[i], &cappedProcess{Process: &detachedProcess{cmd: cmd}, capacity: g.capacity}, nil, g.clock.Now(), 0)
+	}
+	return start, startIDs, nil
+}
+
+// detachedProcess is the process of a detached command that was started by
+// another manager. It is not a child of this one, so it can not be waited for,
+// and its exit status is not known: once it is gone it is reported as exited.
+type detachedProcess struct {
+	cmd *exec.Cmd
+}
+
+// Pid returns the process ID.
+func (p *detachedProcess) Pid() int { return p.cmd.Process.Pid }
+
+// Signal sends a signal to the process.
+func (p *detachedProcess) Signal(sig os.Signal) error { return signalProcess(p.cmd.Process, sig) }
+
+// Wait polls the process until it has exited.
+// It uses real time because it waits for the process rather than for the group's clock.
+func (p *detachedProcess) Wait() error {
+	t := time.NewTicker(detachedPollInterval)
+	defer t.Stop()
+
+	for processRunning(p.Pid(), p.cmd) {
+		<-t.C
+	}
+	return nil
+}
@@ -0,0 +1,52 @@
+package exec_test
+
+import (
+	"os"
+	osexec "os/exec"
+	"path/filepath"
+	"testing"
+
+	"github.com/scgolang/exec"
+)
+
+func TestGroupsDetach(t *testing.T) {
+	var (
+		groupName = "detached"
+		root      = filepath.Join("testdata", "."+t.Name())
+	)
+	_ = os.RemoveAll(root)
+
+	first, err := exec.New(root, exec.WithDetach())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := first.Create(groupName, osexec.Command("sleep", "10")); err != nil {
+		t.Fatal(err)
+	}
+	before, err := first.Statuses(groupName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// A second manager adopts the process instead of starting the command again.
+	second, err := exec.New(root, exec.WithDetach())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := second.Open(groupName); err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = second.Remove(groupName) }()
+
+	after, err := second.Statuses(groupName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for id, status := range before {
+		if status.PID == 0 || after[id].PID != status.PID {
+			t.Fatalf("expected command %s to keep process %d, got %+v", id, status.PID, after[id])
+		}
+		if after[id].State != exec.StateRunning {
+			t.Fatalf("expected command %s to be running, got %s", id, after[id].State)
+		}
+	}
+}
@@ -0,0 +1,25 @@
+//go:build !linux && !windows
+// +build !linux,!windows
+
+package exec
+
+import (
+	"os/exec"
+	"syscall"
+)
+
+// setSession starts cmd in a new session.
+func setSession(cmd *exec.Cmd) error {
+	if cmd.SysProcAttr == nil {
+		cmd.SysProcAttr = &syscall.SysProcAttr{}
+	}
+	cmd.SysProcAttr.Setsid = true
+	return nil
+}
+
+// processRunning returns true if the process with the provided ID exists.
+// The process is not checked to be running cmd.
+func processRunning(pid int, cmd *exec.Cmd) bool {
+	err := syscall.Kill(pid, 0)
+	return err == nil || err == syscall.EPERM
+}
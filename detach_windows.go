@@ -0,0 +1,20 @@
+//go:build windows
+// +build windows
+
+package exec
+
+import (
+	"os/exec"
+
+	"github.com/pkg/errors"
+)
+
+// setSession fails, since commands can not be detached on Windows.
+func setSession(cmd *exec.Cmd) error {
+	return errors.New("detached commands are not supported on windows")
+}
+
+// processRunning returns false, since no process is ever detached on Windows.
+func processRunning(pid int, cmd *exec.Cmd) bool {
+	return false
+}
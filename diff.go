@@ -0,0 +1,254 @@
+package exec
+
+import (
+	"database/sql"
+	"os/exec"
+	"strconv"
+	"syscall"
+
+	"github.com/pkg/errors"
+)
+
+// CommandSpec is the declarative definition of a command in a group.
+type CommandSpec struct {
+	// Name is the name of the command, see SetCommandName.
+	// Named commands can be changed in place, see Diff.
+	Name string `json:"name,omitempty"`
+
+	Path string   `json:"path"`
+	Args []string `json:"args"`
+	Env  []string `json:"env,omitempty"`
+	Dir  string   `json:"dir,omitempty"`
+
+	// Watch has the patterns of the files that restart the command, see RestartOnChange.
+	// ReloadSignal is the signal sent by ReloadCommand, zero for the default.
+	// Stopped is true if the command was stopped with StopCommand.
+	// Diff does not compare these.
+	Watch        []string `json:"watch,omitempty"`
+	ReloadSignal int      `json:"reload_signal,omitempty"`
+	Stopped      bool     `json:"stopped,omitempty"`
+
+	// Labels are the labels of the command, see SetCommandLabels.
+	Labels map[string]string `json:"labels,omitempty"`
+
+	// Jail is the ID of the FreeBSD jail that the command is started in, zero
+	// for none. Commands whose SysProcAttr.Jail is set keep it when they are
+	// stored, so it is also in the definitions of the commands of open groups.
+	// Diff does not compare it, and applying a new jail to a command that is
+	// running takes effect when the group is opened again.
+	Jail int `json:"jail,omitempty"`
+
+	// DeathSignal is the signal that the command gets when the manager exits,
+	// zero for none, see SetDeathSignal. Like Jail, it is kept when the
+	// command is stored, and Diff does not compare it.
+	DeathSignal int `json:"death_signal,omitempty"`
+
+	// Policies, Probes, and Limits configure how the command is run.
+	// They are not persisted, and are set by Build rather than by Apply.
+	// Diff does not compare them.
+	Policies *CommandPolicies `json:"policies,omitempty"`
+	Probes   []Probe          `json:"-"`
+	Limits   *ResourceLimits  `json:"limits,omitempty"`
+}
+
+// NewCommandSpec returns the spec of cmd, with the provided name.
+func NewCommandSpec(name string, cmd *exec.Cmd) CommandSpec {
+	return CommandSpec{
+		Name: name,
+		Path: cmd.Path,
+		Args: append([]string{}, cmd.Args...),
+		Env:  append([]string(nil), cmd.Env...),
+		Dir:  cmd.Dir,
+		Jail: cmdJail(cmd),
+
+		DeathSignal: int(cmdDeathSignal(cmd)),
+	}
+}
+
+// Cmd returns a new, unstarted command with the definition of the spec.
+// The jail of the spec is only set on FreeBSD, and its death signal on Linux, see Apply.
+func (s CommandSpec) Cmd() *exec.Cmd {
+	cmd := &exec.Cmd{
+		Path: s.Path,
+		Args: append([]string{}, s.Args...),
+		Env:  append([]string(nil), s.Env...),
+		Dir:  s.Dir,
+	}
+	_ = setCmdJail(cmd, s.Jail)                               // Only fails where there are no jails.
+	_ = setCmdDeathSignal(cmd, syscall.Signal(s.DeathSignal)) // Only fails where there are no death signals.
+	return cmd
+}
+
+// CommandChange is a difference between a command stored with a group and a desired one.
+type CommandChange struct {
+	// Name is the name of the command, if it has one.
+	Name string `json:"name,omitempty"`
+
+	// InstanceID is the instance ID of the stored command, empty if the command is added.
+	InstanceID string `json:"instance_id,omitempty"`
+
+	// From is the stored definition, nil if the command is added,
+	// and To is the desired definition, nil if the command is removed.
+	From *CommandSpec `json:"from,omitempty"`
+	To   *CommandSpec `json:"to,omitempty"`
+}
+
+// GroupDiff reports how the commands stored with a group differ from the desired ones.
+type GroupDiff struct {
+	Added   []CommandChange `json:"added"`
+	Removed []CommandChange `json:"removed"`
+	Changed []CommandChange `json:"changed"`
+
+	// Unchanged is the number of stored commands that match a desired one.
+	Unchanged int `json:"unchanged"`
+}
+
+// Empty returns true if the stored commands match the desired ones.
+func (d GroupDiff) Empty() bool {
+	return len(d.Added) == 0 && len(d.Removed) == 0 && len(d.Changed) == 0
+}
+
+// storedSpec is a command stored with a group.
+type storedSpec struct {
+	id   string
+	hash string
+	spec CommandSpec
+	used bool
+}
+
+// Diff compares the commands stored with a group to desired without changing anything.
+// A desired command with a name is compared to the stored command with the
+// same name, and is changed if their definitions differ. Other desired
+// commands are matched to identical stored commands, one to one, and are
+// changed if only their names differ. Desired commands that do not match a
+// stored command are added, and stored commands that do not match a desired
+// one are removed. The group does not have to be open.
+func (g *Groups) Diff(groupName string, desired []CommandSpec) (GroupDiff, error) {
+	tx, err := g.db.Begin()
+	if err != nil {
+		return GroupDiff{}, errors.Wrap(err, "starting transaction")
+	}
+	defer func() { _ = tx.Rollback() }() // Read only.
+
+	return g.diffTx(tx, groupName, desired)
+}
+
+// diffTx compares the commands stored with a group to desired using the provided transaction.
+func (g *Groups) diffTx(tx *sql.Tx, groupName string, desired []CommandSpec) (GroupDiff, error) {
+	stored, err := g.getStoredSpecsTx(tx, groupName)
+	if err != nil {
+		return GroupDiff{}, err
+	}
+	var (
+		diff = GroupDiff{
+			Added:   []CommandChange{},
+			Removed: []CommandChange{},
+			Changed: []CommandChange{},
+		}
+		names     = map[string]struct{}{}
+		hashes    = make([]string, len(desired))
+		unmatched = []int{}
+	)
+	for i, spec := range desired {
+		if spec.Name != "" {
+			if _, ok := names[spec.Name]; ok {
+				return GroupDiff{}, errors.Errorf("command name %s is desired more than once", spec.Name)
+			}
+			names[spec.Name] = struct{}{}
+		}
+		hash, err := GetCmdID(spec.Cmd())
+		if err != nil {
+			return GroupDiff{}, errors.Wrap(err, "getting command ID")
+		}
+		hashes[i] = hash
+	}
+	compare := func(i int, ss *storedSpec) {
+		ss.used = true
+		if ss.hash == hashes[i] && ss.spec.Name == desired[i].Name {
+			diff.Unchanged++
+			return
+		}
+		from, to := ss.spec, desired[i]
+		diff.Changed = append(diff.Changed, CommandChange{Name: to.Name, InstanceID: ss.id, From: &from, To: &to})
+	}
+	// Named commands are matched by name first, so that a changed definition is not mistaken for another command.
+	for i, spec := range desired {
+		if ss := findStoredSpec(stored, func(ss *storedSpec) bool { return spec.Name != "" && ss.spec.Name == spec.Name }); ss != nil {
+			compare(i, ss)
+			continue
+		}
+		unmatched = append(unmatched, i)
+	}
+	for _, i := range unmatched {
+		if ss := findStoredSpec(stored, func(ss *storedSpec) bool { return ss.hash == hashes[i] }); ss != nil {
+			compare(i, ss)
+			continue
+		}
+		to := desired[i]
+		diff.Added = append(diff.Added, CommandChange{Name: to.Name, To: &to})
+	}
+	for _, ss := range stored {
+		if !ss.used {
+			from := ss.spec
+			diff.Removed = append(diff.Removed, CommandChange{Name: from.Name, InstanceID: ss.id, From: &from})
+		}
+	}
+	return diff, nil
+}
+
+// findStoredSpec returns the first stored command that has not been matched yet and satisfies match.
+func findStoredSpec(stored []*storedSpec, match func(*storedSpec) bool) *storedSpec {
+	for _, ss := range stored {
+		if !ss.used && match(ss) {
+			return ss
+		}
+	}
+	return nil
+}
+
+// getStoredSpecsTx gets the definitions of the commands stored with a group.
+func (g *Groups) getStoredSpecsTx(tx *sql.Tx, groupName string) ([]*storedSpec, error) {
+	cmds, ids, err := g.getGroupProcessesTx(tx, groupName)
+	if err != nil {
+		return nil, errors.Wrap(err, "getting group commands")
+	}
+	stored := make([]*storedSpec, len(cmds))
+	for i, cmd := range cmds {
+		hash, err := GetCmdID(cmd)
+		if err != nil {
+			return nil, errors.Wrap(err, "getting command ID")
+		}
+		settings, err := g.getCmdSettingsTx(tx, groupName, ids[i])
+		if err != nil {
+			return nil, err
+		}
+		watch, err := g.getCmdWatchTx(tx, groupName, ids[i])
+		if err != nil {
+			return nil, err
+		}
+		spec := CommandSpec{
+			Name:   settings[settingName],
+			Path:   cmd.Path,
+			Args:   cmd.Args,
+			Env:    cmd.Env,
+			Dir:    cmd.Dir,
+			Watch:  watch,
+			Labels: labelsOf(settings),
+			Jail:   cmdJail(cmd),
+
+			DeathSignal: int(cmdDeathSignal(cmd)),
+		}
+		if len(spec.Watch) == 0 {
+			spec.Watch = nil
+		}
+		if value, ok := settings[settingReloadSignal]; ok {
+			if spec.ReloadSignal, err = strconv.Atoi(value); err != nil {
+				return nil, errors.Wrap(err, "parsing reload signal")
+			}
+		}
+		_, spec.Stopped = settings[settingStopped]
+
+		stored[i] = &storedSpec{id: ids[i], hash: hash, spec: spec}
+	}
+	return stored, nil
+}
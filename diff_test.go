@@ -0,0 +1,74 @@
+package exec_test
+
+import (
+	"os"
+	osexec "os/exec"
+	"path/filepath"
+	"testing"
+
+	"github.com/scgolang/exec"
+)
+
+func TestGroupsDiff(t *testing.T) {
+	var (
+		groupName = "sleepers"
+		root      = filepath.Join("testdata", "."+t.Name())
+	)
+	_ = os.RemoveAll(root)
+
+	gs := newTestGroups(t, root)
+	defer func() { _ = gs.Remove(groupName) }() // Best effort.
+
+	var (
+		a = osexec.Command("sleep", "10")
+		b = osexec.Command("sleep", "11")
+		c = osexec.Command("sleep", "12")
+	)
+	if err := gs.Create(groupName, a, b, c); err != nil {
+		t.Fatal(err)
+	}
+	bID, _ := gs.CmdID(groupName, b)
+	if err := gs.SetCommandName(groupName, bID, "worker"); err != nil {
+		t.Fatal(err)
+	}
+	diff, err := gs.Diff(groupName, []exec.CommandSpec{
+		exec.NewCommandSpec("", osexec.Command("sleep", "10")),
+		exec.NewCommandSpec("worker", osexec.Command("sleep", "20")),
+		exec.NewCommandSpec("", osexec.Command("sleep", "13")),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected, got := 1, diff.Unchanged; expected != got {
+		t.Fatalf("expected %d unchanged, got %d", expected, got)
+	}
+	if len(diff.Changed) != 1 || diff.Changed[0].InstanceID != bID || diff.Changed[0].To.Args[1] != "20" {
+		t.Fatalf("expected worker to change, got %+v", diff.Changed)
+	}
+	if len(diff.Added) != 1 || diff.Added[0].To.Args[1] != "13" {
+		t.Fatalf("expected sleep 13 to be added, got %+v", diff.Added)
+	}
+	cID, _ := gs.CmdID(groupName, c)
+	if len(diff.Removed) != 1 || diff.Removed[0].InstanceID != cID {
+		t.Fatalf("expected sleep 12 to be removed, got %+v", diff.Removed)
+	}
+	if diff.Empty() {
+		t.Fatal("expected the diff not to be empty")
+	}
+	if diff, err = gs.Diff(groupName, []exec.CommandSpec{
+		exec.NewCommandSpec("", a),
+		exec.NewCommandSpec("worker", b),
+		exec.NewCommandSpec("", c),
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if !diff.Empty() {
+		t.Fatalf("expected an empty diff, got %+v", diff)
+	}
+	if _, err := gs.Diff(groupName, []exec.CommandSpec{
+		exec.NewCommandSpec("worker", a),
+		exec.NewCommandSpec("worker", b),
+	}); err == nil {
+		t.Fatal("expected an error, got nil")
+	}
+}
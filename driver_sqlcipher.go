@@ -0,0 +1,11 @@
+//go:build sqlcipher
+// +build sqlcipher
+
+package exec
+
+import (
+	_ "github.com/mutecomm/go-sqlcipher/v4" // Load sqlite driver with SQLCipher support.
+)
+
+// sqlcipher is true if the sqlite driver supports encrypted databases.
+const sqlcipher = true
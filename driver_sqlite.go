@@ -0,0 +1,11 @@
+//go:build !sqlcipher
+// +build !sqlcipher
+
+package exec
+
+import (
+	_ "github.com/mattn/go-sqlite3" // Load sqlite driver.
+)
+
+// sqlcipher is true if the sqlite driver supports encrypted databases.
+const sqlcipher = false
@@ -0,0 +1,158 @@
+package exec
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"syscall"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// DefaultDumpSignal is the signal sent by DumpStacks to commands
+// that do not have a dump signal configured.
+// Go programs print the stacks of their goroutines to stderr and exit,
+// JVMs print a thread dump to stdout and keep running.
+const DefaultDumpSignal = syscall.SIGQUIT
+
+// dumpQuiet is how long DumpStacks waits for more output before it considers
+// a dump complete, and dumpTimeout how long it waits at most.
+// They use real time because they wait for I/O rather than for the group's clock.
+const (
+	dumpQuiet   = 500 * time.Millisecond
+	dumpTimeout = 10 * time.Second
+)
+
+// SetDumpSignal sets the signal that DumpStacks sends to a command.
+// The setting is persisted with the group.
+func (g *Groups) SetDumpSignal(groupName string, cmd *exec.Cmd, sig syscall.Signal) error {
+	commandID, err := g.cmdID(groupName, cmd)
+	if err != nil {
+		return errors.Wrap(err, "getting command ID")
+	}
+	return g.setCmdSetting(groupName, commandID, settingDumpSignal, strconv.Itoa(int(sig)))
+}
+
+// DumpSignal returns the signal that DumpStacks sends to a command.
+func (g *Groups) DumpSignal(groupName string, cmd *exec.Cmd) (syscall.Signal, error) {
+	commandID, err := g.cmdID(groupName, cmd)
+	if err != nil {
+		return 0, errors.Wrap(err, "getting command ID")
+	}
+	return g.dumpSignal(groupName, commandID)
+}
+
+// dumpSignal returns the dump signal of the command with the provided ID.
+func (g *Groups) dumpSignal(groupName, commandID string) (syscall.Signal, error) {
+	value, ok, err := g.getCmdSetting(groupName, commandID, settingDumpSignal)
+	if err != nil {
+		return 0, err
+	}
+	if !ok {
+		return DefaultDumpSignal, nil
+	}
+	sig, err := strconv.Atoi(value)
+	if err != nil {
+		return 0, errors.Wrap(err, "parsing dump signal")
+	}
+	return syscall.Signal(sig), nil
+}
+
+// DumpStacks asks a running command that seems to be wedged to print its
+// stacks, by sending it its dump signal, which defaults to SIGQUIT.
+// The output that the command writes until it has been quiet for a while
+// is saved to a diagnostic file in the directory of the group, named
+// <instance ID>.stacks.<timestamp>, whose path is returned.
+// Depending on the program, the signal may make it exit.
+func (g *Groups) DumpStacks(groupName string, cmd *exec.Cmd) (string, error) {
+	grp := g.getGroup(groupName)
+	if grp == nil {
+		return "", errors.Errorf("group %s not found", groupName)
+	}
+	commandID, err := g.cmdID(groupName, cmd)
+	if err != nil {
+		return "", errors.Wrap(err, "getting command ID")
+	}
+	running := grp.lookup(commandID)
+	if running == nil {
+		return "", errors.Errorf("command %s not found in group %s", commandID, groupName)
+	}
+	sig, err := g.dumpSignal(groupName, commandID)
+	if err != nil {
+		return "", errors.Wrap(err, "getting dump signal")
+	}
+	// The log files are opened before the signal is sent, so that the dump can
+	// be read from them even if the command exits and its logs are rotated.
+	var logs [2]*os.File
+
+	for i := range logs {
+		filename, err := logFilename(commandID, i+1)
+		if err != nil {
+			return "", err
+		}
+		f, err := os.Open(filepath.Join(g.root, groupName, filename))
+		if err != nil {
+			return "", errors.Wrap(err, "opening log file")
+		}
+		defer func() { _ = f.Close() }() // Best effort.
+
+		if _, err := f.Seek(0, io.SeekEnd); err != nil {
+			return "", errors.Wrap(err, "seeking to the end of the log file")
+		}
+		logs[i] = f
+	}
+	when := g.clock.Now()
+
+	if err := grp.signal(running, sig); err != nil {
+		return "", errors.Wrap(err, "sending dump signal")
+	}
+	var out [2]bytes.Buffer
+
+	if err := readDump(logs, &out); err != nil {
+		return "", errors.Wrap(err, "reading dump")
+	}
+	var dump bytes.Buffer
+
+	fmt.Fprintf(&dump, "# %s of %s in group %s, %s\n", sig, commandID, groupName, when.Format(time.RFC3339Nano))
+	for i, name := range []string{"stdout", "stderr"} {
+		if out[i].Len() == 0 {
+			continue
+		}
+		fmt.Fprintf(&dump, "# %s\n", name)
+		_, _ = out[i].WriteTo(&dump) // Can not fail.
+	}
+	path := filepath.Join(g.root, groupName, commandID+".stacks."+when.UTC().Format("20060102T150405.000000000Z"))
+
+	if err := ioutil.WriteFile(path, dump.Bytes(), 0644); err != nil {
+		return "", errors.Wrap(err, "writing dump")
+	}
+	return path, nil
+}
+
+// readDump reads what is written to the log files until nothing has been
+// written to them for dumpQuiet, or at most for dumpTimeout.
+func readDump(logs [2]*os.File, out *[2]bytes.Buffer) error {
+	var (
+		deadline = time.Now().Add(dumpTimeout)
+		quiet    = time.Now().Add(dumpQuiet)
+	)
+	for now := time.Now(); now.Before(quiet) && now.Before(deadline); now = time.Now() {
+		for i, f := range logs {
+			n, err := out[i].ReadFrom(f)
+			if err != nil {
+				return err
+			}
+			if n > 0 {
+				quiet = time.Now().Add(dumpQuiet)
+			}
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+	return nil
+}
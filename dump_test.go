@@ -0,0 +1,56 @@
+package exec_test
+
+import (
+	"io/ioutil"
+	"os"
+	osexec "os/exec"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+)
+
+func TestGroupsDumpStacks(t *testing.T) {
+	var (
+		groupName = "wedged"
+		root      = filepath.Join("testdata", "."+t.Name())
+	)
+	_ = os.RemoveAll(root)
+
+	var (
+		gs  = newTestGroups(t, root)
+		cmd = osexec.Command("sh", "-c", `trap 'echo "goroutine 1 [select]:" >&2' QUIT; echo started; while true; do sleep 0.05; done`)
+	)
+	defer func() { _ = gs.Remove(groupName) }() // Best effort.
+
+	if err := gs.Create(groupName, cmd); err != nil {
+		t.Fatal(err)
+	}
+	sig, err := gs.DumpSignal(groupName, cmd)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected, got := syscall.SIGQUIT, sig; expected != got {
+		t.Fatalf("expected %s, got %s", expected, got)
+	}
+	time.Sleep(100 * time.Millisecond) // Give the shell time to install the trap.
+
+	path, err := gs.DumpStacks(groupName, cmd)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected, got := filepath.Join(root, groupName), filepath.Dir(path); !strings.HasSuffix(got, expected) {
+		t.Fatalf("expected the dump in %s, got %s", expected, got)
+	}
+	dump, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(dump), "# stderr\ngoroutine 1 [select]:\n") {
+		t.Fatalf("expected the dump to contain the stacks, got %q", dump)
+	}
+	if strings.Contains(string(dump), "started") {
+		t.Fatalf("expected the dump to only contain output written after the signal, got %q", dump)
+	}
+}
@@ -0,0 +1,206 @@
+package exec
+
+import (
+	"database/sql"
+	"os/exec"
+	"syscall"
+
+	"github.com/pkg/errors"
+)
+
+// DuplicatePolicy decides what Create does with a command that is
+// identical to a command that is already in the group.
+// Commands are identical if they have the same content hash, see GetCmdID.
+type DuplicatePolicy int
+
+// Duplicate command policies.
+const (
+	// DuplicateAllow starts the command alongside the identical ones.
+	// Identical commands can be told apart by their instance index.
+	DuplicateAllow DuplicatePolicy = iota
+
+	// DuplicateReject makes Create return an error without starting any commands.
+	DuplicateReject
+
+	// DuplicateReplace gracefully stops the identical command and starts the
+	// new one in its place. The new command keeps the instance ID, settings,
+	// and watch list of the command it replaces. If the new command fails to
+	// start, a copy of the command it replaces is started again.
+	DuplicateReplace
+
+	// DuplicateKeep leaves identical commands that are running alone and only
+	// starts the commands that are missing, so that calling Create again with
+	// the same commands does nothing. Identical commands that have exited are
+	// started again in place, keeping their instance ID, rather than added.
+	// Commands are matched one to one, so passing a command twice runs two
+	// instances of it.
+	// The commands of a group can only be found if it is open.
+	DuplicateKeep
+)
+
+// SetDuplicatePolicy sets what Create does with commands that are identical to
+// a command that is already in the group. The default is DuplicateAllow.
+func (g *Groups) SetDuplicatePolicy(policy DuplicatePolicy) error {
+	switch policy {
+	default:
+		return errors.Errorf("unknown duplicate policy %d", policy)
+	case DuplicateAllow, DuplicateReject, DuplicateReplace, DuplicateKeep:
+	}
+	g.dupPolicyMu.Lock()
+	g.dupPolicy = policy
+	g.dupPolicyMu.Unlock()
+	return nil
+}
+
+// duplicatePolicy returns the duplicate command policy.
+func (g *Groups) duplicatePolicy() DuplicatePolicy {
+	g.dupPolicyMu.Lock()
+	defer g.dupPolicyMu.Unlock()
+	return g.dupPolicy
+}
+
+// InstanceIndex returns the index of a command among the identical commands
+// in a group, in the order they were added. The first instance has index 0.
+// It returns false if the group is not open or does not have the command.
+func (g *Groups) InstanceIndex(groupName string, cmd *exec.Cmd) (int, bool) {
+	grp := g.getGroup(groupName)
+	if grp == nil {
+		return 0, false
+	}
+	return grp.index(cmd)
+}
+
+// checkDuplicates returns an error if the duplicate policy is DuplicateReject
+// and any of cmds is identical to a command in grp or to another of cmds.
+func (g *Groups) checkDuplicates(groupName string, grp *Group, cmds []*exec.Cmd) error {
+	if g.duplicatePolicy() != DuplicateReject {
+		return nil
+	}
+	seen := map[string]struct{}{}
+
+	if grp != nil {
+		for _, cmd := range grp.Commands() {
+			hash, err := GetCmdID(cmd)
+			if err != nil {
+				return errors.Wrap(err, "getting command ID")
+			}
+			seen[hash] = struct{}{}
+		}
+	}
+	for _, cmd := range cmds {
+		hash, err := GetCmdID(cmd)
+		if err != nil {
+			return errors.Wrap(err, "getting command ID")
+		}
+		if _, ok := seen[hash]; ok {
+			return errors.Errorf("command %s is already in group %s", hash, groupName)
+		}
+		seen[hash] = struct{}{}
+	}
+	return nil
+}
+
+// keptCmd is a command passed to Create that is identical to a command
+// of the group that has exited, and is started in its place.
+type keptCmd struct {
+	cmd, old *exec.Cmd
+}
+
+// keepCmds matches cmds one to one with the identical commands in grp, whatever
+// their state, preferring the ones that are running. It returns the commands
+// of cmds that do not match any, and the ones that match a command that has exited.
+// Commands that are being restarted count as running.
+func keepCmds(grp *Group, cmds []*exec.Cmd) ([]*exec.Cmd, []keptCmd, error) {
+	var (
+		running = []*exec.Cmd{}
+		exited  = []*exec.Cmd{}
+		alive   = map[*exec.Cmd]bool{}
+	)
+	grp.mu.Lock()
+	for _, cmd := range grp.cmds {
+		if grp.aliveLocked(cmd) || grp.states[grp.ids[cmd]] == StateRestarting {
+			running = append(running, cmd)
+			alive[cmd] = true
+		} else {
+			exited = append(exited, cmd)
+		}
+	}
+	grp.mu.Unlock()
+
+	byHash := map[string][]*exec.Cmd{}
+	for _, cmd := range append(running, exited...) {
+		hash, err := GetCmdID(cmd)
+		if err != nil {
+			return nil, nil, errors.Wrap(err, "getting command ID")
+		}
+		byHash[hash] = append(byHash[hash], cmd)
+	}
+	var (
+		missing = []*exec.Cmd{}
+		kept    = []keptCmd{}
+	)
+	for _, cmd := range cmds {
+		hash, err := GetCmdID(cmd)
+		if err != nil {
+			return nil, nil, errors.Wrap(err, "getting command ID")
+		}
+		matches := byHash[hash]
+		if len(matches) == 0 {
+			missing = append(missing, cmd)
+			continue
+		}
+		if old := matches[0]; !alive[old] {
+			kept = append(kept, keptCmd{cmd: cmd, old: old})
+		}
+		byHash[hash] = matches[1:]
+	}
+	return missing, kept, nil
+}
+
+// restartKeptTx starts each kept command in place of the command it matched,
+// with the instance ID of that command, see DuplicateKeep.
+func (g *Groups) restartKeptTx(tx *sql.Tx, groupName string, grp *Group, kept []keptCmd) error {
+	for _, k := range kept {
+		id, _ := grp.ID(k.old)
+
+		if err := g.start(k.cmd, groupName, grp, k.old, id); err != nil {
+			return errors.Wrap(err, "starting command")
+		}
+		if _, err := g.exec(tx, updateProcessID, grp.pid(k.cmd), groupName, id); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// replaceDuplicateTx replaces the command in grp that is identical to cmd, if there is one.
+// It returns false if grp does not have a command that is identical to cmd.
+// If cmd fails to start a copy of the command it replaces is started again.
+func (g *Groups) replaceDuplicateTx(tx *sql.Tx, groupName string, grp *Group, cmd *exec.Cmd) (bool, error) {
+	hash, err := GetCmdID(cmd)
+	if err != nil {
+		return false, errors.Wrap(err, "getting command ID")
+	}
+	old := grp.lookup(hash)
+	if old == nil {
+		return false, nil
+	}
+	id, _ := grp.ID(old)
+	grp.replace(old)
+
+	if err := grp.stop(old, grp.stopSignalOf(old, syscall.SIGTERM), g.timeouts().Stop); err != nil {
+		return false, errors.Wrap(err, "stopping command")
+	}
+	if err := g.start(cmd, groupName, grp, old, id); err != nil {
+		if serr := g.start(cloneCmd(old), groupName, grp, old, id); serr != nil {
+			g.logf("restarting %s in group %s: %s", id, groupName, serr)
+			grp.setState(old, StateFailed, serr)
+			grp.report(old, serr)
+		}
+		return false, errors.Wrap(err, "starting command")
+	}
+	if _, err := g.exec(tx, updateProcessID, grp.pid(cmd), groupName, id); err != nil {
+		return false, err
+	}
+	return true, nil
+}
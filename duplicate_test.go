@@ -0,0 +1,189 @@
+package exec_test
+
+import (
+	"os"
+	osexec "os/exec"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/scgolang/exec"
+)
+
+func TestGroupsDuplicatePolicy(t *testing.T) {
+	var (
+		groupName = "sleepers"
+		root      = filepath.Join("testdata", "."+t.Name())
+	)
+	_ = os.RemoveAll(root)
+
+	var (
+		gs = newTestGroups(t, root)
+		c1 = osexec.Command("sleep", "10")
+		c2 = osexec.Command("sleep", "10")
+	)
+	defer func() { _ = gs.Remove(groupName) }() // Best effort.
+
+	if err := gs.Create(groupName, c1, c2); err != nil {
+		t.Fatal(err)
+	}
+	for i, cmd := range []*osexec.Cmd{c1, c2} {
+		idx, ok := gs.InstanceIndex(groupName, cmd)
+		if !ok {
+			t.Fatalf("expected command %d to have an instance index", i)
+		}
+		if expected, got := i, idx; expected != got {
+			t.Fatalf("expected instance index %d, got %d", expected, got)
+		}
+	}
+	if err := gs.SetDuplicatePolicy(exec.DuplicateReject); err != nil {
+		t.Fatal(err)
+	}
+	if err := gs.Create(groupName, osexec.Command("sleep", "10")); err == nil {
+		t.Fatal("expected an error, got nil")
+	}
+	if err := gs.SetDuplicatePolicy(exec.DuplicateReplace); err != nil {
+		t.Fatal(err)
+	}
+	id, _ := gs.CmdID(groupName, c1)
+	c3 := osexec.Command("sleep", "10")
+
+	if err := gs.Create(groupName, c3); err != nil {
+		t.Fatal(err)
+	}
+	cmds, _ := gs.Commands(groupName)
+	if expected, got := 2, len(cmds); expected != got {
+		t.Fatalf("expected %d commands, got %d", expected, got)
+	}
+	if cmds[0] != c3 {
+		t.Fatal("expected the new command to replace the first instance")
+	}
+	if got, _ := gs.CmdID(groupName, c3); got != id {
+		t.Fatalf("expected instance ID %s, got %s", id, got)
+	}
+	if err := gs.SetDuplicatePolicy(exec.DuplicatePolicy(42)); err == nil {
+		t.Fatal("expected an error, got nil")
+	}
+}
+
+func TestGroupsDuplicateReplaceFails(t *testing.T) {
+	var (
+		groupName = "sleepers"
+		root      = filepath.Join("testdata", "."+t.Name())
+	)
+	_ = os.RemoveAll(root)
+
+	gs := newTestGroups(t, root)
+	defer func() { _ = gs.Remove(groupName) }() // Best effort.
+
+	if err := gs.SetDuplicatePolicy(exec.DuplicateReplace); err != nil {
+		t.Fatal(err)
+	}
+	old := osexec.Command("sleep", "10")
+	if err := gs.Create(groupName, old); err != nil {
+		t.Fatal(err)
+	}
+	id, _ := gs.CmdID(groupName, old)
+
+	// The definition of a command is its arguments and environment,
+	// so the replacement is identical even though it can not start.
+	broken := osexec.Command("sleep", "10")
+	broken.Path = filepath.Join(root, "nonexistent")
+
+	if err := gs.Create(groupName, broken); err == nil {
+		t.Fatal("expected an error, got nil")
+	}
+	cmds, _ := gs.Commands(groupName)
+	if expected, got := 1, len(cmds); expected != got {
+		t.Fatalf("expected %d commands, got %d", expected, got)
+	}
+	if cmds[0] == old || cmds[0] == broken {
+		t.Fatal("expected a copy of the replaced command to be started again")
+	}
+	if got, _ := gs.CmdID(groupName, cmds[0]); got != id {
+		t.Fatalf("expected instance ID %s, got %s", id, got)
+	}
+	statuses, err := gs.Statuses(groupName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected, got := exec.StateRunning, statuses[id].State; expected != got {
+		t.Fatalf("expected state %s, got %s", expected, got)
+	}
+}
+
+func TestGroupsDuplicateKeep(t *testing.T) {
+	var (
+		groupName = "sleepers"
+		root      = filepath.Join("testdata", "."+t.Name())
+	)
+	_ = os.RemoveAll(root)
+
+	gs := newTestGroups(t, root)
+	defer func() { _ = gs.Remove(groupName) }() // Best effort.
+
+	if err := gs.SetDuplicatePolicy(exec.DuplicateKeep); err != nil {
+		t.Fatal(err)
+	}
+	create := func(cmds ...*osexec.Cmd) {
+		if err := gs.Create(groupName, cmds...); err != nil {
+			t.Fatal(err)
+		}
+	}
+	c1, c2 := osexec.Command("sleep", "10"), osexec.Command("sleep", "10")
+	create(c1, c2)
+	create(osexec.Command("sleep", "10"), osexec.Command("sleep", "10"))
+
+	cmds, _ := gs.Commands(groupName)
+	if expected, got := 2, len(cmds); expected != got {
+		t.Fatalf("expected %d commands, got %d", expected, got)
+	}
+	if cmds[0] != c1 || cmds[1] != c2 {
+		t.Fatal("expected the running commands to be left alone")
+	}
+	c3 := osexec.Command("sleep", "11")
+	create(osexec.Command("sleep", "10"), osexec.Command("sleep", "10"), osexec.Command("sleep", "10"), c3)
+
+	if cmds, _ = gs.Commands(groupName); len(cmds) != 4 {
+		t.Fatalf("expected %d commands, got %d", 4, len(cmds))
+	}
+	if cmds[3] != c3 {
+		t.Fatal("expected the missing commands to be added")
+	}
+	// Commands that have exited are started again in place.
+	echo := osexec.Command("echo", "foo")
+	create(echo)
+
+	id, _ := gs.CmdID(groupName, echo)
+
+	for i := 0; i < 2; i++ {
+		for deadline := time.Now().Add(5 * time.Second); ; time.Sleep(10 * time.Millisecond) {
+			statuses, err := gs.Statuses(groupName)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if statuses[id].State == exec.StateExited {
+				break
+			}
+			if time.Now().After(deadline) {
+				t.Fatal("expected echo to exit")
+			}
+		}
+		echo = osexec.Command("echo", "foo")
+		create(echo)
+
+		if got, _ := gs.CmdID(groupName, echo); got != id {
+			t.Fatalf("expected instance ID %s, got %s", id, got)
+		}
+	}
+	if cmds, _ = gs.Commands(groupName); len(cmds) != 5 {
+		t.Fatalf("expected %d commands, got %d", 5, len(cmds))
+	}
+	_ = gs.Close(groupName) // The sleeps are killed.
+
+	if cmds, err := gs.Open(groupName); err != nil {
+		t.Fatal(err)
+	} else if len(cmds) != 5 {
+		t.Fatalf("expected %d stored commands, got %d", 5, len(cmds))
+	}
+}
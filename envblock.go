@@ -0,0 +1,112 @@
+package exec
+
+import (
+	"bytes"
+	"compress/flate"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/base64"
+	"encoding/hex"
+	"io"
+	"io/ioutil"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// envBlockPrefix marks env blocks, which hold a whole environment
+// compressed with DEFLATE and encoded with base64.
+const envBlockPrefix = "deflate:v1:"
+
+var insertEnvBlock = newQuery("inserting env block", `
+INSERT OR IGNORE INTO	env_blocks (block_id, data)
+VALUES			(?, ?)`)
+
+var insertCmdEnvBlock = newQuery("inserting command env block", `
+INSERT INTO	command_env_blocks (command_id, block_id)
+VALUES		(?, ?)`)
+
+var deleteCmdEnvBlocks = newQuery("deleting command env blocks", `
+DELETE FROM	command_env_blocks
+WHERE		command_id = ?`)
+
+var deleteUnusedEnvBlocks = newQuery("deleting unused env blocks", `
+DELETE FROM	env_blocks
+WHERE		block_id NOT IN (SELECT block_id FROM command_env_blocks)`)
+
+var getGroupEnvBlocks = newQuery("getting group env blocks", `
+SELECT		b.command_id, e.data
+FROM		command_env_blocks b
+JOIN		env_blocks e
+ON		e.block_id = b.block_id
+WHERE		b.command_id IN (SELECT instance_id FROM processes WHERE group_name = ?)`)
+
+// insertEnvBlockTx stores the environment of a command as a single compressed block.
+// Without an env key blocks are content addressed, so commands with the same
+// environment share a block. With an env key every command gets its own block,
+// so that the database does not reveal which commands share an environment.
+func (g *Groups) insertEnvBlockTx(tx *sql.Tx, commandID string, env []string) error {
+	data, err := encodeEnvBlock(env)
+	if err != nil {
+		return errors.Wrap(err, "compressing command env")
+	}
+	var blockID string
+	if g.envKey == nil {
+		sum := sha256.Sum256([]byte(data))
+		blockID = hex.EncodeToString(sum[:])
+	} else {
+		if data, err = g.sealEnv(data); err != nil {
+			return errors.Wrap(err, "encrypting command env")
+		}
+		blockID = newInstanceID()
+	}
+	if _, err := g.exec(tx, insertEnvBlock, blockID, data); err != nil {
+		return err
+	}
+	_, err = g.exec(tx, insertCmdEnvBlock, commandID, blockID)
+	return err
+}
+
+// openEnvBlock decrypts, if needed, and decodes an env block.
+func (g *Groups) openEnvBlock(data string) ([]string, error) {
+	data, err := g.openEnv(data)
+	if err != nil {
+		return nil, err
+	}
+	return decodeEnvBlock(data)
+}
+
+// encodeEnvBlock compresses an environment into an env block.
+func encodeEnvBlock(env []string) (string, error) {
+	buf := &bytes.Buffer{}
+	zw, err := flate.NewWriter(buf, flate.BestCompression)
+	if err != nil {
+		return "", err
+	}
+	if _, err := io.WriteString(zw, strings.Join(env, "\x00")); err != nil {
+		return "", err
+	}
+	if err := zw.Close(); err != nil {
+		return "", err
+	}
+	return envBlockPrefix + base64.StdEncoding.EncodeToString(buf.Bytes()), nil
+}
+
+// decodeEnvBlock decompresses an env block.
+func decodeEnvBlock(data string) ([]string, error) {
+	if !strings.HasPrefix(data, envBlockPrefix) {
+		return nil, errors.New("env block has an unknown format")
+	}
+	raw, err := base64.StdEncoding.DecodeString(strings.TrimPrefix(data, envBlockPrefix))
+	if err != nil {
+		return nil, errors.Wrap(err, "decoding env block")
+	}
+	plain, err := ioutil.ReadAll(flate.NewReader(bytes.NewReader(raw)))
+	if err != nil {
+		return nil, errors.Wrap(err, "decompressing env block")
+	}
+	if len(plain) == 0 {
+		return []string{}, nil
+	}
+	return strings.Split(string(plain), "\x00"), nil
+}
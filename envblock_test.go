@@ -0,0 +1,96 @@
+package exec_test
+
+import (
+	"database/sql"
+	"fmt"
+	"os"
+	osexec "os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/scgolang/exec"
+)
+
+func TestGroupsEnvCompression(t *testing.T) {
+	var (
+		groupName = "bigenv"
+		root      = filepath.Join("testdata", "."+t.Name())
+		env       = make([]string, 200)
+	)
+	_ = os.RemoveAll(root)
+
+	for i := range env {
+		env[i] = fmt.Sprintf("VAR_%d=value-%d", i, i)
+	}
+	gs, err := exec.New(root, exec.WithEnvCompression(10))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var (
+		c1 = osexec.Command("true", "one")
+		c2 = osexec.Command("true", "two")
+		c3 = osexec.Command("true", "small")
+	)
+	c1.Env, c2.Env, c3.Env = env, env, []string{"A=1"}
+
+	if err := gs.Create(groupName, c1, c2, c3); err != nil {
+		t.Fatal(err)
+	}
+	if err := gs.Wait(groupName); err != nil {
+		t.Fatal(err)
+	}
+	db, err := sql.Open("sqlite3", filepath.Join(root, "groups.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = db.Close() }()
+
+	for table, expected := range map[string]int{
+		"env_blocks":         1,
+		"command_env_blocks": 2,
+		"command_env":        1,
+	} {
+		var got int
+		if err := db.QueryRow(`SELECT COUNT(*) FROM ` + table).Scan(&got); err != nil {
+			t.Fatal(err)
+		}
+		if expected != got {
+			t.Fatalf("expected %d rows in %s, got %d", expected, table, got)
+		}
+	}
+	gs = newTestGroups(t, root)
+
+	cmds, err := gs.Open(groupName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected, got := 3, len(cmds); expected != got {
+		t.Fatalf("expected %d commands, got %d", expected, got)
+	}
+	for i, cmd := range cmds {
+		expected := strings.Join(env, " ")
+		if i == 2 {
+			expected = "A=1"
+		}
+		if got := strings.Join(cmd.Env, " "); expected != got {
+			t.Fatalf("expected env %q, got %q", expected, got)
+		}
+	}
+	// Removed commands leave nothing behind.
+	if err := gs.Remove(groupName); err != nil {
+		t.Fatal(err)
+	}
+	for _, table := range []string{"command_args", "command_env", "command_env_blocks", "env_blocks"} {
+		var got int
+		if err := db.QueryRow(`SELECT COUNT(*) FROM ` + table).Scan(&got); err != nil {
+			t.Fatal(err)
+		}
+		if got != 0 {
+			t.Fatalf("expected no rows in %s, got %d", table, got)
+		}
+	}
+	if _, err := exec.New(root, exec.WithEnvCompression(-1)); err == nil {
+		t.Fatal("expected an error, got nil")
+	}
+}
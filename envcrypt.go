@@ -0,0 +1,103 @@
+package exec
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"io"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// encryptedEnvPrefix marks env values that are stored encrypted.
+const encryptedEnvPrefix = "enc:v1:"
+
+// SetEnvKey enables encryption at rest of the environment variables of commands.
+// key must be 16, 24, or 32 bytes long to select AES-128, AES-192, or AES-256.
+// Values are sealed with AES-GCM before they are written to the database and
+// opened again when they are read, so the rest of the API is unaffected.
+// Values that were stored before a key was set are still read as plaintext.
+// SetEnvKey should be called before any groups are created or opened.
+func (g *Groups) SetEnvKey(key []byte) error {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return errors.Wrap(err, "creating cipher")
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return errors.Wrap(err, "creating GCM")
+	}
+	g.envKey = aead
+	return nil
+}
+
+// sealEnv encrypts an env value if an env key has been set.
+func (g *Groups) sealEnv(value string) (string, error) {
+	if g.envKey == nil {
+		return value, nil
+	}
+	nonce := make([]byte, g.envKey.NonceSize())
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		return "", errors.Wrap(err, "generating nonce")
+	}
+	sealed := g.envKey.Seal(nonce, nonce, []byte(value), nil)
+	return encryptedEnvPrefix + base64.StdEncoding.EncodeToString(sealed), nil
+}
+
+// openEnv decrypts an env value that was encrypted by sealEnv.
+// Plaintext values are returned as they are.
+func (g *Groups) openEnv(value string) (string, error) {
+	if !strings.HasPrefix(value, encryptedEnvPrefix) {
+		return value, nil
+	}
+	if g.envKey == nil {
+		return "", errors.New("env value is encrypted but no key has been set")
+	}
+	sealed, err := base64.StdEncoding.DecodeString(strings.TrimPrefix(value, encryptedEnvPrefix))
+	if err != nil {
+		return "", errors.Wrap(err, "decoding env value")
+	}
+	ns := g.envKey.NonceSize()
+	if len(sealed) < ns {
+		return "", errors.New("encrypted env value is too short")
+	}
+	plain, err := g.envKey.Open(nil, sealed[:ns], sealed[ns:], nil)
+	if err != nil {
+		return "", errors.Wrap(err, "decrypting env value")
+	}
+	return string(plain), nil
+}
+
+// sealEnvs encrypts every value in env.
+func (g *Groups) sealEnvs(env []string) ([]string, error) {
+	if g.envKey == nil || env == nil {
+		return env, nil
+	}
+	sealed := make([]string, len(env))
+	for i, e := range env {
+		s, err := g.sealEnv(e)
+		if err != nil {
+			return nil, err
+		}
+		sealed[i] = s
+	}
+	return sealed, nil
+}
+
+// openEnvs decrypts every value in env.
+func (g *Groups) openEnvs(env []string) ([]string, error) {
+	if env == nil {
+		return nil, nil
+	}
+	opened := make([]string, len(env))
+	for i, e := range env {
+		o, err := g.openEnv(e)
+		if err != nil {
+			return nil, err
+		}
+		opened[i] = o
+	}
+	return opened, nil
+}
@@ -0,0 +1,67 @@
+package exec_test
+
+import (
+	"database/sql"
+	"os"
+	osexec "os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestGroupsEnvKey(t *testing.T) {
+	var (
+		groupName = "printenv"
+		root      = filepath.Join("testdata", "."+t.Name())
+		key       = []byte("0123456789abcdef0123456789abcdef")
+	)
+	_ = os.RemoveAll(root)
+
+	var (
+		gs  = newTestGroups(t, root)
+		cmd = osexec.Command("printenv", "SECRET")
+	)
+	cmd.Env = []string{"SECRET=hunter2"}
+
+	if err := gs.SetEnvKey(key); err != nil {
+		t.Fatal(err)
+	}
+	if err := gs.Create(groupName, cmd); err != nil {
+		t.Fatal(err)
+	}
+	if err := gs.Wait(groupName); err != nil {
+		t.Fatal(err)
+	}
+	db, err := sql.Open("sqlite3", filepath.Join(root, "groups.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = db.Close() }()
+
+	var stored string
+	if err := db.QueryRow(`SELECT env_var FROM command_env`).Scan(&stored); err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(stored, "hunter2") {
+		t.Fatalf("expected env to be encrypted, got %s", stored)
+	}
+	if _, err := gs.Snapshot(groupName); err != nil {
+		t.Fatal(err)
+	}
+	snaps, err := gs.Snapshots(groupName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected, got := "SECRET=hunter2", snaps[0].Commands[0].Env[0]; expected != got {
+		t.Fatalf("expected %s, got %s", expected, got)
+	}
+	if err := db.QueryRow(`SELECT data FROM snapshots`).Scan(&stored); err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(stored, "hunter2") {
+		t.Fatalf("expected snapshot env to be encrypted, got %s", stored)
+	}
+	if err := gs.SetEnvKey([]byte("short")); err == nil {
+		t.Fatal("expected an error, got nil")
+	}
+}
@@ -0,0 +1,73 @@
+package exec
+
+import (
+	"context"
+	"os/exec"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// CreateEphemeral creates a group that is never stored in the database, for
+// short-lived sessions where writing to it would be wasted work. The output
+// of the commands of an ephemeral group is captured to log files like that of
+// any group, and they are supervised, but their runs are not recorded in the
+// run history, and the group is forgotten once it is removed. Settings that
+// are persisted, like names and labels, can not be set on their commands.
+// If the ephemeral group is already open the commands are added to it.
+// It returns an error if a group with the same name is stored in the database.
+func (g *Groups) CreateEphemeral(groupName string, cmds ...*exec.Cmd) error {
+	grp := g.getGroup(groupName)
+	if grp != nil && !grp.ephemeral {
+		return errors.Errorf("group %s is not ephemeral", groupName)
+	}
+	if grp == nil {
+		ids, err := g.getGroupIDsTx(nil, groupName)
+		if err != nil {
+			return err
+		}
+		if len(ids) > 0 {
+			return errors.Errorf("group %s is stored in the database", groupName)
+		}
+		grp = g.newGroup(groupName)
+		grp.ephemeral = true
+	}
+	ids := make([]string, len(cmds))
+	for i := range cmds {
+		ids[i] = newInstanceID()
+	}
+	if err := g.startAll(context.Background(), groupName, grp, cmds, ids); err != nil {
+		return err
+	}
+	g.groupsMu.Lock()
+	g.groups[groupName] = grp
+	g.groupsMu.Unlock()
+	return nil
+}
+
+// removeEphemeral removes commands from an ephemeral group, or removes the
+// group entirely if no commands are passed, see Remove.
+func (g *Groups) removeEphemeral(groupName string, grp *Group, timeout time.Duration, cmds ...*exec.Cmd) error {
+	commandIDs, err := g.cmdIDs(groupName, cmds)
+	if err != nil {
+		return errors.Wrap(err, "getting command IDs")
+	}
+	if err := g.unwatchFiles(groupName, commandIDs...); err != nil {
+		return errors.Wrap(err, "closing file watchers")
+	}
+	g.unwatchStuck(groupName, commandIDs...)
+	g.unwatchBinaries(groupName, commandIDs...)
+	g.cancelRelaunches(groupName, commandIDs...)
+
+	if err := grp.RemoveTimeout(timeout, cmds...); err != nil {
+		return errors.Wrap(err, "removing commands from group")
+	}
+	if len(cmds) == 0 {
+		g.groupsMu.Lock()
+		if g.groups[groupName] == grp {
+			delete(g.groups, groupName)
+		}
+		g.groupsMu.Unlock()
+	}
+	return nil
+}
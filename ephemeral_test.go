@@ -0,0 +1,50 @@
+package exec_test
+
+import (
+	"os"
+	osexec "os/exec"
+	"path/filepath"
+	"testing"
+)
+
+func TestGroupsCreateEphemeral(t *testing.T) {
+	var (
+		groupName = "session"
+		root      = filepath.Join("testdata", "."+t.Name())
+	)
+	_ = os.RemoveAll(root)
+
+	var (
+		gs  = newTestGroups(t, root)
+		cmd = osexec.Command("echo", "foo")
+	)
+	if err := gs.CreateEphemeral(groupName, cmd); err != nil {
+		t.Fatal(err)
+	}
+	verifyEchoFoo(gs, groupName, cmd, t)
+
+	runs, err := gs.Runs(groupName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(runs) != 0 {
+		t.Fatalf("expected no runs to be recorded, got %+v", runs)
+	}
+	if err := gs.Create(groupName, osexec.Command("true")); err == nil {
+		t.Fatal("expected an error creating a stored group with the name of an ephemeral one")
+	}
+	if err := gs.Remove(groupName); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := gs.Commands(groupName); ok {
+		t.Fatal("expected the ephemeral group to be forgotten once it is removed")
+	}
+	if err := gs.Create(groupName, osexec.Command("true")); err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = gs.Remove(groupName) }()
+
+	if err := gs.CreateEphemeral(groupName, osexec.Command("true")); err == nil {
+		t.Fatal("expected an error creating an ephemeral group with the name of a stored one")
+	}
+}
@@ -0,0 +1,175 @@
+package exec
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// EventVersion is the version of the event schema, see Event.
+// It is only increased by changes that existing consumers can not ignore,
+// such as removing or redefining a field. Adding fields or event kinds
+// does not change it.
+const EventVersion = 1
+
+// EventKind is the kind of an event.
+type EventKind string
+
+// Event kinds. Consumers should skip events of kinds they do not know,
+// since new kinds can be added without changing EventVersion.
+const (
+	// EventState is a command changing state, see Watch.
+	// Its payload is in Event.State.
+	EventState EventKind = "state"
+
+	// EventOutput is a line of output of a command, see Subscribe.
+	// Its payload is in Event.Output.
+	EventOutput EventKind = "output"
+
+	// EventStuck is a command that has neither used CPU time nor written
+	// output for a while, see DetectStuck. Its payload is in Event.Stuck.
+	EventStuck EventKind = "stuck"
+
+	// EventBinary is a change of the executable of a command, see
+	// DetectBinaryChange. Its payload is in Event.Binary.
+	EventBinary EventKind = "binary"
+)
+
+// Event is the stable encoding of the notifications that Watch and Subscribe
+// deliver, for consumers outside of the program. It encodes as JSON like
+//
+//	{"version":1,"kind":"state","time":"2006-01-02T15:04:05Z","group":"synths",
+//	  "command_id":"...","state":{"pid":42,"from":"running","to":"failed","error":"exit status 1"}}
+//
+// Every event has a version, a kind, a time, and a group. The payload of the
+// event is in the field named after its kind, the others are omitted.
+type Event struct {
+	Version int       `json:"version"`
+	Kind    EventKind `json:"kind"`
+	Time    time.Time `json:"time"`
+	Group   string    `json:"group"`
+
+	// CommandID is the instance ID of the command the event is about.
+	CommandID string `json:"command_id,omitempty"`
+
+	State  *StateEvent  `json:"state,omitempty"`
+	Output *OutputEvent `json:"output,omitempty"`
+	Stuck  *StuckEvent  `json:"stuck,omitempty"`
+	Binary *BinaryEvent `json:"binary,omitempty"`
+}
+
+// StateEvent is the payload of an EventState event.
+type StateEvent struct {
+	PID  int   `json:"pid,omitempty"`
+	From State `json:"from"`
+	To   State `json:"to"`
+
+	// Error is the error the command exited with, if any,
+	// and OOMKilled is true if the kernel killed it because it ran out of memory.
+	Error     string `json:"error,omitempty"`
+	OOMKilled bool   `json:"oom_killed,omitempty"`
+}
+
+// OutputEvent is the payload of an EventOutput event.
+type OutputEvent struct {
+	// Fd is 1 for stdout and 2 for stderr.
+	Fd   int    `json:"fd"`
+	Line string `json:"line"`
+}
+
+// StuckEvent is the payload of an EventStuck event.
+type StuckEvent struct {
+	PID int `json:"pid,omitempty"`
+
+	// Idle is how long, in seconds, the command has made no progress,
+	// and Restarted is true if it is being restarted because of it.
+	Idle      float64 `json:"idle"`
+	Restarted bool    `json:"restarted,omitempty"`
+}
+
+// BinaryEvent is the payload of an EventBinary event.
+type BinaryEvent struct {
+	PID int `json:"pid,omitempty"`
+
+	// Path is the path of the executable and SHA256 is the hex-encoded
+	// SHA-256 of its new contents. Restarted is true if the command is
+	// being restarted because of it.
+	Path      string `json:"path"`
+	SHA256    string `json:"sha256"`
+	Restarted bool   `json:"restarted,omitempty"`
+}
+
+// NewStateEvent returns the event of a state change.
+func NewStateEvent(change StateChange) Event {
+	state := &StateEvent{PID: change.PID, From: change.From, To: change.To}
+	if change.Err != nil {
+		state.Error = change.Err.Error()
+		state.OOMKilled = IsOOMKilled(change.Err)
+	}
+	return Event{
+		Version:   EventVersion,
+		Kind:      EventState,
+		Time:      change.Time,
+		Group:     change.Group,
+		CommandID: change.CommandID,
+		State:     state,
+	}
+}
+
+// NewOutputEvent returns the event of a line of output of a command,
+// which was received at t.
+func NewOutputEvent(groupName, commandID string, line LogLine, t time.Time) Event {
+	return Event{
+		Version:   EventVersion,
+		Kind:      EventOutput,
+		Time:      t,
+		Group:     groupName,
+		CommandID: commandID,
+		Output:    &OutputEvent{Fd: line.Fd, Line: line.Text},
+	}
+}
+
+// NewStuckEvent returns the event of a command that was found to be stuck at t,
+// after making no progress for idle.
+func NewStuckEvent(groupName, commandID string, pid int, idle time.Duration, restarted bool, t time.Time) Event {
+	return Event{
+		Version:   EventVersion,
+		Kind:      EventStuck,
+		Time:      t,
+		Group:     groupName,
+		CommandID: commandID,
+		Stuck:     &StuckEvent{PID: pid, Idle: idle.Seconds(), Restarted: restarted},
+	}
+}
+
+// NewBinaryEvent returns the event of the executable of a command at path
+// changing to contents with the provided SHA-256, which was found at t.
+func NewBinaryEvent(groupName, commandID string, pid int, path, sum string, restarted bool, t time.Time) Event {
+	return Event{
+		Version:   EventVersion,
+		Kind:      EventBinary,
+		Time:      t,
+		Group:     groupName,
+		CommandID: commandID,
+		Binary:    &BinaryEvent{PID: pid, Path: path, SHA256: sum, Restarted: restarted},
+	}
+}
+
+// ParseEvent decodes an event that was encoded as JSON.
+// It returns an error if the event has a version that is newer than
+// EventVersion, but not if it has a kind that is not known, in which case
+// only the fields that every event has are set.
+func ParseEvent(data []byte) (Event, error) {
+	var e Event
+	if err := json.Unmarshal(data, &e); err != nil {
+		return Event{}, errors.Wrap(err, "decoding event")
+	}
+	if e.Version < 1 {
+		return Event{}, errors.New("event does not have a version")
+	}
+	if e.Version > EventVersion {
+		return Event{}, errors.Errorf("unsupported event version %d", e.Version)
+	}
+	return e, nil
+}
@@ -0,0 +1,54 @@
+package exec_test
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/scgolang/exec"
+)
+
+func TestEventEncoding(t *testing.T) {
+	change := exec.StateChange{
+		Group:     "synths",
+		CommandID: "abc",
+		PID:       42,
+		From:      exec.StateRunning,
+		To:        exec.StateFailed,
+		Time:      time.Date(2006, 1, 2, 15, 4, 5, 0, time.UTC),
+		Err:       errors.New("exit status 1"),
+	}
+	data, err := json.Marshal(exec.NewStateEvent(change))
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := `{"version":1,"kind":"state","time":"2006-01-02T15:04:05Z","group":"synths","command_id":"abc","state":{"pid":42,"from":"running","to":"failed","error":"exit status 1"}}`
+	if got := string(data); expected != got {
+		t.Fatalf("expected %s, got %s", expected, got)
+	}
+	e, err := exec.ParseEvent(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if e.State == nil || e.State.To != exec.StateFailed || e.Output != nil {
+		t.Fatalf("unexpected event %+v", e)
+	}
+	if data, err = json.Marshal(exec.NewOutputEvent("synths", "abc", exec.LogLine{Fd: 2, Text: "oops"}, change.Time)); err != nil {
+		t.Fatal(err)
+	}
+	expected = `{"version":1,"kind":"output","time":"2006-01-02T15:04:05Z","group":"synths","command_id":"abc","output":{"fd":2,"line":"oops"}}`
+	if got := string(data); expected != got {
+		t.Fatalf("expected %s, got %s", expected, got)
+	}
+	// Kinds that are not known are decoded without their payload.
+	if e, err = exec.ParseEvent([]byte(`{"version":1,"kind":"scaled","group":"synths","scaled":{"to":3}}`)); err != nil {
+		t.Fatal(err)
+	}
+	if expected, got := exec.EventKind("scaled"), e.Kind; expected != got {
+		t.Fatalf("expected kind %s, got %s", expected, got)
+	}
+	if _, err := exec.ParseEvent([]byte(`{"version":2,"kind":"state"}`)); err == nil {
+		t.Fatal("expected a newer version to be rejected")
+	}
+}
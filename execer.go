@@ -0,0 +1,102 @@
+package exec
+
+import (
+	"os"
+	"os/exec"
+
+	"github.com/pkg/errors"
+)
+
+// Process is a process that was started by an Execer.
+type Process interface {
+	// Pid returns the process ID.
+	Pid() int
+
+	// Signal sends a signal to the process.
+	Signal(sig os.Signal) error
+
+	// Wait waits for the process to exit.
+	// It returns an error in the same cases as (*exec.Cmd).Wait.
+	Wait() error
+}
+
+// Execer starts the processes of the commands in a group.
+// The default Execer runs commands with os/exec. Tests can replace it with
+// a fake that does not spawn real processes, see package exectest.
+type Execer interface {
+	Start(cmd *exec.Cmd) (Process, error)
+}
+
+// osExecer is the Execer that uses os/exec.
+type osExecer struct{}
+
+// Start starts cmd.
+func (osExecer) Start(cmd *exec.Cmd) (Process, error) {
+	prepareCmd(cmd)
+
+	if err := cmd.Start(); err != nil {
+		return nil, err
+	}
+	return osProcess{cmd: cmd}, nil
+}
+
+// osProcess is a process that was started with os/exec.
+type osProcess struct {
+	cmd *exec.Cmd
+}
+
+// Pid returns the process ID.
+func (p osProcess) Pid() int { return p.cmd.Process.Pid }
+
+// Signal sends a signal to the process.
+func (p osProcess) Signal(sig os.Signal) error { return signalProcess(p.cmd.Process, sig) }
+
+// Wait waits for the process to exit.
+func (p osProcess) Wait() error { return p.cmd.Wait() }
+
+// WithExecer sets the Execer that starts the processes of the group's commands.
+func WithExecer(execer Execer) GroupOption {
+	return func(g *Group) {
+		g.execer = execer
+	}
+}
+
+// process returns the process of cmd, or nil if cmd was not started by the group.
+func (g *Group) process(cmd *exec.Cmd) Process {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	return g.procs[cmd]
+}
+
+// Pid returns the process ID of a command in the group.
+// It returns false if the command was not started by the group.
+func (g *Group) Pid(cmd *exec.Cmd) (int, bool) {
+	proc := g.process(cmd)
+	if proc == nil {
+		return 0, false
+	}
+	return proc.Pid(), true
+}
+
+// pid returns the process ID of cmd, or zero if cmd was not started by the group.
+func (g *Group) pid(cmd *exec.Cmd) int {
+	pid, _ := g.Pid(cmd)
+	return pid
+}
+
+// pidOf returns the process ID of proc, or zero if proc is nil.
+func pidOf(proc Process) int {
+	if proc == nil {
+		return 0
+	}
+	return proc.Pid()
+}
+
+// signal sends sig to the process of cmd.
+func (g *Group) signal(cmd *exec.Cmd, sig os.Signal) error {
+	proc := g.process(cmd)
+	if proc == nil {
+		return errors.New("command has not been started")
+	}
+	return proc.Signal(sig)
+}
@@ -0,0 +1,17 @@
+//go:build !windows
+// +build !windows
+
+package exec
+
+import (
+	"os"
+	"os/exec"
+)
+
+// prepareCmd does nothing, since processes can be signalled as they are.
+func prepareCmd(cmd *exec.Cmd) {}
+
+// signalProcess sends sig to proc.
+func signalProcess(proc *os.Process, sig os.Signal) error {
+	return proc.Signal(sig)
+}
@@ -0,0 +1,70 @@
+package exec_test
+
+import (
+	"context"
+	"os"
+	osexec "os/exec"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/scgolang/exec"
+	"github.com/scgolang/exec/exectest"
+)
+
+func TestGroupsExecer(t *testing.T) {
+	var (
+		groupName = "fakes"
+		root      = filepath.Join("testdata", "."+t.Name())
+		execer    = exectest.NewExecer(exectest.Script{Delay: -1})
+	)
+	_ = os.RemoveAll(root)
+
+	execer.SetScript("crash", exectest.Script{
+		Stdout:   "hello\n",
+		Delay:    10 * time.Millisecond,
+		ExitCode: 3,
+	})
+	gs, err := exec.New(root, exec.WithGroupOptions(exec.WithExecer(execer)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var (
+		crash = osexec.Command("crash")
+		sleep = osexec.Command("sleep", "forever")
+	)
+	defer func() { _ = gs.Remove(groupName) }() // Best effort.
+
+	if err := gs.Create(groupName, crash, sleep); err != nil {
+		t.Fatal(err)
+	}
+	if expected, got := 2, len(execer.Started()); expected != got {
+		t.Fatalf("expected %d started commands, got %d", expected, got)
+	}
+	id, _ := gs.CmdID(groupName, crash)
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+
+	if err := gs.WaitForState(ctx, groupName, id, exec.StateFailed); err != nil {
+		t.Fatal(err)
+	}
+	results, err := gs.ExitResults(groupName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected, got := 3, results[id].ExitCode; expected != got {
+		t.Fatalf("expected exit code %d, got %d", expected, got)
+	}
+	statuses, err := gs.Statuses(groupName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sleepID, _ := gs.CmdID(groupName, sleep)
+	if statuses[sleepID].PID == 0 {
+		t.Fatal("expected the fake process to have a PID")
+	}
+	if statuses[sleepID].State != exec.StateRunning {
+		t.Fatalf("expected %s to be running, got %s", sleepID, statuses[sleepID].State)
+	}
+}
@@ -0,0 +1,40 @@
+//go:build windows
+// +build windows
+
+package exec
+
+import (
+	"os"
+	"os/exec"
+	"syscall"
+
+	"github.com/pkg/errors"
+)
+
+// procGenerateConsoleCtrlEvent sends console control events, which Windows
+// programs get instead of the signals that ask them to exit.
+var procGenerateConsoleCtrlEvent = syscall.NewLazyDLL("kernel32.dll").NewProc("GenerateConsoleCtrlEvent")
+
+// prepareCmd starts the process of cmd in a console process group of its own,
+// so that it can be sent CTRL_BREAK_EVENT without it reaching this process.
+func prepareCmd(cmd *exec.Cmd) {
+	if cmd.SysProcAttr == nil {
+		cmd.SysProcAttr = &syscall.SysProcAttr{}
+	}
+	cmd.SysProcAttr.CreationFlags |= syscall.CREATE_NEW_PROCESS_GROUP
+}
+
+// signalProcess sends sig to proc. Windows does not have SIGTERM and SIGINT,
+// so they are sent as CTRL_BREAK_EVENT to the console process group of proc,
+// which lets it exit gracefully. os.Kill terminates the process, so stopping
+// a command escalates like it does elsewhere, see WithStopSignal.
+func signalProcess(proc *os.Process, sig os.Signal) error {
+	switch sig {
+	case syscall.SIGTERM, os.Interrupt:
+		if r, _, err := procGenerateConsoleCtrlEvent.Call(syscall.CTRL_BREAK_EVENT, uintptr(proc.Pid)); r == 0 {
+			return errors.Wrap(err, "sending CTRL_BREAK_EVENT")
+		}
+		return nil
+	}
+	return proc.Signal(sig)
+}
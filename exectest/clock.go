@@ -0,0 +1,78 @@
+package exectest
+
+import (
+	"sort"
+	"sync"
+	"time"
+)
+
+// Clock is a fake clock that only moves when it is told to.
+// It implements exec.Clock.
+type Clock struct {
+	now     time.Time
+	waiters []waiter
+	mu      sync.Mutex
+}
+
+// waiter is a channel that is sent the time when the clock reaches at.
+type waiter struct {
+	at time.Time
+	ch chan time.Time
+}
+
+// NewClock creates a fake clock that is set to now.
+func NewClock(now time.Time) *Clock {
+	return &Clock{now: now}
+}
+
+// Now returns the time of the clock.
+func (c *Clock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+// After returns a channel that is sent the time of the clock once it
+// has been advanced by at least d.
+func (c *Clock) After(d time.Duration) <-chan time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	ch := make(chan time.Time, 1)
+	if d <= 0 {
+		ch <- c.now
+		return ch
+	}
+	c.waiters = append(c.waiters, waiter{at: c.now.Add(d), ch: ch})
+	return ch
+}
+
+// Advance moves the clock forward by d, firing the channels returned by After
+// that are due, in order.
+func (c *Clock) Advance(d time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.now = c.now.Add(d)
+
+	sort.Slice(c.waiters, func(i, j int) bool {
+		return c.waiters[i].at.Before(c.waiters[j].at)
+	})
+	pending := c.waiters[:0]
+	for _, w := range c.waiters {
+		if w.at.After(c.now) {
+			pending = append(pending, w)
+			continue
+		}
+		w.ch <- c.now
+	}
+	c.waiters = pending
+}
+
+// Waiters returns how many calls to After are waiting for the clock to advance.
+// Tests can use it to wait until the code under test is blocked on the clock.
+func (c *Clock) Waiters() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return len(c.waiters)
+}
@@ -0,0 +1,2 @@
+// Package exectest provides fakes for testing code that uses package exec.
+package exectest
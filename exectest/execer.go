@@ -0,0 +1,191 @@
+package exectest
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"sync"
+	"syscall"
+	"time"
+
+	execpkg "github.com/scgolang/exec"
+)
+
+// firstPid is the process ID of the first process started by an Execer.
+const firstPid = 100000
+
+// Script describes what a fake process does.
+type Script struct {
+	// Stdout and Stderr are written to the command's standard output and error.
+	Stdout string
+	Stderr string
+
+	// Delay is how long the process runs before it exits on its own.
+	// Zero means it exits right after writing its output.
+	// A negative delay means it runs until it is signalled.
+	Delay time.Duration
+
+	// ExitCode is the exit code of the process when it exits on its own.
+	ExitCode int
+
+	// IgnoreSignals makes the process ignore every signal except SIGKILL.
+	IgnoreSignals bool
+}
+
+// Execer is a fake exec.Execer that runs scripts instead of spawning processes.
+// Scripts are chosen by the first argument of a command, so
+// exec.Command("sleep", "1") runs the script set for "sleep".
+type Execer struct {
+	scripts map[string]Script
+	def     Script
+	nextPid int
+	started []*exec.Cmd
+	mu      sync.Mutex
+}
+
+// NewExecer creates a fake Execer that runs def for commands without a script.
+func NewExecer(def Script) *Execer {
+	return &Execer{
+		scripts: map[string]Script{},
+		def:     def,
+		nextPid: firstPid,
+	}
+}
+
+// SetScript sets the script of the commands whose first argument is name.
+func (e *Execer) SetScript(name string, script Script) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.scripts[name] = script
+}
+
+// Started returns the commands that have been started, in order.
+func (e *Execer) Started() []*exec.Cmd {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return append([]*exec.Cmd(nil), e.started...)
+}
+
+// Start starts a fake process for cmd.
+func (e *Execer) Start(cmd *exec.Cmd) (execpkg.Process, error) {
+	e.mu.Lock()
+	script := e.def
+	if len(cmd.Args) > 0 {
+		if s, ok := e.scripts[cmd.Args[0]]; ok {
+			script = s
+		}
+	}
+	pid := e.nextPid
+	e.nextPid++
+	e.started = append(e.started, cmd)
+	e.mu.Unlock()
+
+	p := &Process{
+		pid:    pid,
+		script: script,
+		done:   make(chan struct{}),
+		sig:    make(chan os.Signal),
+	}
+	go p.run(cmd)
+	return p, nil
+}
+
+// Process is a fake process started by an Execer.
+// It implements exec.Process.
+type Process struct {
+	pid    int
+	script Script
+	err    error
+	done   chan struct{}
+	sig    chan os.Signal
+}
+
+// Pid returns the fake process ID.
+func (p *Process) Pid() int {
+	return p.pid
+}
+
+// Signal sends a signal to the process.
+// It returns os.ErrProcessDone if the process has exited.
+func (p *Process) Signal(sig os.Signal) error {
+	select {
+	case <-p.done:
+		return os.ErrProcessDone
+	case p.sig <- sig:
+		return nil
+	}
+}
+
+// Wait waits for the process to exit.
+// It returns an *ExitError if the process did not exit with code zero.
+func (p *Process) Wait() error {
+	<-p.done
+	return p.err
+}
+
+// run writes the output of the script and waits for it to exit.
+func (p *Process) run(cmd *exec.Cmd) {
+	defer close(p.done)
+
+	write(cmd.Stdout, p.script.Stdout)
+	write(cmd.Stderr, p.script.Stderr)
+
+	var timeout <-chan time.Time
+	if p.script.Delay >= 0 {
+		timeout = time.After(p.script.Delay)
+	}
+	for {
+		select {
+		case <-timeout:
+			p.err = exitError(p.script.ExitCode, nil)
+			return
+		case sig := <-p.sig:
+			if sig == syscall.SIGKILL || !p.script.IgnoreSignals {
+				p.err = exitError(-1, sig)
+				return
+			}
+		}
+	}
+}
+
+// write writes s to w and closes w if it is a file other than os.Stdout and os.Stderr,
+// for example a pipe created by (*exec.Cmd).StdoutPipe.
+func write(w io.Writer, s string) {
+	if w == nil {
+		return
+	}
+	_, _ = io.WriteString(w, s)
+
+	if f, ok := w.(*os.File); ok && f != os.Stdout && f != os.Stderr {
+		_ = f.Close()
+	}
+}
+
+// ExitError is returned by Wait when a fake process exits with a non-zero
+// exit code or because of a signal.
+type ExitError struct {
+	Code   int
+	Signal os.Signal
+}
+
+// exitError returns nil for a clean exit, otherwise an *ExitError.
+func exitError(code int, sig os.Signal) error {
+	if code == 0 && sig == nil {
+		return nil
+	}
+	return &ExitError{Code: code, Signal: sig}
+}
+
+// ExitCode returns the exit code of the process, or -1 if it was killed by a signal.
+func (e *ExitError) ExitCode() int {
+	return e.Code
+}
+
+// Error returns the same message as *exec.ExitError.
+func (e *ExitError) Error() string {
+	if e.Signal != nil {
+		return "signal: " + e.Signal.String()
+	}
+	return fmt.Sprintf("exit status %d", e.Code)
+}
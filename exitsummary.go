@@ -0,0 +1,86 @@
+package exec
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// ExitSummary is a line of the .events file of a command, which has a line
+// for every exit of the command, so that its exits can be analysed without
+// the database, see EventsFilename. It encodes as JSON.
+type ExitSummary struct {
+	Time    time.Time `json:"time"`
+	Group   string    `json:"group"`
+	Command string    `json:"command"`
+	PID     int       `json:"pid,omitempty"`
+
+	// ExitCode is the exit code of the process, or -1 if it was terminated
+	// by a signal, whose name is Signal, see SignalName.
+	ExitCode int    `json:"exit_code"`
+	Signal   string `json:"signal,omitempty"`
+
+	// Duration is how long, in seconds, the process ran.
+	Duration float64 `json:"duration"`
+
+	// MaxRSS is the largest resident set size of the process, in bytes,
+	// zero where it is not known.
+	MaxRSS int64 `json:"max_rss,omitempty"`
+
+	// Error is the error the command exited with, if any.
+	Error string `json:"error,omitempty"`
+}
+
+// EventsFilename returns the name of the file, in the directory of its
+// group, that the exit summaries of a command are appended to.
+func EventsFilename(commandID string) string {
+	return commandID + ".events"
+}
+
+// newExitSummary returns the summary of an exit of a command.
+func newExitSummary(groupName, commandID string, pid int, result ExitResult) ExitSummary {
+	summary := ExitSummary{
+		Time:     result.Exited,
+		Group:    groupName,
+		Command:  commandID,
+		PID:      pid,
+		ExitCode: result.ExitCode,
+		Duration: result.Duration.Seconds(),
+	}
+	if result.ProcessState != nil {
+		summary.Signal, summary.MaxRSS = processStateUsage(result.ProcessState)
+	}
+	if result.Err != nil {
+		summary.Error = result.Err.Error()
+	}
+	return summary
+}
+
+// writeExitSummary appends the summary of an exit of a command to its .events file.
+func (g *Groups) writeExitSummary(groupName, commandID string, pid int, result ExitResult) {
+	if err := g.appendExitSummary(newExitSummary(groupName, commandID, pid, result)); err != nil {
+		g.logf("writing exit summary of %s in group %s: %s", commandID, groupName, err)
+	}
+}
+
+// appendExitSummary appends an exit summary to the .events file of its command.
+func (g *Groups) appendExitSummary(summary ExitSummary) error {
+	data, err := json.Marshal(summary)
+	if err != nil {
+		return errors.Wrap(err, "encoding exit summary")
+	}
+	path := filepath.Join(g.root, summary.Group, EventsFilename(summary.Command))
+
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_APPEND, g.logPerms)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(append(data, '\n')); err != nil {
+		_ = f.Close()
+		return err
+	}
+	return f.Close()
+}
@@ -0,0 +1,28 @@
+//go:build !windows
+// +build !windows
+
+package exec
+
+import (
+	"os"
+	"runtime"
+	"syscall"
+)
+
+// processStateUsage returns the name of the signal that terminated a process,
+// if one did, and the largest resident set size of the process in bytes.
+func processStateUsage(state *os.ProcessState) (string, int64) {
+	var signal string
+	if ws, ok := state.Sys().(syscall.WaitStatus); ok && ws.Signaled() {
+		signal = SignalName(ws.Signal())
+	}
+	ru, ok := state.SysUsage().(*syscall.Rusage)
+	if !ok {
+		return signal, 0
+	}
+	maxRSS := int64(ru.Maxrss)
+	if runtime.GOOS != "darwin" {
+		maxRSS *= 1024 // Kilobytes everywhere but on macOS.
+	}
+	return signal, maxRSS
+}
@@ -0,0 +1,56 @@
+package exec_test
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	osexec "os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/scgolang/exec"
+)
+
+func TestGroupsExitSummary(t *testing.T) {
+	var (
+		groupName = "exitsummary"
+		root      = filepath.Join("testdata", "."+t.Name())
+	)
+	_ = os.RemoveAll(root)
+
+	var (
+		gs  = newTestGroups(t, root)
+		cmd = osexec.Command("sh", "-c", "exit 3")
+	)
+	if err := gs.Create(groupName, cmd); err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = gs.Remove(groupName) }()
+
+	if err := gs.Wait(groupName); err == nil {
+		t.Fatal("expected an error")
+	}
+	id, _ := gs.CmdID(groupName, cmd)
+	data, err := ioutil.ReadFile(filepath.Join(root, groupName, exec.EventsFilename(id)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(strings.TrimSuffix(string(data), "\n"), "\n")
+	if expected, got := 1, len(lines); expected != got {
+		t.Fatalf("expected %d exit summary, got %d", expected, got)
+	}
+	var summary exec.ExitSummary
+	if err := json.Unmarshal([]byte(lines[0]), &summary); err != nil {
+		t.Fatal(err)
+	}
+	if expected, got := 3, summary.ExitCode; expected != got {
+		t.Fatalf("expected exit code %d, got %d", expected, got)
+	}
+	if expected, got := id, summary.Command; expected != got {
+		t.Fatalf("expected command %s, got %s", expected, got)
+	}
+	if summary.PID == 0 || summary.Signal != "" || summary.Error == "" {
+		t.Fatalf("unexpected exit summary %+v", summary)
+	}
+}
@@ -0,0 +1,12 @@
+//go:build windows
+// +build windows
+
+package exec
+
+import "os"
+
+// processStateUsage returns nothing, since Windows processes are not
+// terminated by signals and their resident set size is not reported.
+func processStateUsage(state *os.ProcessState) (string, int64) {
+	return "", 0
+}
@@ -0,0 +1,335 @@
+package exec
+
+import (
+	"database/sql"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+	"github.com/pkg/errors"
+)
+
+// fileChangeDebounce is how long a file watcher waits for changes to settle
+// before restarting its command, so that a burst of writes results in one restart.
+const fileChangeDebounce = 100 * time.Millisecond
+
+// fileWatcher restarts a command when files matching any of its patterns change.
+type fileWatcher struct {
+	patterns []string
+	watcher  *fsnotify.Watcher
+	clock    Clock
+	restart  func()
+	done     chan struct{}
+}
+
+// newFileWatcher creates a file watcher that calls restart when a file
+// matching one of patterns is created, written, removed, or renamed.
+// Relative patterns are resolved against dir.
+func newFileWatcher(dir string, patterns []string, clock Clock, restart func()) (*fileWatcher, error) {
+	w, err := fsnotify.NewWatcher()
+	if err != nil {
+		return nil, errors.Wrap(err, "creating fsnotify watcher")
+	}
+	fw := &fileWatcher{
+		watcher: w,
+		clock:   clock,
+		restart: restart,
+		done:    make(chan struct{}),
+	}
+	dirs := map[string]struct{}{}
+
+	for _, pattern := range patterns {
+		if !filepath.IsAbs(pattern) {
+			pattern = filepath.Join(dir, pattern)
+		}
+		fw.patterns = append(fw.patterns, pattern)
+
+		matches, err := filepath.Glob(pattern)
+		if err != nil {
+			_ = w.Close()
+			return nil, errors.Wrap(err, "expanding "+pattern)
+		}
+		// Watch directories rather than files so that editors which
+		// save by renaming a new file into place still trigger a restart.
+		for _, match := range matches {
+			dirs[filepath.Dir(match)] = struct{}{}
+		}
+		if !hasMeta(pattern) {
+			if info, err := os.Stat(pattern); err == nil && info.IsDir() {
+				dirs[pattern] = struct{}{}
+				continue
+			}
+		}
+		if parent := filepath.Dir(pattern); !hasMeta(parent) {
+			dirs[parent] = struct{}{}
+		}
+	}
+	for d := range dirs {
+		if err := w.Add(d); err != nil {
+			_ = w.Close()
+			return nil, errors.Wrap(err, "watching "+d)
+		}
+	}
+	go fw.run()
+
+	return fw, nil
+}
+
+// run restarts the command after matching file events have settled.
+func (fw *fileWatcher) run() {
+	var settled <-chan time.Time
+
+	for {
+		select {
+		case <-fw.done:
+			return
+		case ev, ok := <-fw.watcher.Events:
+			if !ok {
+				return
+			}
+			if ev.Op == fsnotify.Chmod || !fw.matches(ev.Name) {
+				continue
+			}
+			settled = fw.clock.After(fileChangeDebounce)
+		case _, ok := <-fw.watcher.Errors:
+			if !ok {
+				return
+			}
+		case <-settled:
+			settled = nil
+			fw.restart()
+		}
+	}
+}
+
+// matches returns true if name matches any of the watcher's patterns.
+func (fw *fileWatcher) matches(name string) bool {
+	for _, pattern := range fw.patterns {
+		if pattern == name || pattern == filepath.Dir(name) {
+			return true
+		}
+		if ok, _ := filepath.Match(pattern, name); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// Close stops the file watcher.
+func (fw *fileWatcher) Close() error {
+	close(fw.done)
+	return fw.watcher.Close()
+}
+
+// RestartOnChange sets the files that the provided command watches.
+// When any file matching one of patterns changes, the command is gracefully
+// restarted: it is sent SIGTERM, killed if it has not exited after a short
+// timeout, and a fresh copy of it started.
+// Patterns use filepath.Match syntax and relative patterns are resolved against
+// the command's Dir. Calling RestartOnChange with no patterns stops watching.
+// The watch list is persisted and reinstated when the group is opened.
+func (g *Groups) RestartOnChange(groupName string, cmd *exec.Cmd, patterns ...string) error {
+	if g.getGroup(groupName) == nil {
+		return errors.Errorf("group %s not found", groupName)
+	}
+	commandID, err := g.cmdID(groupName, cmd)
+	if err != nil {
+		return errors.Wrap(err, "getting command ID")
+	}
+	tx, err := g.db.Begin()
+	if err != nil {
+		return errors.Wrap(err, "starting transaction")
+	}
+	if err := g.setCmdWatchTx(tx, groupName, commandID, patterns); err != nil {
+		_ = tx.Rollback()
+		return err
+	}
+	if err := tx.Commit(); err != nil {
+		return errors.Wrap(err, "committing transaction")
+	}
+	return g.watchFiles(groupName, cmd, patterns)
+}
+
+// watchFiles replaces the file watcher for a command.
+func (g *Groups) watchFiles(groupName string, cmd *exec.Cmd, patterns []string) error {
+	commandID, err := g.cmdID(groupName, cmd)
+	if err != nil {
+		return errors.Wrap(err, "getting command ID")
+	}
+	if err := g.unwatchFiles(groupName, commandID); err != nil {
+		return errors.Wrap(err, "closing file watcher")
+	}
+	if len(patterns) == 0 {
+		return nil
+	}
+	fw, err := newFileWatcher(cmd.Dir, patterns, g.clock, func() {
+		if err := g.restart(groupName, commandID); err != nil {
+			if grp := g.getGroup(groupName); grp != nil {
+				grp.setState(cmd, StateFailed, errors.Wrap(err, "restarting after file change"))
+			}
+		}
+	})
+	if err != nil {
+		return err
+	}
+	g.fileWatchersMu.Lock()
+	if g.fileWatchers[groupName] == nil {
+		g.fileWatchers[groupName] = map[string]*fileWatcher{}
+	}
+	g.fileWatchers[groupName][commandID] = fw
+	g.fileWatchersMu.Unlock()
+
+	return nil
+}
+
+// rewatchFiles moves the file watcher of the command with ID oldID over to cmd,
+// using the watch list that is stored for cmd.
+func (g *Groups) rewatchFiles(groupName, oldID string, cmd *exec.Cmd) error {
+	if err := g.unwatchFiles(groupName, oldID); err != nil {
+		return errors.Wrap(err, "closing file watcher")
+	}
+	commandID, err := g.cmdID(groupName, cmd)
+	if err != nil {
+		return errors.Wrap(err, "getting command ID")
+	}
+	tx, err := g.db.Begin()
+	if err != nil {
+		return errors.Wrap(err, "starting transaction")
+	}
+	defer func() { _ = tx.Rollback() }() // Read only.
+
+	patterns, err := g.getCmdWatchTx(tx, groupName, commandID)
+	if err != nil {
+		return err
+	}
+	return g.watchFiles(groupName, cmd, patterns)
+}
+
+// unwatchFiles closes the file watchers of the commands with the provided IDs.
+// If no command IDs are provided then all the file watchers in the group are closed.
+func (g *Groups) unwatchFiles(groupName string, commandIDs ...string) error {
+	g.fileWatchersMu.Lock()
+	defer g.fileWatchersMu.Unlock()
+
+	watchers := g.fileWatchers[groupName]
+	if len(commandIDs) == 0 {
+		delete(g.fileWatchers, groupName)
+	} else {
+		m := map[string]*fileWatcher{}
+		for _, commandID := range commandIDs {
+			if fw, ok := watchers[commandID]; ok {
+				m[commandID] = fw
+				delete(watchers, commandID)
+			}
+		}
+		watchers = m
+	}
+	for _, fw := range watchers {
+		if err := fw.Close(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// removeWatchTx stops watching files for the commands with the provided IDs and
+// deletes their watch lists.
+// If no command IDs are provided then this is done for every command in the group.
+func (g *Groups) removeWatchTx(tx *sql.Tx, groupName string, commandIDs ...string) error {
+	if len(commandIDs) == 0 {
+		if _, err := g.exec(tx, deleteGroupWatch, groupName); err != nil {
+			return err
+		}
+		return errors.Wrap(g.unwatchFiles(groupName), "closing file watchers")
+	}
+	for _, commandID := range commandIDs {
+		if err := g.setCmdWatchTx(tx, groupName, commandID, nil); err != nil {
+			return err
+		}
+	}
+	return errors.Wrap(g.unwatchFiles(groupName, commandIDs...), "closing file watchers")
+}
+
+var getCommandWatch = newQuery("getting command watch list", `
+SELECT		pattern
+FROM		command_watch
+WHERE		group_name = ? AND command_id = ?
+ORDER BY	rowid`)
+
+var getGroupWatch = newQuery("getting group watch lists", `
+SELECT		command_id, pattern
+FROM		command_watch
+WHERE		group_name = ?
+ORDER BY	rowid`)
+
+var insertCommandWatch = newQuery("inserting command watch pattern", `
+INSERT INTO	command_watch (command_id, group_name, pattern)
+VALUES		(?, ?, ?)`)
+
+var deleteCommandWatch = newQuery("deleting command watch list", `
+DELETE FROM	command_watch
+WHERE		group_name = ? AND command_id = ?`)
+
+var deleteGroupWatch = newQuery("deleting group watch lists", `
+DELETE FROM	command_watch
+WHERE		group_name = ?`)
+
+// getGroupWatchTx gets the watch lists of all the commands in a group, keyed by instance ID.
+func (g *Groups) getGroupWatchTx(tx *sql.Tx, groupName string) (map[string][]string, error) {
+	rows, err := g.queryRows(tx, getGroupWatch, groupName)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = rows.Close() }() // Best effort.
+
+	watch := map[string][]string{}
+	for rows.Next() {
+		var commandID, pattern string
+		if err := rows.Scan(&commandID, &pattern); err != nil {
+			return nil, err
+		}
+		watch[commandID] = append(watch[commandID], pattern)
+	}
+	return watch, rows.Err()
+}
+
+// getCmdWatchTx gets the watch list of a command.
+func (g *Groups) getCmdWatchTx(tx *sql.Tx, groupName, commandID string) ([]string, error) {
+	rows, err := g.queryRows(tx, getCommandWatch, groupName, commandID)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = rows.Close() }() // Best effort.
+
+	patterns := []string{}
+	for rows.Next() {
+		var pattern string
+		if err := rows.Scan(&pattern); err != nil {
+			return nil, err
+		}
+		patterns = append(patterns, pattern)
+	}
+	return patterns, rows.Err()
+}
+
+// setCmdWatchTx replaces the watch list of a command.
+func (g *Groups) setCmdWatchTx(tx *sql.Tx, groupName, commandID string, patterns []string) error {
+	if _, err := g.exec(tx, deleteCommandWatch, groupName, commandID); err != nil {
+		return err
+	}
+	for _, pattern := range patterns {
+		if _, err := g.exec(tx, insertCommandWatch, commandID, groupName, pattern); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// hasMeta reports whether path contains any of the magic characters
+// recognized by filepath.Match.
+func hasMeta(path string) bool {
+	return strings.ContainsAny(path, `*?[`)
+}
@@ -0,0 +1,70 @@
+package exec_test
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	osexec "os/exec"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/scgolang/exec"
+)
+
+func TestGroupsRestartOnChange(t *testing.T) {
+	var (
+		groupName = "sleeper"
+		root      = filepath.Join("testdata", "."+t.Name())
+		watched   = filepath.Join(root, "watched")
+	)
+	_ = os.RemoveAll(root)
+
+	var (
+		gs          = newTestGroups(t, root)
+		cmd         = osexec.Command("sleep", "10")
+		ctx, cancel = context.WithCancel(context.Background())
+	)
+	defer cancel()
+
+	if err := os.Mkdir(watched, exec.DirPerms); err != nil {
+		t.Fatal(err)
+	}
+	cmd.Dir = watched
+
+	if err := gs.Create(groupName, cmd); err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = gs.Remove(groupName) }()
+
+	if err := gs.RestartOnChange(groupName, cmd, "*.conf"); err != nil {
+		t.Fatal(err)
+	}
+	changes, err := gs.Watch(ctx, groupName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(watched, "app.conf"), []byte("foo"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	for _, expected := range []exec.State{exec.StateRestarting, exec.StateRunning} {
+		select {
+		case <-time.After(5 * time.Second):
+			t.Fatalf("timeout waiting for %s", expected)
+		case change := <-changes:
+			if got := change.To; expected != got {
+				t.Fatalf("expected state %s, got %s", expected, got)
+			}
+		}
+	}
+	cmds, ok := gs.Commands(groupName)
+	if !ok {
+		t.Fatal("group does not exist")
+	}
+	if expected, got := 1, len(cmds); expected != got {
+		t.Fatalf("expected %d commands, got %d", expected, got)
+	}
+	if cmds[0] == cmd {
+		t.Fatal("expected command to have been replaced")
+	}
+}
@@ -0,0 +1,133 @@
+package exec
+
+import (
+	"database/sql"
+	"os/exec"
+
+	"github.com/pkg/errors"
+)
+
+// CommandInfo describes a command that is stored with a group.
+type CommandInfo struct {
+	// ID is the instance ID of the command.
+	ID string
+
+	// Name is the name of the command, if it has one.
+	Name string
+
+	// Cmd is the running instance of the command.
+	// It is nil if the group is not open or the command is not running.
+	Cmd *exec.Cmd
+
+	// Definition is the stored definition of the command.
+	Definition SnapshotCommand
+}
+
+// SetCommandName names a command so that it can be found with FindCommand.
+// cmdID is the instance ID of the command or its content hash.
+// Names are persisted with the group and must be unique within it.
+// Setting an empty name removes the command's name.
+func (g *Groups) SetCommandName(groupName, cmdID, name string) error {
+	tx, err := g.db.Begin()
+	if err != nil {
+		return errors.Wrap(err, "starting transaction")
+	}
+	if err := g.setCmdNameTx(tx, groupName, cmdID, name); err != nil {
+		_ = tx.Rollback()
+		return err
+	}
+	return errors.Wrap(tx.Commit(), "committing transaction")
+}
+
+// setCmdNameTx names a command using the provided transaction.
+func (g *Groups) setCmdNameTx(tx *sql.Tx, groupName, cmdID, name string) error {
+	_, id, err := g.getStoredCmdTx(tx, groupName, cmdID)
+	if err != nil {
+		return err
+	}
+	if name == "" {
+		_, err := g.exec(tx, deleteCommandSetting, groupName, id, settingName)
+		return errors.Wrap(err, settingName)
+	}
+	other, ok, err := g.getCmdIDByNameTx(tx, groupName, name)
+	if err != nil {
+		return err
+	}
+	if ok && other != id {
+		return errors.Errorf("command %s in group %s is already named %s", other, groupName, name)
+	}
+	return g.setCmdSettingTx(tx, groupName, id, settingName, name)
+}
+
+var getCommandIDByName = newQuery("getting command by name", `
+SELECT	command_id
+FROM	command_settings
+WHERE	group_name = ? AND name = ? AND value = ?`)
+
+// getCmdIDByNameTx gets the instance ID of the command with the provided name.
+// It returns false if no command in the group has the name.
+func (g *Groups) getCmdIDByNameTx(tx *sql.Tx, groupName, name string) (string, bool, error) {
+	var id string
+	if err := g.queryRow(tx, getCommandIDByName, []interface{}{groupName, settingName, name}, &id); err != nil {
+		if err == sql.ErrNoRows {
+			return "", false, nil
+		}
+		return "", false, err
+	}
+	return id, true, nil
+}
+
+// FindCommand looks up a command that is stored with a group by its
+// instance ID, its content hash, or the name given to it with SetCommandName.
+// The group does not have to be open.
+func (g *Groups) FindCommand(groupName, idOrName string) (CommandInfo, error) {
+	tx, err := g.db.Begin()
+	if err != nil {
+		return CommandInfo{}, errors.Wrap(err, "starting transaction")
+	}
+	defer func() { _ = tx.Rollback() }() // Read only.
+
+	return g.findCmdTx(tx, groupName, idOrName)
+}
+
+// findCmdTx looks up a command using the provided transaction.
+func (g *Groups) findCmdTx(tx *sql.Tx, groupName, idOrName string) (CommandInfo, error) {
+	cmdID, ok, err := g.getCmdIDByNameTx(tx, groupName, idOrName)
+	if err != nil {
+		return CommandInfo{}, err
+	}
+	if !ok {
+		cmdID = idOrName
+	}
+	def, id, err := g.getStoredCmdTx(tx, groupName, cmdID)
+	if err != nil {
+		return CommandInfo{}, err
+	}
+	settings, err := g.getCmdSettingsTx(tx, groupName, id)
+	if err != nil {
+		return CommandInfo{}, err
+	}
+	watch, err := g.getCmdWatchTx(tx, groupName, id)
+	if err != nil {
+		return CommandInfo{}, err
+	}
+	info := CommandInfo{
+		ID:   id,
+		Name: settings[settingName],
+		Definition: SnapshotCommand{
+			ID:       id,
+			Path:     def.Path,
+			Args:     def.Args,
+			Env:      def.Env,
+			Dir:      def.Dir,
+			Settings: settings,
+			Watch:    watch,
+		},
+	}
+	if grp := g.getGroup(groupName); grp != nil {
+		if info.Cmd = grp.lookup(id); info.Cmd != nil {
+			info.Definition.Running = grp.State(info.Cmd) == StateRunning
+		}
+	}
+	return info, nil
+}
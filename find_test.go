@@ -0,0 +1,59 @@
+package exec_test
+
+import (
+	"os"
+	osexec "os/exec"
+	"path/filepath"
+	"testing"
+)
+
+func TestGroupsFindCommand(t *testing.T) {
+	var (
+		groupName = "sleepers"
+		root      = filepath.Join("testdata", "."+t.Name())
+	)
+	_ = os.RemoveAll(root)
+
+	var (
+		gs = newTestGroups(t, root)
+		c1 = osexec.Command("sleep", "10")
+		c2 = osexec.Command("sleep", "11")
+	)
+	defer func() { _ = gs.Remove(groupName) }() // Best effort.
+
+	if err := gs.Create(groupName, c1, c2); err != nil {
+		t.Fatal(err)
+	}
+	id, _ := gs.CmdID(groupName, c1)
+
+	if err := gs.SetCommandName(groupName, id, "web"); err != nil {
+		t.Fatal(err)
+	}
+	if err := gs.SetCommandName(groupName, getCommandID(c2, t), "web"); err == nil {
+		t.Fatal("expected an error, got nil")
+	}
+	for _, key := range []string{id, getCommandID(c1, t), "web"} {
+		info, err := gs.FindCommand(groupName, key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if expected, got := id, info.ID; expected != got {
+			t.Fatalf("expected ID %s, got %s", expected, got)
+		}
+		if expected, got := "web", info.Name; expected != got {
+			t.Fatalf("expected name %s, got %s", expected, got)
+		}
+		if info.Cmd != c1 {
+			t.Fatal("expected the running command")
+		}
+		if expected, got := "sleep 10", info.Definition.Args[0]+" "+info.Definition.Args[1]; expected != got {
+			t.Fatalf("expected args %s, got %s", expected, got)
+		}
+		if !info.Definition.Running {
+			t.Fatal("expected the command to be running")
+		}
+	}
+	if _, err := gs.FindCommand(groupName, "nope"); err == nil {
+		t.Fatal("expected an error, got nil")
+	}
+}
@@ -0,0 +1,125 @@
+package exec
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"runtime/debug"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// Fingerprint records what ran a command and where, so that the run history
+// tells which build of a program was running when it failed.
+type Fingerprint struct {
+	// ManagerVersion is the version of the program that manages the groups,
+	// see WithVersion, and Hostname and Platform, like linux/amd64, are
+	// where it runs.
+	ManagerVersion string `json:"manager_version,omitempty"`
+	Hostname       string `json:"hostname,omitempty"`
+	Platform       string `json:"platform,omitempty"`
+
+	// BinaryPath is the path of the executable of the command with symbolic
+	// links resolved, and BinarySHA256 is the hex-encoded SHA-256 of its
+	// contents. BinarySHA256 is empty if the executable could not be read.
+	BinaryPath   string `json:"binary_path,omitempty"`
+	BinarySHA256 string `json:"binary_sha256,omitempty"`
+}
+
+// WithVersion sets the version of the program that manages the groups,
+// which is recorded with every run, see Fingerprint. The default is the
+// version of the main module of the program, if it was built with module
+// support, or an empty string.
+func WithVersion(version string) Option {
+	return func(g *Groups) error {
+		g.version = version
+		return nil
+	}
+}
+
+// mainVersion returns the version of the main module of the program.
+func mainVersion() string {
+	if info, ok := debug.ReadBuildInfo(); ok {
+		return info.Main.Version
+	}
+	return ""
+}
+
+// logBanner logs what manages the groups and where.
+func (g *Groups) logBanner() {
+	g.logf("managing groups in %s with version %q on %s (%s/%s)", g.root, g.version, g.hostname, runtime.GOOS, runtime.GOARCH)
+}
+
+// fingerprint returns the fingerprint of a run of cmd.
+func (g *Groups) fingerprint(cmd *exec.Cmd) Fingerprint {
+	fp := Fingerprint{
+		ManagerVersion: g.version,
+		Hostname:       g.hostname,
+		Platform:       runtime.GOOS + "/" + runtime.GOARCH,
+		BinaryPath:     cmd.Path,
+	}
+	if path, err := filepath.EvalSymlinks(cmd.Path); err == nil {
+		fp.BinaryPath = path
+	}
+	sum, err := g.binaryHashes.sum(fp.BinaryPath)
+	if err != nil {
+		g.logf("hashing %s: %s", fp.BinaryPath, err)
+	}
+	fp.BinarySHA256 = sum
+	return fp
+}
+
+// binaryHashes caches the SHA-256 of executables, so that they are only
+// read again when they change.
+type binaryHashes struct {
+	mu     sync.Mutex
+	hashes map[string]binaryHash
+}
+
+// binaryHash is the SHA-256 of an executable with the provided size and modification time.
+type binaryHash struct {
+	size    int64
+	modTime time.Time
+	sum     string
+}
+
+// sum returns the hex-encoded SHA-256 of the file at path.
+func (bh *binaryHashes) sum(path string) (string, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return "", err
+	}
+	bh.mu.Lock()
+	h, ok := bh.hashes[path]
+	bh.mu.Unlock()
+
+	if ok && h.size == info.Size() && h.modTime.Equal(info.ModTime()) {
+		return h.sum, nil
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer func() { _ = f.Close() }() // Read only.
+
+	hash := sha256.New()
+	if _, err := io.Copy(hash, f); err != nil {
+		return "", errors.Wrap(err, "reading executable")
+	}
+	h = binaryHash{size: info.Size(), modTime: info.ModTime(), sum: hex.EncodeToString(hash.Sum(nil))}
+
+	bh.mu.Lock()
+	if bh.hashes == nil {
+		bh.hashes = map[string]binaryHash{}
+	}
+	bh.hashes[path] = h
+	bh.mu.Unlock()
+
+	return h.sum, nil
+}
@@ -0,0 +1,158 @@
+package exec
+
+import (
+	"database/sql"
+	"os"
+	"path/filepath"
+
+	"github.com/pkg/errors"
+)
+
+var deleteGroupRuns = newQuery("deleting group runs", `
+DELETE FROM	runs
+WHERE		group_name = ?`)
+
+var deleteGroupSnapshots = newQuery("deleting group snapshots", `
+DELETE FROM	snapshots
+WHERE		group_name = ?`)
+
+var deleteGroupQuota = newQuery("deleting group quota", `
+DELETE FROM	group_quotas
+WHERE		group_name = ?`)
+
+// The args and env of the commands that ran in a group are found through
+// its run history, since they are keyed by instance ID only.
+
+var deleteGroupRunArgs = newQuery("deleting args of group runs", `
+DELETE FROM	command_args
+WHERE		command_id IN (SELECT command_id FROM runs WHERE group_name = ?)`)
+
+var deleteGroupRunEnv = newQuery("deleting env of group runs", `
+DELETE FROM	command_env
+WHERE		command_id IN (SELECT command_id FROM runs WHERE group_name = ?)`)
+
+var deleteGroupRunEnvBlocks = newQuery("deleting env blocks of group runs", `
+DELETE FROM	command_env_blocks
+WHERE		command_id IN (SELECT command_id FROM runs WHERE group_name = ?)`)
+
+var getGroupScheduledRuns = newQuery("getting group scheduled runs", `
+SELECT		schedule_id
+FROM		scheduled_runs
+WHERE		group_name = ?`)
+
+// WithGroupGC deletes everything that is left of a group once its last
+// command has been removed: its directory with the log files of its commands,
+// the args, environments, and settings of its commands, and its run history,
+// snapshots, quota, and scheduled runs. The group is
+// forgotten, so it is as if it had never been created. This keeps the root
+// and the database tidy when groups are short-lived.
+func WithGroupGC() Option {
+	return func(g *Groups) error {
+		g.groupGC = true
+		return nil
+	}
+}
+
+// collectGroup deletes what is left of a group if it has no commands, see WithGroupGC.
+func (g *Groups) collectGroup(groupName string) error {
+	grp := g.getGroup(groupName)
+	if grp != nil && len(grp.Commands()) > 0 {
+		return nil
+	}
+	if grp == nil || !grp.ephemeral {
+		// Record queued state changes first, or they bring the run history back.
+		g.flushRuns()
+
+		tx, err := g.db.Begin()
+		if err != nil {
+			return errors.Wrap(err, "starting transaction")
+		}
+		empty, err := g.collectGroupTx(tx, groupName)
+		if err != nil {
+			_ = tx.Rollback()
+			return err
+		}
+		if err := tx.Commit(); err != nil {
+			return errors.Wrap(err, "committing transaction")
+		}
+		if !empty {
+			return nil
+		}
+	}
+	if err := os.RemoveAll(filepath.Join(g.root, groupName)); err != nil {
+		return errors.Wrap(err, "removing group directory")
+	}
+	g.groupsMu.Lock()
+	if g.groups[groupName] == grp {
+		delete(g.groups, groupName)
+	}
+	g.groupsMu.Unlock()
+	return nil
+}
+
+// collectGroupTx deletes the rows of a group that has no stored commands,
+// and returns false without deleting anything if it has some.
+func (g *Groups) collectGroupTx(tx *sql.Tx, groupName string) (bool, error) {
+	ids, err := g.getGroupIDsTx(tx, groupName)
+	if err != nil {
+		return false, err
+	}
+	if len(ids) > 0 {
+		return false, nil
+	}
+	scheduled, err := g.getGroupScheduledRunsTx(tx, groupName)
+	if err != nil {
+		return false, err
+	}
+	for _, id := range scheduled {
+		if _, err := g.exec(tx, deleteScheduledRun, id); err != nil {
+			return false, err
+		}
+	}
+	for _, q := range []query{
+		deleteGroupRunArgs,
+		deleteGroupRunEnv,
+		deleteGroupRunEnvBlocks,
+		deleteGroupSettings,
+		deleteGroupWatch,
+		deleteGroupRuns,
+		deleteGroupSnapshots,
+		deleteGroupQuota,
+	} {
+		if _, err := g.exec(tx, q, groupName); err != nil {
+			return false, err
+		}
+	}
+	if _, err := g.exec(tx, deleteUnusedEnvBlocks); err != nil {
+		return false, err
+	}
+	g.scheduledMu.Lock()
+	for _, id := range scheduled {
+		if cancel, ok := g.scheduled[id]; ok {
+			close(cancel)
+			delete(g.scheduled, id)
+		}
+	}
+	g.scheduledMu.Unlock()
+
+	return true, nil
+}
+
+// getGroupScheduledRunsTx gets the IDs of the runs scheduled for the commands of a group.
+func (g *Groups) getGroupScheduledRunsTx(tx *sql.Tx, groupName string) ([]int64, error) {
+	rows, err := g.queryRows(tx, getGroupScheduledRuns, groupName)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = rows.Close() }() // Best effort.
+
+	ids := []int64{}
+	for rows.Next() {
+		var id int64
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+	return ids, rows.Err()
+}
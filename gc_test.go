@@ -0,0 +1,83 @@
+package exec_test
+
+import (
+	"database/sql"
+	"os"
+	osexec "os/exec"
+	"path/filepath"
+	"testing"
+
+	"github.com/scgolang/exec"
+)
+
+func TestWithGroupGC(t *testing.T) {
+	var (
+		groupName = "churn"
+		root      = filepath.Join("testdata", "."+t.Name())
+	)
+	_ = os.RemoveAll(root)
+
+	gs, err := exec.New(root, exec.WithDBFile("groups.db"), exec.WithGroupGC())
+	if err != nil {
+		t.Fatal(err)
+	}
+	var (
+		c1 = osexec.Command("echo", "foo")
+		c2 = osexec.Command("echo", "bar")
+	)
+	c1.Env = []string{"SECRET=hunter2"}
+
+	if err := gs.SetQuota(groupName, exec.Quota{MaxCommands: 2}); err != nil {
+		t.Fatal(err)
+	}
+	if err := gs.Create(groupName, c1, c2); err != nil {
+		t.Fatal(err)
+	}
+	if err := gs.Wait(groupName); err != nil {
+		t.Fatal(err)
+	}
+	if err := gs.Remove(groupName, c1); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(filepath.Join(root, groupName)); err != nil {
+		t.Fatalf("expected the group directory to be kept while the group has commands, got %v", err)
+	}
+	if err := gs.Remove(groupName, c2); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(filepath.Join(root, groupName)); !os.IsNotExist(err) {
+		t.Fatalf("expected the group directory to be removed, got %v", err)
+	}
+	if _, ok := gs.Commands(groupName); ok {
+		t.Fatal("expected the group to be forgotten")
+	}
+	runs, err := gs.Runs(groupName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(runs) != 0 {
+		t.Fatalf("expected the run history to be deleted, got %+v", runs)
+	}
+	db, err := sql.Open("sqlite3", filepath.Join(root, "groups.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = db.Close() }()
+
+	for _, table := range []string{"processes", "command_args", "command_env", "command_settings"} {
+		var got int
+		if err := db.QueryRow(`SELECT COUNT(*) FROM ` + table).Scan(&got); err != nil {
+			t.Fatal(err)
+		}
+		if got != 0 {
+			t.Fatalf("expected no rows in %s, got %d", table, got)
+		}
+	}
+	q, err := gs.Quota(groupName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if q != (exec.Quota{}) {
+		t.Fatalf("expected the quota to be deleted, got %+v", q)
+	}
+}
@@ -1,96 +1,278 @@
 package exec
 
 import (
+	"context"
 	"os"
 	"os/exec"
 	"strings"
+	"sync"
 	"syscall"
 	"time"
 
 	"github.com/pkg/errors"
 )
 
+// watchBufferSize is the number of state changes buffered for each watcher.
+const watchBufferSize = 64
+
 // Group runs a set of commands.
 type Group struct {
 	cmds   []*exec.Cmd
 	done   chan *exec.Cmd
 	errors chan CmdError
+
+	// name is the name of the group, if it is managed by Groups, and
+	// ephemeral is true if Groups does not store it, see CreateEphemeral.
+	name      string
+	ephemeral bool
+
+	// observe, if not nil, is called with every state change.
+	observe func(StateChange)
+
+	// relaunch, if not nil, is called when a command exits, and returns true
+	// if a new instance of the command will be started in its place, in
+	// which case the exit is not reported to Wait.
+	relaunch func(cmd *exec.Cmd, err error) bool
+
+	// explainExit, if not nil, can replace the error that a command exited
+	// with by one that says why, for example an *OOMError.
+	explainExit func(cmd *exec.Cmd, commandID string, pid int, started time.Time, err error) error
+
+	// exit, if not nil, is called with the result of every exit of a
+	// command, including those of instances that have been replaced.
+	exit func(commandID string, pid int, result ExitResult)
+
+	// paused is true while the group is paused, see Groups.Pause.
+	paused bool
+
+	// ids maps every command in the group to its instance ID.
+	ids map[*exec.Cmd]string
+
+	// states maps instance ID to the state of the command.
+	states   map[string]State
+	watchers map[chan StateChange]struct{}
+
+	// exited has a channel for every started command that is closed
+	// when the command's process has been waited for.
+	exited map[*exec.Cmd]chan struct{}
+
+	// replaced contains commands that are being replaced by a new instance,
+	// so their exit is not reported to Wait.
+	replaced map[*exec.Cmd]struct{}
+
+	// started maps instance ID to when the command was last started,
+	// and restarts maps instance ID to how many times it has been restarted.
+	started  map[string]time.Time
+	restarts map[string]int
+
+	// results maps instance ID to how the command last exited.
+	results map[string]ExitResult
+
+	// stopSignal and gracePeriod are how Remove stops commands,
+	// failFast stops the group when a command fails, and
+	// maxConcurrency, if positive, limits how many commands can run at once.
+	stopSignal     os.Signal
+	gracePeriod    time.Duration
+	failFast       bool
+	maxConcurrency int
+
+	// stopSignals maps instance ID to the stop signal of a command that
+	// has one of its own, which it is stopped with instead of stopSignal.
+	stopSignals map[string]os.Signal
+
+	// clock is used for timeouts and timestamps.
+	clock Clock
+
+	// sandboxProfile, if not empty, is the sandbox-exec profile that commands
+	// are started with, see WithSandboxProfile.
+	sandboxProfile string
+
+	// execer starts processes, and procs maps every started command to its process.
+	execer Execer
+	procs  map[*exec.Cmd]Process
+
+	mu sync.Mutex
 }
 
-// NewGroup creates a new Group instance.
-// ctx can be used to cancel the entire group of processes.
-func NewGroup() *Group {
-	return &Group{
-		cmds:   []*exec.Cmd{},
-		done:   make(chan *exec.Cmd),
-		errors: make(chan CmdError),
+// NewGroup creates a new Group instance configured with opts.
+func NewGroup(opts ...GroupOption) *Group {
+	g := &Group{
+		cmds:     []*exec.Cmd{},
+		done:     make(chan *exec.Cmd),
+		errors:   make(chan CmdError),
+		ids:      map[*exec.Cmd]string{},
+		states:   map[string]State{},
+		watchers: map[chan StateChange]struct{}{},
+		exited:   map[*exec.Cmd]chan struct{}{},
+		replaced: map[*exec.Cmd]struct{}{},
+		started:  map[string]time.Time{},
+		restarts: map[string]int{},
+		results:  map[string]ExitResult{},
+
+		stopSignal:  syscall.SIGKILL,
+		stopSignals: map[string]os.Signal{},
+		gracePeriod: DefaultTimeouts.Remove,
+		clock:       realClock{},
+		execer:      osExecer{},
+		procs:       map[*exec.Cmd]Process{},
+	}
+	for _, opt := range opts {
+		opt(g)
+	}
+	if g.sandboxProfile != "" {
+		g.execer = sandboxExecer{execer: g.execer, profile: g.sandboxProfile}
 	}
+	return g
 }
 
 // Commands returns the commands associated with the Group.
 func (g *Group) Commands() []*exec.Cmd {
-	return g.cmds
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	return append([]*exec.Cmd{}, g.cmds...)
+}
+
+// lookup returns the running instance of the command with the provided ID,
+// or nil if there is no such command in the group.
+// The ID can be an instance ID or the content hash returned by GetCmdID,
+// in which case the first instance with that definition is returned.
+func (g *Group) lookup(commandID string) *exec.Cmd {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	return g.lookupLocked(commandID)
+}
+
+// lookupLocked is lookup for callers that hold the group's lock.
+func (g *Group) lookupLocked(commandID string) *exec.Cmd {
+	for _, cmd := range g.cmds {
+		if g.ids[cmd] == commandID {
+			return cmd
+		}
+	}
+	for _, cmd := range g.cmds {
+		if cid, err := GetCmdID(cmd); err == nil && cid == commandID {
+			return cmd
+		}
+	}
+	return nil
+}
+
+// ID returns the instance ID of a command in the group.
+// If cmd is not one of the group's commands the instance ID of the
+// first command with the same definition is returned.
+// It returns false if there is no such command in the group.
+func (g *Group) ID(cmd *exec.Cmd) (string, bool) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	return g.idLocked(cmd)
+}
+
+// idLocked is ID for callers that hold the group's lock.
+func (g *Group) idLocked(cmd *exec.Cmd) (string, bool) {
+	if id, ok := g.ids[cmd]; ok {
+		return id, true
+	}
+	commandID, err := GetCmdID(cmd)
+	if err != nil {
+		return "", false
+	}
+	if cc := g.lookupLocked(commandID); cc != nil {
+		return g.ids[cc], true
+	}
+	return "", false
+}
+
+// index returns the index of cmd among the commands in the group that
+// have the same definition, in the order they were added.
+// It returns false if there is no such command in the group.
+func (g *Group) index(cmd *exec.Cmd) (int, bool) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	id, ok := g.idLocked(cmd)
+	if !ok {
+		return 0, false
+	}
+	hash, err := GetCmdID(cmd)
+	if err != nil {
+		return 0, false
+	}
+	i := 0
+	for _, cc := range g.cmds {
+		if g.ids[cc] == id {
+			return i, true
+		}
+		if ch, err := GetCmdID(cc); err == nil && ch == hash {
+			i++
+		}
+	}
+	return 0, false
 }
 
 // Remove removes processes from a Group.
 // If no PID's are passed this method stops all the processes in the group.
+// Processes are sent the group's stop signal and killed if they have not
+// exited after the group's grace period, see WithStopSignal and WithGracePeriod.
 func (g *Group) Remove(cmds ...*exec.Cmd) error {
+	return g.RemoveTimeout(g.gracePeriod, cmds...)
+}
+
+// RemoveTimeout is Remove with a grace period that overrides the group's.
+func (g *Group) RemoveTimeout(timeout time.Duration, cmds ...*exec.Cmd) error {
 	var (
-		pm       = map[int]struct{}{}
 		errs     = []string{}
-		errch    = make(chan error)
-		done     = make(chan struct{})
-		stopping []*exec.Cmd
+		stopping = g.Commands()
 	)
-	if len(cmds) == 0 {
-		stopping = g.cmds
-	} else {
-		stopping = cmds
+	if len(cmds) > 0 {
+		stopping = g.running(cmds)
 	}
+	errch := make(chan error, len(stopping))
+
 	for _, cmd := range stopping {
-		pm[cmd.Process.Pid] = struct{}{}
+		g.retire(cmd)
 
 		go func(cmd *exec.Cmd) {
-			if err := cmd.Process.Signal(syscall.SIGKILL); err != nil {
-				if isAlreadyFinished(err) {
-					done <- struct{}{} // The process is already finished.
-					return
-				}
-				errch <- errors.Wrap(err, "sending kill signal")
-			}
-			if err := cmd.Wait(); err != nil {
-				errch <- errors.Wrap(err, "waiting for process to finish")
-			}
+			errch <- errors.Wrap(g.stop(cmd, g.stopSignalOf(cmd, g.stopSignal), timeout), "stopping process")
 		}(cmd)
 	}
-	for range pm {
-		select {
-		case <-time.After(2 * time.Second):
-			return errors.New("timeout")
-		case <-done:
-		case err := <-errch:
+	for range stopping {
+		if err := <-errch; err != nil {
 			errs = append(errs, err.Error())
 		}
 	}
 	if len(errs) > 0 {
 		return errors.New(strings.Join(errs, ", and "))
 	}
-	newCmds := []*exec.Cmd{}
+	for _, cmd := range stopping {
+		g.drop(cmd)
+	}
+	return nil
+}
 
-	for _, cc := range g.cmds {
-		if _, ok := pm[cc.Process.Pid]; ok {
+// running returns the running instances of the provided commands.
+// Commands are matched by ID, so a command that has been restarted
+// can be referred to by an earlier instance of it.
+func (g *Group) running(cmds []*exec.Cmd) []*exec.Cmd {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	running := []*exec.Cmd{}
+	for _, cmd := range cmds {
+		id, ok := g.idLocked(cmd)
+		if !ok {
 			continue
 		}
-		newCmds = append(newCmds, cc)
+		if cc := g.lookupLocked(id); cc != nil {
+			running = append(running, cc)
+		}
 	}
-	g.cmds = newCmds
-	return nil
+	return running
 }
 
 // Signal sends a signal to every process in the Group.
 func (g *Group) Signal(signal os.Signal) error {
-	for _, cmd := range g.cmds {
-		if err := cmd.Process.Signal(signal); err != nil {
+	for _, cmd := range g.Commands() {
+		if err := g.signal(cmd, signal); err != nil {
 			return err
 		}
 	}
@@ -100,30 +282,315 @@ func (g *Group) Signal(signal os.Signal) error {
 // Start starts the provided command and adds it to the group.
 // It also starts a goroutine that waits for the command.
 func (g *Group) Start(cmd *exec.Cmd) error {
-	// Start the process.
-	if err := cmd.Start(); err != nil {
-		return errors.Wrap(err, "starting command")
+	return g.start(cmd, nil, newInstanceID(), nil)
+}
+
+// StartContext is like Start, but the process of the command is killed if
+// ctx is done before it exits, like with exec.CommandContext.
+// The command is not started if ctx is already done.
+func (g *Group) StartContext(ctx context.Context, cmd *exec.Cmd) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	if err := g.Start(cmd); err != nil {
+		return err
+	}
+	exited, ok := g.exitedChan(cmd)
+	if !ok || ctx.Done() == nil {
+		return nil
 	}
 	go func() {
-		if err := cmd.Wait(); err != nil {
-			g.errors <- CmdError{
-				Cmd:   cmd,
-				error: err,
-			}
-			return
+		select {
+		case <-exited:
+		case <-ctx.Done():
+			_ = g.signal(cmd, os.Kill) // Best effort, it may have just exited.
 		}
-		g.done <- cmd
 	}()
-	g.cmds = append(g.cmds, cmd)
+	return nil
+}
+
+// start starts cmd and adds it to the group with the provided instance ID.
+// If old is not nil then cmd takes the place of old in the group.
+// If captured is not nil then exits are reported once it is closed, or
+// captureDrain after the command exits if it is not, so that the output of
+// the command is in its log files when Wait returns.
+func (g *Group) start(cmd, old *exec.Cmd, id string, captured <-chan struct{}) error {
+	if err := g.checkConcurrency(old); err != nil {
+		return err
+	}
+	// Start the process.
+	proc, err := g.execer.Start(cmd)
+	if err != nil {
+		return errors.Wrap(err, "starting command")
+	}
+	exited := g.add(cmd, old, id, proc)
+
+	g.setState(cmd, StateRunning, nil)
+
+	go g.supervise(cmd, proc, exited, captured)
+	return nil
+}
+
+// adopt adds a command whose process is already running, because it was
+// started before the manager re-executed itself, see Resume.
+// Its start time and restart count are restored, and watchers are not
+// notified because the start of the run has already been recorded.
+func (g *Group) adopt(cmd *exec.Cmd, id string, proc Process, captured <-chan struct{}, started time.Time, restarts int) {
+	exited := g.add(cmd, nil, id, proc)
+
+	g.mu.Lock()
+	g.states[id] = StateRunning
+	g.started[id] = started
+	g.restarts[id] = restarts
+	g.mu.Unlock()
+
+	go g.supervise(cmd, proc, exited, captured)
+}
+
+// add adds the process of cmd to the group, in place of old if it is not nil.
+// It returns the channel that is closed once the process has been waited for.
+func (g *Group) add(cmd, old *exec.Cmd, id string, proc Process) chan struct{} {
+	exited := make(chan struct{})
+
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	g.procs[cmd] = proc
+	g.exited[cmd] = exited
+	g.ids[cmd] = id
+	g.cmds = replaceCmd(g.cmds, old, cmd)
+	g.started[id] = g.clock.Now()
+	if old != nil {
+		delete(g.ids, old)
+		g.restarts[id]++
+	}
+	return exited
+}
+
+// supervise waits for the process of cmd and reports how it exited.
+func (g *Group) supervise(cmd *exec.Cmd, proc Process, exited chan struct{}, captured <-chan struct{}) {
+	err := proc.Wait()
+	if err != nil && g.explainExit != nil {
+		g.mu.Lock()
+		commandID := g.ids[cmd]
+		started := g.started[commandID]
+		g.mu.Unlock()
+
+		err = g.explainExit(cmd, commandID, proc.Pid(), started, err)
+	}
+	if captured != nil {
+		drainCapture(captured)
+	}
+	if commandID, result, ok := g.recordExit(cmd, err); ok && g.exit != nil {
+		g.exit(commandID, proc.Pid(), result)
+	}
+	close(exited)
+
+	if g.release(cmd) {
+		return // A new instance has taken this command's place.
+	}
+	if err != nil {
+		g.setState(cmd, StateFailed, err)
+	} else {
+		g.setState(cmd, StateExited, nil)
+	}
+	if g.relaunch != nil && g.relaunch(cmd, err) {
+		return // A new instance will take this command's place.
+	}
+	g.report(cmd, err)
+}
+
+// report reports the exit of cmd to Wait. If cmd failed in a group that
+// fails fast the other commands are stopped.
+func (g *Group) report(cmd *exec.Cmd, err error) {
+	if err == nil {
+		g.done <- cmd
+		return
+	}
+	if g.failFast {
+		go g.stopOthers(cmd)
+	}
+	g.errors <- CmdError{
+		Cmd:   cmd,
+		error: err,
+	}
+}
+
+// replace marks cmd as about to be replaced by a new instance.
+func (g *Group) replace(cmd *exec.Cmd) {
+	g.retire(cmd)
+	g.setState(cmd, StateRestarting, nil)
+}
+
+// retire marks cmd so that its exit is not reported to Wait.
+func (g *Group) retire(cmd *exec.Cmd) {
+	g.mu.Lock()
+	g.replaced[cmd] = struct{}{}
+	g.mu.Unlock()
+}
+
+// unretire undoes retire, so that the exit of cmd is reported to Wait again.
+func (g *Group) unretire(cmd *exec.Cmd) {
+	g.mu.Lock()
+	delete(g.replaced, cmd)
+	g.mu.Unlock()
+}
+
+// drop removes a retired command from the group.
+func (g *Group) drop(cmd *exec.Cmd) {
+	g.setState(cmd, StateStopped, nil)
+
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	for i, cc := range g.cmds {
+		if cc == cmd {
+			g.cmds = append(g.cmds[:i], g.cmds[i+1:]...)
+			break
+		}
+	}
+	if id, ok := g.ids[cmd]; ok {
+		delete(g.states, id)
+		delete(g.started, id)
+		delete(g.restarts, id)
+		delete(g.results, id)
+		delete(g.stopSignals, id)
+		delete(g.ids, cmd)
+	}
+	delete(g.procs, cmd)
+}
+
+// release forgets about an exited command and reports whether
+// it had been replaced by a new instance.
+func (g *Group) release(cmd *exec.Cmd) bool {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	delete(g.exited, cmd)
+	_, ok := g.replaced[cmd]
+	delete(g.replaced, cmd)
+	if ok {
+		delete(g.procs, cmd)
+	}
+	return ok
+}
+
+// exitedChan returns a channel that is closed when cmd has exited.
+// It returns false if cmd has already exited or was not started by the group.
+func (g *Group) exitedChan(cmd *exec.Cmd) (<-chan struct{}, bool) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	exited, ok := g.exited[cmd]
+	return exited, ok
+}
+
+// aliveLocked returns true if the process of cmd has not been waited for.
+// The caller must hold the group's lock.
+func (g *Group) aliveLocked(cmd *exec.Cmd) bool {
+	exited, ok := g.exited[cmd]
+	if !ok {
+		return false
+	}
+	select {
+	case <-exited:
+		return false
+	default:
+		return true
+	}
+}
+
+// setStopSignal sets the signal that the command with the provided instance
+// ID is stopped with, instead of the one that the caller would use.
+// A nil signal removes it.
+func (g *Group) setStopSignal(commandID string, sig os.Signal) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	if sig == nil {
+		delete(g.stopSignals, commandID)
+		return
+	}
+	g.stopSignals[commandID] = sig
+}
+
+// stopSignalOf returns the stop signal of cmd, or def if it does not have one of its own.
+func (g *Group) stopSignalOf(cmd *exec.Cmd, def os.Signal) os.Signal {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	if sig, ok := g.stopSignals[g.ids[cmd]]; ok {
+		return sig
+	}
+	return def
+}
+
+// stopAll sends every command in the group its stop signal, or the group's,
+// and kills the commands that have not exited after timeout.
+// Commands whose stop signal is SIGKILL are killed straight away.
+func (g *Group) stopAll(timeout time.Duration) error {
+	var (
+		cmds  = g.Commands()
+		errch = make(chan error, len(cmds))
+	)
+	for _, cmd := range cmds {
+		sig := g.stopSignalOf(cmd, g.stopSignal)
+		if sig == syscall.SIGKILL {
+			errch <- g.signal(cmd, sig)
+			continue
+		}
+		go func(cmd *exec.Cmd) {
+			errch <- g.stop(cmd, sig, timeout)
+		}(cmd)
+	}
+	var first error
+	for range cmds {
+		if err := <-errch; err != nil && !isAlreadyFinished(err) && first == nil {
+			first = err
+		}
+	}
+	return first
+}
+
+// killAll kills every command of the group that has not exited.
+func (g *Group) killAll() {
+	for _, cmd := range g.alive() {
+		_ = g.signal(cmd, os.Kill) // Best effort, it may have just exited.
+	}
+}
+
+// stop sends sig to cmd and waits for it to exit.
+// If cmd has not exited after timeout it is killed.
+func (g *Group) stop(cmd *exec.Cmd, sig os.Signal, timeout time.Duration) error {
+	exited, ok := g.exitedChan(cmd)
+	if !ok {
+		return nil // Already exited.
+	}
+	if err := g.signal(cmd, sig); err != nil && !isAlreadyFinished(err) {
+		return errors.Wrap(err, "signalling process")
+	}
+	if g.isPaused() {
+		_ = g.signal(cmd, sigCont) // Best effort, it is killed after the timeout otherwise.
+	}
+	select {
+	case <-exited:
+		return nil
+	case <-g.clock.After(timeout):
+	}
+	if err := g.signal(cmd, os.Kill); err != nil && !isAlreadyFinished(err) {
+		return errors.Wrap(err, "killing process")
+	}
+	<-exited
 	return nil
 }
 
 // Wait waits for all commands to finish.
 // If there was an error running any of the commands then CmdError will be returned.
 func (g *Group) Wait(timeout time.Duration) error {
-	for range g.cmds {
+	deadline := g.clock.After(timeout)
+
+	for i, n := 0, g.numCmds(); i < n; i++ {
 		select {
-		case <-time.After(timeout):
+		case <-deadline:
 			return errors.New("timeout after " + timeout.String())
 		case <-g.done:
 			// Finished without a problem.
@@ -134,6 +601,114 @@ func (g *Group) Wait(timeout time.Duration) error {
 	return nil
 }
 
+// WaitContext is like Wait, but waits until ctx is done rather than for a
+// timeout, and returns the error of ctx then. The commands keep running.
+func (g *Group) WaitContext(ctx context.Context) error {
+	for i, n := 0, g.numCmds(); i < n; i++ {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-g.done:
+			// Finished without a problem.
+		case cmderr := <-g.errors:
+			return cmderr
+		}
+	}
+	return nil
+}
+
+// numCmds returns how many commands have been added to the group.
+func (g *Group) numCmds() int {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	return len(g.cmds)
+}
+
+// setState records a state transition for cmd and notifies watchers.
+// Watchers that are not keeping up miss the notification rather than
+// blocking the goroutine that supervises the command.
+func (g *Group) setState(cmd *exec.Cmd, to State, err error) {
+	g.mu.Lock()
+
+	commandID, ok := g.ids[cmd]
+	if !ok {
+		g.mu.Unlock()
+		return
+	}
+	from := g.states[commandID]
+	if from == StateStopped && to != StateRunning {
+		g.mu.Unlock()
+		return // The exit of a stopped command is expected.
+	}
+	g.states[commandID] = to
+
+	change := StateChange{
+		Group:     g.name,
+		CommandID: commandID,
+		Cmd:       cmd,
+		PID:       pidOf(g.procs[cmd]),
+		From:      from,
+		To:        to,
+		Time:      g.clock.Now(),
+		Err:       err,
+	}
+	for ch := range g.watchers {
+		select {
+		case ch <- change:
+		default:
+		}
+	}
+	g.mu.Unlock()
+
+	if g.observe != nil {
+		g.observe(change)
+	}
+}
+
+// State returns the state of the provided command.
+func (g *Group) State(cmd *exec.Cmd) State {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	id, ok := g.idLocked(cmd)
+	if !ok {
+		return StateUnknown
+	}
+	return g.states[id]
+}
+
+// Watch returns a channel that receives a StateChange every time
+// a command in the group changes state.
+// The channel is closed when ctx is done.
+func (g *Group) Watch(ctx context.Context) <-chan StateChange {
+	ch := make(chan StateChange, watchBufferSize)
+
+	g.mu.Lock()
+	g.watchers[ch] = struct{}{}
+	g.mu.Unlock()
+
+	go func() {
+		<-ctx.Done()
+		g.mu.Lock()
+		delete(g.watchers, ch)
+		close(ch)
+		g.mu.Unlock()
+	}()
+	return ch
+}
+
+// replaceCmd replaces old with cmd in cmds.
+// If old is nil or not found then cmd is appended.
+func replaceCmd(cmds []*exec.Cmd, old, cmd *exec.Cmd) []*exec.Cmd {
+	for i, cc := range cmds {
+		if old != nil && cc == old {
+			cmds[i] = cmd
+			return cmds
+		}
+	}
+	return append(cmds, cmd)
+}
+
 func isAlreadyFinished(err error) bool {
 	return strings.HasSuffix(err.Error(), "process already finished")
 }
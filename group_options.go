@@ -0,0 +1,96 @@
+package exec
+
+import (
+	"os"
+	"os/exec"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// GroupOption configures a Group created with NewGroup.
+type GroupOption func(*Group)
+
+// WithStopSignal sets the signal that Remove sends to commands that do not
+// have one of their own, see Groups.SetStopSignal. The default is SIGKILL. On Windows SIGTERM and SIGINT are sent as
+// CTRL_BREAK_EVENT, and commands that do not exit are terminated.
+func WithStopSignal(sig os.Signal) GroupOption {
+	return func(g *Group) {
+		g.stopSignal = sig
+	}
+}
+
+// WithGracePeriod sets how long Remove waits for a command to exit after
+// sending it the stop signal, before killing it.
+// The default is DefaultTimeouts.Remove.
+func WithGracePeriod(d time.Duration) GroupOption {
+	return func(g *Group) {
+		g.gracePeriod = d
+	}
+}
+
+// WithSandboxProfile starts the commands of the group under sandbox-exec with
+// the provided profile, which is written in the sandbox profile language of
+// macOS. Commands fail to start on other platforms.
+func WithSandboxProfile(profile string) GroupOption {
+	return func(g *Group) {
+		g.sandboxProfile = profile
+	}
+}
+
+// WithFailFast makes the group stop all its commands as soon as one of them fails.
+// The other commands are sent the stop signal and killed after the grace period.
+func WithFailFast() GroupOption {
+	return func(g *Group) {
+		g.failFast = true
+	}
+}
+
+// WithMaxConcurrency limits how many commands can run in the group at once.
+// Start returns an error if n commands are already running.
+// Zero, the default, means there is no limit.
+func WithMaxConcurrency(n int) GroupOption {
+	return func(g *Group) {
+		g.maxConcurrency = n
+	}
+}
+
+// WithGroupClock sets the clock the group uses for timeouts and timestamps.
+func WithGroupClock(clock Clock) GroupOption {
+	return func(g *Group) {
+		g.clock = clock
+	}
+}
+
+// checkConcurrency returns an error if the group can not run another command.
+// old is a command that is being replaced, which does not count.
+func (g *Group) checkConcurrency(old *exec.Cmd) error {
+	if g.maxConcurrency <= 0 {
+		return nil
+	}
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	running := 0
+	for _, cmd := range g.cmds {
+		if cmd != old && g.states[g.ids[cmd]] == StateRunning {
+			running++
+		}
+	}
+	if running >= g.maxConcurrency {
+		return errors.Errorf("group has reached its maximum of %d running commands", g.maxConcurrency)
+	}
+	return nil
+}
+
+// stopOthers stops every command in the group except failed.
+func (g *Group) stopOthers(failed *exec.Cmd) {
+	for _, cmd := range g.Commands() {
+		if cmd == failed {
+			continue
+		}
+		go func(cmd *exec.Cmd) {
+			_ = g.stop(cmd, g.stopSignalOf(cmd, g.stopSignal), g.gracePeriod) // Best effort.
+		}(cmd)
+	}
+}
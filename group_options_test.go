@@ -0,0 +1,45 @@
+package exec_test
+
+import (
+	osexec "os/exec"
+	"testing"
+	"time"
+
+	"github.com/scgolang/exec"
+)
+
+func TestGroupFailFast(t *testing.T) {
+	var (
+		g       = exec.NewGroup(exec.WithFailFast(), exec.WithGracePeriod(time.Second))
+		sleeper = osexec.Command("sleep", "10")
+	)
+	if err := g.Start(sleeper); err != nil {
+		t.Fatal(err)
+	}
+	if err := g.Start(osexec.Command("sh", "-c", "exit 1")); err != nil {
+		t.Fatal(err)
+	}
+	if err := g.Wait(5 * time.Second); err == nil {
+		t.Fatal("expected an error, got nil")
+	}
+	deadline := time.Now().Add(2 * time.Second)
+	for g.State(sleeper) == exec.StateRunning {
+		if time.Now().After(deadline) {
+			t.Fatal("expected the other command to be stopped")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestGroupMaxConcurrency(t *testing.T) {
+	g := exec.NewGroup(exec.WithMaxConcurrency(1))
+
+	if err := g.Start(osexec.Command("sleep", "10")); err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = g.Remove() }() // Best effort.
+
+	if err := g.Start(osexec.Command("sleep", "10")); err == nil {
+		t.Fatal("expected an error, got nil")
+	}
+}
@@ -3,6 +3,8 @@ package exec
 import (
 	"bufio"
 	"bytes"
+	"context"
+	"crypto/cipher"
 	"crypto/sha256"
 	"database/sql"
 	"encoding/hex"
@@ -11,11 +13,11 @@ import (
 	"os"
 	"os/exec"
 	"path/filepath"
+	"strconv"
 	"sync"
 	"syscall"
 	"time"
 
-	_ "github.com/mattn/go-sqlite3" // Load sqlite driver.
 	"github.com/pkg/errors"
 	scgolangsql "github.com/scgolang/exec/sql"
 )
@@ -38,24 +40,264 @@ type Groups struct {
 	// db is a database handle.
 	db *sql.DB
 
+	// dbfile is the name of the database file in root.
+	// dbKey, if not nil, encrypts the database with SQLCipher.
+	// driver is the name of the database/sql driver.
+	// dbDSN, if not empty, is used to open the database instead of dbfile.
+	dbfile string
+	dbKey  []byte
+	driver string
+	dbDSN  string
+
+	// dirPerms and logPerms are the permissions of created directories and log files.
+	dirPerms os.FileMode
+	logPerms os.FileMode
+
+	// logger logs errors that happen in the background, if it is not nil.
+	logger Logger
+
+	// groupOpts configure every group.
+	groupOpts []GroupOption
+
+	// clock is used for timeouts and timestamps.
+	clock Clock
+
 	// root is the root directory of the groups.
 	root string
+
+	// fileWatchers maps group name to command ID to the watcher
+	// that restarts the command when files change.
+	fileWatchers   map[string]map[string]*fileWatcher
+	fileWatchersMu sync.Mutex
+
+	// stuckDetectors maps group name to command ID to the detector that
+	// reports the command when it is stuck, and stuckWatchers receive the reports.
+	stuckDetectors map[string]map[string]*stuckDetector
+	stuckWatchers  map[chan Event]struct{}
+	stuckMu        sync.Mutex
+
+	// binaryDetectors maps group name to command ID to the watcher of the
+	// executable of the command, and binaryWatchers receive its reports.
+	binaryDetectors map[string]map[string]*binaryWatcher
+	binaryWatchers  map[chan Event]struct{}
+	binaryMu        sync.Mutex
+
+	// readiness maps group name to command ID to readiness probe,
+	// conditions maps group name to command ID to start conditions,
+	// hooks maps group name to command ID to setup and teardown hooks,
+	// reloadCmds maps group name to command ID to reload command,
+	// restartPolicies maps group name to command ID to restart policy,
+	// health maps group name to command ID to health probe,
+	// logSampling maps group name to command ID to log sampling,
+	// dependencies maps group name to command ID to the IDs of the commands it depends on, and
+	// outputs maps group name to output name to where the output comes from.
+	readiness       map[string]map[string]Probe
+	conditions      map[string]map[string][]Condition
+	hooks           map[string]map[string]Hooks
+	reloadCmds      map[string]map[string]*exec.Cmd
+	restartPolicies map[string]map[string]RestartPolicy
+	health          map[string]map[string]HealthProbe
+	logSampling     map[string]map[string]int
+	dependencies    map[string]map[string][]string
+	outputs         map[string]map[string]output
+	probesMu        sync.Mutex
+
+	// healthCheckers maps group name to instance ID to the checker of the
+	// health of the running instance of a command, see SetHealthProbe.
+	healthCheckers map[string]map[string]*healthChecker
+	healthMu       sync.Mutex
+
+	// relaunches maps group name to instance ID to the restart state of a
+	// command with a restart policy, see SetRestartPolicy.
+	relaunches   map[string]map[string]*relaunch
+	relaunchesMu sync.Mutex
+
+	// templates maps name to group template, see RegisterTemplate.
+	templates   map[string]GroupTemplate
+	templatesMu sync.Mutex
+
+	// runs is a queue of state changes to record in the run history.
+	runs chan runRecord
+
+	// envKey encrypts env values at rest, if it is not nil.
+	envKey cipher.AEAD
+
+	// envBlockMin, if not zero, is the number of env vars from which the
+	// environment of a command is stored as a compressed block.
+	envBlockMin int
+
+	// cgroupMount and cgroupParent are where the cgroups of commands are
+	// created, see WithCgroups, and resourceLimits maps group name to the
+	// limits of each command of the group.
+	cgroupMount    string
+	cgroupParent   string
+	resourceLimits map[string]ResourceLimits
+	cgroupsMu      sync.Mutex
+
+	// oomBaselines maps group name and instance ID to how many OOM kills
+	// the cgroup of a command had when the command was started.
+	oomBaselines map[string]int64
+
+	// coreDumps is true if commands can dump core, see WithCoreDumps.
+	coreDumps bool
+
+	// totalQuota limits how many commands all the groups can have, see SetTotalQuota.
+	totalQuota   int
+	totalQuotaMu sync.Mutex
+
+	// dupPolicy decides what Create does with identical commands.
+	dupPolicy   DuplicatePolicy
+	dupPolicyMu sync.Mutex
+
+	// logPolicyCfg decides what happens to the log files of restarted commands,
+	// and logFormatCfg how output is written to them.
+	logPolicyCfg LogPolicy
+	logFormatCfg LogFormat
+	logPolicyMu  sync.Mutex
+
+	// startConcurrency limits how many commands are started at once.
+	// captureSlots, if not nil, limits how many commands can write
+	// their output at once.
+	startConcurrency int
+	captureSlots     chan struct{}
+	limitsMu         sync.Mutex
+
+	// streaming is true if the output of commands can be subscribed to.
+	// tees maps group name and instance ID to the tee of a command's output.
+	streaming bool
+	tees      map[string]*tee
+	teesMu    sync.Mutex
+
+	// metrics is true if the output of commands is counted, see WithOutputMetrics.
+	// meters maps group name and instance ID to the meter of a command's output.
+	metrics  bool
+	meters   map[string]*meter
+	metersMu sync.Mutex
+
+	// detach is true if commands are started detached, see WithDetach.
+	detach bool
+
+	// groupGC is true if groups are deleted once they have no commands, see WithGroupGC.
+	groupGC bool
+
+	// version and hostname are recorded with every run, along with the
+	// SHA-256 of the executable of the command, see Fingerprint.
+	version      string
+	hostname     string
+	binaryHashes binaryHashes
+
+	// stmts holds the prepared statements.
+	stmts stmts
+
+	// captureHealth keeps track of output capture, see Health.
+	captureHealth captureHealth
+
+	// jobs are the one-shot commands enqueued with Enqueue.
+	jobs *jobQueue
+
+	// scheduled maps the ID of every run scheduled with RunAt to
+	// a channel that is closed to cancel it.
+	scheduled   map[int64]chan struct{}
+	scheduledMu sync.Mutex
+
+	// capacity limits how many processes run at once, see SetMaxRunning.
+	// priorities maps group name to command ID to the priority of a command.
+	capacity     *capacity
+	priorities   map[string]map[string]int
+	prioritiesMu sync.Mutex
+
+	// pipes maps group name and instance ID to the pipes that the output
+	// of a command is captured from, and handoff is non-zero while the
+	// manager is re-executing itself, see Reexec.
+	pipes   map[string]*capturePipes
+	pipesMu sync.Mutex
+	handoff int32
+
+	// timeoutsCfg configures how long operations wait.
+	timeoutsCfg Timeouts
+	timeoutsMu  sync.Mutex
 }
 
 // NewGroups creates a new collection of persistent process groups.
 func NewGroups(root, dbfile string) (*Groups, error) {
+	return New(root, WithDBFile(dbfile))
+}
+
+// NewEncryptedGroups creates a new collection of persistent process groups
+// whose database is encrypted on disk with SQLCipher, see WithDBKey.
+func NewEncryptedGroups(root, dbfile string, key []byte) (*Groups, error) {
+	return New(root, WithDBFile(dbfile), WithDBKey(key))
+}
+
+// New creates a new collection of persistent process groups
+// in the root directory, configured with opts.
+func New(root string, opts ...Option) (*Groups, error) {
+	return NewContext(context.Background(), root, opts...)
+}
+
+// NewContext is like New, but gives up initializing the database, which
+// creates and migrates its tables, once ctx is done.
+func NewContext(ctx context.Context, root string, opts ...Option) (*Groups, error) {
 	absRoot, err := filepath.Abs(root)
 	if err != nil {
 		return nil, err
 	}
 	g := &Groups{
-		groups: map[string]*Group{},
-		root:   absRoot,
+		groups:       map[string]*Group{},
+		root:         absRoot,
+		dbfile:       DefaultDBFile,
+		driver:       DefaultDriver,
+		dirPerms:     DirPerms,
+		logPerms:     LogPerms,
+		fileWatchers: map[string]map[string]*fileWatcher{},
+		readiness:    map[string]map[string]Probe{},
+		conditions:   map[string]map[string][]Condition{},
+		hooks:        map[string]map[string]Hooks{},
+		reloadCmds:   map[string]map[string]*exec.Cmd{},
+		relaunches:   map[string]map[string]*relaunch{},
+		templates:    map[string]GroupTemplate{},
+		tees:         map[string]*tee{},
+		meters:       map[string]*meter{},
+		pipes:        map[string]*capturePipes{},
+		runs:         make(chan runRecord, runsBufferSize),
+		clock:        realClock{},
+		capacity:     newCapacity(realClock{}),
+		priorities:   map[string]map[string]int{},
+		jobs:         newJobQueue(),
+		scheduled:    map[int64]chan struct{}{},
+
+		cgroupMount:    DefaultCgroupMount,
+		resourceLimits: map[string]ResourceLimits{},
+		oomBaselines:   map[string]int64{},
+
+		stuckDetectors: map[string]map[string]*stuckDetector{},
+		stuckWatchers:  map[chan Event]struct{}{},
+
+		binaryDetectors: map[string]map[string]*binaryWatcher{},
+		binaryWatchers:  map[chan Event]struct{}{},
+
+		restartPolicies: map[string]map[string]RestartPolicy{},
+		health:          map[string]map[string]HealthProbe{},
+		logSampling:     map[string]map[string]int{},
+		dependencies:    map[string]map[string][]string{},
+		outputs:         map[string]map[string]output{},
+		healthCheckers:  map[string]map[string]*healthChecker{},
+
+		version: mainVersion(),
 	}
+	g.hostname, _ = os.Hostname() // Best effort, it is only recorded.
+
+	for _, opt := range opts {
+		if err := opt(g); err != nil {
+			return nil, err
+		}
+	}
+	g.capacity.clock = g.clock
+
 	info, err := os.Stat(g.root)
 	if err != nil {
 		if os.IsNotExist(err) {
-			if err := os.Mkdir(g.root, DirPerms); err != nil {
+			if err := os.Mkdir(g.root, g.dirPerms); err != nil {
 				return nil, errors.Wrap(err, "creating "+g.root+" directory")
 			}
 		}
@@ -63,47 +305,165 @@ func NewGroups(root, dbfile string) (*Groups, error) {
 	if info != nil && !info.IsDir() {
 		return nil, errors.Wrap(err, g.root+" is not a directory")
 	}
-	db, err := sql.Open("sqlite3", filepath.Join(root, dbfile))
-	if err != nil {
-		return nil, errors.Wrap(err, "opening db")
+	if g.db == nil {
+		db, err := sql.Open(g.driver, g.dsn())
+		if err != nil {
+			return nil, errors.Wrap(err, "opening db")
+		}
+		g.db = db
 	}
-	g.db = db
-	if err := g.initialize(); err != nil {
+	if err := g.initialize(ctx); err != nil {
 		return nil, errors.Wrap(err, "initializing groups")
 	}
+	g.logBanner()
+
+	go g.writeRuns()
+
+	if err := g.armScheduledRuns(); err != nil {
+		return nil, errors.Wrap(err, "arming scheduled runs")
+	}
 	return g, nil
 }
 
-// captureOutput captures the output of the provided command.
-func (g *Groups) captureOutput(outPipe, errPipe io.ReadCloser, groupName string, cmd *exec.Cmd) error {
-	commandID, err := GetCmdID(cmd)
+// captureOutput captures the output of the command with the provided instance ID
+// to the log files opened with openLog, sampling repeated lines if sample is
+// more than one, see SetLogSampling.
+// The returned channel is closed when both pipes have been read to the end
+// and the log files are closed.
+func (g *Groups) captureOutput(outPipe, errPipe *os.File, groupName, commandID string, sample int, openLog func(groupName, filename string) (*os.File, error)) (<-chan struct{}, error) {
+	stdout, err := openLog(groupName, fmt.Sprintf("%s.stdout", commandID))
 	if err != nil {
-		return errors.Wrap(err, "getting command ID")
+		return nil, errors.Wrap(err, "creating new process stdout file")
 	}
-	stdout, err := os.Create(filepath.Join(g.root, groupName, fmt.Sprintf("%s.stdout", commandID)))
+	stderr, err := openLog(groupName, fmt.Sprintf("%s.stderr", commandID))
 	if err != nil {
-		return errors.Wrap(err, "creating new process stdout file")
+		_ = stdout.Close()
+		return nil, errors.Wrap(err, "creating new process stderr file")
+	}
+	var (
+		_, slots = g.limits()
+		captured = make(chan struct{})
+		errDone  = make(chan struct{})
+		t        *tee
+		pipes    = &capturePipes{stdout: outPipe, stderr: errPipe, captured: captured}
+	)
+	if g.streaming {
+		t = g.tee(groupName, commandID)
+	}
+	g.addPipes(groupName, commandID, pipes)
+
+	go func() {
+		defer close(errDone)
+		g.capture(stderr, errPipe, slots, t, sample, 2, groupName, commandID)
+	}()
+	go func() {
+		defer close(captured)
+		g.capture(stdout, outPipe, slots, t, sample, 1, groupName, commandID)
+		<-errDone
+		g.removePipes(groupName, commandID, pipes)
+	}()
+	return captured, nil
+}
+
+// captureDrain is how long the exit of a command waits for its output to be captured.
+// Output can take longer if the command left children running that hold its pipes open.
+const captureDrain = 500 * time.Millisecond
+
+// drainCapture waits for captured to be closed, or at most captureDrain.
+// It uses real time because it waits for I/O rather than for the group's clock.
+func drainCapture(captured <-chan struct{}) {
+	t := time.NewTimer(captureDrain)
+	defer t.Stop()
+
+	select {
+	case <-captured:
+	case <-t.C:
+	}
+}
+
+// capture copies one output stream of a command to its log file and closes both.
+// If t is not nil the output is also sent to the subscribers of the command,
+// and if output metrics are enabled it is counted.
+func (g *Groups) capture(dst *os.File, src *os.File, slots chan struct{}, t *tee, sample, fd int, groupName, commandID string) {
+	stream := "stdout"
+	if fd == 2 {
+		stream = "stderr"
+	}
+	var onWrite func([]byte)
+	if t != nil {
+		onWrite = func(p []byte) { t.write(fd, p) }
+		defer t.flush(fd)
+	}
+	if g.metrics {
+		m, tw := g.meter(groupName, commandID), onWrite
+		onWrite = func(p []byte) {
+			m.add(p, g.clock.Now())
+			if tw != nil {
+				tw(p)
+			}
+		}
+	}
+	var out logFile = dst
+	if g.logFormat() == LogJSONLines {
+		out = &jsonLinesFile{file: dst, clock: g.clock, group: groupName, command: commandID, fd: fd}
+	}
+	if sample > 1 {
+		out = &sampledFile{out: out, n: sample}
+	}
+	g.captureHealth.begin()
+
+	err := filesync(out, src, slots, onWrite)
+	if g.handingOff() && os.IsTimeout(err) {
+		// The pipe is left open for the new image of the manager, see Reexec.
+		_ = out.Close()
+		g.captureHealth.end(nil)
+		return
 	}
-	stderr, err := os.Create(filepath.Join(g.root, groupName, fmt.Sprintf("%s.stderr", commandID)))
 	if err != nil {
-		return errors.Wrap(err, "creating new process stderr file")
+		g.logf("capturing %s of %s in group %s: %s", stream, commandID, groupName, err)
 	}
-	go func() { _ = filesync(stdout, outPipe) }()
-	go func() { _ = filesync(stderr, errPipe) }()
-	return nil
+	if cerr := out.Close(); cerr != nil {
+		g.logf("closing %s log of %s in group %s: %s", stream, commandID, groupName, cerr)
+		if err == nil {
+			err = cerr
+		}
+	}
+	_ = src.Close()
+
+	g.captureHealth.end(err)
+}
+
+// createLog creates or truncates a log file in a group's directory.
+func (g *Groups) createLog(groupName, filename string) (*os.File, error) {
+	return os.OpenFile(filepath.Join(g.root, groupName, filename), os.O_RDWR|os.O_CREATE|os.O_TRUNC, g.logPerms)
 }
 
 // Close closes a Group.
 func (g *Groups) Close(groupName string) error {
+	return g.close(context.Background(), groupName, g.timeouts().Close)
+}
+
+// CloseContext is like Close, but once ctx is done the commands that have
+// not exited yet are killed rather than given the rest of their stop timeout,
+// and the error of ctx is returned.
+func (g *Groups) CloseContext(ctx context.Context, groupName string) error {
+	return g.close(ctx, groupName, g.timeouts().Close)
+}
+
+// close closes a group, waiting up to timeout for its commands to exit,
+// or until ctx is done.
+func (g *Groups) close(ctx context.Context, groupName string, timeout time.Duration) error {
 	grp := g.getGroup(groupName)
 	if grp == nil {
 		return nil
 	}
+	// The transaction does not end with ctx, so that the commands are
+	// killed by closeTx even if ctx is already done.
 	tx, err := g.db.Begin()
 	if err != nil {
 		return errors.Wrap(err, "starting transaction")
 	}
-	if err := g.closeTx(tx, groupName, grp); err != nil {
+	if err := g.closeTx(ctx, tx, groupName, grp, timeout); err != nil {
 		_ = tx.Rollback()
 		return err
 	}
@@ -114,14 +474,34 @@ func (g *Groups) Close(groupName string) error {
 }
 
 // closeTx closes a group ands updates the database using the provided Tx.
-func (g *Groups) closeTx(tx *sql.Tx, groupName string, grp *Group) error {
-	if err := grp.Signal(syscall.SIGKILL); err != nil {
-		if !isAlreadyFinished(err) {
-			return errors.Wrap(err, "signalling process group")
-		}
+func (g *Groups) closeTx(ctx context.Context, tx *sql.Tx, groupName string, grp *Group, timeout time.Duration) error {
+	if err := g.unwatchFiles(groupName); err != nil {
+		return errors.Wrap(err, "closing file watchers")
+	}
+	g.unwatchStuck(groupName)
+	g.unwatchBinaries(groupName)
+	g.cancelRelaunches(groupName)
+
+	if ctx.Done() != nil {
+		closed := make(chan struct{})
+		defer close(closed)
+
+		go func() {
+			select {
+			case <-closed:
+			case <-ctx.Done():
+				grp.killAll()
+			}
+		}()
 	}
-	// Arbitrary timeout.
-	return errors.Wrap(grp.Wait(2*time.Second), "waiting for process group")
+	if err := grp.stopAll(timeout); err != nil && ctx.Err() == nil {
+		return errors.Wrap(err, "signalling process group")
+	}
+	err := grp.Wait(timeout)
+	if ctx.Err() != nil {
+		return ctx.Err()
+	}
+	return errors.Wrap(err, "waiting for process group")
 }
 
 // Commands returns the commands that are part of the specified group.
@@ -138,12 +518,23 @@ func (g *Groups) Commands(groupName string) ([]*exec.Cmd, bool) {
 }
 
 // Create creates a new group with the provided name.
+// If the group is already open the commands are added to it, and commands
+// that are identical to one already in the group are handled according to
+// the duplicate policy, see SetDuplicatePolicy.
 func (g *Groups) Create(groupName string, cmds ...*exec.Cmd) error {
-	tx, err := g.db.Begin()
+	return g.CreateContext(context.Background(), groupName, cmds...)
+}
+
+// CreateContext is like Create, but gives up once ctx is done: the commands
+// that have not been started are not, the ones that have been are stopped,
+// and the database transaction is rolled back. Waiting for readiness probes
+// gives up too. Once CreateContext has returned, ctx no longer affects the group.
+func (g *Groups) CreateContext(ctx context.Context, groupName string, cmds ...*exec.Cmd) error {
+	tx, err := g.db.BeginTx(ctx, nil)
 	if err != nil {
 		return errors.Wrap(err, "starting transaction")
 	}
-	if err := g.createTx(tx, groupName, cmds...); err != nil {
+	if err := g.createTx(ctx, tx, groupName, cmds...); err != nil {
 		_ = tx.Rollback()
 		return err
 	}
@@ -151,66 +542,136 @@ func (g *Groups) Create(groupName string, cmds ...*exec.Cmd) error {
 }
 
 // createTx creates a group with a sql transaction.
-func (g *Groups) createTx(tx *sql.Tx, groupName string, cmds ...*exec.Cmd) error {
-	grp := NewGroup()
+func (g *Groups) createTx(ctx context.Context, tx *sql.Tx, groupName string, cmds ...*exec.Cmd) error {
+	grp := g.getGroup(groupName)
+
+	if grp != nil && grp.ephemeral {
+		return errors.Errorf("group %s is ephemeral, see CreateEphemeral", groupName)
+	}
+	if grp != nil && g.duplicatePolicy() == DuplicateKeep {
+		missing, kept, err := keepCmds(grp, cmds)
+		if err != nil {
+			return err
+		}
+		if err := g.restartKeptTx(tx, groupName, grp, kept); err != nil {
+			return err
+		}
+		cmds = missing
+	}
+	if err := g.checkDuplicates(groupName, grp, cmds); err != nil {
+		return err
+	}
+	added, err := g.addedHashes(grp, cmds)
+	if err != nil {
+		return err
+	}
+	if err := g.checkQuotaTx(tx, groupName, added, nil); err != nil {
+		return err
+	}
+	if grp == nil {
+		grp = g.newGroup(groupName)
+		if err := g.addTx(ctx, tx, groupName, grp, cmds...); err != nil {
+			return err
+		}
+		g.groupsMu.Lock()
+		g.groups[groupName] = grp
+		g.groupsMu.Unlock()
+		return nil
+	}
+	started := []*exec.Cmd{}
 	for _, cmd := range cmds {
-		if err := g.startTx(tx, cmd, groupName, grp); err != nil {
-			return errors.Wrap(err, "starting command")
+		if g.duplicatePolicy() == DuplicateReplace {
+			replaced, err := g.replaceDuplicateTx(tx, groupName, grp, cmd)
+			if err != nil {
+				return g.abortStart(groupName, grp, started, err)
+			}
+			if replaced {
+				continue
+			}
 		}
-		if err := insertCmd(tx, groupName, cmd); err != nil {
-			return errors.Wrap(err, "inserting new command")
+		if err := g.addTx(ctx, tx, groupName, grp, cmd); err != nil {
+			return g.abortStart(groupName, grp, started, err)
 		}
+		started = append(started, cmd)
 	}
-	g.groupsMu.Lock()
-	g.groups[groupName] = grp
-	g.groupsMu.Unlock()
 	return nil
 }
 
-const getCommandArgs = `
-SELECT		arg
-FROM		command_args
-WHERE		command_id = ?`
-
-func (g *Groups) getCommandArgs(cid int) ([]string, error) {
-	rows, err := g.db.Query(getCommandArgs, cid)
-	if err != nil {
-		return nil, err
+// addTx starts commands in an existing group and inserts them in the database.
+// Each command is given a new instance ID.
+func (g *Groups) addTx(ctx context.Context, tx *sql.Tx, groupName string, grp *Group, cmds ...*exec.Cmd) error {
+	ids := make([]string, len(cmds))
+	for i := range cmds {
+		ids[i] = newInstanceID()
 	}
-	defer func() { _ = rows.Close() }() // Best effort.
-
-	args := []string{}
-	for rows.Next() {
-		var arg string
-		if err := rows.Scan(&arg); err != nil {
-			return nil, err
+	if err := g.startAll(ctx, groupName, grp, cmds, ids); err != nil {
+		return err
+	}
+	for i, cmd := range cmds {
+		if err := g.insertCmd(tx, groupName, ids[i], grp.pid(cmd), cmd); err != nil {
+			return g.abortStart(groupName, grp, cmds, errors.Wrap(err, "inserting new command"))
 		}
-		args = append(args, arg)
 	}
-	return args, rows.Err()
+	return nil
 }
 
-const getCommandEnv = `
-SELECT		env
-FROM		command_env
-WHERE		command_id = ?`
+// addCmdTx starts a command with the provided instance ID in an existing
+// group and inserts it in the database.
+func (g *Groups) addCmdTx(tx *sql.Tx, groupName string, grp *Group, id string, cmd *exec.Cmd) error {
+	if err := g.startTx(tx, cmd, groupName, grp, id); err != nil {
+		return errors.Wrap(err, "starting command")
+	}
+	if err := g.insertCmd(tx, groupName, id, grp.pid(cmd), cmd); err != nil {
+		return errors.Wrap(err, "inserting new command")
+	}
+	return nil
+}
 
-func (g *Groups) getCommandEnv(cid int) ([]string, error) {
-	rows, err := g.db.Query(getCommandEnv, cid)
-	if err != nil {
-		return nil, err
+// newGroup creates a Group that is managed by g.
+func (g *Groups) newGroup(groupName string) *Group {
+	grp := NewGroup(g.groupOpts...)
+	grp.name = groupName
+	grp.explainExit = func(cmd *exec.Cmd, commandID string, pid int, started time.Time, err error) error {
+		g.collectCore(groupName, commandID, cmd, pid, started, err)
+		return g.explainExit(groupName, commandID, pid, started, err)
 	}
-	defer func() { _ = rows.Close() }() // Best effort.
+	grp.exit = func(commandID string, pid int, result ExitResult) {
+		g.writeExitSummary(groupName, commandID, pid, result)
+	}
+	grp.relaunch = func(cmd *exec.Cmd, err error) bool {
+		return g.relaunch(groupName, grp, cmd, err)
+	}
+	grp.observe = func(change StateChange) {
+		if !grp.ephemeral {
+			g.recordRun(change)
+		}
 
-	env := []string{}
-	for rows.Next() {
-		var e string
-		if err := rows.Scan(&e); err != nil {
-			return nil, err
+		switch change.To {
+		case StateRunning:
+			g.forgiveRelaunch(groupName, change.CommandID)
+			if grp.isPaused() {
+				if err := grp.signal(change.Cmd, sigStop); err != nil {
+					g.logf("pausing command %s in group %s: %s", change.CommandID, groupName, err)
+				}
+			}
+			g.checkHealth(groupName, grp, change.Cmd, change.CommandID)
+		case StateExited, StateFailed, StateStopped:
+			g.removeCgroup(groupName, change.CommandID)
+
+			if change.From == StateRunning {
+				g.runTeardown(groupName, change.CommandID, change.Cmd)
+			}
 		}
-		env = append(env, e)
 	}
-	return env, rows.Err()
+	grp.execer = cappedExecer{
+		execer: envExecer{
+			execer: grp.execer,
+			env:    func(cmd *exec.Cmd) ([]string, error) { return g.interpolateEnv(groupName, grp, cmd) },
+		},
+		capacity: g.capacity,
+		priority: func(cmd *exec.Cmd) int { return g.priority(groupName, cmd) },
+	}
+	return grp
 }
 
 // getGroup gets a named group.
@@ -221,107 +682,289 @@ func (g *Groups) getGroup(name string) *Group {
 	return grp
 }
 
-const getGroupProcesses = `
-SELECT		p.command_id, arg, env_var
-FROM		processes p
-LEFT JOIN	command_args a
-ON		p.command_id = a.command_id
-LEFT JOIN	command_env e
-ON		p.command_id = e.command_id
-WHERE		p.group_name = ?`
+// The command_id column of command_args, command_env, command_settings,
+// command_watch, and runs holds the instance ID of a command.
+// In processes, command_id is the content hash returned by GetCmdID.
+
+var getGroupProcesses = newQuery("getting group processes", `
+SELECT		instance_id
+FROM		processes
+WHERE		group_name = ?
+ORDER BY	rowid`)
+
+var getGroupArgs = newQuery("getting group command args", `
+SELECT		command_id, arg
+FROM		command_args
+WHERE		command_id IN (SELECT instance_id FROM processes WHERE group_name = ?)
+ORDER BY	command_id, idx`)
+
+var getGroupJails = newQuery("getting group command jails", `
+SELECT	command_id, value
+FROM	command_settings
+WHERE	group_name = ? AND name = 'jail'`)
+
+var getGroupDeathSignals = newQuery("getting group command death signals", `
+SELECT	command_id, value
+FROM	command_settings
+WHERE	group_name = ? AND name = 'death_signal'`)
+
+var getGroupEnv = newQuery("getting group command env", `
+SELECT		command_id, env_var
+FROM		command_env
+WHERE		command_id IN (SELECT instance_id FROM processes WHERE group_name = ?)
+ORDER BY	command_id, idx`)
 
 // getGroupProcessesTx gets the processes for a group from a database using
-// the provided sql transaction.
-func (g *Groups) getGroupProcessesTx(tx *sql.Tx, groupName string) ([]*exec.Cmd, error) {
-	rows, err := tx.Query(getGroupProcesses, groupName)
+// the provided sql transaction. It also returns the instance ID of each process.
+// The processes, their args, and their environments are read with one query each,
+// so that the number of rows is the sum of the number of args and env vars
+// rather than their product.
+func (g *Groups) getGroupProcessesTx(tx *sql.Tx, groupName string) ([]*exec.Cmd, []string, error) {
+	order, err := g.getGroupIDsTx(tx, groupName)
+	if err != nil {
+		return nil, nil, err
+	}
+	args, err := g.getGroupValuesTx(tx, getGroupArgs, groupName, nil)
+	if err != nil {
+		return nil, nil, err
+	}
+	env, err := g.getGroupValuesTx(tx, getGroupEnv, groupName, g.openEnv)
+	if err != nil {
+		return nil, nil, err
+	}
+	blocks, err := g.getGroupValuesTx(tx, getGroupEnvBlocks, groupName, nil)
+	if err != nil {
+		return nil, nil, err
+	}
+	for id, data := range blocks {
+		if env[id], err = g.openEnvBlock(data[0]); err != nil {
+			return nil, nil, errors.Wrap(err, "opening command env block")
+		}
+	}
+	jails, err := g.getGroupValuesTx(tx, getGroupJails, groupName, nil)
+	if err != nil {
+		return nil, nil, err
+	}
+	deathSignals, err := g.getGroupValuesTx(tx, getGroupDeathSignals, groupName, nil)
+	if err != nil {
+		return nil, nil, err
+	}
+	// Commands are returned in the order they were added to the group.
+	commands := make([]*exec.Cmd, 0, len(order))
+	ids := make([]string, 0, len(order))
+	for _, id := range order {
+		if len(args[id]) == 0 {
+			return nil, nil, errors.Errorf("command %s in group %s has no args", id, groupName)
+		}
+		cmd := exec.Command(args[id][0], args[id][1:]...)
+		cmd.Env = env[id]
+
+		if len(jails[id]) > 0 {
+			jid, err := strconv.Atoi(jails[id][0])
+			if err != nil {
+				return nil, nil, errors.Wrap(err, "parsing jail ID")
+			}
+			if err := setCmdJail(cmd, jid); err != nil {
+				return nil, nil, errors.Wrapf(err, "command %s in group %s", id, groupName)
+			}
+		}
+		if len(deathSignals[id]) > 0 {
+			sig, err := strconv.Atoi(deathSignals[id][0])
+			if err != nil {
+				return nil, nil, errors.Wrap(err, "parsing death signal")
+			}
+			if err := setCmdDeathSignal(cmd, syscall.Signal(sig)); err != nil {
+				return nil, nil, errors.Wrapf(err, "command %s in group %s", id, groupName)
+			}
+		}
+		commands = append(commands, cmd)
+		ids = append(ids, id)
+	}
+	return commands, ids, nil
+}
+
+// getGroupIDsTx gets the instance IDs of the processes in a group, in the order they were added.
+func (g *Groups) getGroupIDsTx(tx *sql.Tx, groupName string) ([]string, error) {
+	rows, err := g.queryRows(tx, getGroupProcesses, groupName)
 	if err != nil {
 		return nil, err
 	}
 	defer func() { _ = rows.Close() }() // Best effort.
 
-	commandsMap := map[string]*exec.Cmd{}
-
+	ids := []string{}
 	for rows.Next() {
-		var (
-			commandID string
-			arg       = sql.NullString{}
-			envvar    = sql.NullString{}
-		)
-		if err := rows.Scan(&commandID, &arg, &envvar); err != nil {
+		var id string
+		if err := rows.Scan(&id); err != nil {
 			return nil, err
 		}
-		if _, ok := commandsMap[commandID]; !ok {
-			commandsMap[commandID] = &exec.Cmd{}
-		}
-		if arg.Valid {
-			commandsMap[commandID].Args = append(commandsMap[commandID].Args, arg.String)
+		ids = append(ids, id)
+	}
+	return ids, rows.Err()
+}
+
+// getGroupValuesTx runs a query that returns (command_id, value) rows for the
+// commands in a group, and returns the values of each command in order.
+// If open is not nil it is applied to each value.
+func (g *Groups) getGroupValuesTx(tx *sql.Tx, q query, groupName string, open func(string) (string, error)) (map[string][]string, error) {
+	rows, err := g.queryRows(tx, q, groupName)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = rows.Close() }() // Best effort.
+
+	values := map[string][]string{}
+	for rows.Next() {
+		var commandID, value string
+		if err := rows.Scan(&commandID, &value); err != nil {
+			return nil, err
 		}
-		if envvar.Valid {
-			commandsMap[commandID].Env = append(commandsMap[commandID].Env, envvar.String)
+		if open != nil {
+			if value, err = open(value); err != nil {
+				return nil, err
+			}
 		}
+		values[commandID] = append(values[commandID], value)
+	}
+	return values, rows.Err()
+}
 
+func (g *Groups) initialize(ctx context.Context) error {
+	sqldata, err := scgolangsql.Asset("createTables.sql")
+	if err != nil {
+		return errors.Wrap(err, "getting sql data")
 	}
-	if err := rows.Err(); err != nil {
-		return nil, errors.Wrap(err, "scanning group commands row")
+	if _, err := g.db.ExecContext(ctx, string(sqldata)); err != nil {
+		return errors.Wrap(err, "creating tables")
 	}
-	var (
-		commands = make([]*exec.Cmd, len(commandsMap))
-		i        = 0
-	)
-	for _, cmd := range commandsMap {
-		commands[i] = exec.Command(cmd.Args[0], cmd.Args[1:]...)
-		i++
+	if err := g.migrate(ctx); err != nil {
+		return errors.Wrap(err, "migrating database")
 	}
-	return commands, nil
+	return g.prepareQueries(ctx)
 }
 
-func (g *Groups) initialize() error {
-	sqldata, err := scgolangsql.Asset("createTables.sql")
+// migrate updates databases that were created by earlier versions of this package.
+func (g *Groups) migrate(ctx context.Context) error {
+	if err := g.migrateInstanceIDs(ctx); err != nil {
+		return err
+	}
+	return g.migrateFingerprints(ctx)
+}
+
+// migrateInstanceIDs adds instance IDs to the commands of databases that do not have them.
+func (g *Groups) migrateInstanceIDs(ctx context.Context) error {
+	ok, err := g.hasColumn(ctx, "processes", "instance_id")
 	if err != nil {
-		return errors.Wrap(err, "getting sql data")
+		return err
+	}
+	if ok {
+		return nil
+	}
+	// Before instance IDs, commands were identified by their content hash.
+	if _, err := g.db.ExecContext(ctx, `ALTER TABLE processes ADD COLUMN instance_id TEXT`); err != nil {
+		return errors.Wrap(err, "adding processes.instance_id")
+	}
+	_, err = g.db.ExecContext(ctx, `UPDATE processes SET instance_id = command_id WHERE instance_id IS NULL`)
+	return errors.Wrap(err, "setting processes.instance_id")
+}
+
+// fingerprintColumns are the columns of the runs table that hold the fingerprint of a run.
+var fingerprintColumns = []string{"manager_version", "hostname", "platform", "binary_path", "binary_sha256"}
+
+// migrateFingerprints adds the fingerprint columns to the runs table of
+// databases that do not have them. Earlier runs have no fingerprint.
+func (g *Groups) migrateFingerprints(ctx context.Context) error {
+	for _, column := range fingerprintColumns {
+		ok, err := g.hasColumn(ctx, "runs", column)
+		if err != nil {
+			return err
+		}
+		if ok {
+			continue
+		}
+		if _, err := g.db.ExecContext(ctx, `ALTER TABLE runs ADD COLUMN `+column+` TEXT`); err != nil {
+			return errors.Wrap(err, "adding runs."+column)
+		}
+	}
+	return nil
+}
+
+// hasColumn returns true if the table has the named column.
+func (g *Groups) hasColumn(ctx context.Context, table, column string) (bool, error) {
+	rows, err := g.db.QueryContext(ctx, `PRAGMA table_info(`+table+`)`)
+	if err != nil {
+		return false, errors.Wrap(err, "getting table info for "+table)
+	}
+	defer func() { _ = rows.Close() }() // Best effort.
+
+	cols, err := rows.Columns()
+	if err != nil {
+		return false, err
+	}
+	for rows.Next() {
+		var (
+			vals = make([]interface{}, len(cols))
+			name sql.NullString
+		)
+		for i, col := range cols {
+			if col == "name" {
+				vals[i] = &name
+			} else {
+				vals[i] = new(interface{})
+			}
+		}
+		if err := rows.Scan(vals...); err != nil {
+			return false, err
+		}
+		if name.String == column {
+			return true, nil
+		}
 	}
-	_, err = g.db.Exec(string(sqldata))
-	return errors.Wrap(err, "creating tables")
+	return false, rows.Err()
 }
 
 // Logs returns a *bufio.Scanner that can be used to
 // read the logs of a process in the current group.
+// The logs span the log files of the previous runs of the process, oldest
+// first, that LogPerRun keeps, including compressed ones, and end with the
+// log file of the current run. See LogFiles.
 // Pass 1 to get stdout and 2 to get stderr.
 // Calling code is expected to close the io.Closer that is returned.
 func (g *Groups) Logs(groupName string, cmd *exec.Cmd, fd int) (*bufio.Scanner, io.Closer, error) {
-	commandID, err := GetCmdID(cmd)
-	if err != nil {
-		return nil, nil, errors.Wrap(err, "getting command ID")
-	}
-	var filename string
-	switch fd {
-	default:
-		return nil, nil, errors.Errorf("fd (%d) must be either 1 (stdout) or 2 (stderr)", fd)
-	case 1:
-		filename = fmt.Sprintf("%s.stdout", commandID)
-	case 2:
-		filename = fmt.Sprintf("%s.stderr", commandID)
-	}
-	f, err := os.Open(filepath.Join(g.root, groupName, filename))
+	rc, err := g.openLogs(groupName, cmd, fd)
 	if err != nil {
 		return nil, nil, err
 	}
-	return bufio.NewScanner(f), f, nil
+	return bufio.NewScanner(rc), rc, nil
 }
 
 // Open opens the Group with the provided name and sets it to the current Group.
+// Commands that were stopped with StopCommand are not started, and with
+// WithDetach the commands whose processes are still running are adopted.
 // If there is no Group with the provided name then this method initializes a new one.
 func (g *Groups) Open(groupName string) ([]*exec.Cmd, error) {
-	tx, err := g.db.Begin()
+	return g.OpenContext(context.Background(), groupName)
+}
+
+// OpenContext is like Open, but gives up once ctx is done, like CreateContext.
+func (g *Groups) OpenContext(ctx context.Context, groupName string) ([]*exec.Cmd, error) {
+	if grp := g.getGroup(groupName); grp != nil && grp.ephemeral {
+		return nil, errors.Errorf("group %s is ephemeral and can not be opened", groupName)
+	}
+	tx, err := g.db.BeginTx(ctx, nil)
 	if err != nil {
 		return nil, errors.Wrap(err, "starting transaction")
 	}
-	cmds, err := g.getGroupProcessesTx(tx, groupName)
+	cmds, ids, err := g.getGroupProcessesTx(tx, groupName)
 	if err != nil {
+		_ = tx.Rollback()
 		return nil, errors.Wrap(err, "getting group commands")
 	}
-	grp := NewGroup()
-	if err := g.openTx(tx, groupName, grp, cmds...); err != nil {
+	if cmds, ids, err = g.skipStoppedTx(tx, groupName, cmds, ids); err != nil {
+		_ = tx.Rollback()
+		return nil, err
+	}
+	grp := g.newGroup(groupName)
+	if err := g.openTx(ctx, tx, groupName, grp, cmds, ids); err != nil {
 		_ = tx.Rollback()
 		return nil, err
 	}
@@ -332,11 +975,58 @@ func (g *Groups) Open(groupName string) ([]*exec.Cmd, error) {
 }
 
 // openTx starts up a process group.
-func (g *Groups) openTx(tx *sql.Tx, groupName string, grp *Group, cmds ...*exec.Cmd) error {
-	for _, cmd := range cmds {
-		if err := g.startTx(tx, cmd, groupName, grp); err != nil {
+// ids holds the instance ID of each command.
+// The commands are started in parallel, bounded by the start concurrency,
+// and the database is updated with a single prepared statement.
+func (g *Groups) openTx(ctx context.Context, tx *sql.Tx, groupName string, grp *Group, cmds []*exec.Cmd, ids []string) error {
+	watch, err := g.getGroupWatchTx(tx, groupName)
+	if err != nil {
+		return err
+	}
+	settings := make([]map[string]string, len(cmds))
+	for i, cmd := range cmds {
+		if settings[i], err = g.getCmdSettingsTx(tx, groupName, ids[i]); err != nil {
 			return err
 		}
+		// Restored before the command starts, so that an early exit is restarted.
+		if err := g.restoreRestartPolicy(groupName, cmd, settings[i]); err != nil {
+			return err
+		}
+	}
+	start, startIDs := cmds, ids
+	if g.detach {
+		if start, startIDs, err = g.adoptDetachedTx(tx, groupName, grp, cmds, ids); err != nil {
+			return err
+		}
+	}
+	if err := g.startAll(ctx, groupName, grp, start, startIDs); err != nil {
+		return err
+	}
+	for i, cmd := range cmds {
+		commandID := ids[i]
+
+		if _, err := g.exec(tx, updateProcessID, grp.pid(cmd), groupName, commandID); err != nil {
+			return g.abortStart(groupName, grp, cmds, err)
+		}
+		if err := g.watchFiles(groupName, cmd, watch[commandID]); err != nil {
+			if i > 0 {
+				_ = g.unwatchFiles(groupName, ids[:i]...) // Best effort.
+			}
+			return g.abortStart(groupName, grp, cmds, errors.Wrap(err, "watching command files"))
+		}
+		if err := g.restoreStuck(groupName, commandID, settings[i]); err != nil {
+			return g.abortStart(groupName, grp, cmds, err)
+		}
+		if err := g.restoreStopSignal(grp, commandID, settings[i]); err != nil {
+			return g.abortStart(groupName, grp, cmds, err)
+		}
+		if err := g.restoreBinaryChange(groupName, commandID, cmd, settings[i]); err != nil {
+			g.unwatchBinaries(groupName, ids[:i]...)
+			return g.abortStart(groupName, grp, cmds, err)
+		}
+	}
+	if err := g.restorePaused(tx, groupName, grp); err != nil {
+		g.logf("pausing group %s: %s", groupName, err)
 	}
 	return nil
 }
@@ -344,160 +1034,327 @@ func (g *Groups) openTx(tx *sql.Tx, groupName string, grp *Group, cmds ...*exec.
 // Remove removes commands from a group, or removes a group entirely
 // if there are no command ID's passed.
 func (g *Groups) Remove(groupName string, cmds ...*exec.Cmd) error {
-	tx, err := g.db.Begin()
-	if err != nil {
-		return errors.Wrap(err, "starting transaction")
-	}
-	if err := g.removeTx(tx, groupName, cmds...); err != nil {
-		_ = tx.Rollback()
-		return err
-	}
-	return errors.Wrap(tx.Commit(), "committing transaction")
+	return g.remove(groupName, g.timeouts().Remove, cmds...)
 }
 
-func (g *Groups) removeTx(tx *sql.Tx, groupName string, cmds ...*exec.Cmd) error {
-	var (
-		args  = make([]interface{}, 1+len(cmds))
-		query = `DELETE FROM processes WHERE group_name = ? AND (`
-	)
-	args[0] = groupName
-
-	for i, cmd := range cmds {
-		if i > 0 {
-			query += ` OR `
+// remove removes commands from a group, waiting up to timeout for each of them to exit.
+func (g *Groups) remove(groupName string, timeout time.Duration, cmds ...*exec.Cmd) error {
+	if grp := g.getGroup(groupName); grp != nil && grp.ephemeral {
+		if err := g.removeEphemeral(groupName, grp, timeout, cmds...); err != nil {
+			return err
+		}
+	} else {
+		tx, err := g.db.Begin()
+		if err != nil {
+			return errors.Wrap(err, "starting transaction")
+		}
+		if err := g.removeTx(tx, groupName, timeout, cmds...); err != nil {
+			_ = tx.Rollback()
+			return err
+		}
+		if err := tx.Commit(); err != nil {
+			return errors.Wrap(err, "committing transaction")
 		}
-		query += `process_id = ?`
-		args[i+1] = cmd.Process.Pid
-	}
-	query += `)`
-
-	if len(cmds) == 0 {
-		query = `DELETE FROM processes WHERE group_name = ?`
 	}
-	if _, err := g.db.Exec(query, args...); err != nil {
-		return errors.Wrap(err, "deleting group commands from database")
+	if g.groupGC {
+		return errors.Wrap(g.collectGroup(groupName), "collecting group")
 	}
+	return nil
+}
+
+func (g *Groups) removeTx(tx *sql.Tx, groupName string, timeout time.Duration, cmds ...*exec.Cmd) error {
 	grp := g.getGroup(groupName)
 
 	if grp == nil {
 		return errors.Errorf("group %s not found", groupName)
 	}
-	return errors.Wrap(grp.Remove(cmds...), "removing commands from group")
+	commandIDs, err := g.cmdIDs(groupName, cmds)
+	if err != nil {
+		return errors.Wrap(err, "getting command IDs")
+	}
+	stored := commandIDs
+	if len(cmds) == 0 {
+		if stored, err = g.getGroupIDsTx(tx, groupName); err != nil {
+			return err
+		}
+	}
+	if err := g.deleteCmdsTx(tx, groupName, stored...); err != nil {
+		return err
+	}
+	if err := g.removeWatchTx(tx, groupName, commandIDs...); err != nil {
+		return err
+	}
+	if err := g.removeSettingsTx(tx, groupName, commandIDs...); err != nil {
+		return err
+	}
+	g.unwatchStuck(groupName, commandIDs...)
+	g.unwatchBinaries(groupName, commandIDs...)
+	g.cancelRelaunches(groupName, commandIDs...)
+
+	return errors.Wrap(grp.RemoveTimeout(timeout, cmds...), "removing commands from group")
 }
 
-func (g *Groups) startTx(tx *sql.Tx, cmd *exec.Cmd, groupName string, grp *Group) error {
-	outPipe, err := cmd.StdoutPipe()
-	if err != nil {
-		return errors.Wrap(err, "getting stdout pipe")
+func (g *Groups) startTx(tx *sql.Tx, cmd *exec.Cmd, groupName string, grp *Group, id string) error {
+	return g.start(cmd, groupName, grp, nil, id)
+}
+
+// start captures the output of cmd and starts it as part of grp.
+// If old is not nil then cmd replaces old in the group.
+// If id is empty then cmd keeps the instance ID of old, or gets a new
+// instance ID if old is nil.
+func (g *Groups) start(cmd *exec.Cmd, groupName string, grp *Group, old *exec.Cmd, id string) error {
+	if id == "" && old != nil {
+		id, _ = grp.ID(old)
 	}
-	errPipe, err := cmd.StderrPipe()
-	if err != nil {
-		return errors.Wrap(err, "getting stderr pipe")
+	if id == "" {
+		id = newInstanceID()
+	}
+	if err := g.waitConditions(groupName, cmd); err != nil {
+		return errors.Wrap(err, "checking start conditions")
+	}
+	if err := g.runSetup(groupName, id, cmd); err != nil {
+		return err
+	}
+	if err := g.makeGroupDir(groupName); err != nil {
+		return err
+	}
+	if err := g.prepareCgroup(groupName, id); err != nil {
+		return errors.Wrap(err, "preparing cgroup")
 	}
-	if err := os.Mkdir(filepath.Join(g.root, groupName), DirPerms); err != nil {
+	var captured <-chan struct{}
+
+	if g.detach {
+		closeLogs, err := g.detachCmd(cmd, groupName, id)
+		if err != nil {
+			return errors.Wrap(err, "detaching command")
+		}
+		defer closeLogs()
+	} else {
+		outPipe, outWriter, err := outputPipe(cmd.Stdout)
+		if err != nil {
+			return errors.Wrap(err, "getting stdout pipe")
+		}
+		errPipe, errWriter, err := outputPipe(cmd.Stderr)
+		if err != nil {
+			_, _ = outPipe.Close(), outWriter.Close()
+			return errors.Wrap(err, "getting stderr pipe")
+		}
+		cmd.Stdout, cmd.Stderr = outWriter, errWriter
+
+		// The child has its own copies of the write ends once it has started,
+		// so the pipes reach EOF when it (and any child of its own) exits.
+		defer func() { _, _ = outWriter.Close(), errWriter.Close() }()
+
+		if captured, err = g.captureOutput(outPipe, errPipe, groupName, id, g.logSample(groupName, cmd), g.openLog); err != nil {
+			_, _ = outPipe.Close(), errPipe.Close()
+			return errors.Wrap(err, "capturing output of child process")
+		}
+	}
+	if err := grp.start(cmd, old, id, captured); err != nil {
+		return errors.Wrap(err, "starting child process")
+	}
+	if err := g.enterCgroup(grp, cmd, groupName, id); err != nil {
+		return err
+	}
+	g.allowCoreDumps(grp, cmd, groupName)
+	return nil
+}
+
+// makeGroupDir creates the directory of a group, where the log files of its commands are.
+func (g *Groups) makeGroupDir(groupName string) error {
+	if err := os.Mkdir(filepath.Join(g.root, groupName), g.dirPerms); err != nil {
 		if !os.IsExist(err) {
 			return errors.Wrap(err, "creating group directory")
 		}
 	}
-	if err := g.captureOutput(outPipe, errPipe, groupName, cmd); err != nil {
-		return errors.Wrap(err, "capturing output of child process")
-	}
-	if err := grp.Start(cmd); err != nil {
-		return errors.Wrap(err, "starting child process")
+	return nil
+}
+
+// Watch streams state changes for the commands in a group until ctx is done.
+// It returns an error if the group is not open.
+// Notifications are dropped for receivers that fall too far behind.
+func (g *Groups) Watch(ctx context.Context, groupName string) (<-chan StateChange, error) {
+	grp := g.getGroup(groupName)
+	if grp == nil {
+		return nil, errors.Errorf("group %s not found", groupName)
 	}
-	return errors.Wrap(err, "inserting cmd start action")
+	return grp.Watch(ctx), nil
 }
 
 // Wait waits for a process group to finish.
 func (g *Groups) Wait(groupName string) error {
-	return g.getGroup(groupName).Wait(10 * time.Second)
+	return g.WaitTimeout(groupName, g.timeouts().Wait)
 }
 
-const insertCmdQuery = `INSERT INTO processes (command_id, group_name, process_id)
-                        VALUES                (?,          ?,          ?)`
+// WaitContext is like Wait, but waits until ctx is done rather than for
+// Timeouts.Wait, and returns the error of ctx then. The commands keep running.
+func (g *Groups) WaitContext(ctx context.Context, groupName string) error {
+	grp := g.getGroup(groupName)
+	if grp == nil {
+		return errors.Errorf("group %s not found", groupName)
+	}
+	return grp.WaitContext(ctx)
+}
+
+var insertCmdQuery = newQuery("inserting command", `
+INSERT INTO	processes (instance_id, command_id, group_name, process_id)
+VALUES		(?, ?, ?, ?)`)
+
+var insertCmdArg = newQuery("inserting command args", `
+INSERT INTO	command_args (command_id, idx, arg)
+VALUES		(?, ?, ?)`)
+
+var insertCmdEnvVar = newQuery("inserting command env", `
+INSERT INTO	command_env (command_id, idx, env_var)
+VALUES		(?, ?, ?)`)
+
+var deleteProcess = newQuery("deleting command", `
+DELETE FROM	processes
+WHERE		group_name = ? AND instance_id = ?`)
+
+var deleteCmdArgs = newQuery("deleting command args", `
+DELETE FROM	command_args
+WHERE		command_id = ?`)
+
+var deleteCmdEnv = newQuery("deleting command env", `
+DELETE FROM	command_env
+WHERE		command_id = ?`)
+
+// deleteCmdsTx deletes the stored commands with the provided instance IDs along
+// with their args and environments, and the env blocks that are no longer used.
+func (g *Groups) deleteCmdsTx(tx *sql.Tx, groupName string, ids ...string) error {
+	for _, id := range ids {
+		if _, err := g.exec(tx, deleteProcess, groupName, id); err != nil {
+			return err
+		}
+		for _, q := range []query{deleteCmdArgs, deleteCmdEnv, deleteCmdEnvBlocks} {
+			if _, err := g.exec(tx, q, id); err != nil {
+				return err
+			}
+		}
+	}
+	if len(ids) == 0 {
+		return nil
+	}
+	_, err := g.exec(tx, deleteUnusedEnvBlocks)
+	return err
+}
 
 // insertCmd inserts a command in the database along with its args and environment variables.
 // Calling code is expected to roll back the transaction if this func returns an error.
-func insertCmd(tx *sql.Tx, groupName string, cmd *exec.Cmd) error {
-	commandID, err := GetCmdID(cmd)
+func (g *Groups) insertCmd(tx *sql.Tx, groupName, id string, pid int, cmd *exec.Cmd) error {
+	hash, err := GetCmdID(cmd)
 	if err != nil {
 		return errors.Wrap(err, "getting command ID")
 	}
-	if _, err := tx.Exec(insertCmdQuery, commandID, groupName, cmd.Process.Pid); err != nil {
-		return errors.Wrap(err, "inserting command")
+	if _, err := g.exec(tx, insertCmdQuery, id, hash, groupName, pid); err != nil {
+		return err
 	}
-	if len(cmd.Args) > 0 {
-		if err := insertCmdArgs(tx, commandID, cmd.Args); err != nil {
-			return errors.Wrap(err, "inserting command args")
+	commandID := id
+	for i, arg := range cmd.Args {
+		if _, err := g.exec(tx, insertCmdArg, commandID, i, arg); err != nil {
+			return err
 		}
 	}
-	if len(cmd.Env) > 0 {
-		if err := insertCmdEnv(tx, commandID, cmd.Env); err != nil {
-			return errors.Wrap(err, "inserting command environment")
+	if g.envBlockMin > 0 && len(cmd.Env) >= g.envBlockMin {
+		if err := g.insertEnvBlockTx(tx, commandID, cmd.Env); err != nil {
+			return err
+		}
+	} else if len(cmd.Env) > 0 {
+		env, err := g.sealEnvs(cmd.Env)
+		if err != nil {
+			return errors.Wrap(err, "encrypting command environment")
+		}
+		for i, e := range env {
+			if _, err := g.exec(tx, insertCmdEnvVar, commandID, i, e); err != nil {
+				return err
+			}
 		}
 	}
-	return nil
+	return g.setCmdAttrsTx(tx, groupName, commandID, cmd)
 }
 
-func insertCmdArgs(tx *sql.Tx, commandID string, args []string) error {
-	var (
-		insertCmdArgsQuery = `INSERT INTO command_args (command_id, idx, arg) VALUES`
-		argsArgs           = make([]interface{}, 3*len(args))
-	)
-	for i, arg := range args {
-		if i == 0 {
-			insertCmdArgsQuery += ` (?, ?, ?)`
-		} else {
-			insertCmdArgsQuery += `, (?, ?, ?)`
-		}
-		argsArgs[(i*3)+0] = commandID
-		argsArgs[(i*3)+1] = i
-		argsArgs[(i*3)+2] = arg
+// outputPipe creates a pipe for capturing an output stream of a command.
+// Unlike (*exec.Cmd).StdoutPipe the read end is not closed by Wait,
+// so output can still be read after the command has exited.
+func outputPipe(w io.Writer) (*os.File, *os.File, error) {
+	if w != nil {
+		return nil, nil, errors.New("output already set")
 	}
-	_, err := tx.Exec(insertCmdArgsQuery, argsArgs...)
-	return errors.Wrap(err, "inserting command arguments")
+	return os.Pipe()
 }
 
-func insertCmdEnv(tx *sql.Tx, commandID string, env []string) error {
-	var (
-		insertCmdEnvQuery = `INSERT INTO command_env  (command_id, idx, env) VALUES`
-		envArgs           = make([]interface{}, 3*len(env))
-	)
-	for i, env := range env {
-		if i == 0 {
-			insertCmdEnvQuery += ` (?, ?, ?)`
-		} else {
-			insertCmdEnvQuery += `, (?, ?, ?)`
-		}
-		envArgs[(i*3)+0] = commandID
-		envArgs[(i*3)+1] = i
-		envArgs[(i*3)+2] = env
-	}
-	_, err := tx.Exec(insertCmdEnvQuery, envArgs...)
-	return errors.Wrap(err, "inserting command env")
+// logFile is a log file that the output of a command is captured to.
+type logFile interface {
+	io.WriteCloser
+	Sync() error
 }
 
-// filesync copies data from an io.Reader to a file.
-func filesync(dst *os.File, src io.Reader) error {
-	buf := make([]byte, os.Getpagesize())
+// filesync copies data from an io.Reader to a file and commits it to stable storage.
+// Without capture slots or onWrite the data is copied with io.Copy, so that the file's
+// ReadFrom can move it without passing through a user space buffer where the
+// platform allows it, and dst is synced once src is exhausted.
+// If slots is not nil a slot is held while writing each chunk to dst,
+// and each chunk is synced as it is written.
+// If onWrite is not nil it is called with each chunk after it is written.
+func filesync(dst logFile, src io.Reader, slots chan struct{}, onWrite func([]byte)) error {
+	bufp := captureBufs.Get().(*[]byte)
+	defer captureBufs.Put(bufp)
+
+	if slots == nil && onWrite == nil {
+		if _, err := io.CopyBuffer(dst, src, *bufp); err != nil {
+			return err
+		}
+		return dst.Sync()
+	}
+	buf := *bufp
 	for {
-		if _, err := src.Read(buf); err != nil {
-			if err == io.EOF {
-				break
+		n, err := src.Read(buf)
+		if n > 0 {
+			if slots != nil {
+				slots <- struct{}{}
+			}
+			werr := writeSync(dst, buf[:n])
+
+			if slots != nil {
+				<-slots
+			}
+			if werr != nil {
+				return werr
+			}
+			if onWrite != nil {
+				onWrite(buf[:n])
 			}
-			return err
 		}
-		if _, err := dst.Write(buf); err != nil {
-			return err
+		if err == io.EOF {
+			return nil
 		}
-		if err := dst.Sync(); err != nil {
+		if err != nil {
 			return err
 		}
 	}
-	return nil
 }
 
-// GetCmdID hashes the args and env of a command to form a unique ID.
+// captureBufs holds the buffers used to capture output, so that supervising
+// many processes does not allocate a new buffer for every stream.
+var captureBufs = sync.Pool{
+	New: func() interface{} {
+		buf := make([]byte, os.Getpagesize())
+		return &buf
+	},
+}
+
+// writeSync writes buf to dst and commits it to stable storage.
+func writeSync(dst logFile, buf []byte) error {
+	if _, err := dst.Write(buf); err != nil {
+		return err
+	}
+	return dst.Sync()
+}
+
+// GetCmdID hashes the args and env of a command to form an ID for its definition.
+// Identical commands have the same content hash, so each command started in a
+// group is also given an instance ID, see Groups.CmdID.
 func GetCmdID(cmd *exec.Cmd) (string, error) {
 	var (
 		h    = sha256.New()
@@ -511,6 +1368,40 @@ func GetCmdID(cmd *exec.Cmd) (string, error) {
 	return hex.EncodeToString(h.Sum(nil)), nil
 }
 
+// CmdID returns the instance ID of a command in a group.
+// If cmd is not one of the group's commands the instance ID of the first
+// command in the group with the same definition is returned.
+// It returns false if the group is not open or has no such command.
+func (g *Groups) CmdID(groupName string, cmd *exec.Cmd) (string, bool) {
+	grp := g.getGroup(groupName)
+	if grp == nil {
+		return "", false
+	}
+	return grp.ID(cmd)
+}
+
+// cmdID returns the instance ID of a command in a group, falling back to
+// the content hash of the command if it is not part of an open group.
+func (g *Groups) cmdID(groupName string, cmd *exec.Cmd) (string, error) {
+	if id, ok := g.CmdID(groupName, cmd); ok {
+		return id, nil
+	}
+	return GetCmdID(cmd)
+}
+
+// cmdIDs gets the IDs of the provided commands, see cmdID.
+func (g *Groups) cmdIDs(groupName string, cmds []*exec.Cmd) ([]string, error) {
+	commandIDs := make([]string, len(cmds))
+	for i, cmd := range cmds {
+		commandID, err := g.cmdID(groupName, cmd)
+		if err != nil {
+			return nil, err
+		}
+		commandIDs[i] = commandID
+	}
+	return commandIDs, nil
+}
+
 func s2b(ss []string) [][]byte {
 	bs := make([][]byte, len(ss))
 	for i, s := range ss {
@@ -1,10 +1,15 @@
 package exec_test
 
 import (
+	"context"
+	"database/sql"
+	"fmt"
 	"os"
 	osexec "os/exec"
 	"path/filepath"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/scgolang/exec"
 )
@@ -69,6 +74,96 @@ func verifyEchoFoo(gs *exec.Groups, groupName string, cmd *osexec.Cmd, t *testin
 	}
 }
 
+func TestGroupsOpenMany(t *testing.T) {
+	var (
+		groupName = "sleepers"
+		root      = filepath.Join("testdata", "."+t.Name())
+		n         = 50
+	)
+	_ = os.RemoveAll(root)
+
+	var (
+		gs   = newTestGroups(t, root)
+		cmds = make([]*osexec.Cmd, n)
+	)
+	for i := range cmds {
+		cmds[i] = osexec.Command("sleep", fmt.Sprintf("%d", 10+i))
+	}
+	if err := gs.Create(groupName, cmds...); err != nil {
+		t.Fatal(err)
+	}
+	stoppedID, _ := gs.CmdID(groupName, cmds[n/2])
+	if err := gs.StopCommand(groupName, stoppedID); err != nil {
+		t.Fatal(err)
+	}
+	_ = gs.Close(groupName)
+
+	gs = newTestGroups(t, root)
+	defer func() { _ = gs.Remove(groupName) }() // Best effort.
+
+	opened, err := gs.Open(groupName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected, got := n-1, len(opened); expected != got {
+		t.Fatalf("expected %d commands, got %d", expected, got)
+	}
+	for i, cmd := range opened {
+		j := i
+		if i >= n/2 {
+			j++
+		}
+		if expected, got := cmds[j].Args[1], cmd.Args[1]; expected != got {
+			t.Fatalf("expected command %d to sleep for %s, got %s", i, expected, got)
+		}
+		if id, _ := gs.CmdID(groupName, cmd); id == stoppedID {
+			t.Fatal("expected the stopped command not to be started")
+		}
+	}
+}
+
+func TestGroupsOpenArgsEnv(t *testing.T) {
+	var (
+		groupName = "argsenv"
+		root      = filepath.Join("testdata", "."+t.Name())
+	)
+	_ = os.RemoveAll(root)
+
+	var (
+		gs   = newTestGroups(t, root)
+		c1   = osexec.Command("sh", "-c", "exit 0", "zero", "one", "two", "three")
+		c2   = osexec.Command("true", "a", "b")
+		args = [][]string{c1.Args, c2.Args}
+	)
+	c1.Env = []string{"A=1", "B=2", "C=3", "D=4"}
+	envs := [][]string{c1.Env, nil}
+
+	if err := gs.Create(groupName, c1, c2); err != nil {
+		t.Fatal(err)
+	}
+	if err := gs.Wait(groupName); err != nil {
+		t.Fatal(err)
+	}
+	gs = newTestGroups(t, root)
+	defer func() { _ = gs.Remove(groupName) }() // Best effort.
+
+	cmds, err := gs.Open(groupName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected, got := len(args), len(cmds); expected != got {
+		t.Fatalf("expected %d commands, got %d", expected, got)
+	}
+	for i, cmd := range cmds {
+		if expected, got := strings.Join(args[i], " "), strings.Join(cmd.Args, " "); expected != got {
+			t.Fatalf("expected args %q, got %q", expected, got)
+		}
+		if expected, got := strings.Join(envs[i], " "), strings.Join(cmd.Env, " "); expected != got {
+			t.Fatalf("expected env %q, got %q", expected, got)
+		}
+	}
+}
+
 func TestGroupsRemove(t *testing.T) {
 	var (
 		groupName = "greps"
@@ -146,3 +241,201 @@ func getCommandID(cmd *osexec.Cmd, t *testing.T) string {
 	}
 	return cid
 }
+
+func TestGroupsWatch(t *testing.T) {
+	var (
+		groupName = "sleeper"
+		root      = filepath.Join("testdata", "."+t.Name())
+	)
+	_ = os.RemoveAll(root)
+
+	var (
+		gs          = newTestGroups(t, root)
+		ctx, cancel = context.WithCancel(context.Background())
+	)
+	defer cancel()
+
+	if err := gs.Create(groupName, osexec.Command("sleep", "0.2")); err != nil {
+		t.Fatal(err)
+	}
+	changes, err := gs.Watch(ctx, groupName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := gs.Wait(groupName); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case <-time.After(time.Second):
+		t.Fatal("timeout waiting for state change")
+	case change := <-changes:
+		if expected, got := groupName, change.Group; expected != got {
+			t.Fatalf("expected group %s, got %s", expected, got)
+		}
+		if expected, got := exec.StateRunning, change.From; expected != got {
+			t.Fatalf("expected from state %s, got %s", expected, got)
+		}
+		if expected, got := exec.StateExited, change.To; expected != got {
+			t.Fatalf("expected to state %s, got %s", expected, got)
+		}
+	}
+	if _, err := gs.Watch(ctx, "nope"); err == nil {
+		t.Fatal("expected an error, got nil")
+	}
+}
+
+func TestGroupsDuplicateCommands(t *testing.T) {
+	var (
+		groupName = "sleepers"
+		root      = filepath.Join("testdata", "."+t.Name())
+	)
+	_ = os.RemoveAll(root)
+
+	var (
+		gs = newTestGroups(t, root)
+		c1 = osexec.Command("sleep", "10")
+		c2 = osexec.Command("sleep", "10")
+	)
+	if err := gs.Create(groupName, c1, c2); err != nil {
+		t.Fatal(err)
+	}
+	id1, ok := gs.CmdID(groupName, c1)
+	if !ok {
+		t.Fatal("expected first command to have an instance ID")
+	}
+	id2, ok := gs.CmdID(groupName, c2)
+	if !ok {
+		t.Fatal("expected second command to have an instance ID")
+	}
+	if id1 == id2 {
+		t.Fatalf("expected identical commands to have different instance IDs, both got %s", id1)
+	}
+	if err := gs.Remove(groupName, c1); err != nil {
+		t.Fatal(err)
+	}
+	cmds, ok := gs.Commands(groupName)
+	if !ok {
+		t.Fatal("expected group to exist")
+	}
+	if expected, got := 1, len(cmds); expected != got {
+		t.Fatalf("expected %d commands, got %d", expected, got)
+	}
+	if cmds[0] != c2 {
+		t.Fatal("expected the second command to keep running")
+	}
+	_ = gs.Remove(groupName) // Best effort.
+}
+
+func TestGroupsCaptureOutput(t *testing.T) {
+	for _, slots := range []int{0, 1} {
+		var (
+			groupName = "chatty"
+			root      = filepath.Join("testdata", fmt.Sprintf(".%s%d", t.Name(), slots))
+		)
+		_ = os.RemoveAll(root)
+
+		gs, err := exec.New(root, exec.WithCaptureConcurrency(slots))
+		if err != nil {
+			t.Fatal(err)
+		}
+		verifyCapture(gs, groupName, 20000, t)
+	}
+}
+
+func verifyCapture(gs *exec.Groups, groupName string, lines int, t *testing.T) {
+	cmd := osexec.Command("sh", "-c", fmt.Sprintf("seq 1 %d; seq 1 %d >&2", lines, lines))
+	defer func() { _ = gs.Remove(groupName) }() // Best effort.
+
+	if err := gs.Create(groupName, cmd); err != nil {
+		t.Fatal(err)
+	}
+	if err := gs.Wait(groupName); err != nil {
+		t.Fatal(err)
+	}
+	for _, fd := range []int{1, 2} {
+		scanner, closer, err := gs.Logs(groupName, cmd, fd)
+		if err != nil {
+			t.Fatal(err)
+		}
+		n := 0
+		for scanner.Scan() {
+			n++
+		}
+		_ = closer.Close()
+
+		if err := scanner.Err(); err != nil {
+			t.Fatal(err)
+		}
+		if expected, got := lines, n; expected != got {
+			t.Fatalf("expected %d lines on fd %d, got %d", expected, fd, got)
+		}
+	}
+}
+
+func TestGroupsIndexes(t *testing.T) {
+	root := filepath.Join("testdata", "."+t.Name())
+	_ = os.RemoveAll(root)
+
+	if err := os.MkdirAll(root, exec.DirPerms); err != nil {
+		t.Fatal(err)
+	}
+	db, err := sql.Open("sqlite3", filepath.Join(root, "groups.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = db.Close() }()
+
+	if _, err := exec.New(root, exec.WithDB(db)); err != nil {
+		t.Fatal(err)
+	}
+	for _, index := range []string{
+		"processes_group_name",
+		"command_args_command_id",
+		"command_env_command_id",
+	} {
+		var count int
+		if err := db.QueryRow(`SELECT COUNT(*) FROM sqlite_master WHERE type = 'index' AND name = ?`, index).Scan(&count); err != nil {
+			t.Fatal(err)
+		}
+		if expected, got := 1, count; expected != got {
+			t.Fatalf("expected index %s to exist", index)
+		}
+	}
+}
+
+func TestGroupsCreateRollback(t *testing.T) {
+	var (
+		groupName = "sleepers"
+		root      = filepath.Join("testdata", "."+t.Name())
+	)
+	_ = os.RemoveAll(root)
+
+	gs := newTestGroups(t, root)
+	defer func() { _ = gs.Remove(groupName) }() // Best effort.
+
+	missing := filepath.Join(root, "missing")
+
+	// The commands that started before the missing one are stopped.
+	if err := gs.Create(groupName, osexec.Command("sleep", "10"), osexec.Command("sleep", "11"), osexec.Command(missing)); err == nil {
+		t.Fatal("expected an error, got nil")
+	}
+	if expected, got := 0, gs.CapacityStats().Running; expected != got {
+		t.Fatalf("expected %d running, got %d", expected, got)
+	}
+	if _, ok := gs.Commands(groupName); ok {
+		t.Fatal("expected the group not to be open")
+	}
+	if err := gs.Create(groupName, osexec.Command("sleep", "10")); err != nil {
+		t.Fatal(err)
+	}
+	if err := gs.Create(groupName, osexec.Command("sleep", "11"), osexec.Command(missing)); err == nil {
+		t.Fatal("expected an error, got nil")
+	}
+	if expected, got := 1, gs.CapacityStats().Running; expected != got {
+		t.Fatalf("expected %d running, got %d", expected, got)
+	}
+	cmds, _ := gs.Commands(groupName)
+	if expected, got := 1, len(cmds); expected != got {
+		t.Fatalf("expected %d commands, got %d", expected, got)
+	}
+}
@@ -0,0 +1,83 @@
+package exec
+
+import (
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"time"
+)
+
+// HandoffEnv is the environment variable that tells a manager which was
+// started by Reexec where to find the state that Resume reattaches to.
+const HandoffEnv = "SCGOLANG_EXEC_HANDOFF"
+
+// handoffFile is the name of the file in the root directory that holds the
+// state handed off by Reexec.
+const handoffFile = ".handoff.json"
+
+// handoffCaptureTimeout is how long Reexec waits for output capture to stop.
+const handoffCaptureTimeout = 2 * time.Second
+
+// handoffState is the live state of the manager that Reexec hands off to the new image.
+type handoffState struct {
+	Groups []handoffGroup `json:"groups"`
+}
+
+// handoffGroup is the live state of an open group.
+type handoffGroup struct {
+	Name     string       `json:"name"`
+	Commands []handoffCmd `json:"commands"`
+}
+
+// handoffCmd is the live state of a running command.
+// Stdout and Stderr are the file descriptors of the read ends of its output pipes.
+type handoffCmd struct {
+	InstanceID string    `json:"instance_id"`
+	PID        int       `json:"pid"`
+	Started    time.Time `json:"started"`
+	Restarts   int       `json:"restarts"`
+	Stdout     int       `json:"stdout"`
+	Stderr     int       `json:"stderr"`
+}
+
+// capturePipes are the read ends of the pipes that the output of a command
+// is captured from, and the channel that is closed once capture stops.
+type capturePipes struct {
+	stdout   *os.File
+	stderr   *os.File
+	captured <-chan struct{}
+}
+
+// addPipes records the pipes that the output of a command is captured from.
+func (g *Groups) addPipes(groupName, commandID string, pipes *capturePipes) {
+	g.pipesMu.Lock()
+	g.pipes[groupName+"/"+commandID] = pipes
+	g.pipesMu.Unlock()
+}
+
+// removePipes forgets the pipes of a command, unless a new instance of it has replaced them.
+func (g *Groups) removePipes(groupName, commandID string, pipes *capturePipes) {
+	g.pipesMu.Lock()
+	if key := groupName + "/" + commandID; g.pipes[key] == pipes {
+		delete(g.pipes, key)
+	}
+	g.pipesMu.Unlock()
+}
+
+// getPipes returns the pipes of a command, or nil if its output is not being captured.
+func (g *Groups) getPipes(groupName, commandID string) *capturePipes {
+	g.pipesMu.Lock()
+	defer g.pipesMu.Unlock()
+	return g.pipes[groupName+"/"+commandID]
+}
+
+// handingOff returns true while the manager is re-executing itself.
+func (g *Groups) handingOff() bool {
+	return atomic.LoadInt32(&g.handoff) != 0
+}
+
+// resumeLog opens a log file for appending without a separator, since the
+// run that wrote to it is still going.
+func (g *Groups) resumeLog(groupName, filename string) (*os.File, error) {
+	return os.OpenFile(filepath.Join(g.root, groupName, filename), os.O_RDWR|os.O_CREATE|os.O_APPEND, g.logPerms)
+}
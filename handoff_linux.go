@@ -0,0 +1,361 @@
+//go:build linux
+// +build linux
+
+package exec
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"syscall"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// Reexec upgrades the manager in place: it hands off the live state of the
+// open groups and replaces the running program with the one at path, called
+// with args, without stopping any of the supervised commands.
+// If path is empty the current executable is used, and if args is nil os.Args is.
+//
+// Because exec keeps the process ID, the commands stay children of the
+// manager and their output pipes stay open. The new program must create
+// Groups with the same root directory and call Resume to reattach to them.
+// Reexec only returns if it failed, in which case the manager carries on
+// supervising the commands as before.
+//
+// Commands with a death signal can not be handed off, since exec ends the
+// threads that started them, see SetDeathSignal, so Reexec returns an error
+// if an open group has one running.
+//
+// No other method of the groups should be called while Reexec runs.
+// A command that exits while the state is being handed off is reported by
+// the new program as failed, because its exit status can not be handed off.
+func (g *Groups) Reexec(path string, args []string) error {
+	if path == "" {
+		exe, err := os.Executable()
+		if err != nil {
+			return errors.Wrap(err, "getting executable")
+		}
+		path = exe
+	}
+	if args == nil {
+		args = os.Args
+	}
+	if !atomic.CompareAndSwapInt32(&g.handoff, 0, 1) {
+		return errors.New("manager is already re-executing")
+	}
+	defer atomic.StoreInt32(&g.handoff, 0)
+
+	state, pipes, err := g.handoffState()
+	if err != nil {
+		return err
+	}
+	if err := stopCapture(pipes); err != nil {
+		g.resumeCapture(state, pipes)
+		return err
+	}
+	g.flushRuns()
+
+	statePath := filepath.Join(g.root, handoffFile)
+	data, err := json.Marshal(state)
+	if err != nil {
+		g.resumeCapture(state, pipes)
+		return errors.Wrap(err, "encoding state")
+	}
+	if err := ioutil.WriteFile(statePath, data, 0600); err != nil {
+		g.resumeCapture(state, pipes)
+		return errors.Wrap(err, "writing state")
+	}
+	env := []string{}
+	for _, kv := range os.Environ() {
+		if !strings.HasPrefix(kv, HandoffEnv+"=") {
+			env = append(env, kv)
+		}
+	}
+	env = append(env, HandoffEnv+"="+statePath)
+
+	err = setInheritable(pipes, true)
+	if err == nil {
+		err = syscall.Exec(path, args, env)
+	}
+	// Exec only returns if it failed.
+	_ = setInheritable(pipes, false)
+	_ = os.Remove(statePath)
+	g.resumeCapture(state, pipes)
+
+	return errors.Wrap(err, "executing "+path)
+}
+
+// handoffState collects the live state of the open groups, and the pipes that
+// the output of their commands is captured from, keyed by group name and instance ID.
+func (g *Groups) handoffState() (handoffState, map[string]*capturePipes, error) {
+	var (
+		state = handoffState{Groups: []handoffGroup{}}
+		pipes = map[string]*capturePipes{}
+	)
+	g.groupsMu.RLock()
+	defer g.groupsMu.RUnlock()
+
+	for name, grp := range g.groups {
+		hg := handoffGroup{Name: name, Commands: []handoffCmd{}}
+
+		grp.mu.Lock()
+		for _, cmd := range grp.cmds {
+			if !grp.aliveLocked(cmd) {
+				continue // Its exit has been reported.
+			}
+			id := grp.ids[cmd]
+
+			proc := grp.procs[cmd]
+			if cp, ok := proc.(*cappedProcess); ok {
+				proc = cp.Process
+			}
+			switch proc.(type) {
+			case osProcess:
+				if cmdDeathSignal(cmd) != 0 {
+					grp.mu.Unlock()
+					return handoffState{}, nil, errors.Errorf("command %s in group %s has a death signal, which exec would send it", id, name)
+				}
+			case *adoptedProcess:
+			default:
+				grp.mu.Unlock()
+				return handoffState{}, nil, errors.Errorf("process of command %s in group %s can not be handed off", id, name)
+			}
+			hc := handoffCmd{
+				InstanceID: id,
+				PID:        pidOf(grp.procs[cmd]),
+				Started:    grp.started[id],
+				Restarts:   grp.restarts[id],
+				Stdout:     -1,
+				Stderr:     -1,
+			}
+			if p := g.getPipes(name, id); p != nil {
+				hc.Stdout, hc.Stderr = fd(p.stdout), fd(p.stderr)
+				pipes[name+"/"+id] = p
+			}
+			hg.Commands = append(hg.Commands, hc)
+		}
+		grp.mu.Unlock()
+
+		state.Groups = append(state.Groups, hg)
+	}
+	return state, pipes, nil
+}
+
+// stopCapture stops copying the output of commands to their log files,
+// without closing the pipes it is read from.
+func stopCapture(pipes map[string]*capturePipes) error {
+	now := time.Now()
+
+	for _, p := range pipes {
+		_, _ = p.stdout.SetReadDeadline(now), p.stderr.SetReadDeadline(now)
+	}
+	deadline := time.NewTimer(handoffCaptureTimeout)
+	defer deadline.Stop()
+
+	for key, p := range pipes {
+		select {
+		case <-p.captured:
+		case <-deadline.C:
+			return errors.Errorf("timeout waiting for output capture of %s to stop", key)
+		}
+	}
+	return nil
+}
+
+// resumeCapture starts copying the output of commands to their log files
+// again after a handoff failed.
+func (g *Groups) resumeCapture(state handoffState, pipes map[string]*capturePipes) {
+	for _, hg := range state.Groups {
+		for _, hc := range hg.Commands {
+			p, ok := pipes[hg.Name+"/"+hc.InstanceID]
+			if !ok {
+				continue
+			}
+			_, _ = p.stdout.SetReadDeadline(time.Time{}), p.stderr.SetReadDeadline(time.Time{})
+
+			select {
+			case <-p.captured:
+			default:
+				continue // Capture did not stop.
+			}
+			var cmd *exec.Cmd
+			if grp := g.getGroup(hg.Name); grp != nil {
+				cmd = grp.lookup(hc.InstanceID)
+			}
+			if _, err := g.captureOutput(p.stdout, p.stderr, hg.Name, hc.InstanceID, g.logSample(hg.Name, cmd), g.resumeLog); err != nil {
+				g.logf("resuming capture of %s in group %s: %s", hc.InstanceID, hg.Name, err)
+			}
+		}
+	}
+}
+
+// setInheritable sets whether the pipes are inherited by the program that replaces this one.
+func setInheritable(pipes map[string]*capturePipes, inherit bool) error {
+	for _, p := range pipes {
+		for _, f := range []*os.File{p.stdout, p.stderr} {
+			raw, err := f.SyscallConn()
+			if err != nil {
+				return err
+			}
+			var serr error
+			if err := raw.Control(func(fd uintptr) {
+				var flags uintptr
+				if !inherit {
+					flags = syscall.FD_CLOEXEC
+				}
+				_, _, errno := syscall.Syscall(syscall.SYS_FCNTL, fd, syscall.F_SETFD, flags)
+				if errno != 0 {
+					serr = errno
+				}
+			}); err != nil {
+				return err
+			}
+			if serr != nil {
+				return errors.Wrap(serr, "setting close-on-exec of "+f.Name())
+			}
+		}
+	}
+	return nil
+}
+
+// fd returns the file descriptor of f without putting it in blocking mode, as f.Fd does.
+func fd(f *os.File) int {
+	raw, err := f.SyscallConn()
+	if err != nil {
+		return -1
+	}
+	n := -1
+	_ = raw.Control(func(fd uintptr) { n = int(fd) })
+	return n
+}
+
+// Resume reattaches to the commands of a manager that re-executed itself
+// with Reexec, and opens their groups. It returns the names of the groups,
+// or nil if this program was not started by Reexec.
+// Groups that are resumed must not be opened with Open.
+func (g *Groups) Resume() ([]string, error) {
+	path := os.Getenv(HandoffEnv)
+	if path == "" {
+		return nil, nil
+	}
+	_ = os.Unsetenv(HandoffEnv)
+
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, errors.Wrap(err, "reading handed off state")
+	}
+	_ = os.Remove(path)
+
+	var state handoffState
+	if err := json.Unmarshal(data, &state); err != nil {
+		return nil, errors.Wrap(err, "decoding handed off state")
+	}
+	names := []string{}
+	for _, hg := range state.Groups {
+		if err := g.resumeGroup(hg); err != nil {
+			return names, errors.Wrap(err, "resuming group "+hg.Name)
+		}
+		names = append(names, hg.Name)
+	}
+	return names, nil
+}
+
+// resumeGroup reattaches to the commands of a group that was handed off.
+func (g *Groups) resumeGroup(hg handoffGroup) error {
+	tx, err := g.db.Begin()
+	if err != nil {
+		return errors.Wrap(err, "starting transaction")
+	}
+	defer func() { _ = tx.Rollback() }() // Nothing is written.
+
+	cmds, ids, err := g.getGroupProcessesTx(tx, hg.Name)
+	if err != nil {
+		return errors.Wrap(err, "getting group commands")
+	}
+	watch, err := g.getGroupWatchTx(tx, hg.Name)
+	if err != nil {
+		return err
+	}
+	byID := make(map[string]*exec.Cmd, len(ids))
+	for i, id := range ids {
+		byID[id] = cmds[i]
+	}
+	var (
+		grp     = g.newGroup(hg.Name)
+		adopted = []*exec.Cmd{}
+	)
+	for _, hc := range hg.Commands {
+		cmd, ok := byID[hc.InstanceID]
+		if !ok {
+			return errors.Errorf("command %s is not stored with the group", hc.InstanceID)
+		}
+		var captured <-chan struct{}
+
+		if hc.Stdout >= 0 && hc.Stderr >= 0 {
+			syscall.CloseOnExec(hc.Stdout)
+			syscall.CloseOnExec(hc.Stderr)
+
+			var (
+				stdout = os.NewFile(uintptr(hc.Stdout), "|0")
+				stderr = os.NewFile(uintptr(hc.Stderr), "|0")
+			)
+			if captured, err = g.captureOutput(stdout, stderr, hg.Name, hc.InstanceID, g.logSample(hg.Name, cmd), g.resumeLog); err != nil {
+				return errors.Wrap(err, "capturing output of child process")
+			}
+		}
+		proc, err := os.FindProcess(hc.PID)
+		if err != nil {
+			return errors.Wrap(err, "finding process")
+		}
+		cmd.Process = proc
+
+		// Adopted processes are already running, so they count against the capacity without waiting for it.
+		g.capacity.claim()
+		grp.adopt(cmd, hc.InstanceID, &cappedProcess{Process: &adoptedProcess{cmd: cmd}, capacity: g.capacity}, captured, hc.Started, hc.Restarts)
+		adopted = append(adopted, cmd)
+	}
+	g.groupsMu.Lock()
+	g.groups[hg.Name] = grp
+	g.groupsMu.Unlock()
+
+	for _, cmd := range adopted {
+		id, _ := grp.ID(cmd)
+		if err := g.watchFiles(hg.Name, cmd, watch[id]); err != nil {
+			return errors.Wrap(err, "watching command files")
+		}
+	}
+	return nil
+}
+
+// adoptedProcess is a process that was started by the program that this one
+// replaced with Reexec. It is still a child of this process, because exec
+// keeps the process ID, so it can be waited for.
+type adoptedProcess struct {
+	cmd *exec.Cmd
+}
+
+// Pid returns the process ID.
+func (p *adoptedProcess) Pid() int { return p.cmd.Process.Pid }
+
+// Signal sends a signal to the process.
+func (p *adoptedProcess) Signal(sig os.Signal) error { return p.cmd.Process.Signal(sig) }
+
+// Wait waits for the process to exit and returns an *exec.ExitError if it failed, like (*exec.Cmd).Wait.
+func (p *adoptedProcess) Wait() error {
+	state, err := p.cmd.Process.Wait()
+	if err != nil {
+		return errors.Wrap(err, "waiting for process that was handed off")
+	}
+	p.cmd.ProcessState = state
+
+	if !state.Success() {
+		return &exec.ExitError{ProcessState: state}
+	}
+	return nil
+}
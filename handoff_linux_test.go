@@ -0,0 +1,98 @@
+//go:build linux
+// +build linux
+
+package exec_test
+
+import (
+	"io/ioutil"
+	"os"
+	osexec "os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/scgolang/exec"
+)
+
+// reexecRootEnv makes TestGroupsReexec run as a manager that re-executes
+// itself, with the root directory it names.
+const reexecRootEnv = "EXEC_TEST_REEXEC_ROOT"
+
+func TestGroupsReexec(t *testing.T) {
+	if root := os.Getenv(reexecRootEnv); root != "" {
+		runReexecManager(root, t)
+		return
+	}
+	root := filepath.Join("testdata", "."+t.Name())
+	_ = os.RemoveAll(root)
+
+	manager := osexec.Command(os.Args[0], "-test.run", "^TestGroupsReexec$", "-test.v")
+	manager.Env = append(os.Environ(), reexecRootEnv+"="+root)
+
+	out, err := manager.CombinedOutput()
+	if err != nil {
+		t.Fatalf("%s: %s", err, out)
+	}
+	if !strings.Contains(string(out), "resumed group handoff") {
+		t.Fatalf("expected the manager to resume the group, got %s", out)
+	}
+}
+
+// runReexecManager starts a command and re-executes the test binary,
+// which then resumes supervising the command.
+func runReexecManager(root string, t *testing.T) {
+	const groupName = "handoff"
+
+	gs, err := exec.New(root)
+	if err != nil {
+		t.Fatal(err)
+	}
+	names, err := gs.Resume()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if names == nil {
+		cmd := osexec.Command("sh", "-c", "echo before; sleep 1; echo after")
+		if err := gs.Create(groupName, cmd); err != nil {
+			t.Fatal(err)
+		}
+		t.Fatal(gs.Reexec("", nil)) // Only returns if it failed.
+	}
+	if expected, got := groupName, strings.Join(names, ","); expected != got {
+		t.Fatalf("expected groups %s, got %s", expected, got)
+	}
+	defer func() { _ = gs.Remove(groupName) }() // Best effort.
+
+	cmds, _ := gs.Commands(groupName)
+	if expected, got := 1, len(cmds); expected != got {
+		t.Fatalf("expected %d commands, got %d", expected, got)
+	}
+	statuses, err := gs.Statuses(groupName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for id, status := range statuses {
+		if expected, got := exec.StateRunning, status.State; expected != got {
+			t.Fatalf("expected %s to be %s, got %s", id, expected, got)
+		}
+	}
+	if err := gs.Wait(groupName); err != nil {
+		t.Fatal(err)
+	}
+	id, _ := gs.CmdID(groupName, cmds[0])
+	stdout, err := ioutil.ReadFile(filepath.Join(root, groupName, id+".stdout"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected, got := "before\nafter\n", string(stdout); expected != got {
+		t.Fatalf("expected stdout %q, got %q", expected, got)
+	}
+	runs, err := gs.Runs(groupName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected, got := 1, len(runs); expected != got {
+		t.Fatalf("expected %d run, got %d", expected, got)
+	}
+	t.Logf("resumed group %s", groupName)
+}
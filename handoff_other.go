@@ -0,0 +1,24 @@
+//go:build !linux
+// +build !linux
+
+package exec
+
+import (
+	"os"
+
+	"github.com/pkg/errors"
+)
+
+// Reexec is only supported on Linux.
+func (g *Groups) Reexec(path string, args []string) error {
+	return errors.New("reexec is only supported on linux")
+}
+
+// Resume is only supported on Linux. Like on Linux, it returns nil
+// if this program was not started by Reexec.
+func (g *Groups) Resume() ([]string, error) {
+	if os.Getenv(HandoffEnv) == "" {
+		return nil, nil
+	}
+	return nil, errors.New("resume is only supported on linux")
+}
@@ -0,0 +1,143 @@
+package exec
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// HealthTimeout is how long HealthHandler waits for the checks to finish.
+const HealthTimeout = 5 * time.Second
+
+// Names of the checks run by Health.
+const (
+	// HealthDB checks that the database answers a query.
+	HealthDB = "db"
+
+	// HealthCapture checks that the output of commands is being written to their log files.
+	HealthCapture = "capture"
+
+	// HealthSupervision checks that state changes of commands are being processed.
+	HealthSupervision = "supervision"
+)
+
+// Health is the health of Groups itself, as opposed to the commands it runs.
+type Health struct {
+	// OK is true if every check passed.
+	OK     bool          `json:"ok"`
+	Checks []HealthCheck `json:"checks"`
+}
+
+// HealthCheck is the result of one of the checks run by Health.
+type HealthCheck struct {
+	Name  string `json:"name"`
+	OK    bool   `json:"ok"`
+	Error string `json:"error,omitempty"`
+}
+
+// captureHealth keeps track of the goroutines that capture output.
+type captureHealth struct {
+	active  int
+	lastErr error
+	mu      sync.Mutex
+}
+
+// begin records that a capture started.
+func (c *captureHealth) begin() {
+	c.mu.Lock()
+	c.active++
+	c.mu.Unlock()
+}
+
+// end records that a capture ended with err.
+// A capture that succeeds clears the error of an earlier one that failed.
+func (c *captureHealth) end(err error) {
+	c.mu.Lock()
+	c.active--
+	c.lastErr = err
+	c.mu.Unlock()
+}
+
+// check returns the error of the last capture that ended, if it failed.
+func (c *captureHealth) check() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.lastErr != nil {
+		return errors.Wrapf(c.lastErr, "%d captures active, last one failed", c.active)
+	}
+	return nil
+}
+
+// Health checks that Groups is working: that its database is reachable,
+// that output is being captured, and that the goroutine which records
+// state changes is keeping up. Checks that do not finish before ctx is
+// done fail, so a manager that is wedged reports itself as unhealthy.
+func (g *Groups) Health(ctx context.Context) Health {
+	checks := []struct {
+		name  string
+		check func(context.Context) error
+	}{
+		{HealthDB, g.checkDB},
+		{HealthCapture, func(context.Context) error { return g.captureHealth.check() }},
+		{HealthSupervision, g.checkSupervision},
+	}
+	health := Health{OK: true, Checks: make([]HealthCheck, 0, len(checks))}
+
+	for _, c := range checks {
+		result := HealthCheck{Name: c.name, OK: true}
+		if err := c.check(ctx); err != nil {
+			result.OK, result.Error = false, err.Error()
+			health.OK = false
+		}
+		health.Checks = append(health.Checks, result)
+	}
+	return health
+}
+
+// checkDB runs a query that does not touch any table.
+func (g *Groups) checkDB(ctx context.Context) error {
+	var one int
+	return errors.Wrap(g.db.QueryRowContext(ctx, `SELECT 1`).Scan(&one), "querying database")
+}
+
+// checkSupervision waits for the queued state changes to be recorded,
+// like flushRuns. Supervision goroutines block when the queue is full,
+// so this fails if the writer stopped.
+func (g *Groups) checkSupervision(ctx context.Context) error {
+	flushed := make(chan struct{})
+
+	select {
+	case g.runs <- runRecord{flushed: flushed}:
+	case <-ctx.Done():
+		return errors.Wrap(ctx.Err(), "queueing state changes")
+	}
+	select {
+	case <-flushed:
+		return nil
+	case <-ctx.Done():
+		return errors.Wrapf(ctx.Err(), "recording %d queued state changes", len(g.runs))
+	}
+}
+
+// HealthHandler returns an HTTP handler that runs Health and responds with
+// its result as JSON, with status 200 if every check passed and 503 otherwise.
+// The checks are given at most HealthTimeout.
+func (g *Groups) HealthHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx, cancel := context.WithTimeout(r.Context(), HealthTimeout)
+		defer cancel()
+
+		health := g.Health(ctx)
+
+		w.Header().Set("Content-Type", "application/json")
+		if !health.OK {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+		_ = json.NewEncoder(w).Encode(health) // Best effort.
+	})
+}
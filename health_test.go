@@ -0,0 +1,75 @@
+package exec_test
+
+import (
+	"database/sql"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	osexec "os/exec"
+	"path/filepath"
+	"testing"
+
+	"github.com/scgolang/exec"
+)
+
+func TestGroupsHealth(t *testing.T) {
+	var (
+		groupName = "echofoo"
+		root      = filepath.Join("testdata", "."+t.Name())
+	)
+	_ = os.RemoveAll(root)
+
+	if err := os.MkdirAll(root, exec.DirPerms); err != nil {
+		t.Fatal(err)
+	}
+	db, err := sql.Open("sqlite3", filepath.Join(root, "groups.db")+"?_txlock=immediate")
+	if err != nil {
+		t.Fatal(err)
+	}
+	gs, err := exec.New(root, exec.WithDB(db))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = gs.Remove(groupName) }() // Best effort.
+
+	if err := gs.Create(groupName, osexec.Command("echo", "foo")); err != nil {
+		t.Fatal(err)
+	}
+	if err := gs.Wait(groupName); err != nil {
+		t.Fatal(err)
+	}
+	health := getHealth(gs.HealthHandler(), http.StatusOK, t)
+	if !health.OK {
+		t.Fatalf("expected groups to be healthy, got %+v", health)
+	}
+	if expected, got := 3, len(health.Checks); expected != got {
+		t.Fatalf("expected %d checks, got %d", expected, got)
+	}
+	if err := db.Close(); err != nil {
+		t.Fatal(err)
+	}
+	health = getHealth(gs.HealthHandler(), http.StatusServiceUnavailable, t)
+	if health.OK {
+		t.Fatal("expected groups to be unhealthy")
+	}
+	for _, check := range health.Checks {
+		if expected, got := check.Name != exec.HealthDB, check.OK; expected != got {
+			t.Fatalf("expected check %s to be ok=%t, got %+v", check.Name, expected, check)
+		}
+	}
+}
+
+func getHealth(handler http.Handler, status int, t *testing.T) exec.Health {
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest("GET", "/healthz", nil))
+
+	if expected, got := status, rec.Code; expected != got {
+		t.Fatalf("expected status %d, got %d", expected, got)
+	}
+	var health exec.Health
+	if err := json.NewDecoder(rec.Body).Decode(&health); err != nil {
+		t.Fatal(err)
+	}
+	return health
+}
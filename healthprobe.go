@@ -0,0 +1,232 @@
+package exec
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"os/exec"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// Defaults of the fields of HealthProbe.
+const (
+	DefaultHealthInterval = 10 * time.Second
+	DefaultHealthFailures = 3
+)
+
+// HealthProbe checks periodically that a running command is healthy,
+// see SetHealthProbe.
+type HealthProbe struct {
+	Probe Probe
+
+	// Interval is the time between checks, DefaultHealthInterval if it is zero,
+	// and Timeout is how long a check can take, Interval if it is zero.
+	Interval time.Duration
+	Timeout  time.Duration
+
+	// Failures is how many checks in a row have to fail for the command
+	// to be unhealthy, DefaultHealthFailures if it is zero.
+	Failures int
+
+	// Restart, if true, gracefully restarts a command once it is unhealthy.
+	Restart bool
+}
+
+// withDefaults returns the probe with defaults in place of its zero fields.
+func (hp HealthProbe) withDefaults() HealthProbe {
+	if hp.Interval == 0 {
+		hp.Interval = DefaultHealthInterval
+	}
+	if hp.Timeout == 0 {
+		hp.Timeout = hp.Interval
+	}
+	if hp.Failures == 0 {
+		hp.Failures = DefaultHealthFailures
+	}
+	return hp
+}
+
+// ExecProbe returns a probe that runs a command, which passes if it exits
+// with status 0. A new command with the definition of check is run every time.
+func ExecProbe(check *exec.Cmd) Probe {
+	return ProbeFunc(func(ctx context.Context, _ *exec.Cmd) error {
+		c := exec.CommandContext(ctx, check.Path)
+		c.Args = append([]string{}, check.Args...)
+		c.Env = append([]string(nil), check.Env...)
+		c.Dir = check.Dir
+		return errors.Wrap(c.Run(), "running check")
+	})
+}
+
+// TCPProbe returns a probe that passes if addr, a host:port, accepts connections.
+func TCPProbe(addr string) Probe {
+	return ProbeFunc(func(ctx context.Context, _ *exec.Cmd) error {
+		return dialTCP(ctx, addr)
+	})
+}
+
+// HTTPProbe returns a probe that passes if url responds to a GET with status 200.
+func HTTPProbe(url string) Probe {
+	return ProbeFunc(func(ctx context.Context, _ *exec.Cmd) error {
+		return httpGet(ctx, url)
+	})
+}
+
+// dialTCP returns nil if addr accepts connections.
+func dialTCP(ctx context.Context, addr string) error {
+	var d net.Dialer
+	conn, err := d.DialContext(ctx, "tcp", addr)
+	if err != nil {
+		return err
+	}
+	return conn.Close()
+}
+
+// httpGet returns nil if url responds to a GET with status 200.
+func httpGet(ctx context.Context, url string) error {
+	req, err := http.NewRequest(http.MethodGet, url, nil)
+	if err != nil {
+		return err
+	}
+	resp, err := http.DefaultClient.Do(req.WithContext(ctx))
+	if err != nil {
+		return err
+	}
+	_ = resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return errors.Errorf("status %s", resp.Status)
+	}
+	return nil
+}
+
+// SetHealthProbe sets the probe that checks a command periodically while it
+// is running. Once the command fails Failures checks in a row it is
+// unhealthy, which its status reports, until it passes a check again.
+// A nil Probe removes the health probe.
+// Like readiness probes, health probes are not persisted and must be set
+// every time a Groups is created, before the command is started.
+func (g *Groups) SetHealthProbe(groupName string, cmd *exec.Cmd, hp HealthProbe) error {
+	if hp.Interval < 0 || hp.Timeout < 0 || hp.Failures < 0 {
+		return errors.New("health probe interval, timeout, and failures must not be negative")
+	}
+	commandID, err := GetCmdID(cmd)
+	if err != nil {
+		return errors.Wrap(err, "getting command ID")
+	}
+	g.probesMu.Lock()
+	defer g.probesMu.Unlock()
+
+	if g.health[groupName] == nil {
+		g.health[groupName] = map[string]HealthProbe{}
+	}
+	if hp.Probe == nil {
+		delete(g.health[groupName], commandID)
+	} else {
+		g.health[groupName][commandID] = hp.withDefaults()
+	}
+	return nil
+}
+
+// healthProbe returns the health probe of cmd, and false if it has none.
+func (g *Groups) healthProbe(groupName string, cmd *exec.Cmd) (HealthProbe, bool) {
+	hash, err := GetCmdID(cmd)
+	if err != nil {
+		return HealthProbe{}, false
+	}
+	g.probesMu.Lock()
+	defer g.probesMu.Unlock()
+
+	hp, ok := g.health[groupName][hash]
+	return hp, ok
+}
+
+// healthChecker checks the health of a running instance of a command.
+type healthChecker struct {
+	// unhealthy is the error of the last check if the command is unhealthy.
+	unhealthy string
+}
+
+// checkHealth checks the health of cmd, which has just started running,
+// until it is no longer the running instance of the command.
+func (g *Groups) checkHealth(groupName string, grp *Group, cmd *exec.Cmd, commandID string) {
+	hp, ok := g.healthProbe(groupName, cmd)
+	if !ok {
+		return
+	}
+	hc := &healthChecker{}
+
+	g.healthMu.Lock()
+	if g.healthCheckers[groupName] == nil {
+		g.healthCheckers[groupName] = map[string]*healthChecker{}
+	}
+	g.healthCheckers[groupName][commandID] = hc
+	g.healthMu.Unlock()
+
+	go func() {
+		defer func() {
+			g.healthMu.Lock()
+			if g.healthCheckers[groupName][commandID] == hc {
+				delete(g.healthCheckers[groupName], commandID)
+			}
+			g.healthMu.Unlock()
+		}()
+		running := func() bool {
+			return grp.lookup(commandID) == cmd && grp.State(cmd) == StateRunning
+		}
+		for failures := 0; ; {
+			<-g.clock.After(hp.Interval)
+			if !running() {
+				return
+			}
+			if grp.isPaused() {
+				failures = 0
+				continue
+			}
+			ctx, cancel := withClockTimeout(context.Background(), g.clock, hp.Timeout)
+			err := hp.Probe.Probe(ctx, cmd)
+			cancel()
+
+			if !running() {
+				return
+			}
+			if err == nil {
+				failures = 0
+				g.setUnhealthy(hc, "")
+				continue
+			}
+			if failures++; failures < hp.Failures {
+				continue
+			}
+			g.setUnhealthy(hc, err.Error())
+
+			if hp.Restart {
+				g.logf("command %s in group %s is unhealthy, restarting it: %s", commandID, groupName, err)
+				if rerr := g.restart(groupName, commandID); rerr != nil {
+					g.logf("restarting unhealthy command %s in group %s: %s", commandID, groupName, rerr)
+				}
+				return
+			}
+		}
+	}()
+}
+
+// setUnhealthy records the result of a health check.
+func (g *Groups) setUnhealthy(hc *healthChecker, unhealthy string) {
+	g.healthMu.Lock()
+	hc.unhealthy = unhealthy
+	g.healthMu.Unlock()
+}
+
+// unhealthy returns the error that makes a command unhealthy,
+// or an empty string if it is healthy or has no health probe.
+func (g *Groups) unhealthy(groupName, commandID string) string {
+	g.healthMu.Lock()
+	defer g.healthMu.Unlock()
+
+	if hc := g.healthCheckers[groupName][commandID]; hc != nil {
+		return hc.unhealthy
+	}
+	return ""
+}
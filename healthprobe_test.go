@@ -0,0 +1,68 @@
+package exec_test
+
+import (
+	"context"
+	"errors"
+	"os"
+	osexec "os/exec"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/scgolang/exec"
+)
+
+func TestGroupsSetHealthProbe(t *testing.T) {
+	var (
+		groupName = "daemons"
+		root      = filepath.Join("testdata", "."+t.Name())
+	)
+	_ = os.RemoveAll(root)
+
+	var (
+		gs      = newTestGroups(t, root)
+		sick    = osexec.Command("sleep", "10")
+		healthy = osexec.Command("sleep", "11")
+		checks  int32
+	)
+	failing := exec.ProbeFunc(func(ctx context.Context, cmd *osexec.Cmd) error {
+		atomic.AddInt32(&checks, 1)
+		return errors.New("not answering")
+	})
+	if err := gs.SetHealthProbe(groupName, sick, exec.HealthProbe{Probe: failing, Interval: 10 * time.Millisecond, Failures: 2, Restart: true}); err != nil {
+		t.Fatal(err)
+	}
+	if err := gs.SetHealthProbe(groupName, healthy, exec.HealthProbe{Probe: exec.ExecProbe(osexec.Command("true")), Interval: 10 * time.Millisecond}); err != nil {
+		t.Fatal(err)
+	}
+	if err := gs.Create(groupName, sick, healthy); err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = gs.Remove(groupName) }()
+
+	var (
+		sickID, _    = gs.CmdID(groupName, sick)
+		healthyID, _ = gs.CmdID(groupName, healthy)
+		deadline     = time.Now().Add(5 * time.Second)
+	)
+	for {
+		statuses, err := gs.Statuses(groupName)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if statuses[sickID].Restarts >= 1 {
+			if statuses[healthyID].Unhealthy != "" || statuses[healthyID].Restarts != 0 {
+				t.Fatalf("expected a command that passes its health probe to be healthy, got %+v", statuses[healthyID])
+			}
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("timeout waiting for the unhealthy command to be restarted, got %+v after %d checks", statuses[sickID], atomic.LoadInt32(&checks))
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if err := gs.SetHealthProbe(groupName, sick, exec.HealthProbe{Probe: failing, Failures: -1}); err == nil {
+		t.Fatal("expected an error, got nil")
+	}
+}
@@ -0,0 +1,206 @@
+package exec
+
+import (
+	"database/sql"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// Run is a record of one execution of a command.
+type Run struct {
+	ID        int64     `json:"id"`
+	Group     string    `json:"group"`
+	CommandID string    `json:"command_id"`
+	PID       int       `json:"pid"`
+	Started   time.Time `json:"started"`
+
+	// Exited is the zero time if the run has not finished.
+	Exited time.Time `json:"exited"`
+
+	// State is the state the command was in at the end of the run,
+	// or StateRunning if it has not finished.
+	State State `json:"state"`
+
+	// Error is the error the command exited with, if any,
+	// and OOMKilled is true if the kernel killed it because it ran out of memory.
+	Error     string `json:"error,omitempty"`
+	OOMKilled bool   `json:"oom_killed,omitempty"`
+
+	// Fingerprint is what ran the command and where.
+	// It is empty for runs recorded by earlier versions of this package.
+	Fingerprint Fingerprint `json:"fingerprint"`
+}
+
+// ErrStopIteration can be returned by the function passed to EachRun or
+// EachSnapshot to stop iterating without an error.
+var ErrStopIteration = errors.New("stop iteration")
+
+// stopIteration returns the error that stops an iteration because fn returned err.
+func stopIteration(err error) error {
+	if err == ErrStopIteration {
+		return nil
+	}
+	return err
+}
+
+// runsBufferSize is the number of state changes that can be waiting to be
+// recorded in the run history before supervision goroutines block.
+const runsBufferSize = 1024
+
+// runRecord is a state change waiting to be recorded in the run history.
+// If flushed is not nil it is closed once every earlier record has been written.
+type runRecord struct {
+	change  StateChange
+	flushed chan struct{}
+}
+
+// recordRun queues a state change to be recorded in the run history.
+// It is called on every state change of a group managed by g.
+// Changes are written by a single goroutine so that supervision never waits
+// on a transaction that is holding the database's write lock.
+func (g *Groups) recordRun(change StateChange) {
+	g.runs <- runRecord{change: change}
+}
+
+// flushRuns waits for every queued state change to be recorded.
+func (g *Groups) flushRuns() {
+	flushed := make(chan struct{})
+	g.runs <- runRecord{flushed: flushed}
+	<-flushed
+}
+
+// writeRuns writes queued state changes to the database.
+func (g *Groups) writeRuns() {
+	for rec := range g.runs {
+		if rec.flushed != nil {
+			close(rec.flushed)
+			continue
+		}
+		g.writeRun(rec.change)
+	}
+}
+
+// writeRun records the start or end of a run in the database.
+func (g *Groups) writeRun(change StateChange) {
+	switch change.To {
+	case StateRunning:
+		if change.PID == 0 {
+			return
+		}
+		fp := g.fingerprint(change.Cmd)
+
+		if _, err := g.exec(
+			nil, insertRun,
+			change.Group, change.CommandID, change.PID, change.Time.UnixNano(), StateRunning.String(),
+			fp.ManagerVersion, fp.Hostname, fp.Platform, fp.BinaryPath, fp.BinarySHA256,
+		); err != nil {
+			g.logf("recording start of %s in group %s: %s", change.CommandID, change.Group, err)
+		}
+	case StateExited, StateFailed, StateStopped:
+		if change.PID == 0 {
+			return
+		}
+		var errmsg string
+		if change.Err != nil {
+			errmsg = change.Err.Error()
+		}
+		if _, err := g.exec(
+			nil, updateRun,
+			change.Time.UnixNano(), change.To.String(), errmsg, change.Group, change.CommandID, change.PID,
+		); err != nil {
+			g.logf("recording exit of %s in group %s: %s", change.CommandID, change.Group, err)
+		}
+	}
+}
+
+var insertRun = newQuery("inserting run", `
+INSERT INTO	runs (group_name, command_id, process_id, started, state,
+		      manager_version, hostname, platform, binary_path, binary_sha256)
+VALUES		(?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`)
+
+var updateRun = newQuery("updating run", `
+UPDATE	runs
+SET	exited = ?, state = ?, error = ?
+WHERE	group_name = ? AND command_id = ? AND process_id = ? AND exited IS NULL`)
+
+var getRuns = newQuery("querying runs", `
+SELECT		run_id, group_name, command_id, process_id, started, exited, state, error,
+		manager_version, hostname, platform, binary_path, binary_sha256
+FROM		runs
+WHERE		group_name = ?
+ORDER BY	run_id`)
+
+// Runs returns the run history of a group, oldest first.
+// Use EachRun for groups with a long history.
+func (g *Groups) Runs(groupName string) ([]Run, error) {
+	runs := []Run{}
+	err := g.EachRun(groupName, func(run Run) error {
+		runs = append(runs, run)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return runs, nil
+}
+
+// EachRun calls fn with each run in the history of a group, oldest first,
+// without reading the whole history into memory.
+// If fn returns an error iteration stops and EachRun returns it,
+// unless it is ErrStopIteration in which case EachRun returns nil.
+// The database is being read while fn runs, so it should not block for long.
+func (g *Groups) EachRun(groupName string, fn func(Run) error) error {
+	g.flushRuns()
+
+	rows, err := g.queryRows(nil, getRuns, groupName)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = rows.Close() }() // Best effort.
+
+	for rows.Next() {
+		run, err := scanRun(rows)
+		if err != nil {
+			return errors.Wrap(err, "scanning run row")
+		}
+		if err := fn(run); err != nil {
+			return stopIteration(err)
+		}
+	}
+	return errors.Wrap(rows.Err(), "scanning run rows")
+}
+
+// scanRun scans a row of the runs table.
+func scanRun(rows *sql.Rows) (Run, error) {
+	var (
+		run     Run
+		started int64
+		exited  sql.NullInt64
+		state   string
+		errmsg  sql.NullString
+		fp      = make([]sql.NullString, len(fingerprintColumns))
+	)
+	if err := rows.Scan(
+		&run.ID, &run.Group, &run.CommandID, &run.PID, &started, &exited, &state, &errmsg,
+		&fp[0], &fp[1], &fp[2], &fp[3], &fp[4],
+	); err != nil {
+		return Run{}, err
+	}
+	run.Fingerprint = Fingerprint{
+		ManagerVersion: fp[0].String,
+		Hostname:       fp[1].String,
+		Platform:       fp[2].String,
+		BinaryPath:     fp[3].String,
+		BinarySHA256:   fp[4].String,
+	}
+	run.Started = time.Unix(0, started)
+	if exited.Valid {
+		run.Exited = time.Unix(0, exited.Int64)
+	}
+	run.State = parseState(state)
+	run.Error = errmsg.String
+	run.OOMKilled = strings.HasPrefix(run.Error, oomMessage)
+	return run, nil
+}
@@ -0,0 +1,89 @@
+package exec_test
+
+import (
+	"errors"
+	"os"
+	osexec "os/exec"
+	"path/filepath"
+	"testing"
+
+	"github.com/scgolang/exec"
+)
+
+func TestGroupsEachRun(t *testing.T) {
+	var (
+		groupName = "echoers"
+		root      = filepath.Join("testdata", "."+t.Name())
+	)
+	_ = os.RemoveAll(root)
+
+	gs := newTestGroups(t, root)
+	defer func() { _ = gs.Remove(groupName) }() // Best effort.
+
+	if err := gs.Create(groupName, osexec.Command("echo", "1"), osexec.Command("echo", "2"), osexec.Command("echo", "3")); err != nil {
+		t.Fatal(err)
+	}
+	if err := gs.Wait(groupName); err != nil {
+		t.Fatal(err)
+	}
+	n := 0
+	if err := gs.EachRun(groupName, func(run exec.Run) error {
+		if n++; n == 2 {
+			return exec.ErrStopIteration
+		}
+		return nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if expected, got := 2, n; expected != got {
+		t.Fatalf("expected %d runs before stopping, got %d", expected, got)
+	}
+	errBoom := errors.New("boom")
+	if err := gs.EachRun(groupName, func(run exec.Run) error {
+		return errBoom
+	}); err != errBoom {
+		t.Fatalf("expected %v, got %v", errBoom, err)
+	}
+	runs, err := gs.Runs(groupName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected, got := 3, len(runs); expected != got {
+		t.Fatalf("expected %d runs, got %d", expected, got)
+	}
+}
+
+func TestRunFingerprint(t *testing.T) {
+	var (
+		groupName = "fingerprinted"
+		root      = filepath.Join("testdata", "."+t.Name())
+	)
+	_ = os.RemoveAll(root)
+
+	gs, err := exec.New(root, exec.WithDBFile("groups.db"), exec.WithVersion("v1.2.3"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = gs.Remove(groupName) }() // Best effort.
+
+	if err := gs.Create(groupName, osexec.Command("true")); err != nil {
+		t.Fatal(err)
+	}
+	if err := gs.Wait(groupName); err != nil {
+		t.Fatal(err)
+	}
+	runs, err := gs.Runs(groupName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected, got := 1, len(runs); expected != got {
+		t.Fatalf("expected %d runs, got %d", expected, got)
+	}
+	fp := runs[0].Fingerprint
+	if expected, got := "v1.2.3", fp.ManagerVersion; expected != got {
+		t.Fatalf("expected manager version %s, got %s", expected, got)
+	}
+	if fp.Platform == "" || fp.BinaryPath == "" || len(fp.BinarySHA256) != 64 {
+		t.Fatalf("expected the platform and the path and SHA-256 of the executable, got %+v", fp)
+	}
+}
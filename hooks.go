@@ -0,0 +1,91 @@
+package exec
+
+import (
+	"os/exec"
+
+	"github.com/pkg/errors"
+)
+
+// Hooks are commands that prepare the environment of a command and clean it
+// up, like creating directories, running migrations, or releasing ports,
+// see SetHooks.
+type Hooks struct {
+	// Setup, if not nil, runs to completion before every start of the
+	// command, which only starts if Setup exits with status 0.
+	Setup *exec.Cmd
+
+	// Teardown, if not nil, runs after the command has exited, failed,
+	// or been stopped. It does not run when the command is restarted.
+	Teardown *exec.Cmd
+}
+
+// Suffixes of the IDs that the runs of hooks are recorded with.
+const (
+	setupSuffix    = ".setup"
+	teardownSuffix = ".teardown"
+)
+
+// SetHooks sets the hooks of a command. Their output is captured to log files
+// named after the instance ID of the command with a .setup or .teardown
+// suffix, like <instance ID>.setup.stdout, and their runs are recorded in the
+// run history of the group with those IDs.
+// Like readiness probes, hooks are not persisted and must be set every time
+// a Groups is created, before the command is started.
+func (g *Groups) SetHooks(groupName string, cmd *exec.Cmd, hooks Hooks) error {
+	for _, hook := range []*exec.Cmd{hooks.Setup, hooks.Teardown} {
+		if hook != nil && (hook.Stdout != nil || hook.Stderr != nil) {
+			return errors.New("output of a hook must not be set")
+		}
+	}
+	commandID, err := GetCmdID(cmd)
+	if err != nil {
+		return errors.Wrap(err, "getting command ID")
+	}
+	g.probesMu.Lock()
+	defer g.probesMu.Unlock()
+
+	if g.hooks[groupName] == nil {
+		g.hooks[groupName] = map[string]Hooks{}
+	}
+	if hooks.Setup == nil && hooks.Teardown == nil {
+		delete(g.hooks[groupName], commandID)
+	} else {
+		g.hooks[groupName][commandID] = hooks
+	}
+	return nil
+}
+
+// cmdHooks returns the hooks of cmd.
+func (g *Groups) cmdHooks(groupName string, cmd *exec.Cmd) Hooks {
+	hash, err := GetCmdID(cmd)
+	if err != nil {
+		return Hooks{}
+	}
+	g.probesMu.Lock()
+	defer g.probesMu.Unlock()
+	return g.hooks[groupName][hash]
+}
+
+// runSetup runs the setup hook of cmd, if it has one,
+// and returns an error if it does not exit with status 0.
+func (g *Groups) runSetup(groupName, commandID string, cmd *exec.Cmd) error {
+	hook := g.cmdHooks(groupName, cmd).Setup
+	if hook == nil {
+		return nil
+	}
+	result := g.runJobCmd(&Job{ID: commandID + setupSuffix, Group: groupName}, cloneCmd(hook))
+	return errors.Wrap(result.Err, "running setup hook")
+}
+
+// runTeardown runs the teardown hook of cmd, if it has one.
+// Failures are logged, since the command has already exited.
+func (g *Groups) runTeardown(groupName, commandID string, cmd *exec.Cmd) {
+	hook := g.cmdHooks(groupName, cmd).Teardown
+	if hook == nil {
+		return
+	}
+	result := g.runJobCmd(&Job{ID: commandID + teardownSuffix, Group: groupName}, cloneCmd(hook))
+	if result.Err != nil {
+		g.logf("running teardown hook of %s in group %s: %s", commandID, groupName, result.Err)
+	}
+}
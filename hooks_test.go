@@ -0,0 +1,74 @@
+package exec_test
+
+import (
+	"os"
+	osexec "os/exec"
+	"path/filepath"
+	"testing"
+
+	"github.com/scgolang/exec"
+)
+
+func TestGroupsHooks(t *testing.T) {
+	var (
+		groupName = "migrated"
+		root      = filepath.Join("testdata", "."+t.Name())
+	)
+	_ = os.RemoveAll(root)
+
+	gs := newTestGroups(t, root)
+	absRoot, err := filepath.Abs(root)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var (
+		setup    = filepath.Join(absRoot, "setup")
+		teardown = filepath.Join(absRoot, "teardown")
+		cmd      = osexec.Command("test", "-f", setup)
+	)
+	if err := gs.SetHooks(groupName, cmd, exec.Hooks{
+		Setup:    osexec.Command("touch", setup),
+		Teardown: osexec.Command("touch", teardown),
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if err := gs.Create(groupName, cmd); err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = gs.Remove(groupName) }()
+
+	if err := gs.Wait(groupName); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(teardown); err != nil {
+		t.Fatalf("expected the teardown hook to have run: %s", err)
+	}
+	commandID, ok := gs.CmdID(groupName, cmd)
+	if !ok {
+		t.Fatal("command not found")
+	}
+	runs, err := gs.Runs(groupName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	recorded := map[string]bool{}
+	for _, run := range runs {
+		recorded[run.CommandID] = true
+	}
+	for _, id := range []string{commandID + ".setup", commandID, commandID + ".teardown"} {
+		if !recorded[id] {
+			t.Fatalf("expected a run of %s, got %+v", id, runs)
+		}
+	}
+	// A command whose setup fails is not started.
+	failing := osexec.Command("sleep", "10")
+	if err := gs.SetHooks(groupName, failing, exec.Hooks{Setup: osexec.Command("false")}); err != nil {
+		t.Fatal(err)
+	}
+	if err := gs.Create(groupName, failing); err == nil {
+		t.Fatal("expected an error, got nil")
+	}
+	if err := gs.SetHooks(groupName, failing, exec.Hooks{Setup: &osexec.Cmd{Stdout: os.Stdout}}); err == nil {
+		t.Fatal("expected an error, got nil")
+	}
+}
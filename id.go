@@ -0,0 +1,19 @@
+package exec
+
+import (
+	"crypto/rand"
+	"fmt"
+)
+
+// newInstanceID returns a random (version 4) UUID that identifies
+// one instance of a command in a group.
+func newInstanceID() string {
+	var b [16]byte
+	if _, err := rand.Read(b[:]); err != nil {
+		panic("reading random bytes: " + err.Error())
+	}
+	b[6] = (b[6] & 0x0f) | 0x40 // Version 4.
+	b[8] = (b[8] & 0x3f) | 0x80 // RFC 4122 variant.
+
+	return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:])
+}
@@ -0,0 +1,30 @@
+//go:build freebsd
+// +build freebsd
+
+package exec
+
+import (
+	"os/exec"
+	"syscall"
+)
+
+// cmdJail returns the ID of the jail that cmd is started in, or zero if it is not jailed.
+func cmdJail(cmd *exec.Cmd) int {
+	if cmd.SysProcAttr == nil {
+		return 0
+	}
+	return cmd.SysProcAttr.Jail
+}
+
+// setCmdJail makes cmd start in the jail with the provided ID, with jail_attach.
+// Zero leaves cmd as it is.
+func setCmdJail(cmd *exec.Cmd, jid int) error {
+	if jid == 0 {
+		return nil
+	}
+	if cmd.SysProcAttr == nil {
+		cmd.SysProcAttr = &syscall.SysProcAttr{}
+	}
+	cmd.SysProcAttr.Jail = jid
+	return nil
+}
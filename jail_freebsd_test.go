@@ -0,0 +1,61 @@
+//go:build freebsd
+// +build freebsd
+
+package exec_test
+
+import (
+	"bytes"
+	"os"
+	osexec "os/exec"
+	"path/filepath"
+	"strconv"
+	"syscall"
+	"testing"
+
+	"github.com/scgolang/exec"
+)
+
+// jailEnv names the ID of an existing jail that TestGroupsJail starts commands in.
+const jailEnv = "EXEC_TEST_JAIL"
+
+func TestGroupsJail(t *testing.T) {
+	jid, err := strconv.Atoi(os.Getenv(jailEnv))
+	if err != nil {
+		t.Skip("set " + jailEnv + " to the ID of a jail to run this test")
+	}
+	var (
+		groupName = "jailed"
+		root      = filepath.Join("testdata", "."+t.Name())
+	)
+	_ = os.RemoveAll(root)
+
+	gs := newTestGroups(t, root)
+	defer func() { _ = gs.Remove(groupName) }() // Best effort.
+
+	cmd := osexec.Command("sleep", "10")
+	cmd.SysProcAttr = &syscall.SysProcAttr{Jail: jid}
+
+	if err := gs.Create(groupName, cmd); err != nil {
+		t.Fatal(err)
+	}
+	var exported bytes.Buffer
+	if err := gs.Export(groupName, exec.FormatJSON, &exported); err != nil {
+		t.Fatal(err)
+	}
+	spec, err := exec.Import(&exported, exec.FormatJSON)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected, got := jid, spec.Commands[0].Jail; expected != got {
+		t.Fatalf("expected jail %d, got %d", expected, got)
+	}
+	_ = gs.Close(groupName)
+
+	cmds, err := gs.Open(groupName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cmds[0].SysProcAttr == nil || cmds[0].SysProcAttr.Jail != jid {
+		t.Fatalf("expected the reopened command to be started in jail %d", jid)
+	}
+}
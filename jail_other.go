@@ -0,0 +1,23 @@
+//go:build !freebsd
+// +build !freebsd
+
+package exec
+
+import (
+	"os/exec"
+
+	"github.com/pkg/errors"
+)
+
+// cmdJail returns zero, since only FreeBSD has jails.
+func cmdJail(cmd *exec.Cmd) int {
+	return 0
+}
+
+// setCmdJail returns an error unless jid is zero, since only FreeBSD has jails.
+func setCmdJail(cmd *exec.Cmd, jid int) error {
+	if jid == 0 {
+		return nil
+	}
+	return errors.New("jails are only supported on freebsd")
+}
@@ -0,0 +1,407 @@
+package exec
+
+import (
+	"os/exec"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// DefaultJobConcurrency is the number of jobs that run at the same time across all groups.
+const DefaultJobConcurrency = 4
+
+// Job is a one-shot command that was enqueued with Enqueue.
+// Its runs are recorded in the run history of its group, with the job ID as
+// their command ID, and its output is written to log files named after the job ID.
+type Job struct {
+	ID    string
+	Group string
+	Cmd   *exec.Cmd
+
+	// retry decides whether the job is run again if it fails, see WithRetry.
+	// attempts is how many times the job has been started.
+	retry    RetryPolicy
+	attempts int32
+
+	// key and window deduplicate submissions of the job, see WithIdempotencyKey.
+	key    string
+	window time.Duration
+
+	// windows decide when the job can start, see WithRunWindows.
+	windows RunWindows
+
+	done   chan struct{}
+	result ExitResult
+}
+
+// JobOption configures a job, see Enqueue.
+type JobOption func(*Job) error
+
+// Done returns a channel that is closed when the job has finished.
+func (j *Job) Done() <-chan struct{} {
+	return j.done
+}
+
+// Wait waits for the job to finish and returns the error it exited with, if any.
+func (j *Job) Wait() error {
+	<-j.done
+	return j.result.Err
+}
+
+// Attempts returns how many times the job has been started.
+func (j *Job) Attempts() int {
+	return int(atomic.LoadInt32(&j.attempts))
+}
+
+// Result returns how the last attempt of the job exited.
+// It returns false if the job has not finished.
+func (j *Job) Result() (ExitResult, bool) {
+	select {
+	case <-j.done:
+		return j.result, true
+	default:
+		return ExitResult{}, false
+	}
+}
+
+// jobQueue holds the jobs that are waiting to run.
+// Groups that have jobs waiting take turns, the group that was served least
+// recently going first, so that a group that enqueues many jobs can not
+// starve the others.
+type jobQueue struct {
+	// max is how many jobs run at once, and limits how many jobs of a group run at once.
+	max    int
+	limits map[string]int
+
+	// pending maps group name to the jobs of the group that are waiting, oldest first.
+	// turns has the groups with jobs waiting, in the order they started waiting.
+	pending map[string][]*Job
+	turns   []string
+
+	// served maps group name to when the group last had a job started,
+	// counted in job starts, for groups with jobs waiting or running.
+	served map[string]int64
+	starts int64
+
+	// running is how many jobs are running, and byGroup how many of each group.
+	running int
+	byGroup map[string]int
+
+	// keyed maps group name and idempotency key to the job enqueued with them.
+	keyed map[string]keyedJob
+
+	mu sync.Mutex
+}
+
+// keyedJob is a job that was enqueued with an idempotency key, see WithIdempotencyKey.
+type keyedJob struct {
+	job     *Job
+	expires time.Time
+}
+
+// newJobQueue creates an empty job queue.
+func newJobQueue() *jobQueue {
+	return &jobQueue{
+		max:     DefaultJobConcurrency,
+		limits:  map[string]int{},
+		pending: map[string][]*Job{},
+		served:  map[string]int64{},
+		byGroup: map[string]int{},
+		keyed:   map[string]keyedJob{},
+	}
+}
+
+// dedupe returns the job that was enqueued with the same group and
+// idempotency key as job within its window, if there is one. Otherwise it
+// records job as the one enqueued with the key at now.
+// Records whose window has passed are removed.
+func (q *jobQueue) dedupe(job *Job, now time.Time) (*Job, bool) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	for key, kj := range q.keyed {
+		if !now.Before(kj.expires) {
+			delete(q.keyed, key)
+		}
+	}
+	key := job.Group + "/" + job.key
+	if kj, ok := q.keyed[key]; ok {
+		return kj.job, true
+	}
+	q.keyed[key] = keyedJob{job: job, expires: now.Add(job.window)}
+	return nil, false
+}
+
+// push adds a job to the end of the queue of its group.
+func (q *jobQueue) push(job *Job) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	if len(q.pending[job.Group]) == 0 {
+		q.turns = append(q.turns, job.Group)
+	}
+	q.pending[job.Group] = append(q.pending[job.Group], job)
+}
+
+// pop removes the job that should run next and counts it as running.
+// It returns nil if no job can run now.
+func (q *jobQueue) pop() *Job {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	if q.running >= q.max {
+		return nil
+	}
+	next := -1
+	for i, groupName := range q.turns {
+		if limit := q.limits[groupName]; limit > 0 && q.byGroup[groupName] >= limit {
+			continue
+		}
+		if next < 0 || q.served[groupName] < q.served[q.turns[next]] {
+			next = i
+		}
+	}
+	if next < 0 {
+		return nil
+	}
+	groupName := q.turns[next]
+	job := q.pending[groupName][0]
+
+	if q.pending[groupName] = q.pending[groupName][1:]; len(q.pending[groupName]) == 0 {
+		delete(q.pending, groupName)
+		q.turns = append(q.turns[:next], q.turns[next+1:]...)
+	}
+	q.starts++
+	q.served[groupName] = q.starts
+	q.running++
+	q.byGroup[groupName]++
+
+	return job
+}
+
+// finish counts a job as no longer running.
+func (q *jobQueue) finish(job *Job) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	q.running--
+	if q.byGroup[job.Group]--; q.byGroup[job.Group] > 0 {
+		return
+	}
+	delete(q.byGroup, job.Group)
+
+	if len(q.pending[job.Group]) == 0 {
+		delete(q.served, job.Group)
+	}
+}
+
+// queued returns how many jobs are waiting to run.
+func (q *jobQueue) queued() int {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	n := 0
+	for _, jobs := range q.pending {
+		n += len(jobs)
+	}
+	return n
+}
+
+// SetJobConcurrency sets how many jobs run at the same time across all groups.
+// The default is DefaultJobConcurrency.
+// Jobs also count against the limit set with SetMaxRunning.
+func (g *Groups) SetJobConcurrency(n int) error {
+	if n < 1 {
+		return errors.Errorf("job concurrency must be at least 1, got %d", n)
+	}
+	g.jobs.mu.Lock()
+	g.jobs.max = n
+	g.jobs.mu.Unlock()
+
+	g.runJobs()
+	return nil
+}
+
+// SetGroupJobConcurrency sets how many jobs of a group run at the same time,
+// within the limit set with SetJobConcurrency.
+// Zero, the default, means the group is only limited by SetJobConcurrency.
+func (g *Groups) SetGroupJobConcurrency(groupName string, n int) error {
+	if n < 0 {
+		return errors.Errorf("job concurrency must not be negative, got %d", n)
+	}
+	g.jobs.mu.Lock()
+	if n == 0 {
+		delete(g.jobs.limits, groupName)
+	} else {
+		g.jobs.limits[groupName] = n
+	}
+	g.jobs.mu.Unlock()
+
+	g.runJobs()
+	return nil
+}
+
+// Enqueue queues cmd to run once in a group, and returns the job that runs it.
+// The group does not have to be open. Jobs run in the order they were
+// enqueued within a group, and groups take turns to run their jobs, see
+// SetJobConcurrency and SetGroupJobConcurrency. opts configure the job, see
+// WithRetry and WithIdempotencyKey.
+// Jobs are not persisted, so jobs that have not finished are lost if the
+// program exits.
+func (g *Groups) Enqueue(groupName string, cmd *exec.Cmd, opts ...JobOption) (*Job, error) {
+	if cmd.Process != nil {
+		return nil, errors.New("command has already been started")
+	}
+	if cmd.Stdout != nil || cmd.Stderr != nil {
+		return nil, errors.New("output of a job must not be set")
+	}
+	job := &Job{
+		ID:    newInstanceID(),
+		Group: groupName,
+		Cmd:   cmd,
+		done:  make(chan struct{}),
+	}
+	for _, opt := range opts {
+		if err := opt(job); err != nil {
+			return nil, err
+		}
+	}
+	if job.key != "" {
+		if existing, ok := g.jobs.dedupe(job, g.clock.Now()); ok {
+			return existing, nil
+		}
+	}
+	g.jobs.push(job)
+	g.runJobs()
+
+	return job, nil
+}
+
+// runJobs starts as many of the queued jobs as can run.
+func (g *Groups) runJobs() {
+	for job := g.jobs.pop(); job != nil; job = g.jobs.pop() {
+		go g.runJob(job)
+	}
+}
+
+// runJob runs an attempt of a job, then starts the jobs that were waiting for it to finish.
+// If the attempt failed and the job should be retried, the job is queued again
+// once its backoff has passed, without holding up other jobs in the meantime.
+// A job that can not start now because of its run windows is queued again
+// once it can, and one that can never start fails.
+func (g *Groups) runJob(job *Job) {
+	now := g.clock.Now()
+	if next, ok := job.windows.next(now); !ok || next.After(now) {
+		g.jobs.finish(job)
+		g.runJobs()
+
+		if !ok {
+			job.result = exitResult(job.Cmd, errors.New("job can not start in any of its run windows"), now, now)
+			close(job.done)
+			return
+		}
+		<-g.clock.After(next.Sub(now))
+		g.jobs.push(job)
+		g.runJobs()
+		return
+	}
+	cmd := job.Cmd
+	if attempts := atomic.AddInt32(&job.attempts, 1); attempts > 1 {
+		cmd = cloneCmd(job.Cmd)
+	}
+	result := g.runJobCmd(job, cmd)
+
+	delay, retry := job.retry.next(job.Attempts(), result)
+	if !retry {
+		job.result = result
+		close(job.done)
+	}
+	g.jobs.finish(job)
+	g.runJobs()
+
+	if retry {
+		<-g.clock.After(delay)
+		g.jobs.push(job)
+		g.runJobs()
+	}
+}
+
+// runJobCmd runs an attempt of a job with cmd and records the run in the run history.
+func (g *Groups) runJobCmd(job *Job, cmd *exec.Cmd) ExitResult {
+	started := g.clock.Now()
+	failed := func(err error) ExitResult {
+		return exitResult(cmd, err, started, g.clock.Now())
+	}
+	if err := g.makeGroupDir(job.Group); err != nil {
+		return failed(err)
+	}
+	outPipe, outWriter, err := outputPipe(cmd.Stdout)
+	if err != nil {
+		return failed(errors.Wrap(err, "getting stdout pipe"))
+	}
+	errPipe, errWriter, err := outputPipe(cmd.Stderr)
+	if err != nil {
+		_, _ = outPipe.Close(), outWriter.Close()
+		return failed(errors.Wrap(err, "getting stderr pipe"))
+	}
+	cmd.Stdout, cmd.Stderr = outWriter, errWriter
+
+	captured, err := g.captureOutput(outPipe, errPipe, job.Group, job.ID, 0, g.openLog)
+	if err != nil {
+		_, _, _, _ = outPipe.Close(), errPipe.Close(), outWriter.Close(), errWriter.Close()
+		return failed(errors.Wrap(err, "capturing output of child process"))
+	}
+	proc, err := g.newGroup(job.Group).execer.Start(cmd)
+	_, _ = outWriter.Close(), errWriter.Close()
+	if err != nil {
+		drainCapture(captured)
+		return failed(errors.Wrap(err, "starting child process"))
+	}
+	started = g.clock.Now()
+	g.recordRun(StateChange{
+		Group:     job.Group,
+		CommandID: job.ID,
+		Cmd:       cmd,
+		PID:       proc.Pid(),
+		To:        StateRunning,
+		Time:      started,
+	})
+	err = proc.Wait()
+	drainCapture(captured)
+
+	result := exitResult(cmd, err, started, g.clock.Now())
+	change := StateChange{
+		Group:     job.Group,
+		CommandID: job.ID,
+		Cmd:       cmd,
+		PID:       proc.Pid(),
+		From:      StateRunning,
+		To:        StateExited,
+		Time:      result.Exited,
+		Err:       err,
+	}
+	if err != nil {
+		change.To = StateFailed
+	}
+	g.recordRun(change)
+
+	return result
+}
+
+// WithIdempotencyKey deduplicates submissions of a job: if a job was enqueued
+// in the same group with the same key less than window ago, Enqueue returns
+// that job, whether or not it has finished, instead of running the command again.
+func WithIdempotencyKey(key string, window time.Duration) JobOption {
+	return func(job *Job) error {
+		if key == "" {
+			return errors.New("idempotency key must not be empty")
+		}
+		if window <= 0 {
+			return errors.Errorf("idempotency window must be positive, got %s", window)
+		}
+		job.key, job.window = key, window
+		return nil
+	}
+}
@@ -0,0 +1,203 @@
+package exec_test
+
+import (
+	"io/ioutil"
+	"os"
+	osexec "os/exec"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/scgolang/exec"
+	"github.com/scgolang/exec/exectest"
+)
+
+func TestGroupsEnqueue(t *testing.T) {
+	root := filepath.Join("testdata", "."+t.Name())
+	_ = os.RemoveAll(root)
+
+	gs := newTestGroups(t, root)
+
+	job, err := gs.Enqueue("jobs", osexec.Command("echo", "hello"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := job.Wait(); err != nil {
+		t.Fatal(err)
+	}
+	result, ok := job.Result()
+	if !ok {
+		t.Fatal("expected a result")
+	}
+	if expected, got := 0, result.ExitCode; expected != got {
+		t.Fatalf("expected exit code %d, got %d", expected, got)
+	}
+	out, err := ioutil.ReadFile(filepath.Join(root, "jobs", job.ID+".stdout"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected, got := "hello\n", string(out); expected != got {
+		t.Fatalf("expected output %q, got %q", expected, got)
+	}
+	failed, err := gs.Enqueue("jobs", osexec.Command("false"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := failed.Wait(); err == nil {
+		t.Fatal("expected an error, got nil")
+	}
+	runs, err := gs.Runs("jobs")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected, got := 2, len(runs); expected != got {
+		t.Fatalf("expected %d runs, got %d", expected, got)
+	}
+	if expected, got := job.ID, runs[0].CommandID; expected != got {
+		t.Fatalf("expected command ID %s, got %s", expected, got)
+	}
+	if expected, got := exec.StateExited, runs[0].State; expected != got {
+		t.Fatalf("expected state %s, got %s", expected, got)
+	}
+	if expected, got := exec.StateFailed, runs[1].State; expected != got {
+		t.Fatalf("expected state %s, got %s", expected, got)
+	}
+}
+
+func TestGroupsEnqueueRoundRobin(t *testing.T) {
+	root := filepath.Join("testdata", "."+t.Name())
+	_ = os.RemoveAll(root)
+
+	gs := newTestGroups(t, root)
+
+	if err := gs.SetJobConcurrency(1); err != nil {
+		t.Fatal(err)
+	}
+	order, err := filepath.Abs(filepath.Join(root, "order"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	jobs := []*exec.Job{}
+	for _, c := range []struct {
+		groupName string
+		script    string
+	}{
+		{groupName: "a", script: "sleep 0.2; echo a1 >> " + order},
+		{groupName: "a", script: "echo a2 >> " + order},
+		{groupName: "a", script: "echo a3 >> " + order},
+		{groupName: "b", script: "echo b1 >> " + order},
+		{groupName: "b", script: "echo b2 >> " + order},
+	} {
+		job, err := gs.Enqueue(c.groupName, osexec.Command("sh", "-c", c.script))
+		if err != nil {
+			t.Fatal(err)
+		}
+		jobs = append(jobs, job)
+	}
+	if expected, got := 4, gs.Diagnostics().JobsQueued; expected != got {
+		t.Fatalf("expected %d jobs queued, got %d", expected, got)
+	}
+	for _, job := range jobs {
+		if err := job.Wait(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	data, err := ioutil.ReadFile(order)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected, got := "a1\nb1\na2\nb2\na3\n", string(data); expected != got {
+		t.Fatalf("expected job order %q, got %q", expected, got)
+	}
+}
+
+func TestGroupsEnqueueGroupLimit(t *testing.T) {
+	root := filepath.Join("testdata", "."+t.Name())
+	_ = os.RemoveAll(root)
+
+	gs := newTestGroups(t, root)
+
+	if err := gs.SetGroupJobConcurrency("a", 1); err != nil {
+		t.Fatal(err)
+	}
+	jobs := []*exec.Job{}
+	for _, groupName := range []string{"a", "a", "b"} {
+		job, err := gs.Enqueue(groupName, osexec.Command("sleep", "0.2"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		jobs = append(jobs, job)
+	}
+	results := []exec.ExitResult{}
+	for _, job := range jobs {
+		if err := job.Wait(); err != nil {
+			t.Fatal(err)
+		}
+		result, _ := job.Result()
+		results = append(results, result)
+	}
+	// The second job of a waits for the first, but b does not.
+	if results[1].Started.Before(results[0].Exited) {
+		t.Fatalf("expected the second job to start after the first exited, got %+v", results)
+	}
+	if !results[2].Started.Before(results[0].Exited) {
+		t.Fatalf("expected the job of another group to run alongside, got %+v", results)
+	}
+	if err := gs.SetGroupJobConcurrency("a", -1); err == nil {
+		t.Fatal("expected an error, got nil")
+	}
+	if err := gs.SetJobConcurrency(0); err == nil {
+		t.Fatal("expected an error, got nil")
+	}
+}
+
+func TestGroupsEnqueueIdempotencyKey(t *testing.T) {
+	root := filepath.Join("testdata", "."+t.Name())
+	_ = os.RemoveAll(root)
+
+	clock := exectest.NewClock(time.Unix(0, 0))
+	gs, err := exec.New(root, exec.WithClock(clock))
+	if err != nil {
+		t.Fatal(err)
+	}
+	enqueue := func(groupName, key string) *exec.Job {
+		job, err := gs.Enqueue(groupName, osexec.Command("true"), exec.WithIdempotencyKey(key, time.Minute))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return job
+	}
+	first := enqueue("jobs", "nightly")
+	if err := first.Wait(); err != nil {
+		t.Fatal(err)
+	}
+	if expected, got := first, enqueue("jobs", "nightly"); expected != got {
+		t.Fatalf("expected job %s, got %s", expected.ID, got.ID)
+	}
+	other := enqueue("other", "nightly")
+	if other == first {
+		t.Fatal("expected the key to be scoped to the group")
+	}
+	if err := other.Wait(); err != nil {
+		t.Fatal(err)
+	}
+	clock.Advance(time.Minute)
+
+	second := enqueue("jobs", "nightly")
+	if second == first {
+		t.Fatal("expected a new job once the window has passed")
+	}
+	if err := second.Wait(); err != nil {
+		t.Fatal(err)
+	}
+	runs, err := gs.Runs("jobs")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected, got := 2, len(runs); expected != got {
+		t.Fatalf("expected %d runs, got %d", expected, got)
+	}
+	if _, err := gs.Enqueue("jobs", osexec.Command("true"), exec.WithIdempotencyKey("nightly", 0)); err == nil {
+		t.Fatal("expected an error, got nil")
+	}
+}
@@ -0,0 +1,92 @@
+package exec
+
+import (
+	"database/sql"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// labelPrefix is the prefix of the names of the settings that hold the labels of a command.
+const labelPrefix = "label:"
+
+// SetCommandLabels replaces the labels of a command, which are free-form
+// key value pairs for tooling, for example to tell which team owns a command.
+// cmdID is the instance ID of the command or its content hash.
+// Labels are persisted with the group, which does not have to be open.
+func (g *Groups) SetCommandLabels(groupName, cmdID string, labels map[string]string) error {
+	tx, err := g.db.Begin()
+	if err != nil {
+		return errors.Wrap(err, "starting transaction")
+	}
+	_, id, err := g.getStoredCmdTx(tx, groupName, cmdID)
+	if err != nil {
+		_ = tx.Rollback()
+		return err
+	}
+	if err := g.setCmdLabelsTx(tx, groupName, id, labels); err != nil {
+		_ = tx.Rollback()
+		return err
+	}
+	return errors.Wrap(tx.Commit(), "committing transaction")
+}
+
+// CommandLabels returns the labels of a command.
+// cmdID is the instance ID of the command or its content hash.
+func (g *Groups) CommandLabels(groupName, cmdID string) (map[string]string, error) {
+	tx, err := g.db.Begin()
+	if err != nil {
+		return nil, errors.Wrap(err, "starting transaction")
+	}
+	defer func() { _ = tx.Rollback() }() // Read only.
+
+	_, id, err := g.getStoredCmdTx(tx, groupName, cmdID)
+	if err != nil {
+		return nil, err
+	}
+	settings, err := g.getCmdSettingsTx(tx, groupName, id)
+	if err != nil {
+		return nil, err
+	}
+	return labelsOf(settings), nil
+}
+
+// setCmdLabelsTx replaces the labels of the command with the provided instance ID using the provided transaction.
+func (g *Groups) setCmdLabelsTx(tx *sql.Tx, groupName, id string, labels map[string]string) error {
+	settings, err := g.getCmdSettingsTx(tx, groupName, id)
+	if err != nil {
+		return err
+	}
+	for name := range settings {
+		if !strings.HasPrefix(name, labelPrefix) {
+			continue
+		}
+		if _, err := g.exec(tx, deleteCommandSetting, groupName, id, name); err != nil {
+			return errors.Wrap(err, name)
+		}
+	}
+	for key, value := range labels {
+		if key == "" {
+			return errors.New("label key must not be empty")
+		}
+		if _, err := g.exec(tx, insertCommandSetting, id, groupName, labelPrefix+key, value); err != nil {
+			return errors.Wrap(err, labelPrefix+key)
+		}
+	}
+	return nil
+}
+
+// labelsOf returns the labels in the settings of a command, or nil if it has none.
+func labelsOf(settings map[string]string) map[string]string {
+	var labels map[string]string
+	for name, value := range settings {
+		if !strings.HasPrefix(name, labelPrefix) {
+			continue
+		}
+		if labels == nil {
+			labels = map[string]string{}
+		}
+		labels[strings.TrimPrefix(name, labelPrefix)] = value
+	}
+	return labels
+}
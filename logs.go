@@ -0,0 +1,401 @@
+package exec
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// LogPolicy decides what happens to the log files of a command when it is
+// started again, for example when it is restarted or its group is opened.
+type LogPolicy int
+
+// Log file policies.
+const (
+	// LogTruncate truncates the log files, so that they only have the output
+	// of the latest run of the command.
+	LogTruncate LogPolicy = iota
+
+	// LogAppend appends the output of every run to the same log files.
+	// Each run after the first starts with a separator line, see LogSeparator.
+	LogAppend
+
+	// LogPerRun keeps the output of previous runs in files of their own.
+	// The log files of the previous run are renamed by appending a run number,
+	// counting from 1 for the oldest. Those files may be compressed with gzip
+	// by adding a .gz suffix to their name, for example by logrotate, and are
+	// still read by Logs. See LogFiles.
+	LogPerRun
+)
+
+// LogFormat decides how the output of commands is written to their log files.
+type LogFormat int
+
+// Log file formats.
+const (
+	// LogRaw writes the output of commands to their log files as it is.
+	LogRaw LogFormat = iota
+
+	// LogJSONLines writes every line of output as a LogRecord encoded as JSON,
+	// one per line, so that log files can be read by log pipelines as they are.
+	// Logs then returns the records rather than the lines of output.
+	// LogAppend does not write separators in this format, since every record
+	// has the time it was captured.
+	LogJSONLines
+)
+
+// LogRecord is a line of output of a command that was written in the LogJSONLines format.
+// Output that is not valid UTF-8 has the invalid bytes replaced by U+FFFD.
+type LogRecord struct {
+	Time    time.Time `json:"time"`
+	Group   string    `json:"group"`
+	Command string    `json:"command"`
+
+	// Fd is 1 for stdout and 2 for stderr.
+	Fd int `json:"fd"`
+
+	// Line is the line of output, without its line terminator.
+	Line string `json:"line"`
+}
+
+// LogSeparator is the format of the line that LogAppend writes to the log
+// files before the output of a new run. It is formatted with the time the
+// run started, in RFC 3339 format.
+const LogSeparator = "--- restarted at %s ---\n"
+
+// SetLogPolicy sets what happens to the log files of commands that are
+// started again. The default is LogTruncate.
+func (g *Groups) SetLogPolicy(policy LogPolicy) error {
+	switch policy {
+	default:
+		return errors.Errorf("unknown log policy %d", policy)
+	case LogTruncate, LogAppend, LogPerRun:
+	}
+	g.logPolicyMu.Lock()
+	g.logPolicyCfg = policy
+	g.logPolicyMu.Unlock()
+	return nil
+}
+
+// logPolicy returns the log file policy.
+func (g *Groups) logPolicy() LogPolicy {
+	g.logPolicyMu.Lock()
+	defer g.logPolicyMu.Unlock()
+	return g.logPolicyCfg
+}
+
+// SetLogFormat sets how the output of commands is written to their log files.
+// It applies to commands that are started after it is set. The default is LogRaw.
+func (g *Groups) SetLogFormat(format LogFormat) error {
+	switch format {
+	default:
+		return errors.Errorf("unknown log format %d", format)
+	case LogRaw, LogJSONLines:
+	}
+	g.logPolicyMu.Lock()
+	g.logFormatCfg = format
+	g.logPolicyMu.Unlock()
+	return nil
+}
+
+// logFormat returns the log file format.
+func (g *Groups) logFormat() LogFormat {
+	g.logPolicyMu.Lock()
+	defer g.logPolicyMu.Unlock()
+	return g.logFormatCfg
+}
+
+// openLog opens a log file in a group's directory for a new run of a command,
+// according to the log policy.
+func (g *Groups) openLog(groupName, filename string) (*os.File, error) {
+	path := filepath.Join(g.root, groupName, filename)
+
+	switch g.logPolicy() {
+	case LogAppend:
+		return g.appendLog(path)
+	case LogPerRun:
+		if err := rotateLog(path); err != nil {
+			return nil, errors.Wrap(err, "rotating log file")
+		}
+	}
+	return g.createLog(groupName, filename)
+}
+
+// appendLog opens a log file for appending and writes a separator
+// if it already has output.
+func (g *Groups) appendLog(path string) (*os.File, error) {
+	f, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE|os.O_APPEND, g.logPerms)
+	if err != nil {
+		return nil, err
+	}
+	info, err := f.Stat()
+	if err != nil {
+		_ = f.Close()
+		return nil, err
+	}
+	if info.Size() == 0 || g.logFormat() == LogJSONLines {
+		return f, nil
+	}
+	if _, err := fmt.Fprintf(f, LogSeparator, g.clock.Now().Format(time.RFC3339)); err != nil {
+		_ = f.Close()
+		return nil, errors.Wrap(err, "writing log separator")
+	}
+	return f, nil
+}
+
+// rotateLog renames a log file to the first free numbered name.
+// It does nothing if the file does not exist.
+func rotateLog(path string) error {
+	if _, err := os.Stat(path); err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+	n := len(runLogs(path)) + 1
+	return os.Rename(path, path+"."+strconv.Itoa(n))
+}
+
+// runLogs returns the numbered log files of previous runs, oldest first.
+// A file that has been compressed in place of its numbered name is returned
+// with its .gz suffix.
+func runLogs(path string) []string {
+	paths := []string{}
+	for n := 1; ; n++ {
+		runPath := path + "." + strconv.Itoa(n)
+		if _, err := os.Stat(runPath); err == nil {
+			paths = append(paths, runPath)
+		} else if _, err := os.Stat(runPath + gzipSuffix); err == nil {
+			paths = append(paths, runPath+gzipSuffix)
+		} else {
+			return paths
+		}
+	}
+}
+
+// gzipSuffix is the suffix of the log files of previous runs that have been compressed.
+const gzipSuffix = ".gz"
+
+// LogFiles returns the paths of the log files of a command, oldest first.
+// The last one is the log file of the current run.
+// Only LogPerRun keeps more than one log file per output stream.
+// fd must be 1 (stdout) or 2 (stderr).
+func (g *Groups) LogFiles(groupName string, cmd *exec.Cmd, fd int) ([]string, error) {
+	commandID, err := g.cmdID(groupName, cmd)
+	if err != nil {
+		return nil, errors.Wrap(err, "getting command ID")
+	}
+	filename, err := logFilename(commandID, fd)
+	if err != nil {
+		return nil, err
+	}
+	path := filepath.Join(g.root, groupName, filename)
+
+	if _, err := os.Stat(path); err != nil {
+		return nil, err
+	}
+	return append(runLogs(path), path), nil
+}
+
+// logFilename returns the name of the log file of an output stream of a command.
+func logFilename(commandID string, fd int) (string, error) {
+	switch fd {
+	default:
+		return "", errors.Errorf("fd (%d) must be either 1 (stdout) or 2 (stderr)", fd)
+	case 1:
+		return fmt.Sprintf("%s.stdout", commandID), nil
+	case 2:
+		return fmt.Sprintf("%s.stderr", commandID), nil
+	}
+}
+
+// jsonLinesFile is a log file that output is written to in the LogJSONLines format.
+// A line that has not been terminated when the file is closed is written as a record of its own.
+// The file is not embedded, so that io.Copy can not bypass Write with its ReadFrom.
+type jsonLinesFile struct {
+	file *os.File
+
+	clock   Clock
+	group   string
+	command string
+	fd      int
+
+	// partial is output that has not been terminated by a newline yet.
+	partial []byte
+}
+
+// Write writes a record for every line of output that p terminates.
+func (f *jsonLinesFile) Write(p []byte) (int, error) {
+	f.partial = append(f.partial, p...)
+
+	var (
+		out  []byte
+		now  = f.clock.Now()
+		rest = f.partial
+	)
+	for i := bytes.IndexByte(rest, '\n'); i >= 0; i = bytes.IndexByte(rest, '\n') {
+		out = f.appendRecord(out, rest[:i], now)
+		rest = rest[i+1:]
+	}
+	f.partial = append(f.partial[:0], rest...)
+
+	if len(out) == 0 {
+		return len(p), nil
+	}
+	if _, err := f.file.Write(out); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+// Sync commits the records that have been written to stable storage.
+func (f *jsonLinesFile) Sync() error {
+	return f.file.Sync()
+}
+
+// Close writes a record for output that was not terminated, and closes the file.
+func (f *jsonLinesFile) Close() error {
+	if len(f.partial) > 0 {
+		out := f.appendRecord(nil, f.partial, f.clock.Now())
+		f.partial = nil
+
+		if _, err := f.file.Write(out); err != nil {
+			_ = f.file.Close()
+			return err
+		}
+		if err := f.file.Sync(); err != nil {
+			_ = f.file.Close()
+			return err
+		}
+	}
+	return f.file.Close()
+}
+
+// appendRecord appends the record of a line of output to out.
+func (f *jsonLinesFile) appendRecord(out, line []byte, now time.Time) []byte {
+	data, err := json.Marshal(LogRecord{
+		Time:    now,
+		Group:   f.group,
+		Command: f.command,
+		Fd:      f.fd,
+		Line:    string(line),
+	})
+	if err != nil {
+		return out // Can not happen, as every field can be encoded.
+	}
+	return append(append(out, data...), '\n')
+}
+
+// openLogs returns a reader of the output of a command that spans all of its
+// log files, oldest first, see LogFiles.
+func (g *Groups) openLogs(groupName string, cmd *exec.Cmd, fd int) (io.ReadCloser, error) {
+	paths, err := g.LogFiles(groupName, cmd, fd)
+	if err != nil {
+		return nil, err
+	}
+	return &logReader{paths: paths}, nil
+}
+
+// logReader reads log files one after the other as if they were one,
+// decompressing the ones with a .gz suffix. Files are only opened once the
+// ones before them have been read, and files that have gone in the meantime
+// are skipped. A newline is added after a file whose output was not
+// terminated by one, so that lines never span two runs.
+type logReader struct {
+	paths []string
+
+	f *os.File
+	r io.Reader
+
+	// unterminated is true if the output read from the current file does
+	// not end with a newline, and newline is true if a newline must be read
+	// before the next file.
+	unterminated bool
+	newline      bool
+}
+
+// Read reads from the current log file, moving on to the next one when it is done.
+func (lr *logReader) Read(p []byte) (int, error) {
+	if len(p) == 0 {
+		return 0, nil
+	}
+	for {
+		if lr.newline {
+			lr.newline = false
+			p[0] = '\n'
+			return 1, nil
+		}
+		if lr.r == nil {
+			if len(lr.paths) == 0 {
+				return 0, io.EOF
+			}
+			if err := lr.next(); err != nil {
+				return 0, err
+			}
+			continue
+		}
+		n, err := lr.r.Read(p)
+		if n > 0 {
+			lr.unterminated = p[n-1] != '\n'
+		}
+		if err == io.EOF {
+			lr.newline = lr.unterminated && len(lr.paths) > 0
+			lr.unterminated = false
+			err = lr.closeFile()
+		}
+		if n > 0 || err != nil {
+			return n, err
+		}
+	}
+}
+
+// next opens the next log file.
+func (lr *logReader) next() error {
+	path := lr.paths[0]
+	lr.paths = lr.paths[1:]
+
+	f, err := os.Open(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil // Rotated or removed since it was listed.
+		}
+		return err
+	}
+	lr.f, lr.r = f, f
+
+	if strings.HasSuffix(path, gzipSuffix) {
+		zr, err := gzip.NewReader(f)
+		if err != nil {
+			_ = lr.closeFile()
+			return errors.Wrap(err, "decompressing "+filepath.Base(path))
+		}
+		lr.r = zr
+	}
+	return nil
+}
+
+// closeFile closes the current log file.
+func (lr *logReader) closeFile() error {
+	if lr.f == nil {
+		return nil
+	}
+	err := lr.f.Close()
+	lr.f, lr.r = nil, nil
+	return err
+}
+
+// Close closes the log file that is being read.
+func (lr *logReader) Close() error {
+	lr.paths = nil
+	return lr.closeFile()
+}
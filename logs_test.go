@@ -0,0 +1,219 @@
+package exec_test
+
+import (
+	"compress/gzip"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	osexec "os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/scgolang/exec"
+)
+
+func TestGroupsLogPolicy(t *testing.T) {
+	for _, tc := range []struct {
+		policy exec.LogPolicy
+		files  int
+		lines  int
+	}{
+		{policy: exec.LogTruncate, files: 1, lines: 1},
+		{policy: exec.LogAppend, files: 1, lines: 3},
+		{policy: exec.LogPerRun, files: 2, lines: 1},
+	} {
+		var (
+			groupName = "echofoo"
+			root      = filepath.Join("testdata", fmt.Sprintf(".%s%d", t.Name(), tc.policy))
+		)
+		_ = os.RemoveAll(root)
+
+		gs, err := exec.New(root, exec.WithLogPolicy(tc.policy))
+		if err != nil {
+			t.Fatal(err)
+		}
+		cmd := osexec.Command("echo", "foo")
+
+		if err := gs.Create(groupName, cmd); err != nil {
+			t.Fatal(err)
+		}
+		if err := gs.Wait(groupName); err != nil {
+			t.Fatal(err)
+		}
+		// Open the group again, like a new process would.
+		gs, err = exec.New(root, exec.WithLogPolicy(tc.policy))
+		if err != nil {
+			t.Fatal(err)
+		}
+		cmds, err := gs.Open(groupName)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := gs.Wait(groupName); err != nil {
+			t.Fatal(err)
+		}
+		files, err := gs.LogFiles(groupName, cmds[0], 1)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if expected, got := tc.files, len(files); expected != got {
+			t.Fatalf("policy %d: expected %d log files, got %d", tc.policy, expected, got)
+		}
+		for _, file := range files {
+			data, err := ioutil.ReadFile(file)
+			if err != nil {
+				t.Fatal(err)
+			}
+			lines := strings.Split(strings.TrimSuffix(string(data), "\n"), "\n")
+			if expected, got := tc.lines, len(lines); expected != got {
+				t.Fatalf("policy %d: expected %d lines in %s, got %d", tc.policy, expected, file, got)
+			}
+			if expected, got := "foo", lines[len(lines)-1]; expected != got {
+				t.Fatalf("policy %d: expected %s, got %s", tc.policy, expected, got)
+			}
+		}
+		_ = gs.Remove(groupName)
+	}
+	gs := newTestGroups(t, filepath.Join("testdata", "."+t.Name()))
+	if err := gs.SetLogPolicy(exec.LogPolicy(42)); err == nil {
+		t.Fatal("expected an error, got nil")
+	}
+}
+
+func TestGroupsLogsSpanRuns(t *testing.T) {
+	var (
+		groupName = "printfoo"
+		root      = filepath.Join("testdata", "."+t.Name())
+		cmd       = osexec.Command("printf", "foo")
+	)
+	_ = os.RemoveAll(root)
+
+	run := func(create bool) *exec.Groups {
+		gs, err := exec.New(root, exec.WithLogPolicy(exec.LogPerRun))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if create {
+			err = gs.Create(groupName, cmd)
+		} else {
+			_, err = gs.Open(groupName)
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := gs.Wait(groupName); err != nil {
+			t.Fatal(err)
+		}
+		return gs
+	}
+	gs := run(true)
+	id, _ := gs.CmdID(groupName, cmd)
+	absRoot, err := filepath.Abs(root)
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(absRoot, groupName, id+".stdout")
+
+	_ = run(false)
+
+	// Compress the log file of the first run, like logrotate would.
+	data, err := ioutil.ReadFile(path + ".1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	f, err := os.Create(path + ".1.gz")
+	if err != nil {
+		t.Fatal(err)
+	}
+	zw := gzip.NewWriter(f)
+	if _, err := zw.Write(data); err != nil {
+		t.Fatal(err)
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := f.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Remove(path + ".1"); err != nil {
+		t.Fatal(err)
+	}
+	gs = run(false)
+	defer func() { _ = gs.Remove(groupName) }()
+
+	files, err := gs.LogFiles(groupName, cmd, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected, got := []string{path + ".1.gz", path + ".2", path}, files; strings.Join(expected, ",") != strings.Join(got, ",") {
+		t.Fatalf("expected log files %v, got %v", expected, got)
+	}
+	scanner, closer, err := gs.Logs(groupName, cmd, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = closer.Close() }()
+
+	lines := []string{}
+	for scanner.Scan() {
+		lines = append(lines, scanner.Text())
+	}
+	if err := scanner.Err(); err != nil {
+		t.Fatal(err)
+	}
+	if expected, got := "foo,foo,foo", strings.Join(lines, ","); expected != got {
+		t.Fatalf("expected lines %s, got %s", expected, got)
+	}
+}
+
+func TestGroupsLogJSONLines(t *testing.T) {
+	var (
+		groupName = "echoers"
+		root      = filepath.Join("testdata", "."+t.Name())
+	)
+	_ = os.RemoveAll(root)
+
+	gs, err := exec.New(root, exec.WithLogFormat(exec.LogJSONLines))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = gs.Remove(groupName) }() // Best effort.
+
+	cmd := osexec.Command("sh", "-c", `echo foo; echo '"bar"' >&2; printf baz`)
+
+	if err := gs.Create(groupName, cmd); err != nil {
+		t.Fatal(err)
+	}
+	if err := gs.Wait(groupName); err != nil {
+		t.Fatal(err)
+	}
+	id, _ := gs.CmdID(groupName, cmd)
+
+	for fd, expected := range map[int][]string{1: {"foo", "baz"}, 2: {`"bar"`}} {
+		scanner, closer, err := gs.Logs(groupName, cmd, fd)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got := []string{}
+		for scanner.Scan() {
+			var rec exec.LogRecord
+			if err := json.Unmarshal(scanner.Bytes(), &rec); err != nil {
+				t.Fatalf("decoding %q: %s", scanner.Text(), err)
+			}
+			if rec.Group != groupName || rec.Command != id || rec.Fd != fd || rec.Time.IsZero() {
+				t.Fatalf("unexpected record %+v", rec)
+			}
+			got = append(got, rec.Line)
+		}
+		_ = closer.Close()
+
+		if expected, got := strings.Join(expected, ","), strings.Join(got, ","); expected != got {
+			t.Fatalf("fd %d: expected lines %s, got %s", fd, expected, got)
+		}
+	}
+	if err := gs.SetLogFormat(exec.LogFormat(9)); err == nil {
+		t.Fatal("expected an error, got nil")
+	}
+}
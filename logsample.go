@@ -0,0 +1,141 @@
+package exec
+
+import (
+	"bytes"
+	"fmt"
+	"os/exec"
+
+	"github.com/pkg/errors"
+)
+
+// LogRepeated is the format of the line that is written to the log files of
+// a command with log sampling in place of lines that are identical to the
+// line before them. It is formatted with how many lines it stands for.
+const LogRepeated = "--- last line repeated %d times ---\n"
+
+// SetLogSampling tames commands that write the same line over and over:
+// the first of consecutive identical lines of output is written to the log
+// files of the command as it is, and every n lines that repeat it are written
+// as a single LogRepeated line with their count, so that the number of lines
+// the command wrote can still be told. The remaining count is written when a
+// different line comes, or when the command exits. Output sent to
+// subscribers and counted by output metrics is not sampled.
+// Zero or one means no sampling, which is the default.
+// Like readiness probes, log sampling is not persisted and must be set every
+// time a Groups is created, before the command is started.
+func (g *Groups) SetLogSampling(groupName string, cmd *exec.Cmd, n int) error {
+	if n < 0 {
+		return errors.Errorf("log sampling must not be negative, got %d", n)
+	}
+	commandID, err := GetCmdID(cmd)
+	if err != nil {
+		return errors.Wrap(err, "getting command ID")
+	}
+	g.probesMu.Lock()
+	defer g.probesMu.Unlock()
+
+	if g.logSampling[groupName] == nil {
+		g.logSampling[groupName] = map[string]int{}
+	}
+	if n <= 1 {
+		delete(g.logSampling[groupName], commandID)
+	} else {
+		g.logSampling[groupName][commandID] = n
+	}
+	return nil
+}
+
+// logSample returns the log sampling of cmd, zero if it has none.
+func (g *Groups) logSample(groupName string, cmd *exec.Cmd) int {
+	if cmd == nil {
+		return 0
+	}
+	hash, err := GetCmdID(cmd)
+	if err != nil {
+		return 0
+	}
+	g.probesMu.Lock()
+	defer g.probesMu.Unlock()
+	return g.logSampling[groupName][hash]
+}
+
+// sampledFile is a log file that consecutive identical lines are sampled
+// into, see SetLogSampling.
+type sampledFile struct {
+	out logFile
+	n   int
+
+	// last is the last line that was written, with its newline,
+	// and repeats is how many lines have repeated it since.
+	last    []byte
+	repeats int
+
+	// partial is output that has not been terminated by a newline yet.
+	partial []byte
+}
+
+// Write writes the lines of output that p terminates, sampling the repeated ones.
+func (f *sampledFile) Write(p []byte) (int, error) {
+	f.partial = append(f.partial, p...)
+
+	var (
+		out  []byte
+		rest = f.partial
+	)
+	for i := bytes.IndexByte(rest, '\n'); i >= 0; i = bytes.IndexByte(rest, '\n') {
+		out = f.appendLine(out, rest[:i+1])
+		rest = rest[i+1:]
+	}
+	f.partial = append(f.partial[:0], rest...)
+
+	if len(out) == 0 {
+		return len(p), nil
+	}
+	if _, err := f.out.Write(out); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+// appendLine appends what is written for a line of output to out.
+func (f *sampledFile) appendLine(out, line []byte) []byte {
+	if f.last != nil && bytes.Equal(line, f.last) {
+		if f.repeats++; f.repeats == f.n {
+			out = f.appendRepeats(out)
+		}
+		return out
+	}
+	out = f.appendRepeats(out)
+	f.last = append(f.last[:0], line...)
+	return append(out, line...)
+}
+
+// appendRepeats appends the line that stands for the lines that repeated the last one, if there were any.
+func (f *sampledFile) appendRepeats(out []byte) []byte {
+	if f.repeats == 0 {
+		return out
+	}
+	out = append(out, fmt.Sprintf(LogRepeated, f.repeats)...)
+	f.repeats = 0
+	return out
+}
+
+// Sync commits the output that has been written to stable storage.
+func (f *sampledFile) Sync() error {
+	return f.out.Sync()
+}
+
+// Close writes the remaining count of repeated lines and output that was
+// not terminated, and closes the file.
+func (f *sampledFile) Close() error {
+	out := append(f.appendRepeats(nil), f.partial...)
+	f.partial = nil
+
+	if len(out) > 0 {
+		if _, err := f.out.Write(out); err != nil {
+			_ = f.out.Close()
+			return err
+		}
+	}
+	return f.out.Close()
+}
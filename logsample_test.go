@@ -0,0 +1,53 @@
+package exec_test
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	osexec "os/exec"
+	"path/filepath"
+	"testing"
+
+	"github.com/scgolang/exec"
+)
+
+func TestGroupsSetLogSampling(t *testing.T) {
+	var (
+		groupName = "spammer"
+		root      = filepath.Join("testdata", "."+t.Name())
+	)
+	_ = os.RemoveAll(root)
+
+	var (
+		gs  = newTestGroups(t, root)
+		cmd = osexec.Command("sh", "-c", "for i in 1 2 3 4 5 6 7 8; do echo spam; done; echo done; echo done")
+	)
+	if err := gs.SetLogSampling(groupName, cmd, 3); err != nil {
+		t.Fatal(err)
+	}
+	if err := gs.Create(groupName, cmd); err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = gs.Remove(groupName) }()
+
+	if err := gs.Wait(groupName); err != nil {
+		t.Fatal(err)
+	}
+	id, _ := gs.CmdID(groupName, cmd)
+	data, err := ioutil.ReadFile(filepath.Join(root, groupName, id+".stdout"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := "spam\n" +
+		fmt.Sprintf(exec.LogRepeated, 3) +
+		fmt.Sprintf(exec.LogRepeated, 3) +
+		fmt.Sprintf(exec.LogRepeated, 1) +
+		"done\n" +
+		fmt.Sprintf(exec.LogRepeated, 1)
+	if got := string(data); expected != got {
+		t.Fatalf("expected %q, got %q", expected, got)
+	}
+	if err := gs.SetLogSampling(groupName, cmd, -1); err == nil {
+		t.Fatal("expected an error, got nil")
+	}
+}
@@ -0,0 +1,152 @@
+package exec
+
+import (
+	"database/sql"
+	"os/exec"
+	"syscall"
+
+	"github.com/pkg/errors"
+)
+
+// StopCommand gracefully stops a single command in a group.
+// The command is sent SIGTERM and killed if it has not exited after a short timeout.
+// Unlike Remove the command stays stored with the group, so it can be brought
+// back up with StartCommand. Stopped commands are not started when the group is opened.
+func (g *Groups) StopCommand(groupName, cmdID string) error {
+	grp := g.getGroup(groupName)
+	if grp == nil {
+		return errors.Errorf("group %s not found", groupName)
+	}
+	cmd := grp.lookup(cmdID)
+	if cmd == nil {
+		return errors.Errorf("command %s not found in group %s", cmdID, groupName)
+	}
+	id, _ := grp.ID(cmd)
+
+	if err := g.setCmdSetting(groupName, id, settingStopped, "true"); err != nil {
+		return err
+	}
+	if err := g.unwatchFiles(groupName, id); err != nil {
+		return errors.Wrap(err, "closing file watcher")
+	}
+	grp.retire(cmd)
+
+	if err := grp.stop(cmd, grp.stopSignalOf(cmd, syscall.SIGTERM), g.timeouts().Stop); err != nil {
+		return errors.Wrap(err, "stopping command")
+	}
+	grp.drop(cmd)
+
+	return nil
+}
+
+// StartCommand starts a single command that is stored with a group but is not
+// running, for example because it was stopped with StopCommand.
+// cmdID is the instance ID of the command or its content hash.
+func (g *Groups) StartCommand(groupName, cmdID string) (*exec.Cmd, error) {
+	grp := g.getGroup(groupName)
+	if grp == nil {
+		return nil, errors.Errorf("group %s not found", groupName)
+	}
+	if grp.lookup(cmdID) != nil {
+		return nil, errors.Errorf("command %s is already running in group %s", cmdID, groupName)
+	}
+	tx, err := g.db.Begin()
+	if err != nil {
+		return nil, errors.Wrap(err, "starting transaction")
+	}
+	cmd, err := g.startCommandTx(tx, groupName, grp, cmdID)
+	if err != nil {
+		_ = tx.Rollback()
+		return nil, err
+	}
+	return cmd, errors.Wrap(tx.Commit(), "committing transaction")
+}
+
+// startCommandTx starts a stored command using the provided transaction.
+func (g *Groups) startCommandTx(tx *sql.Tx, groupName string, grp *Group, cmdID string) (*exec.Cmd, error) {
+	cmd, id, err := g.getStoredCmdTx(tx, groupName, cmdID)
+	if err != nil {
+		return nil, err
+	}
+	if err := g.startTx(tx, cmd, groupName, grp, id); err != nil {
+		return nil, err
+	}
+	if _, err := g.exec(tx, updateProcessID, grp.pid(cmd), groupName, id); err != nil {
+		return nil, err
+	}
+	if _, err := g.exec(tx, deleteCommandSetting, groupName, id, settingStopped); err != nil {
+		return nil, errors.Wrap(err, settingStopped)
+	}
+	patterns, err := g.getCmdWatchTx(tx, groupName, id)
+	if err != nil {
+		return nil, err
+	}
+	if err := g.watchFiles(groupName, cmd, patterns); err != nil {
+		return nil, errors.Wrap(err, "watching command files")
+	}
+	return cmd, nil
+}
+
+// getStoredCmdTx gets the definition of a stored command and its instance ID.
+// cmdID is the instance ID of the command or its content hash.
+func (g *Groups) getStoredCmdTx(tx *sql.Tx, groupName, cmdID string) (*exec.Cmd, string, error) {
+	cmds, ids, err := g.getGroupProcessesTx(tx, groupName)
+	if err != nil {
+		return nil, "", errors.Wrap(err, "getting group commands")
+	}
+	for i, id := range ids {
+		if id == cmdID {
+			return cmds[i], id, nil
+		}
+	}
+	for i, cmd := range cmds {
+		if hash, err := GetCmdID(cmd); err == nil && hash == cmdID {
+			return cmd, ids[i], nil
+		}
+	}
+	return nil, "", errors.Errorf("command %s not found in group %s", cmdID, groupName)
+}
+
+var getStoppedCommands = newQuery("getting stopped commands", `
+SELECT	command_id
+FROM	command_settings
+WHERE	group_name = ? AND name = ?`)
+
+// getStoppedTx returns the instance IDs of the commands in a group that were stopped with StopCommand.
+func (g *Groups) getStoppedTx(tx *sql.Tx, groupName string) (map[string]struct{}, error) {
+	rows, err := g.queryRows(tx, getStoppedCommands, groupName, settingStopped)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = rows.Close() }() // Best effort.
+
+	stopped := map[string]struct{}{}
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		stopped[id] = struct{}{}
+	}
+	return stopped, rows.Err()
+}
+
+// skipStoppedTx returns the commands, and their instance IDs, that were not stopped with StopCommand.
+func (g *Groups) skipStoppedTx(tx *sql.Tx, groupName string, cmds []*exec.Cmd, ids []string) ([]*exec.Cmd, []string, error) {
+	stopped, err := g.getStoppedTx(tx, groupName)
+	if err != nil {
+		return nil, nil, err
+	}
+	var (
+		startCmds = []*exec.Cmd{}
+		startIDs  = []string{}
+	)
+	for i, id := range ids {
+		if _, ok := stopped[id]; ok {
+			continue
+		}
+		startCmds = append(startCmds, cmds[i])
+		startIDs = append(startIDs, id)
+	}
+	return startCmds, startIDs, nil
+}
@@ -0,0 +1,58 @@
+package exec_test
+
+import (
+	"os"
+	osexec "os/exec"
+	"path/filepath"
+	"testing"
+)
+
+func TestGroupsStopStartCommand(t *testing.T) {
+	var (
+		groupName = "sleepers"
+		root      = filepath.Join("testdata", "."+t.Name())
+	)
+	_ = os.RemoveAll(root)
+
+	var (
+		gs = newTestGroups(t, root)
+		c1 = osexec.Command("sleep", "10")
+		c2 = osexec.Command("sleep", "11")
+	)
+	defer func() { _ = gs.Remove(groupName) }() // Best effort.
+
+	if err := gs.Create(groupName, c1, c2); err != nil {
+		t.Fatal(err)
+	}
+	id, ok := gs.CmdID(groupName, c1)
+	if !ok {
+		t.Fatal("expected command to have an instance ID")
+	}
+	if err := gs.StopCommand(groupName, id); err != nil {
+		t.Fatal(err)
+	}
+	cmds, _ := gs.Commands(groupName)
+	if expected, got := 1, len(cmds); expected != got {
+		t.Fatalf("expected %d commands, got %d", expected, got)
+	}
+	if cmds[0] != c2 {
+		t.Fatal("expected the other command to keep running")
+	}
+	cmd, err := gs.StartCommand(groupName, id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, _ := gs.CmdID(groupName, cmd); got != id {
+		t.Fatalf("expected instance ID %s, got %s", id, got)
+	}
+	cmds, _ = gs.Commands(groupName)
+	if expected, got := 2, len(cmds); expected != got {
+		t.Fatalf("expected %d commands, got %d", expected, got)
+	}
+	if _, err := gs.StartCommand(groupName, id); err == nil {
+		t.Fatal("expected an error, got nil")
+	}
+	if err := gs.StopCommand(groupName, "nope"); err == nil {
+		t.Fatal("expected an error, got nil")
+	}
+}
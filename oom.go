@@ -0,0 +1,120 @@
+package exec
+
+import (
+	"bufio"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// oomMessage starts the message of an OOMError, which is how the run history tells OOM kills apart.
+const oomMessage = "killed by the kernel OOM killer"
+
+// OOMError is the error of a command that the kernel killed because the
+// host, or the cgroup of the command, ran out of memory, see SetResourceLimits.
+type OOMError struct {
+	// Err is the error returned by waiting for the command.
+	Err error
+}
+
+// Error returns a description of the error.
+func (e *OOMError) Error() string {
+	return oomMessage + ": " + e.Err.Error()
+}
+
+// Cause returns the error returned by waiting for the command.
+func (e *OOMError) Cause() error { return e.Err }
+
+// Unwrap returns the error returned by waiting for the command.
+func (e *OOMError) Unwrap() error { return e.Err }
+
+// ExitCode returns -1, since the command was terminated by a signal.
+func (e *OOMError) ExitCode() int { return -1 }
+
+// IsOOMKilled returns true if err is an *OOMError, or a CmdError of one.
+func IsOOMKilled(err error) bool {
+	if ce, ok := err.(CmdError); ok {
+		err = ce.error
+	}
+	var oom *OOMError
+	return errors.As(err, &oom)
+}
+
+// explainExit returns an *OOMError if a command of a group that exited with
+// err was killed by the OOM killer, and err otherwise. Commands with a memory
+// limit are looked up in the memory events of their cgroup, and others in the
+// kernel log, which only works with permission to read it.
+func (g *Groups) explainExit(groupName, commandID string, pid int, started time.Time, err error) error {
+	if !killedBy(err, syscall.SIGKILL) {
+		return err
+	}
+	if kills, ok := g.oomKills(groupName, commandID); ok {
+		g.cgroupsMu.Lock()
+		before := g.oomBaselines[groupName+"/"+commandID]
+		g.cgroupsMu.Unlock()
+
+		if kills > before {
+			return &OOMError{Err: err}
+		}
+		return err
+	}
+	if kernelOOMKilled(pid, started) {
+		return &OOMError{Err: err}
+	}
+	return err
+}
+
+// recordOOMBaseline remembers how many OOM kills the cgroup of a command had when it was started.
+func (g *Groups) recordOOMBaseline(groupName, commandID string) {
+	kills, ok := g.oomKills(groupName, commandID)
+	if !ok {
+		return
+	}
+	g.cgroupsMu.Lock()
+	g.oomBaselines[groupName+"/"+commandID] = kills
+	g.cgroupsMu.Unlock()
+}
+
+// oomKills returns how many processes the OOM killer has killed in the cgroup
+// of a command. It returns false if the command does not have a memory limit.
+func (g *Groups) oomKills(groupName, commandID string) (int64, bool) {
+	_, limits, version := g.cgroupDirs(groupName, commandID)
+	if limits.MemoryMax == 0 {
+		return 0, false
+	}
+	path := filepath.Join(g.cgroupMount, g.cgroupParent, groupName, commandID, "memory.events")
+	if version == 1 {
+		path = filepath.Join(g.cgroupMount, "memory", g.cgroupParent, groupName, commandID, "memory.oom_control")
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		return 0, false
+	}
+	defer func() { _ = f.Close() }() // Best effort.
+
+	for scanner := bufio.NewScanner(f); scanner.Scan(); {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) != 2 || fields[0] != "oom_kill" {
+			continue
+		}
+		kills, err := strconv.ParseInt(fields[1], 10, 64)
+		return kills, err == nil
+	}
+	return 0, false
+}
+
+// killedBy returns true if err is the error of a command that was terminated by sig.
+func killedBy(err error, sig syscall.Signal) bool {
+	ee, ok := errors.Cause(err).(*exec.ExitError)
+	if !ok {
+		return false
+	}
+	ws, ok := ee.Sys().(syscall.WaitStatus)
+	return ok && ws.Signaled() && ws.Signal() == sig
+}
@@ -0,0 +1,80 @@
+//go:build linux
+// +build linux
+
+package exec
+
+import (
+	"io/ioutil"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// kernelOOMKilled returns true if the kernel log says that the OOM killer
+// killed the process with the provided ID after it was started. Reading the
+// kernel log needs CAP_SYSLOG, unless kernel.dmesg_restrict is 0, so without
+// it this returns false.
+func kernelOOMKilled(pid int, started time.Time) bool {
+	boot, err := bootTime()
+	if err != nil {
+		return false
+	}
+	// The file is not opened with os, since its poller would wait for new
+	// records at the end of the log instead of returning EAGAIN.
+	fd, err := syscall.Open("/dev/kmsg", syscall.O_RDONLY|syscall.O_NONBLOCK|syscall.O_CLOEXEC, 0)
+	if err != nil {
+		return false
+	}
+	defer func() { _ = syscall.Close(fd) }() // Best effort.
+
+	var (
+		buf    = make([]byte, 8192)
+		needle = "Killed process " + strconv.Itoa(pid) + " "
+	)
+	for {
+		// Every read returns a record: priority,sequence,microseconds since boot,flags;message
+		n, err := syscall.Read(fd, buf)
+		if err == syscall.EPIPE {
+			continue // Records were overwritten while reading.
+		}
+		if err != nil || n <= 0 {
+			return false
+		}
+		record := string(buf[:n])
+
+		semi := strings.IndexByte(record, ';')
+		if semi < 0 || !strings.Contains(record[semi:], needle) {
+			continue
+		}
+		fields := strings.Split(record[:semi], ",")
+		if len(fields) < 3 {
+			continue
+		}
+		usec, err := strconv.ParseInt(fields[2], 10, 64)
+		if err != nil {
+			continue
+		}
+		// The process ID could have been used before, so the record must be newer than the process.
+		if boot.Add(time.Duration(usec) * time.Microsecond).After(started.Add(-time.Second)) {
+			return true
+		}
+	}
+}
+
+// bootTime returns when the host booted.
+func bootTime() (time.Time, error) {
+	data, err := ioutil.ReadFile("/proc/uptime")
+	if err != nil {
+		return time.Time{}, err
+	}
+	fields := strings.Fields(string(data))
+	if len(fields) == 0 {
+		return time.Time{}, syscall.EINVAL
+	}
+	uptime, err := strconv.ParseFloat(fields[0], 64)
+	if err != nil {
+		return time.Time{}, err
+	}
+	return time.Now().Add(-time.Duration(uptime * float64(time.Second))), nil
+}
@@ -0,0 +1,11 @@
+//go:build !linux
+// +build !linux
+
+package exec
+
+import "time"
+
+// kernelOOMKilled returns false, since only the kernel log of Linux is read.
+func kernelOOMKilled(pid int, started time.Time) bool {
+	return false
+}
@@ -0,0 +1,311 @@
+package exec
+
+import (
+	"database/sql"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// DefaultDBFile is the name of the database file of Groups created with New,
+// unless it is changed with WithDBFile.
+const DefaultDBFile = "groups.db"
+
+// LogPerms are the default permissions for log files created by this package.
+const LogPerms = 0666
+
+// DefaultDriver is the name of the database/sql driver used by Groups.
+const DefaultDriver = "sqlite3"
+
+// txLockParam makes transactions take the database write lock when they begin.
+// Otherwise a transaction that reads and then writes fails with "database is
+// locked" if the run history is written in between.
+const txLockParam = "_txlock=immediate"
+
+// Logger logs errors that happen in the background, for example while
+// capturing output or recording run history, that can not be returned to a caller.
+// *log.Logger implements Logger.
+type Logger interface {
+	Printf(format string, v ...interface{})
+}
+
+// Option configures Groups created with New.
+type Option func(*Groups) error
+
+// WithDBFile sets the name of the database file, relative to the root directory.
+func WithDBFile(dbfile string) Option {
+	return func(g *Groups) error {
+		if dbfile == "" {
+			return errors.New("database file name must not be empty")
+		}
+		g.dbfile = dbfile
+		return nil
+	}
+}
+
+// WithDBKey encrypts the database on disk with SQLCipher.
+// key must be 32 bytes long and is used as the raw SQLCipher key.
+// The package must be built with the sqlcipher build tag for this to work.
+func WithDBKey(key []byte) Option {
+	return func(g *Groups) error {
+		if !sqlcipher {
+			return errors.New("database encryption requires building with the sqlcipher tag")
+		}
+		if len(key) != 32 {
+			return errors.Errorf("key must be 32 bytes, got %d", len(key))
+		}
+		g.dbKey = append([]byte(nil), key...)
+		return nil
+	}
+}
+
+// WithDriver sets the name of the database/sql driver that is used to open the
+// database file. The driver must understand sqlite DSNs and SQL.
+func WithDriver(name string) Option {
+	return func(g *Groups) error {
+		g.driver = name
+		return nil
+	}
+}
+
+// WithDSN opens the database with the provided data source name instead of
+// a file in the root directory. The DSN is passed as is to the driver,
+// see WithDriver. For sqlite3, _txlock=immediate is recommended.
+func WithDSN(dsn string) Option {
+	return func(g *Groups) error {
+		if dsn == "" {
+			return errors.New("DSN must not be empty")
+		}
+		g.dbDSN = dsn
+		return nil
+	}
+}
+
+// WithDB makes Groups use an already open database, so that it can share
+// a connection pool with the rest of an application or use its own driver.
+// The database must speak the sqlite dialect of SQL. Groups creates its
+// tables in it if they do not exist, and never closes it.
+// For sqlite3, opening it with _txlock=immediate is recommended.
+func WithDB(db *sql.DB) Option {
+	return func(g *Groups) error {
+		if db == nil {
+			return errors.New("db must not be nil")
+		}
+		g.db = db
+		return nil
+	}
+}
+
+// WithLogger sets the logger for errors that happen in the background.
+// By default they are discarded.
+func WithLogger(logger Logger) Option {
+	return func(g *Groups) error {
+		g.logger = logger
+		return nil
+	}
+}
+
+// WithStartConcurrency sets how many commands are started at the same time, see SetStartConcurrency.
+func WithStartConcurrency(n int) Option {
+	return func(g *Groups) error {
+		return g.SetStartConcurrency(n)
+	}
+}
+
+// WithCaptureConcurrency sets how many commands can write their output at the same time,
+// see SetCaptureConcurrency.
+func WithCaptureConcurrency(n int) Option {
+	return func(g *Groups) error {
+		return g.SetCaptureConcurrency(n)
+	}
+}
+
+// WithMaxRunning sets how many processes can run at the same time across all groups,
+// see SetMaxRunning.
+func WithMaxRunning(n int) Option {
+	return func(g *Groups) error {
+		return g.SetMaxRunning(n)
+	}
+}
+
+// WithDuplicatePolicy sets what Create does with identical commands, see SetDuplicatePolicy.
+func WithDuplicatePolicy(policy DuplicatePolicy) Option {
+	return func(g *Groups) error {
+		return g.SetDuplicatePolicy(policy)
+	}
+}
+
+// WithLogPolicy sets what happens to the log files of restarted commands, see SetLogPolicy.
+func WithLogPolicy(policy LogPolicy) Option {
+	return func(g *Groups) error {
+		return g.SetLogPolicy(policy)
+	}
+}
+
+// WithLogFormat sets how the output of commands is written to their log files, see SetLogFormat.
+func WithLogFormat(format LogFormat) Option {
+	return func(g *Groups) error {
+		return g.SetLogFormat(format)
+	}
+}
+
+// WithOutputStreaming makes the output of commands available to Subscribe,
+// in addition to their log files. Without it output is copied to the log
+// files more efficiently.
+func WithOutputStreaming() Option {
+	return func(g *Groups) error {
+		g.streaming = true
+		return nil
+	}
+}
+
+// WithOutputMetrics counts the output of commands, see Throughput.
+// Like WithOutputStreaming, it makes copying output to the log files less efficient.
+func WithOutputMetrics() Option {
+	return func(g *Groups) error {
+		g.metrics = true
+		return nil
+	}
+}
+
+// WithDetach starts commands detached, so that they keep running when the
+// program that manages them exits, see Open.
+func WithDetach() Option {
+	return func(g *Groups) error {
+		g.detach = true
+		return nil
+	}
+}
+
+// WithTimeouts sets the timeouts used by operations on the groups.
+func WithTimeouts(t Timeouts) Option {
+	return func(g *Groups) error {
+		g.SetTimeouts(t)
+		return nil
+	}
+}
+
+// WithEnvKey encrypts environment variables at rest, see SetEnvKey.
+func WithEnvKey(key []byte) Option {
+	return func(g *Groups) error {
+		return g.SetEnvKey(key)
+	}
+}
+
+// WithEnvCompression stores the environment of commands that have at least
+// minVars variables as a single compressed block, which is shared by commands
+// with the same environment unless an env key is set. Zero disables it.
+// Environments that were stored before are read either way.
+func WithEnvCompression(minVars int) Option {
+	return func(g *Groups) error {
+		if minVars < 0 {
+			return errors.Errorf("minimum number of env vars must not be negative, got %d", minVars)
+		}
+		g.envBlockMin = minVars
+		return nil
+	}
+}
+
+// WithPerms sets the permissions of the directories and log files that are created.
+// The defaults are DirPerms and LogPerms.
+func WithPerms(dirPerms, logPerms os.FileMode) Option {
+	return func(g *Groups) error {
+		g.dirPerms = dirPerms
+		g.logPerms = logPerms
+		return nil
+	}
+}
+
+// WithCoreDumps lets the commands dump core, by raising their core file size
+// limit to the hard limit when they start, and moves the core files they dump
+// into the directory of their group, see CoreDumps. Where core files are
+// dumped depends on the core pattern of the kernel, see core(5). Core files
+// that the kernel pipes to a program, such as systemd-coredump, are left to it.
+// It is only supported on Linux.
+func WithCoreDumps() Option {
+	return func(g *Groups) error {
+		if !coreDumpsSupported {
+			return errors.New("core dumps are only supported on linux")
+		}
+		g.coreDumps = true
+		return nil
+	}
+}
+
+// WithCgroups sets where the cgroups that enforce resource limits are created,
+// see SetResourceLimits. mount is where the cgroup filesystem is mounted,
+// usually DefaultCgroupMount, and parent is the path of a cgroup, relative to
+// the mount, that this process can create cgroups in and that has no processes
+// of its own, for example a cgroup delegated to it by systemd. With cgroups v1
+// parent is the relative path in the hierarchy of each controller.
+func WithCgroups(mount, parent string) Option {
+	return func(g *Groups) error {
+		if mount == "" || parent == "" {
+			return errors.New("cgroup mount and parent must not be empty")
+		}
+		g.cgroupMount, g.cgroupParent = mount, strings.Trim(parent, "/")
+		return nil
+	}
+}
+
+// WithGracefulStop makes Close and Remove stop commands gracefully, so that
+// they can flush their buffers and clean up: commands are sent SIGTERM, and
+// killed if they have not exited after grace, which is set as Timeouts.Close
+// and Timeouts.Remove. Commands with a stop signal of their own are sent it
+// instead, see SetStopSignal.
+func WithGracefulStop(grace time.Duration) Option {
+	return func(g *Groups) error {
+		if grace <= 0 {
+			return errors.Errorf("grace period must be positive, got %s", grace)
+		}
+		g.groupOpts = append(g.groupOpts, WithStopSignal(syscall.SIGTERM), WithGracePeriod(grace))
+
+		t := g.timeoutsCfg
+		t.Close, t.Remove = grace, grace
+		g.SetTimeouts(t)
+		return nil
+	}
+}
+
+// WithGroupOptions sets the options of every group that is created or opened.
+func WithGroupOptions(opts ...GroupOption) Option {
+	return func(g *Groups) error {
+		g.groupOpts = append(g.groupOpts, opts...)
+		return nil
+	}
+}
+
+// WithClock sets the clock used for timeouts and timestamps by the groups
+// and every group that is created or opened.
+func WithClock(clock Clock) Option {
+	return func(g *Groups) error {
+		g.clock = clock
+		g.groupOpts = append(g.groupOpts, WithGroupClock(clock))
+		return nil
+	}
+}
+
+// dsn returns the data source name of the database.
+func (g *Groups) dsn() string {
+	if g.dbDSN != "" {
+		return g.dbDSN
+	}
+	path := filepath.Join(g.root, g.dbfile)
+	if g.dbKey == nil {
+		return path + "?" + txLockParam
+	}
+	return fmt.Sprintf("%s?_pragma_key=x'%s'&_pragma_cipher_page_size=4096&%s", path, hex.EncodeToString(g.dbKey), txLockParam)
+}
+
+// logf logs an error that can not be returned to a caller.
+func (g *Groups) logf(format string, v ...interface{}) {
+	if g.logger != nil {
+		g.logger.Printf(format, v...)
+	}
+}
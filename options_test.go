@@ -0,0 +1,127 @@
+package exec_test
+
+import (
+	"database/sql"
+	"os"
+	osexec "os/exec"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/scgolang/exec"
+)
+
+func TestNew(t *testing.T) {
+	var (
+		groupName = "echofoo"
+		root      = filepath.Join("testdata", "."+t.Name())
+	)
+	_ = os.RemoveAll(root)
+
+	gs, err := exec.New(root,
+		exec.WithDBFile("state.db"),
+		exec.WithPerms(0700, 0600),
+		exec.WithTimeouts(exec.Timeouts{Wait: 5 * time.Second}),
+		exec.WithStartConcurrency(2),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cmd := osexec.Command("echo", "foo")
+
+	if err := gs.Create(groupName, cmd); err != nil {
+		t.Fatal(err)
+	}
+	if err := gs.Wait(groupName); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(filepath.Join(root, "state.db")); err != nil {
+		t.Fatal(err)
+	}
+	id, _ := gs.CmdID(groupName, cmd)
+	info, err := os.Stat(filepath.Join(root, groupName, id+".stdout"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected, got := os.FileMode(0600), info.Mode().Perm(); expected != got {
+		t.Fatalf("expected log file permissions %s, got %s", expected, got)
+	}
+	if _, err := exec.New(root, exec.WithStartConcurrency(0)); err == nil {
+		t.Fatal("expected an error, got nil")
+	}
+}
+
+func TestNewWithDB(t *testing.T) {
+	var (
+		groupName = "echofoo"
+		root      = filepath.Join("testdata", "."+t.Name())
+	)
+	_ = os.RemoveAll(root)
+
+	if err := os.MkdirAll(root, exec.DirPerms); err != nil {
+		t.Fatal(err)
+	}
+	db, err := sql.Open("sqlite3", filepath.Join(root, "shared.db")+"?_txlock=immediate")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = db.Close() }()
+
+	gs, err := exec.New(root, exec.WithDB(db))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := gs.Create(groupName, osexec.Command("echo", "foo")); err != nil {
+		t.Fatal(err)
+	}
+	if err := gs.Wait(groupName); err != nil {
+		t.Fatal(err)
+	}
+	var count int
+	if err := db.QueryRow(`SELECT COUNT(*) FROM processes WHERE group_name = ?`, groupName).Scan(&count); err != nil {
+		t.Fatal(err)
+	}
+	if expected, got := 1, count; expected != got {
+		t.Fatalf("expected %d processes, got %d", expected, got)
+	}
+	if _, err := os.Stat(filepath.Join(root, exec.DefaultDBFile)); !os.IsNotExist(err) {
+		t.Fatalf("expected no database file to be created, got %v", err)
+	}
+}
+
+func TestWithGracefulStop(t *testing.T) {
+	var (
+		groupName = "flushers"
+		root      = filepath.Join("testdata", "."+t.Name())
+	)
+	_ = os.RemoveAll(root)
+
+	if _, err := exec.New(root, exec.WithGracefulStop(0)); err == nil {
+		t.Fatal("expected an error, got nil")
+	}
+	gs, err := exec.New(root, exec.WithGracefulStop(2*time.Second))
+	if err != nil {
+		t.Fatal(err)
+	}
+	absRoot, err := filepath.Abs(root)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var (
+		marker = filepath.Join(absRoot, "flushed")
+		cmd    = osexec.Command("sh", "-c", "trap 'touch "+marker+"; exit 0' TERM; sleep 10 & wait")
+	)
+	if err := gs.Create(groupName, cmd); err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = gs.Remove(groupName) }()
+
+	time.Sleep(200 * time.Millisecond) // Let the shell set its trap.
+
+	if err := gs.Close(groupName); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(marker); err != nil {
+		t.Fatalf("expected the command to have been sent SIGTERM rather than killed: %s", err)
+	}
+}
@@ -0,0 +1,165 @@
+package exec
+
+import (
+	"os/exec"
+	"regexp"
+
+	"github.com/pkg/errors"
+)
+
+// outputRef matches a reference to an output of a command in the value of an
+// environment variable of another command, see SetOutput.
+var outputRef = regexp.MustCompile(`\$\{output:([A-Za-z0-9_.-]+)\}`)
+
+// outputName matches the names of outputs.
+var outputName = regexp.MustCompile(`^[A-Za-z0-9_.-]+$`)
+
+// output is where the value of an output of a group comes from.
+type output struct {
+	// hash is the content hash of the command that has the output,
+	// and pattern matches the line of its stdout that has the value.
+	hash    string
+	pattern *regexp.Regexp
+}
+
+// SetOutput declares a value that a command prints on stdout, like the port
+// it listens on, so that the other commands of its group can use it in their
+// environment. The environment variables of a command can reference the
+// output with ${output:<name>}, like PORT=${output:db.port}, which is
+// replaced, just before the command is started, with the first submatch of
+// pattern, or the whole match if it has none, in the last line of stdout
+// that matches. Only the process sees the value: the command itself, and
+// what it is stored and identified by, keeps the reference.
+// A command that references an output depends on the command that has it,
+// see SetDependencies, and fails to start if the output has not been
+// printed by then, so a readiness probe like LogProbe(pattern) should make
+// sure that it is. Output names are unique in a group and made of letters,
+// digits, '_', '.', and '-'. A nil pattern removes the output.
+// Like readiness probes, outputs are not persisted and must be set every
+// time a Groups is created, before the commands are started.
+func (g *Groups) SetOutput(groupName string, cmd *exec.Cmd, name string, pattern *regexp.Regexp) error {
+	if !outputName.MatchString(name) {
+		return errors.Errorf("invalid output name %q", name)
+	}
+	commandID, err := GetCmdID(cmd)
+	if err != nil {
+		return errors.Wrap(err, "getting command ID")
+	}
+	g.probesMu.Lock()
+	defer g.probesMu.Unlock()
+
+	if g.outputs[groupName] == nil {
+		g.outputs[groupName] = map[string]output{}
+	}
+	if pattern == nil {
+		delete(g.outputs[groupName], name)
+		return nil
+	}
+	if out, ok := g.outputs[groupName][name]; ok && out.hash != commandID {
+		return errors.Errorf("output %s is already set by another command of group %s", name, groupName)
+	}
+	g.outputs[groupName][name] = output{hash: commandID, pattern: pattern}
+	return nil
+}
+
+// outputDeps returns the content hashes of the commands whose outputs cmd references.
+// The caller must hold probesMu.
+func (g *Groups) outputDeps(groupName string, cmd *exec.Cmd) []string {
+	var deps []string
+	for _, kv := range cmd.Env {
+		for _, m := range outputRef.FindAllStringSubmatch(kv, -1) {
+			if out, ok := g.outputs[groupName][m[1]]; ok {
+				deps = append(deps, out.hash)
+			}
+		}
+	}
+	return deps
+}
+
+// interpolateEnv returns the environment of cmd with the references to
+// outputs replaced by their values, or nil if it references none.
+func (g *Groups) interpolateEnv(groupName string, grp *Group, cmd *exec.Cmd) ([]string, error) {
+	var env []string
+
+	for i, kv := range cmd.Env {
+		if !outputRef.MatchString(kv) {
+			continue
+		}
+		if env == nil {
+			env = append([]string(nil), cmd.Env...)
+		}
+		var err error
+		env[i] = outputRef.ReplaceAllStringFunc(kv, func(ref string) string {
+			value, verr := g.outputValue(groupName, grp, outputRef.FindStringSubmatch(ref)[1])
+			if verr != nil && err == nil {
+				err = verr
+			}
+			return value
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	return env, nil
+}
+
+// outputValue returns the value of an output of a group.
+func (g *Groups) outputValue(groupName string, grp *Group, name string) (string, error) {
+	g.probesMu.Lock()
+	out, ok := g.outputs[groupName][name]
+	g.probesMu.Unlock()
+
+	if !ok {
+		return "", errors.Errorf("output %s is not set in group %s", name, groupName)
+	}
+	src := grp.lookup(out.hash)
+	if src == nil {
+		return "", errors.Errorf("the command with output %s is not running in group %s", name, groupName)
+	}
+	commandID, _ := grp.ID(src)
+
+	var (
+		value string
+		found bool
+	)
+	err := g.scanLog(groupName, commandID, 1, func(line []byte) bool {
+		if m := out.pattern.FindSubmatch(line); m != nil {
+			value, found = string(m[0]), true
+			if len(m) > 1 {
+				value = string(m[1])
+			}
+		}
+		return true
+	})
+	if err != nil {
+		return "", errors.Wrapf(err, "reading output %s", name)
+	}
+	if !found {
+		return "", errors.Errorf("output %s has not been printed in group %s", name, groupName)
+	}
+	return value, nil
+}
+
+// envExecer is an Execer that starts processes with the references to
+// outputs in their environment replaced by their values, see SetOutput.
+type envExecer struct {
+	execer Execer
+	env    func(cmd *exec.Cmd) ([]string, error)
+}
+
+// Start starts cmd with its environment interpolated. The environment of
+// cmd is put back once the process has started, since it identifies cmd.
+func (e envExecer) Start(cmd *exec.Cmd) (Process, error) {
+	env, err := e.env(cmd)
+	if err != nil {
+		return nil, errors.Wrap(err, "interpolating environment")
+	}
+	if env == nil {
+		return e.execer.Start(cmd)
+	}
+	orig := cmd.Env
+	cmd.Env = env
+	defer func() { cmd.Env = orig }()
+
+	return e.execer.Start(cmd)
+}
@@ -0,0 +1,68 @@
+package exec_test
+
+import (
+	"io/ioutil"
+	"os"
+	osexec "os/exec"
+	"path/filepath"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/scgolang/exec"
+)
+
+func TestGroupsSetOutput(t *testing.T) {
+	var (
+		groupName = "outputs"
+		root      = filepath.Join("testdata", "."+t.Name())
+	)
+	_ = os.RemoveAll(root)
+
+	gs, err := exec.New(root, exec.WithDBFile("groups.db"), exec.WithTimeouts(exec.Timeouts{Ready: 5 * time.Second}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var (
+		pattern   = regexp.MustCompile(`^listening on port (\d+)$`)
+		server    = osexec.Command("sh", "-c", "sleep 0.2; echo listening on port 4242; sleep 10")
+		dependent = osexec.Command("sh", "-c", `echo "connecting to $PORT"; sleep 10`)
+	)
+	dependent.Env = []string{"PORT=${output:server.port}"}
+
+	if err := gs.SetOutput(groupName, server, "server.port", pattern); err != nil {
+		t.Fatal(err)
+	}
+	if err := gs.SetOutput(groupName, dependent, "server.port", pattern); err == nil {
+		t.Fatal("expected an error for an output that is already set")
+	}
+	if err := gs.SetOutput(groupName, server, "bad name", pattern); err == nil {
+		t.Fatal("expected an error for an invalid output name")
+	}
+	if err := gs.SetReadinessProbe(groupName, server, gs.LogProbe(groupName, pattern)); err != nil {
+		t.Fatal(err)
+	}
+	// The dependent comes first, the output makes it start after the server.
+	if err := gs.Create(groupName, dependent, server); err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = gs.Remove(groupName) }()
+
+	id, ok := gs.CmdID(groupName, dependent)
+	if !ok {
+		t.Fatal("expected the dependent command to keep its definition")
+	}
+	path := filepath.Join(root, groupName, id+".stdout")
+
+	for deadline := time.Now().Add(5 * time.Second); ; time.Sleep(20 * time.Millisecond) {
+		data, err := ioutil.ReadFile(path)
+		if err != nil && !os.IsNotExist(err) {
+			t.Fatal(err)
+		}
+		if expected, got := "connecting to 4242\n", string(data); expected == got {
+			break
+		} else if time.Now().After(deadline) {
+			t.Fatalf("expected %q, got %q", expected, got)
+		}
+	}
+}
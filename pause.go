@@ -0,0 +1,108 @@
+package exec
+
+import (
+	"database/sql"
+
+	"github.com/pkg/errors"
+)
+
+// settingPaused is the setting that marks a group as paused, see Pause.
+// It is a setting of the group rather than of one of its commands, so it is
+// stored with an empty command ID.
+const settingPaused = "paused"
+
+// Pause suspends every running command of a group by sending it SIGSTOP.
+// The group stays paused until Unpause: commands that start in the meantime,
+// like restarted ones, are paused as soon as they are running, and the
+// commands of a paused group are paused again once Open has started them.
+// Paused commands are not health checked nor detected as stuck, and they are
+// sent SIGCONT after their stop signal so that they can exit gracefully.
+// Pausing is not supported on Windows.
+func (g *Groups) Pause(groupName string) error {
+	return g.setPaused(groupName, true)
+}
+
+// Unpause sends SIGCONT to every running command of a group that was paused
+// with Pause. It is not called Resume, which resumes the groups of a manager
+// that re-executed itself, see Reexec.
+func (g *Groups) Unpause(groupName string) error {
+	return g.setPaused(groupName, false)
+}
+
+// setPaused pauses or resumes a group and records whether it is paused.
+func (g *Groups) setPaused(groupName string, paused bool) error {
+	if sigStop == nil {
+		return errors.New("pausing commands is not supported on windows")
+	}
+	grp := g.getGroup(groupName)
+	if grp == nil {
+		return errors.Errorf("group %s not found", groupName)
+	}
+	if !grp.ephemeral {
+		tx, err := g.db.Begin()
+		if err != nil {
+			return errors.Wrap(err, "starting transaction")
+		}
+		if err := g.setPausedTx(tx, groupName, paused); err != nil {
+			_ = tx.Rollback()
+			return err
+		}
+		if err := tx.Commit(); err != nil {
+			return errors.Wrap(err, "committing transaction")
+		}
+	}
+	return grp.setPaused(paused)
+}
+
+// setPausedTx records whether a group is paused using the provided transaction.
+func (g *Groups) setPausedTx(tx *sql.Tx, groupName string, paused bool) error {
+	if !paused {
+		_, err := g.exec(tx, deleteCommandSetting, groupName, "", settingPaused)
+		return errors.Wrap(err, settingPaused)
+	}
+	return g.setCmdSettingTx(tx, groupName, "", settingPaused, "true")
+}
+
+// restorePaused pauses a group that was paused when it was last open.
+func (g *Groups) restorePaused(tx *sql.Tx, groupName string, grp *Group) error {
+	if sigStop == nil {
+		return nil
+	}
+	settings, err := g.getCmdSettingsTx(tx, groupName, "")
+	if err != nil {
+		return err
+	}
+	if _, ok := settings[settingPaused]; !ok {
+		return nil
+	}
+	return grp.setPaused(true)
+}
+
+// setPaused sends SIGSTOP, or SIGCONT, to every command of the group that
+// has not exited, and records whether the group is paused. It carries on when
+// a command can not be signaled and returns the first error.
+func (g *Group) setPaused(paused bool) error {
+	sig := sigCont
+	if paused {
+		sig = sigStop
+	}
+	g.mu.Lock()
+	g.paused = paused
+	g.mu.Unlock()
+
+	var first error
+	for _, cmd := range g.alive() {
+		if err := g.signal(cmd, sig); err != nil && !isAlreadyFinished(err) && first == nil {
+			id, _ := g.ID(cmd)
+			first = errors.Wrapf(err, "signalling %s", id)
+		}
+	}
+	return first
+}
+
+// isPaused returns true if the group is paused, see Groups.Pause.
+func (g *Group) isPaused() bool {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	return g.paused
+}
@@ -0,0 +1,12 @@
+//go:build !windows
+// +build !windows
+
+package exec
+
+import (
+	"os"
+	"syscall"
+)
+
+// sigStop and sigCont pause and resume a process, see Pause.
+var sigStop, sigCont os.Signal = syscall.SIGSTOP, syscall.SIGCONT
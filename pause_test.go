@@ -0,0 +1,73 @@
+package exec_test
+
+import (
+	"os"
+	osexec "os/exec"
+	"path/filepath"
+	"runtime"
+	"testing"
+	"time"
+)
+
+func TestGroupsPause(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("processes can not be paused on windows")
+	}
+	var (
+		groupName = "pausable"
+		root      = filepath.Join("testdata", "."+t.Name())
+	)
+	_ = os.RemoveAll(root)
+
+	var (
+		gs  = newTestGroups(t, root)
+		cmd = osexec.Command("sh", "-c", "while true; do echo tick; sleep 0.05; done")
+	)
+	if err := gs.Create(groupName, cmd); err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = gs.Remove(groupName) }()
+
+	id, _ := gs.CmdID(groupName, cmd)
+	logSize := func() int64 {
+		info, err := os.Stat(filepath.Join(root, groupName, id+".stdout"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return info.Size()
+	}
+	paused := func() bool {
+		statuses, err := gs.Statuses(groupName)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return statuses[id].Paused
+	}
+	if err := gs.Pause(groupName); err != nil {
+		t.Fatal(err)
+	}
+	if !paused() {
+		t.Fatal("expected the command to be paused")
+	}
+	if err := gs.Restart(groupName); err == nil {
+		t.Fatal("expected restarting a paused group to fail")
+	}
+	time.Sleep(200 * time.Millisecond)
+	before := logSize()
+	time.Sleep(300 * time.Millisecond)
+
+	if after := logSize(); before != after {
+		t.Fatalf("expected no output while paused, log grew from %d to %d bytes", before, after)
+	}
+	if err := gs.Unpause(groupName); err != nil {
+		t.Fatal(err)
+	}
+	if paused() {
+		t.Fatal("expected the command to be resumed")
+	}
+	time.Sleep(300 * time.Millisecond)
+
+	if after := logSize(); after <= before {
+		t.Fatalf("expected output once resumed, log stayed at %d bytes", after)
+	}
+}
@@ -0,0 +1,9 @@
+//go:build windows
+// +build windows
+
+package exec
+
+import "os"
+
+// sigStop and sigCont are nil, since processes can not be paused on Windows.
+var sigStop, sigCont os.Signal
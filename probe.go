@@ -0,0 +1,204 @@
+package exec
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// probeInterval is the time between attempts of a probe.
+const probeInterval = 100 * time.Millisecond
+
+// instanceIDKey is the key of the context value that has the instance ID of
+// the command that a readiness probe checks, for probes that need it.
+type instanceIDKey struct{}
+
+// Probe checks the condition of a running command.
+type Probe interface {
+	// Probe returns nil if the command passes the check.
+	Probe(ctx context.Context, cmd *exec.Cmd) error
+}
+
+// ProbeFunc adapts an ordinary function to the Probe interface.
+type ProbeFunc func(ctx context.Context, cmd *exec.Cmd) error
+
+// Probe calls f.
+func (f ProbeFunc) Probe(ctx context.Context, cmd *exec.Cmd) error {
+	return f(ctx, cmd)
+}
+
+// FileProbe returns a probe that passes once the file at path exists.
+func FileProbe(path string) Probe {
+	return ProbeFunc(func(ctx context.Context, _ *exec.Cmd) error {
+		_, err := os.Stat(path)
+		return err
+	})
+}
+
+// LogProbe returns a probe that passes once a line of output of the command,
+// on stdout or stderr, matches pattern. Lines are read from the log files of
+// the command, so with LogAppend the output of earlier runs matches too.
+func (g *Groups) LogProbe(groupName string, pattern *regexp.Regexp) Probe {
+	return ProbeFunc(func(ctx context.Context, cmd *exec.Cmd) error {
+		commandID, ok := ctx.Value(instanceIDKey{}).(string)
+		if !ok {
+			id, err := g.cmdID(groupName, cmd)
+			if err != nil {
+				return errors.Wrap(err, "getting command ID")
+			}
+			commandID = id
+		}
+		for fd := 1; fd <= 2; fd++ {
+			ok, err := g.logMatches(groupName, commandID, fd, pattern)
+			if err != nil {
+				return err
+			}
+			if ok {
+				return nil
+			}
+		}
+		return errors.Errorf("no line of output matches %s", pattern)
+	})
+}
+
+// logMatches returns true if a line in a log file of the command with the
+// provided instance ID matches pattern.
+func (g *Groups) logMatches(groupName, commandID string, fd int, pattern *regexp.Regexp) (bool, error) {
+	matched := false
+	err := g.scanLog(groupName, commandID, fd, func(line []byte) bool {
+		matched = pattern.Match(line)
+		return !matched
+	})
+	return matched, err
+}
+
+// scanLog calls fn with every line of output in a log file of the command
+// with the provided instance ID, until fn returns false. Lines of files in
+// the LogJSONLines format are decoded. It does nothing if there is no log file.
+func (g *Groups) scanLog(groupName, commandID string, fd int, fn func(line []byte) bool) error {
+	filename, err := logFilename(commandID, fd)
+	if err != nil {
+		return err
+	}
+	f, err := os.Open(filepath.Join(g.root, groupName, filename))
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	defer func() { _ = f.Close() }() // Read only.
+
+	var (
+		scanner   = bufio.NewScanner(f)
+		jsonLines = g.logFormat() == LogJSONLines
+	)
+	for scanner.Scan() {
+		line := scanner.Bytes()
+		if jsonLines {
+			var rec LogRecord
+			if json.Unmarshal(line, &rec) != nil {
+				continue
+			}
+			line = []byte(rec.Line)
+		}
+		if !fn(line) {
+			return nil
+		}
+	}
+	return scanner.Err()
+}
+
+// SetReadinessProbe sets the probe that decides when a command is ready.
+// Commands without a readiness probe are ready as soon as they have started.
+// Create and Open wait for every command they start to be ready before they
+// start the next one, so that commands which depend on the ones before them
+// only start once those are ready, and they fail if a command does not
+// become ready within Timeouts.Ready. With a start concurrency greater than
+// one, that many commands are waited for at the same time.
+// See TCPProbe, FileProbe, and LogProbe for probes of common conditions.
+// Probes are not persisted, they must be set every time a Groups is created.
+func (g *Groups) SetReadinessProbe(groupName string, cmd *exec.Cmd, probe Probe) error {
+	commandID, err := GetCmdID(cmd)
+	if err != nil {
+		return errors.Wrap(err, "getting command ID")
+	}
+	g.probesMu.Lock()
+	defer g.probesMu.Unlock()
+
+	if g.readiness[groupName] == nil {
+		g.readiness[groupName] = map[string]Probe{}
+	}
+	if probe == nil {
+		delete(g.readiness[groupName], commandID)
+	} else {
+		g.readiness[groupName][commandID] = probe
+	}
+	return nil
+}
+
+// readinessProbe returns the readiness probe of the first of the provided
+// command IDs that has one, or nil if none of them do.
+func (g *Groups) readinessProbe(groupName string, commandIDs ...string) Probe {
+	g.probesMu.Lock()
+	defer g.probesMu.Unlock()
+
+	for _, commandID := range commandIDs {
+		if probe, ok := g.readiness[groupName][commandID]; ok {
+			return probe
+		}
+	}
+	return nil
+}
+
+// waitReady polls probe until cmd passes it.
+// It returns an error if cmd exits, ctx is done, or cmd does not become
+// ready within timeout.
+func (grp *Group) waitReady(ctx context.Context, probe Probe, cmd *exec.Cmd, timeout time.Duration) error {
+	tctx, cancel := withClockTimeout(ctx, grp.clock, timeout)
+	defer cancel()
+
+	err := grp.waitReadyContext(tctx, probe, cmd)
+	if err != nil && ctx.Err() != nil {
+		return ctx.Err()
+	}
+	if err != nil && tctx.Err() != nil {
+		return errors.Wrap(err, "timeout after "+timeout.String())
+	}
+	return err
+}
+
+// waitReadyContext polls probe until cmd passes it.
+// It returns an error if cmd exits or ctx is done before cmd is ready.
+func (grp *Group) waitReadyContext(ctx context.Context, probe Probe, cmd *exec.Cmd) error {
+	if probe == nil {
+		return nil
+	}
+	exited, ok := grp.exitedChan(cmd)
+	if !ok {
+		return errors.New("command exited before becoming ready")
+	}
+	if id, ok := grp.ID(cmd); ok {
+		ctx = context.WithValue(ctx, instanceIDKey{}, id)
+	}
+	for {
+		err := probe.Probe(ctx, cmd)
+		if err == nil {
+			return nil
+		}
+		select {
+		case <-ctx.Done():
+			return err
+		case <-exited:
+			return errors.New("command exited before becoming ready")
+		case <-grp.clock.After(probeInterval):
+		}
+	}
+}
@@ -0,0 +1,116 @@
+package exec_test
+
+import (
+	"context"
+	"os"
+	osexec "os/exec"
+	"path/filepath"
+	"regexp"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/scgolang/exec"
+)
+
+func TestGroupsCreateWaitsForReadiness(t *testing.T) {
+	var (
+		groupName = "dependents"
+		root      = filepath.Join("testdata", "."+t.Name())
+	)
+	_ = os.RemoveAll(root)
+
+	gs, err := exec.New(root, exec.WithDBFile("groups.db"), exec.WithTimeouts(exec.Timeouts{Ready: 5 * time.Second}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	marker, err := filepath.Abs(filepath.Join(root, "marker"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var (
+		server    = osexec.Command("sh", "-c", "sleep 0.3; touch "+marker+"; echo listening; sleep 10")
+		dependent = osexec.Command("sh", "-c", "test -f "+marker+" && sleep 10")
+	)
+	if err := gs.SetReadinessProbe(groupName, server, gs.LogProbe(groupName, regexp.MustCompile("^listening$"))); err != nil {
+		t.Fatal(err)
+	}
+	if err := gs.Create(groupName, server, dependent); err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = gs.Remove(groupName) }()
+
+	time.Sleep(100 * time.Millisecond)
+
+	statuses, err := gs.Statuses(groupName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	dependentID, _ := gs.CmdID(groupName, dependent)
+	if expected, got := exec.StateRunning, statuses[dependentID].State; expected != got {
+		t.Fatalf("expected the dependent command to be started once the server was ready, got %s", got)
+	}
+}
+
+func TestGroupsCreateFailsUnready(t *testing.T) {
+	var (
+		groupName = "unready"
+		root      = filepath.Join("testdata", "."+t.Name())
+	)
+	_ = os.RemoveAll(root)
+
+	gs, err := exec.New(root, exec.WithDBFile("groups.db"), exec.WithTimeouts(exec.Timeouts{Ready: 300 * time.Millisecond}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var (
+		server    = osexec.Command("sleep", "10")
+		dependent = osexec.Command("sleep", "11")
+	)
+	if err := gs.SetReadinessProbe(groupName, server, exec.FileProbe(filepath.Join(root, "never"))); err != nil {
+		t.Fatal(err)
+	}
+	if err := gs.Create(groupName, server, dependent); err == nil {
+		t.Fatal("expected an error, got nil")
+	}
+	if dependent.Process != nil {
+		t.Fatal("expected the command after the unready one not to be started")
+	}
+	cmds, _ := gs.Commands(groupName)
+	if len(cmds) != 0 {
+		t.Fatalf("expected no commands to be stored, got %d", len(cmds))
+	}
+}
+
+func TestCommandSpecBuildWaitsForProbes(t *testing.T) {
+	var (
+		groupName = "built"
+		root      = filepath.Join("testdata", "."+t.Name())
+	)
+	_ = os.RemoveAll(root)
+
+	var (
+		gs     = newTestGroups(t, root)
+		probed int32
+		probe  = exec.ProbeFunc(func(ctx context.Context, cmd *osexec.Cmd) error {
+			atomic.AddInt32(&probed, 1)
+			return nil
+		})
+	)
+	cmd, err := exec.CommandSpec{
+		Path:   "/bin/sleep",
+		Args:   []string{"sleep", "10"},
+		Probes: []exec.Probe{probe, probe},
+	}.Build(gs, groupName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := gs.Create(groupName, cmd); err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = gs.Remove(groupName) }()
+
+	if got := atomic.LoadInt32(&probed); got != 2 {
+		t.Fatalf("expected both probes to have passed once, got %d probes", got)
+	}
+}
@@ -0,0 +1,153 @@
+package exec
+
+import (
+	"context"
+	"database/sql"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// query is a statement that Groups runs often.
+// Errors from it are wrapped with desc, and its statistics are kept under desc.
+type query struct {
+	desc string
+	sql  string
+}
+
+// queries are all the statements created with newQuery.
+// They are prepared once, when the database is initialized.
+var queries []query
+
+// newQuery creates a statement that is prepared when the database is initialized.
+func newQuery(desc, sql string) query {
+	q := query{desc: desc, sql: sql}
+	queries = append(queries, q)
+	return q
+}
+
+// QueryStats are statistics about one of the statements run by Groups.
+type QueryStats struct {
+	// Calls is how many times the statement was run, and Errors how many of those failed.
+	Calls  int64
+	Errors int64
+
+	// Duration is the total time spent running the statement.
+	// For statements that return rows it does not include reading them.
+	Duration time.Duration
+}
+
+// stmts holds the prepared statements of Groups and their statistics.
+type stmts struct {
+	prepared map[query]*sql.Stmt
+	stats    map[string]QueryStats
+	mu       sync.Mutex
+}
+
+// prepareQueries prepares every statement created with newQuery.
+// Statements are prepared up front, rather than the first time they are used,
+// so that preparing one never waits for a connection that a transaction holds.
+func (g *Groups) prepareQueries(ctx context.Context) error {
+	g.stmts.mu.Lock()
+	defer g.stmts.mu.Unlock()
+
+	g.stmts.prepared = make(map[query]*sql.Stmt, len(queries))
+	g.stmts.stats = map[string]QueryStats{}
+
+	for _, q := range queries {
+		stmt, err := g.db.PrepareContext(ctx, q.sql)
+		if err != nil {
+			return errors.Wrap(err, "preparing statement for "+q.desc)
+		}
+		g.stmts.prepared[q] = stmt
+	}
+	return nil
+}
+
+// QueryStats returns statistics about the statements that have been run,
+// keyed by what each of them does, e.g. "updating process ID".
+func (g *Groups) QueryStats() map[string]QueryStats {
+	g.stmts.mu.Lock()
+	defer g.stmts.mu.Unlock()
+
+	stats := make(map[string]QueryStats, len(g.stmts.stats))
+	for desc, s := range g.stmts.stats {
+		stats[desc] = s
+	}
+	return stats
+}
+
+// stmt returns the prepared statement of q for use with tx,
+// or outside of a transaction if tx is nil.
+func (g *Groups) stmt(tx *sql.Tx, q query) (*sql.Stmt, error) {
+	g.stmts.mu.Lock()
+	stmt, ok := g.stmts.prepared[q]
+	g.stmts.mu.Unlock()
+
+	if !ok {
+		return nil, errors.Errorf("statement for %s has not been prepared", q.desc)
+	}
+	if tx != nil {
+		return tx.Stmt(stmt), nil
+	}
+	return stmt, nil
+}
+
+// record adds a run of q that took d and returned err to the statistics.
+func (g *Groups) record(q query, d time.Duration, err error) {
+	g.stmts.mu.Lock()
+	defer g.stmts.mu.Unlock()
+
+	s := g.stmts.stats[q.desc]
+	s.Calls++
+	s.Duration += d
+	if err != nil {
+		s.Errors++
+	}
+	g.stmts.stats[q.desc] = s
+}
+
+// exec runs q with the provided transaction, or outside of a transaction if tx is nil.
+func (g *Groups) exec(tx *sql.Tx, q query, args ...interface{}) (sql.Result, error) {
+	stmt, err := g.stmt(tx, q)
+	if err != nil {
+		return nil, err
+	}
+	start := time.Now()
+	result, err := stmt.Exec(args...)
+	g.record(q, time.Since(start), err)
+
+	return result, errors.Wrap(err, q.desc)
+}
+
+// queryRows runs q, which returns rows, like exec.
+func (g *Groups) queryRows(tx *sql.Tx, q query, args ...interface{}) (*sql.Rows, error) {
+	stmt, err := g.stmt(tx, q)
+	if err != nil {
+		return nil, err
+	}
+	start := time.Now()
+	rows, err := stmt.Query(args...)
+	g.record(q, time.Since(start), err)
+
+	return rows, errors.Wrap(err, q.desc)
+}
+
+// queryRow runs q, which returns at most one row, like exec and scans the row into dest.
+// It returns sql.ErrNoRows, unwrapped, if there is no row.
+func (g *Groups) queryRow(tx *sql.Tx, q query, args []interface{}, dest ...interface{}) error {
+	stmt, err := g.stmt(tx, q)
+	if err != nil {
+		return err
+	}
+	start := time.Now()
+	err = stmt.QueryRow(args...).Scan(dest...)
+	if err == sql.ErrNoRows {
+		g.record(q, time.Since(start), nil)
+		return err
+	}
+	g.record(q, time.Since(start), err)
+
+	return errors.Wrap(err, q.desc)
+}
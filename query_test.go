@@ -0,0 +1,33 @@
+package exec_test
+
+import (
+	"os"
+	osexec "os/exec"
+	"path/filepath"
+	"testing"
+)
+
+func TestGroupsQueryStats(t *testing.T) {
+	var (
+		groupName = "echofoo"
+		root      = filepath.Join("testdata", "."+t.Name())
+	)
+	_ = os.RemoveAll(root)
+
+	gs := newTestGroups(t, root)
+	defer func() { _ = gs.Remove(groupName) }() // Best effort.
+
+	if err := gs.Create(groupName, osexec.Command("echo", "foo"), osexec.Command("echo", "bar")); err != nil {
+		t.Fatal(err)
+	}
+	stats := gs.QueryStats()
+	if expected, got := int64(2), stats["inserting command"].Calls; expected != got {
+		t.Fatalf("expected %d calls, got %d", expected, got)
+	}
+	if expected, got := int64(4), stats["inserting command args"].Calls; expected != got {
+		t.Fatalf("expected %d calls, got %d", expected, got)
+	}
+	if got := stats["inserting command"].Errors; got != 0 {
+		t.Fatalf("expected no errors, got %d", got)
+	}
+}
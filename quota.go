@@ -0,0 +1,211 @@
+package exec
+
+import (
+	"database/sql"
+	"fmt"
+	"os/exec"
+
+	"github.com/pkg/errors"
+)
+
+// Quota limits the commands that are stored with a group.
+// Zero values mean there is no limit.
+type Quota struct {
+	// MaxCommands is how many commands the group can have,
+	// including commands that were stopped with StopCommand.
+	MaxCommands int `json:"max_commands,omitempty"`
+
+	// MaxReplicas is how many identical commands the group can have,
+	// see GetCmdID.
+	MaxReplicas int `json:"max_replicas,omitempty"`
+}
+
+// Quota limits.
+const (
+	QuotaCommands = "commands"
+	QuotaReplicas = "replicas"
+	QuotaTotal    = "total"
+)
+
+// QuotaError is returned by Create and Replace when a change to a group
+// would exceed its quota. Nothing is changed when it is returned.
+type QuotaError struct {
+	Group string
+
+	// Limit is QuotaCommands, QuotaReplicas, or QuotaTotal for the limit set
+	// with SetTotalQuota, and CommandID is the content hash of the replicated
+	// command if it is QuotaReplicas.
+	Limit     string
+	CommandID string
+
+	// Max is the quota, and Count the number of commands the change would leave
+	// the group with, or all the groups with if Limit is QuotaTotal.
+	Max   int
+	Count int
+}
+
+// Error returns a description of the error.
+func (e *QuotaError) Error() string {
+	switch e.Limit {
+	case QuotaTotal:
+		return fmt.Sprintf("groups can have at most %d commands in total, got %d adding to group %s", e.Max, e.Count, e.Group)
+	case QuotaReplicas:
+		return fmt.Sprintf("group %s can have at most %d replicas of command %s, got %d", e.Group, e.Max, e.CommandID, e.Count)
+	default:
+		return fmt.Sprintf("group %s can have at most %d commands, got %d", e.Group, e.Max, e.Count)
+	}
+}
+
+var getGroupQuota = newQuery("getting group quota", `
+SELECT	max_commands, max_replicas
+FROM	group_quotas
+WHERE	group_name = ?`)
+
+var setGroupQuota = newQuery("setting group quota", `
+INSERT OR REPLACE INTO	group_quotas (group_name, max_commands, max_replicas)
+VALUES			(?, ?, ?)`)
+
+var countCommands = newQuery("counting commands", `
+SELECT	COUNT(*)
+FROM	processes`)
+
+var getGroupHashes = newQuery("getting group command hashes", `
+SELECT	command_id
+FROM	processes
+WHERE	group_name = ?`)
+
+// SetQuota sets the quota of a group. The quota is persisted, and is kept
+// when the group is removed, unless groups are collected, see WithGroupGC. Commands that a group already has are not
+// affected by a lower quota, but no more can be added until it is met.
+func (g *Groups) SetQuota(groupName string, q Quota) error {
+	if q.MaxCommands < 0 || q.MaxReplicas < 0 {
+		return errors.Errorf("quota must not be negative, got %+v", q)
+	}
+	_, err := g.exec(nil, setGroupQuota, groupName, q.MaxCommands, q.MaxReplicas)
+	return err
+}
+
+// Quota returns the quota of a group. It is the zero Quota if none has been set.
+func (g *Groups) Quota(groupName string) (Quota, error) {
+	return g.getQuotaTx(nil, groupName)
+}
+
+// getQuotaTx gets the quota of a group using the provided transaction.
+func (g *Groups) getQuotaTx(tx *sql.Tx, groupName string) (Quota, error) {
+	var q Quota
+	if err := g.queryRow(tx, getGroupQuota, []interface{}{groupName}, &q.MaxCommands, &q.MaxReplicas); err != nil && err != sql.ErrNoRows {
+		return Quota{}, err
+	}
+	return q, nil
+}
+
+// SetTotalQuota limits how many commands all the groups can have together,
+// including commands that were stopped with StopCommand, on top of the quota
+// of each group, see SetQuota. It is not persisted, so it must be set every
+// time a Groups is created. Zero, the default, means there is no limit.
+func (g *Groups) SetTotalQuota(max int) error {
+	if max < 0 {
+		return errors.Errorf("total quota must not be negative, got %d", max)
+	}
+	g.totalQuotaMu.Lock()
+	g.totalQuota = max
+	g.totalQuotaMu.Unlock()
+	return nil
+}
+
+// checkTotalQuotaTx returns a *QuotaError if adding n commands to a group
+// would exceed the total quota.
+func (g *Groups) checkTotalQuotaTx(tx *sql.Tx, groupName string, n int) error {
+	g.totalQuotaMu.Lock()
+	max := g.totalQuota
+	g.totalQuotaMu.Unlock()
+
+	if max == 0 || n <= 0 {
+		return nil
+	}
+	var total int
+	if err := g.queryRow(tx, countCommands, nil, &total); err != nil {
+		return err
+	}
+	if count := total + n; count > max {
+		return &QuotaError{Group: groupName, Limit: QuotaTotal, Max: max, Count: count}
+	}
+	return nil
+}
+
+// checkQuotaTx returns a *QuotaError if adding commands with the content hashes
+// in add, and removing ones with the hashes in remove, would exceed a group's quota
+// or the total quota.
+// Changes that do not make a group that is already over its quota worse are allowed.
+func (g *Groups) checkQuotaTx(tx *sql.Tx, groupName string, add, remove []string) error {
+	if err := g.checkTotalQuotaTx(tx, groupName, len(add)-len(remove)); err != nil {
+		return err
+	}
+	q, err := g.getQuotaTx(tx, groupName)
+	if err != nil || q == (Quota{}) {
+		return err
+	}
+	before, err := g.getGroupHashesTx(tx, groupName)
+	if err != nil {
+		return err
+	}
+	var (
+		after = map[string]int{}
+		total = 0
+	)
+	for hash, n := range before {
+		after[hash] = n
+		total += n
+	}
+	for _, hash := range add {
+		after[hash]++
+	}
+	for _, hash := range remove {
+		after[hash]--
+	}
+	if count := total + len(add) - len(remove); q.MaxCommands > 0 && count > q.MaxCommands && count > total {
+		return &QuotaError{Group: groupName, Limit: QuotaCommands, Max: q.MaxCommands, Count: count}
+	}
+	for _, hash := range add {
+		if count := after[hash]; q.MaxReplicas > 0 && count > q.MaxReplicas && count > before[hash] {
+			return &QuotaError{Group: groupName, Limit: QuotaReplicas, CommandID: hash, Max: q.MaxReplicas, Count: count}
+		}
+	}
+	return nil
+}
+
+// getGroupHashesTx counts the stored commands of a group by content hash.
+func (g *Groups) getGroupHashesTx(tx *sql.Tx, groupName string) (map[string]int, error) {
+	rows, err := g.queryRows(tx, getGroupHashes, groupName)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = rows.Close() }() // Best effort.
+
+	counts := map[string]int{}
+	for rows.Next() {
+		var hash string
+		if err := rows.Scan(&hash); err != nil {
+			return nil, err
+		}
+		counts[hash]++
+	}
+	return counts, rows.Err()
+}
+
+// addedHashes returns the content hashes of the commands that Create adds to a group,
+// leaving out the ones that replace an identical command because of DuplicateReplace.
+func (g *Groups) addedHashes(grp *Group, cmds []*exec.Cmd) ([]string, error) {
+	hashes := []string{}
+	for _, cmd := range cmds {
+		hash, err := GetCmdID(cmd)
+		if err != nil {
+			return nil, errors.Wrap(err, "getting command ID")
+		}
+		if grp != nil && g.duplicatePolicy() == DuplicateReplace && grp.lookup(hash) != nil {
+			continue
+		}
+		hashes = append(hashes, hash)
+	}
+	return hashes, nil
+}
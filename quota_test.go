@@ -0,0 +1,64 @@
+package exec_test
+
+import (
+	"os"
+	osexec "os/exec"
+	"path/filepath"
+	"testing"
+
+	"github.com/pkg/errors"
+	"github.com/scgolang/exec"
+)
+
+func TestGroupsQuota(t *testing.T) {
+	var (
+		groupName = "sleepers"
+		root      = filepath.Join("testdata", "."+t.Name())
+		quota     = exec.Quota{MaxCommands: 2, MaxReplicas: 1}
+	)
+	_ = os.RemoveAll(root)
+
+	gs := newTestGroups(t, root)
+	defer func() { _ = gs.Remove(groupName) }() // Best effort.
+
+	if err := gs.SetQuota(groupName, quota); err != nil {
+		t.Fatal(err)
+	}
+	verifyQuotaError(gs.Create(groupName, osexec.Command("sleep", "10"), osexec.Command("sleep", "10")), exec.QuotaReplicas, t)
+
+	sleep10, sleep11 := osexec.Command("sleep", "10"), osexec.Command("sleep", "11")
+	if err := gs.Create(groupName, sleep10, sleep11); err != nil {
+		t.Fatal(err)
+	}
+	verifyQuotaError(gs.Create(groupName, osexec.Command("sleep", "12")), exec.QuotaCommands, t)
+
+	id, _ := gs.CmdID(groupName, sleep10)
+	verifyQuotaError(gs.Replace(groupName, id, osexec.Command("sleep", "11")), exec.QuotaReplicas, t)
+
+	if err := gs.Replace(groupName, id, osexec.Command("sleep", "12")); err != nil {
+		t.Fatal(err)
+	}
+	if cmds, _ := gs.Commands(groupName); len(cmds) != 2 {
+		t.Fatalf("expected 2 commands, got %d", len(cmds))
+	}
+	got, err := newTestGroups(t, root).Quota(groupName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected := quota; expected != got {
+		t.Fatalf("expected quota %+v, got %+v", expected, got)
+	}
+	if err := gs.SetQuota(groupName, exec.Quota{MaxCommands: -1}); err == nil {
+		t.Fatal("expected an error, got nil")
+	}
+}
+
+func verifyQuotaError(err error, limit string, t *testing.T) {
+	qerr, ok := errors.Cause(err).(*exec.QuotaError)
+	if !ok {
+		t.Fatalf("expected a quota error, got %v", err)
+	}
+	if expected, got := limit, qerr.Limit; expected != got {
+		t.Fatalf("expected %s quota to be exceeded, got %s", expected, got)
+	}
+}
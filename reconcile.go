@@ -0,0 +1,170 @@
+package exec
+
+import (
+	"context"
+	"database/sql"
+	"os/exec"
+
+	"github.com/pkg/errors"
+)
+
+// CreateOrOpen creates a group with cmds if it is not stored, and otherwise
+// opens it and reconciles it with cmds: stored commands that are identical
+// to one of cmds are opened, the ones that are not are removed, and the
+// commands of cmds that are missing are added. Commands are matched one to
+// one by content hash, see GetCmdID. Stored commands that were stopped with
+// StopCommand stay stopped.
+// If the group is already open its commands are reconciled the same way.
+// It returns the commands of the group.
+func (g *Groups) CreateOrOpen(groupName string, cmds ...*exec.Cmd) ([]*exec.Cmd, error) {
+	tx, err := g.db.Begin()
+	if err != nil {
+		return nil, errors.Wrap(err, "starting transaction")
+	}
+	if err := g.createOrOpenTx(tx, groupName, cmds); err != nil {
+		_ = tx.Rollback()
+		return nil, err
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, errors.Wrap(err, "committing transaction")
+	}
+	return g.getGroup(groupName).Commands(), nil
+}
+
+// createOrOpenTx creates or opens a group and reconciles it with cmds using the provided transaction.
+func (g *Groups) createOrOpenTx(tx *sql.Tx, groupName string, cmds []*exec.Cmd) error {
+	stored, ids, err := g.getGroupProcessesTx(tx, groupName)
+	if err != nil {
+		return errors.Wrap(err, "getting group commands")
+	}
+	if grp := g.getGroup(groupName); grp != nil {
+		return g.reconcileTx(tx, groupName, grp, stored, ids, cmds)
+	}
+	if len(stored) == 0 {
+		return g.createTx(context.Background(), tx, groupName, cmds...)
+	}
+	matched, missing, err := matchCmds(stored, cmds)
+	if err != nil {
+		return err
+	}
+	var (
+		keepCmds  = []*exec.Cmd{}
+		keepIDs   = []string{}
+		removeIDs = []string{}
+	)
+	for i, id := range ids {
+		if matched[i] {
+			keepCmds, keepIDs = append(keepCmds, stored[i]), append(keepIDs, id)
+		} else {
+			removeIDs = append(removeIDs, id)
+		}
+	}
+	if err := g.deleteStoredTx(tx, groupName, removeIDs); err != nil {
+		return err
+	}
+	if keepCmds, keepIDs, err = g.skipStoppedTx(tx, groupName, keepCmds, keepIDs); err != nil {
+		return err
+	}
+	grp := g.newGroup(groupName)
+	if err := g.openTx(context.Background(), tx, groupName, grp, keepCmds, keepIDs); err != nil {
+		return err
+	}
+	g.groupsMu.Lock()
+	g.groups[groupName] = grp
+	g.groupsMu.Unlock()
+
+	return g.createTx(context.Background(), tx, groupName, missing...)
+}
+
+// reconcileTx reconciles an open group with cmds using the provided transaction.
+// stored and ids are the commands that are stored with the group, which include
+// the commands that were stopped with StopCommand, as they are not in grp.
+func (g *Groups) reconcileTx(tx *sql.Tx, groupName string, grp *Group, stored []*exec.Cmd, ids []string, cmds []*exec.Cmd) error {
+	var (
+		current    = grp.Commands()
+		open       = map[string]struct{}{}
+		stoppedIDs = []string{}
+	)
+	for _, cmd := range current {
+		if id, ok := grp.ID(cmd); ok {
+			open[id] = struct{}{}
+		}
+	}
+	have := append([]*exec.Cmd{}, current...)
+	for i, id := range ids {
+		if _, ok := open[id]; !ok {
+			have, stoppedIDs = append(have, stored[i]), append(stoppedIDs, id)
+		}
+	}
+	matched, missing, err := matchCmds(have, cmds)
+	if err != nil {
+		return err
+	}
+	var (
+		extra     = []*exec.Cmd{}
+		removeIDs = []string{}
+	)
+	for i, cmd := range current {
+		if !matched[i] {
+			extra = append(extra, cmd)
+		}
+	}
+	for i, id := range stoppedIDs {
+		if !matched[len(current)+i] {
+			removeIDs = append(removeIDs, id)
+		}
+	}
+	if len(extra) > 0 {
+		if err := g.removeTx(tx, groupName, g.timeouts().Remove, extra...); err != nil {
+			return err
+		}
+	}
+	if err := g.deleteStoredTx(tx, groupName, removeIDs); err != nil {
+		return err
+	}
+	return g.createTx(context.Background(), tx, groupName, missing...)
+}
+
+// deleteStoredTx deletes commands that are not running, and their watch lists
+// and settings, from the database using the provided transaction.
+func (g *Groups) deleteStoredTx(tx *sql.Tx, groupName string, ids []string) error {
+	if err := g.deleteCmdsTx(tx, groupName, ids...); err != nil {
+		return err
+	}
+	if len(ids) == 0 {
+		return nil
+	}
+	if err := g.removeWatchTx(tx, groupName, ids...); err != nil {
+		return err
+	}
+	return g.removeSettingsTx(tx, groupName, ids...)
+}
+
+// matchCmds matches each of want to an identical command in have, one to one.
+// It returns whether each command in have was matched, and the commands of want that were not.
+func matchCmds(have, want []*exec.Cmd) ([]bool, []*exec.Cmd, error) {
+	byHash := map[string][]int{}
+	for i, cmd := range have {
+		hash, err := GetCmdID(cmd)
+		if err != nil {
+			return nil, nil, errors.Wrap(err, "getting command ID")
+		}
+		byHash[hash] = append(byHash[hash], i)
+	}
+	var (
+		matched = make([]bool, len(have))
+		missing = []*exec.Cmd{}
+	)
+	for _, cmd := range want {
+		hash, err := GetCmdID(cmd)
+		if err != nil {
+			return nil, nil, errors.Wrap(err, "getting command ID")
+		}
+		if idxs := byHash[hash]; len(idxs) > 0 {
+			matched[idxs[0]], byHash[hash] = true, idxs[1:]
+			continue
+		}
+		missing = append(missing, cmd)
+	}
+	return matched, missing, nil
+}
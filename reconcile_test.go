@@ -0,0 +1,65 @@
+package exec_test
+
+import (
+	"os"
+	osexec "os/exec"
+	"path/filepath"
+	"testing"
+
+	"github.com/scgolang/exec"
+)
+
+func TestGroupsCreateOrOpen(t *testing.T) {
+	var (
+		groupName = "sleepers"
+		root      = filepath.Join("testdata", "."+t.Name())
+	)
+	_ = os.RemoveAll(root)
+
+	gs := newTestGroups(t, root)
+	defer func() { _ = gs.Remove(groupName) }() // Best effort.
+
+	a, b := osexec.Command("sleep", "10"), osexec.Command("sleep", "11")
+
+	cmds, err := gs.CreateOrOpen(groupName, a, b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected, got := 2, len(cmds); expected != got {
+		t.Fatalf("expected %d commands, got %d", expected, got)
+	}
+	if cmds, err = gs.CreateOrOpen(groupName, osexec.Command("sleep", "10"), osexec.Command("sleep", "11")); err != nil {
+		t.Fatal(err)
+	}
+	if len(cmds) != 2 || cmds[0] != a || cmds[1] != b {
+		t.Fatalf("expected the open group to be left alone, got %v", cmds)
+	}
+	_ = gs.Close(groupName)
+
+	// b is removed from storage, a is opened, and c is added.
+	c := osexec.Command("sleep", "12")
+	if cmds, err = gs.CreateOrOpen(groupName, osexec.Command("sleep", "10"), c); err != nil {
+		t.Fatal(err)
+	}
+	verifyCmdHashes(cmds, []*osexec.Cmd{a, c}, t)
+
+	_ = gs.Close(groupName)
+
+	if cmds, err = gs.Open(groupName); err != nil {
+		t.Fatal(err)
+	}
+	verifyCmdHashes(cmds, []*osexec.Cmd{a, c}, t)
+}
+
+// verifyCmdHashes checks that cmds have the same content hashes as expected, in order.
+func verifyCmdHashes(cmds, expected []*osexec.Cmd, t *testing.T) {
+	if len(cmds) != len(expected) {
+		t.Fatalf("expected %d commands, got %d", len(expected), len(cmds))
+	}
+	for i, cmd := range cmds {
+		want, _ := exec.GetCmdID(expected[i])
+		if got, _ := exec.GetCmdID(cmd); want != got {
+			t.Fatalf("expected command %d to be %s, got %s", i, want, got)
+		}
+	}
+}
@@ -0,0 +1,191 @@
+package exec
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"sync"
+
+	"github.com/pkg/errors"
+)
+
+// Registry hosts several Groups in one process, each with its own root
+// directory and database, under a namespace.
+// It refuses to host two Groups that share a root or a database, which would
+// supervise the same stored commands, and it only signals processes through
+// the namespace that supervises them.
+type Registry struct {
+	groups map[string]*Groups
+
+	// tenants has the namespaces that have been configured with SetTenant.
+	tenants map[string]Tenant
+
+	mu sync.RWMutex
+}
+
+// NewRegistry creates an empty registry.
+func NewRegistry() *Registry {
+	return &Registry{groups: map[string]*Groups{}, tenants: map[string]Tenant{}}
+}
+
+// Add creates Groups in root, configured with opts, under namespace.
+func (r *Registry) Add(namespace, root string, opts ...Option) (*Groups, error) {
+	if namespace == "" {
+		return nil, errors.New("namespace must not be empty")
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if _, ok := r.groups[namespace]; ok {
+		return nil, errors.Errorf("namespace %s already exists", namespace)
+	}
+	absRoot, err := filepath.Abs(root)
+	if err != nil {
+		return nil, err
+	}
+	for ns, other := range r.groups {
+		if other.root == absRoot {
+			return nil, errors.Errorf("root %s is already used by namespace %s", absRoot, ns)
+		}
+	}
+	g, err := New(root, opts...)
+	if err != nil {
+		return nil, err
+	}
+	for ns, other := range r.groups {
+		if other.db == g.db {
+			return nil, errors.Errorf("database is already used by namespace %s", ns)
+		}
+	}
+	r.groups[namespace] = g
+	return g, nil
+}
+
+// Get returns the Groups of a namespace.
+func (r *Registry) Get(namespace string) (*Groups, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	g, ok := r.groups[namespace]
+	if !ok {
+		return nil, errors.Errorf("namespace %s not found", namespace)
+	}
+	return g, nil
+}
+
+// Namespaces returns the namespaces in the registry, sorted.
+func (r *Registry) Namespaces() []string {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	namespaces := make([]string, 0, len(r.groups))
+	for ns := range r.groups {
+		namespaces = append(namespaces, ns)
+	}
+	sort.Strings(namespaces)
+	return namespaces
+}
+
+// Remove closes the open groups of a namespace and removes it from the registry.
+// The commands stay stored in its database.
+func (r *Registry) Remove(namespace string) error {
+	r.mu.Lock()
+	g, ok := r.groups[namespace]
+	delete(r.groups, namespace)
+	delete(r.tenants, namespace)
+	r.mu.Unlock()
+
+	if !ok {
+		return errors.Errorf("namespace %s not found", namespace)
+	}
+	for _, groupName := range g.groupNames() {
+		// Close kills the commands, so they are expected to exit with an error.
+		if err := g.Close(groupName); err != nil {
+			if _, ok := errors.Cause(err).(CmdError); !ok {
+				return errors.Wrap(err, "closing group "+groupName)
+			}
+		}
+	}
+	return nil
+}
+
+// Lookup returns the namespace and group of the command whose process has the provided ID.
+// It returns false if no namespace supervises the process.
+func (r *Registry) Lookup(pid int) (namespace, groupName string, ok bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	for ns, g := range r.groups {
+		if groupName, ok := g.supervisor(pid); ok {
+			return ns, groupName, true
+		}
+	}
+	return "", "", false
+}
+
+// Signal sends a signal to a process that is supervised by namespace.
+// It returns an error, without sending the signal, if the process is not
+// supervised by namespace, even if another namespace supervises it.
+func (r *Registry) Signal(namespace string, pid int, sig os.Signal) error {
+	g, err := r.Get(namespace)
+	if err != nil {
+		return err
+	}
+	groupName, ok := g.supervisor(pid)
+	if !ok {
+		if other, _, ok := r.Lookup(pid); ok {
+			return errors.Errorf("process %d is supervised by namespace %s, not %s", pid, other, namespace)
+		}
+		return errors.Errorf("process %d is not supervised by namespace %s", pid, namespace)
+	}
+	grp := g.getGroup(groupName)
+	if grp == nil {
+		return errors.Errorf("group %s not found", groupName)
+	}
+	cmd := grp.supervising(pid)
+	if cmd == nil {
+		return errors.Errorf("process %d is not supervised by namespace %s", pid, namespace)
+	}
+	return grp.signal(cmd, sig)
+}
+
+// groupNames returns the names of the open groups.
+func (g *Groups) groupNames() []string {
+	g.groupsMu.RLock()
+	defer g.groupsMu.RUnlock()
+
+	names := make([]string, 0, len(g.groups))
+	for name := range g.groups {
+		names = append(names, name)
+	}
+	return names
+}
+
+// supervisor returns the name of the open group with a command whose process has the provided ID.
+func (g *Groups) supervisor(pid int) (string, bool) {
+	g.groupsMu.RLock()
+	defer g.groupsMu.RUnlock()
+
+	for name, grp := range g.groups {
+		if grp.supervising(pid) != nil {
+			return name, true
+		}
+	}
+	return "", false
+}
+
+// supervising returns the command whose process has the provided ID and
+// has not exited, or nil if there is none, since the ID of a process that
+// has exited may have been reused.
+func (g *Group) supervising(pid int) *exec.Cmd {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	for _, cmd := range g.cmds {
+		if pid > 0 && pidOf(g.procs[cmd]) == pid && g.aliveLocked(cmd) {
+			return cmd
+		}
+	}
+	return nil
+}
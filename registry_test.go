@@ -0,0 +1,99 @@
+package exec_test
+
+import (
+	"database/sql"
+	"os"
+	osexec "os/exec"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"testing"
+
+	"github.com/scgolang/exec"
+)
+
+func TestRegistry(t *testing.T) {
+	var (
+		groupName = "sleepers"
+		root      = filepath.Join("testdata", "."+t.Name())
+		rootA     = filepath.Join(root, "a")
+		rootB     = filepath.Join(root, "b")
+		reg       = exec.NewRegistry()
+	)
+	_ = os.RemoveAll(root)
+
+	if err := os.MkdirAll(root, exec.DirPerms); err != nil {
+		t.Fatal(err)
+	}
+	a, err := reg.Add("a", rootA)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := reg.Add("b", rootB)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _, _ = a.Remove(groupName), b.Remove(groupName) }() // Best effort.
+
+	if _, err := reg.Add("a", filepath.Join(root, "c")); err == nil {
+		t.Fatal("expected an error for a duplicate namespace, got nil")
+	}
+	if _, err := reg.Add("c", rootA); err == nil {
+		t.Fatal("expected an error for a shared root, got nil")
+	}
+	db, err := sql.Open("sqlite3", filepath.Join(root, "shared.db")+"?_txlock=immediate")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = db.Close() }()
+
+	if _, err := reg.Add("d", filepath.Join(root, "d"), exec.WithDB(db)); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := reg.Add("e", filepath.Join(root, "e"), exec.WithDB(db)); err == nil {
+		t.Fatal("expected an error for a shared database, got nil")
+	}
+	if expected, got := "a,b,d", strings.Join(reg.Namespaces(), ","); expected != got {
+		t.Fatalf("expected namespaces %s, got %s", expected, got)
+	}
+	var (
+		cmdA = osexec.Command("sleep", "10")
+		cmdB = osexec.Command("sleep", "10")
+	)
+	if err := a.Create(groupName, cmdA); err != nil {
+		t.Fatal(err)
+	}
+	if err := b.Create(groupName, cmdB); err != nil {
+		t.Fatal(err)
+	}
+	pidB := cmdB.Process.Pid
+
+	ns, grp, ok := reg.Lookup(pidB)
+	if !ok {
+		t.Fatalf("expected process %d to be found", pidB)
+	}
+	if expected, got := "b/"+groupName, ns+"/"+grp; expected != got {
+		t.Fatalf("expected %s, got %s", expected, got)
+	}
+	if err := reg.Signal("a", pidB, syscall.SIGTERM); err == nil {
+		t.Fatal("expected an error signalling another namespace's process, got nil")
+	}
+	if _, _, ok := reg.Lookup(pidB); !ok {
+		t.Fatalf("expected process %d to still be running", pidB)
+	}
+	if err := reg.Signal("b", pidB, syscall.SIGTERM); err != nil {
+		t.Fatal(err)
+	}
+	if err := b.Wait(groupName); err == nil {
+		t.Fatal("expected an error from the signalled command, got nil")
+	}
+	if _, _, ok := reg.Lookup(pidB); ok {
+		t.Fatalf("expected process %d to be gone after it exited", pidB)
+	}
+	if err := reg.Remove("a"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := reg.Get("a"); err == nil {
+		t.Fatal("expected an error for a removed namespace, got nil")
+	}
+}
@@ -0,0 +1,169 @@
+package exec
+
+import (
+	"fmt"
+	"os/exec"
+	"strconv"
+	"strings"
+	"syscall"
+
+	"github.com/pkg/errors"
+)
+
+// DefaultReloadSignal is the signal sent by ReloadCommand and Reload to
+// commands that do not have a reload signal configured.
+const DefaultReloadSignal = syscall.SIGHUP
+
+// SetReloadSignal sets the signal that ReloadCommand and Reload send to a command.
+// The setting is persisted with the group.
+func (g *Groups) SetReloadSignal(groupName string, cmd *exec.Cmd, sig syscall.Signal) error {
+	commandID, err := g.cmdID(groupName, cmd)
+	if err != nil {
+		return errors.Wrap(err, "getting command ID")
+	}
+	return g.setCmdSetting(groupName, commandID, settingReloadSignal, strconv.Itoa(int(sig)))
+}
+
+// ReloadSignal returns the signal that ReloadCommand sends to a command.
+func (g *Groups) ReloadSignal(groupName string, cmd *exec.Cmd) (syscall.Signal, error) {
+	commandID, err := g.cmdID(groupName, cmd)
+	if err != nil {
+		return 0, errors.Wrap(err, "getting command ID")
+	}
+	return g.reloadSignal(groupName, commandID)
+}
+
+// reloadSignal returns the reload signal of the command with the provided ID.
+func (g *Groups) reloadSignal(groupName, commandID string) (syscall.Signal, error) {
+	value, ok, err := g.getCmdSetting(groupName, commandID, settingReloadSignal)
+	if err != nil {
+		return 0, err
+	}
+	if !ok {
+		return DefaultReloadSignal, nil
+	}
+	sig, err := strconv.Atoi(value)
+	if err != nil {
+		return 0, errors.Wrap(err, "parsing reload signal")
+	}
+	return syscall.Signal(sig), nil
+}
+
+// reloadSuffix is the suffix of the ID that the runs of reload commands are recorded with.
+const reloadSuffix = ".reload"
+
+// SetReloadCommand sets a command that ReloadCommand and Reload run to make
+// a command reload its configuration, like "nginx -s reload", in place of
+// sending it its reload signal. The reload command succeeds if it exits with
+// status 0. Its output is captured to log files named after the instance ID
+// of the command with a .reload suffix, and its runs are recorded in the run
+// history of the group with that ID, like the runs of hooks, see SetHooks.
+// A nil reload command removes it.
+// Like hooks, reload commands are not persisted and must be set every time
+// a Groups is created.
+func (g *Groups) SetReloadCommand(groupName string, cmd, reload *exec.Cmd) error {
+	if reload != nil && (reload.Stdout != nil || reload.Stderr != nil) {
+		return errors.New("output of a reload command must not be set")
+	}
+	commandID, err := GetCmdID(cmd)
+	if err != nil {
+		return errors.Wrap(err, "getting command ID")
+	}
+	g.probesMu.Lock()
+	defer g.probesMu.Unlock()
+
+	if g.reloadCmds[groupName] == nil {
+		g.reloadCmds[groupName] = map[string]*exec.Cmd{}
+	}
+	if reload == nil {
+		delete(g.reloadCmds[groupName], commandID)
+	} else {
+		g.reloadCmds[groupName][commandID] = reload
+	}
+	return nil
+}
+
+// reloadCmd returns the reload command of cmd, or nil if it has none.
+func (g *Groups) reloadCmd(groupName string, cmd *exec.Cmd) *exec.Cmd {
+	hash, err := GetCmdID(cmd)
+	if err != nil {
+		return nil
+	}
+	g.probesMu.Lock()
+	defer g.probesMu.Unlock()
+	return g.reloadCmds[groupName][hash]
+}
+
+// ReloadCommand asks a running command to reload its configuration in place
+// by running its reload command, see SetReloadCommand, or sending it its
+// reload signal, which defaults to SIGHUP.
+// Unlike a restart the process keeps running with the same PID.
+func (g *Groups) ReloadCommand(groupName string, cmd *exec.Cmd) error {
+	grp := g.getGroup(groupName)
+	if grp == nil {
+		return errors.Errorf("group %s not found", groupName)
+	}
+	commandID, err := g.cmdID(groupName, cmd)
+	if err != nil {
+		return errors.Wrap(err, "getting command ID")
+	}
+	running := grp.lookup(commandID)
+	if running == nil {
+		return errors.Errorf("command %s not found in group %s", commandID, groupName)
+	}
+	instanceID, _ := grp.ID(running)
+	return g.reload(groupName, grp, running, instanceID)
+}
+
+// ReloadError reports the commands that Reload could not reload.
+type ReloadError struct {
+	Failures []SignalFailure
+}
+
+// Error returns a description of the error.
+func (e *ReloadError) Error() string {
+	msgs := make([]string, len(e.Failures))
+	for i, f := range e.Failures {
+		msgs[i] = fmt.Sprintf("command %s: %s", f.CommandID, f.Err)
+	}
+	return fmt.Sprintf("reloading %d commands failed: %s", len(e.Failures), strings.Join(msgs, "; "))
+}
+
+// Reload asks every running command of a group to reload its configuration,
+// like ReloadCommand, one at a time in the order of the group.
+// It carries on when a command can not be reloaded and returns a
+// *ReloadError with the commands that could not be, if there are any.
+func (g *Groups) Reload(groupName string) error {
+	grp := g.getGroup(groupName)
+	if grp == nil {
+		return errors.Errorf("group %s not found", groupName)
+	}
+	var failures []SignalFailure
+
+	for _, cmd := range grp.alive() {
+		instanceID, ok := grp.ID(cmd)
+		if !ok {
+			continue // Removed in the meantime.
+		}
+		if err := g.reload(groupName, grp, cmd, instanceID); err != nil {
+			failures = append(failures, SignalFailure{Group: groupName, CommandID: instanceID, Err: err})
+		}
+	}
+	if len(failures) > 0 {
+		return &ReloadError{Failures: failures}
+	}
+	return nil
+}
+
+// reload runs the reload command of a running command, or sends it its reload signal.
+func (g *Groups) reload(groupName string, grp *Group, cmd *exec.Cmd, instanceID string) error {
+	if reload := g.reloadCmd(groupName, cmd); reload != nil {
+		result := g.runJobCmd(&Job{ID: instanceID + reloadSuffix, Group: groupName}, cloneCmd(reload))
+		return errors.Wrap(result.Err, "running reload command")
+	}
+	sig, err := g.reloadSignal(groupName, instanceID)
+	if err != nil {
+		return errors.Wrap(err, "getting reload signal")
+	}
+	return errors.Wrap(grp.signal(cmd, sig), "sending reload signal")
+}
@@ -0,0 +1,118 @@
+//go:build !windows
+// +build !windows
+
+package exec_test
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	osexec "os/exec"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/scgolang/exec"
+)
+
+func TestGroupsReloadCommand(t *testing.T) {
+	var (
+		groupName = "reloader"
+		root      = filepath.Join("testdata", "."+t.Name())
+	)
+	_ = os.RemoveAll(root)
+
+	var (
+		gs          = newTestGroups(t, root)
+		cmd         = osexec.Command("sh", "-c", `trap "exit 3" USR1; sleep 10 & wait`)
+		ctx, cancel = context.WithCancel(context.Background())
+	)
+	defer cancel()
+
+	if err := gs.Create(groupName, cmd); err != nil {
+		t.Fatal(err)
+	}
+	sig, err := gs.ReloadSignal(groupName, cmd)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected, got := syscall.SIGHUP, sig; expected != got {
+		t.Fatalf("expected %s, got %s", expected, got)
+	}
+	if err := gs.SetReloadSignal(groupName, cmd, syscall.SIGUSR1); err != nil {
+		t.Fatal(err)
+	}
+	changes, err := gs.Watch(ctx, groupName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(100 * time.Millisecond) // Give the shell time to install the trap.
+
+	if err := gs.ReloadCommand(groupName, cmd); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case <-time.After(5 * time.Second):
+		t.Fatal("timeout waiting for command to handle reload signal")
+	case change := <-changes:
+		if expected, got := exec.StateFailed, change.To; expected != got {
+			t.Fatalf("expected state %s, got %s", expected, got)
+		}
+		if expected, got := "exit status 3", change.Err.Error(); expected != got {
+			t.Fatalf("expected %s, got %s", expected, got)
+		}
+	}
+}
+
+func TestGroupsReload(t *testing.T) {
+	var (
+		groupName = "reloaders"
+		root      = filepath.Join("testdata", "."+t.Name())
+	)
+	_ = os.RemoveAll(root)
+
+	gs := newTestGroups(t, root)
+
+	marker, err := filepath.Abs(filepath.Join(root, "marker"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var (
+		signaled  = osexec.Command("sh", "-c", `trap "echo reloaded" HUP; while true; do sleep 0.05; done`)
+		commanded = osexec.Command("sleep", "10")
+	)
+	if err := gs.SetReloadCommand(groupName, commanded, osexec.Command("touch", marker)); err != nil {
+		t.Fatal(err)
+	}
+	if err := gs.Create(groupName, signaled, commanded); err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = gs.Remove(groupName) }()
+
+	time.Sleep(100 * time.Millisecond) // Give the shell time to install the trap.
+
+	if err := gs.Reload(groupName); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(marker); err != nil {
+		t.Fatalf("expected the reload command to have run: %s", err)
+	}
+	id, _ := gs.CmdID(groupName, signaled)
+
+	for deadline := time.Now().Add(5 * time.Second); ; time.Sleep(20 * time.Millisecond) {
+		data, err := ioutil.ReadFile(filepath.Join(root, groupName, id+".stdout"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if strings.Contains(string(data), "reloaded") {
+			break
+		} else if time.Now().After(deadline) {
+			t.Fatal("timeout waiting for command to handle reload signal")
+		}
+	}
+	if err := gs.Reload("nope"); err == nil {
+		t.Fatal("expected an error for a group that does not exist")
+	}
+}
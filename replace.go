@@ -0,0 +1,104 @@
+package exec
+
+import (
+	"context"
+	"database/sql"
+	"os/exec"
+	"syscall"
+
+	"github.com/pkg/errors"
+)
+
+// Replace upgrades a command without a gap in service.
+// It starts newCmd alongside the running command with ID cmdID, waits for
+// newCmd to pass its readiness probe (or the old command's readiness probe,
+// if newCmd does not have one), then gracefully stops the old command.
+// The old command's settings and watch list are carried over to newCmd.
+// If newCmd fails to become ready it is stopped and the old command keeps running.
+func (g *Groups) Replace(groupName, cmdID string, newCmd *exec.Cmd) error {
+	grp := g.getGroup(groupName)
+	if grp == nil {
+		return errors.Errorf("group %s not found", groupName)
+	}
+	timeouts := g.timeouts()
+
+	old := grp.lookup(cmdID)
+	if old == nil {
+		return errors.Errorf("command %s not found in group %s", cmdID, groupName)
+	}
+	oldID, _ := grp.ID(old)
+
+	// Readiness probes are set by definition, before there is an instance.
+	newHash, err := GetCmdID(newCmd)
+	if err != nil {
+		return errors.Wrap(err, "getting command ID")
+	}
+	oldHash, err := GetCmdID(old)
+	if err != nil {
+		return errors.Wrap(err, "getting command ID")
+	}
+	if err := g.checkQuotaTx(nil, groupName, []string{newHash}, []string{oldHash}); err != nil {
+		return err
+	}
+	newID := newInstanceID()
+
+	// The old command keeps running, so newCmd would never get capacity if the limit has been reached.
+	defer g.capacity.allowSurge(newCmd)()
+
+	if err := g.start(newCmd, groupName, grp, nil, newID); err != nil {
+		return errors.Wrap(err, "starting new command")
+	}
+	if err := grp.waitReady(context.Background(), g.readinessProbe(groupName, newHash, oldHash), newCmd, timeouts.Ready); err != nil {
+		grp.retire(newCmd)
+		_ = grp.stop(newCmd, syscall.SIGTERM, timeouts.Stop)
+		grp.drop(newCmd)
+		return errors.Wrap(err, "waiting for new command to be ready")
+	}
+	tx, err := g.db.Begin()
+	if err != nil {
+		return errors.Wrap(err, "starting transaction")
+	}
+	if err := g.replaceTx(tx, groupName, oldID, newID, grp.pid(newCmd), newCmd); err != nil {
+		_ = tx.Rollback()
+		return err
+	}
+	if err := tx.Commit(); err != nil {
+		return errors.Wrap(err, "committing transaction")
+	}
+	grp.retire(old)
+
+	if err := grp.stop(old, grp.stopSignalOf(old, syscall.SIGTERM), timeouts.Stop); err != nil {
+		return errors.Wrap(err, "stopping old command")
+	}
+	grp.drop(old)
+
+	return g.rewatchFiles(groupName, oldID, newCmd)
+}
+
+var updateSettingsID = newQuery("updating command_settings", `
+UPDATE	command_settings
+SET	command_id = ?
+WHERE	group_name = ? AND command_id = ?`)
+
+var updateWatchID = newQuery("updating command_watch", `
+UPDATE	command_watch
+SET	command_id = ?
+WHERE	group_name = ? AND command_id = ?`)
+
+// replaceTx swaps the command with instance ID oldID for newCmd, with instance ID newID
+// and process ID pid, in the database.
+func (g *Groups) replaceTx(tx *sql.Tx, groupName, oldID, newID string, pid int, newCmd *exec.Cmd) error {
+	if err := g.deleteCmdsTx(tx, groupName, oldID); err != nil {
+		return errors.Wrap(err, "deleting old command")
+	}
+	if err := g.insertCmd(tx, groupName, newID, pid, newCmd); err != nil {
+		return errors.Wrap(err, "inserting new command")
+	}
+	for _, q := range []query{updateSettingsID, updateWatchID} {
+		if _, err := g.exec(tx, q, newID, groupName, oldID); err != nil {
+			return err
+		}
+	}
+	// The jail and death signal of the old command were moved with its settings.
+	return g.setCmdAttrsTx(tx, groupName, newID, newCmd)
+}
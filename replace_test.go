@@ -0,0 +1,143 @@
+package exec_test
+
+import (
+	"context"
+	"os"
+	osexec "os/exec"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/scgolang/exec"
+)
+
+func TestGroupsReplace(t *testing.T) {
+	var (
+		groupName = "sleepers"
+		root      = filepath.Join("testdata", "."+t.Name())
+	)
+	_ = os.RemoveAll(root)
+
+	var (
+		gs     = newTestGroups(t, root)
+		oldCmd = osexec.Command("sleep", "10")
+		newCmd = osexec.Command("sleep", "20")
+		probed = false
+	)
+	if err := gs.Create(groupName, oldCmd); err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = gs.Remove(groupName) }()
+
+	if err := gs.SetReadinessProbe(groupName, newCmd, exec.ProbeFunc(func(ctx context.Context, cmd *osexec.Cmd) error {
+		if !probed {
+			probed = true
+			return errors.New("not ready yet")
+		}
+		return nil
+	})); err != nil {
+		t.Fatal(err)
+	}
+	if err := gs.Replace(groupName, getCommandID(oldCmd, t), newCmd); err != nil {
+		t.Fatal(err)
+	}
+	if !probed {
+		t.Fatal("expected readiness probe to be called")
+	}
+	cmds, ok := gs.Commands(groupName)
+	if !ok {
+		t.Fatal("group does not exist")
+	}
+	if expected, got := 1, len(cmds); expected != got {
+		t.Fatalf("expected %d commands, got %d", expected, got)
+	}
+	if expected, got := newCmd, cmds[0]; expected != got {
+		t.Fatalf("expected %v, got %v", expected.Args, got.Args)
+	}
+	if oldCmd.ProcessState == nil {
+		t.Fatal("expected old command to have exited")
+	}
+}
+
+func TestGroupsReplaceNotReady(t *testing.T) {
+	var (
+		groupName = "sleepers"
+		root      = filepath.Join("testdata", "."+t.Name())
+	)
+	_ = os.RemoveAll(root)
+
+	var (
+		gs     = newTestGroups(t, root)
+		oldCmd = osexec.Command("sleep", "10")
+		newCmd = osexec.Command("false")
+	)
+	if err := gs.Create(groupName, oldCmd); err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = gs.Remove(groupName) }()
+
+	if err := gs.SetReadinessProbe(groupName, newCmd, exec.ProbeFunc(func(ctx context.Context, cmd *osexec.Cmd) error {
+		return errors.New("never ready")
+	})); err != nil {
+		t.Fatal(err)
+	}
+	if err := gs.Replace(groupName, getCommandID(oldCmd, t), newCmd); err == nil {
+		t.Fatal("expected an error, got nil")
+	}
+	cmds, ok := gs.Commands(groupName)
+	if !ok {
+		t.Fatal("group does not exist")
+	}
+	if expected, got := 1, len(cmds); expected != got {
+		t.Fatalf("expected %d commands, got %d", expected, got)
+	}
+	if expected, got := oldCmd, cmds[0]; expected != got {
+		t.Fatalf("expected %v, got %v", expected.Args, got.Args)
+	}
+}
+
+func TestGroupsUpdateCanaryRollback(t *testing.T) {
+	var (
+		groupName = "sleepers"
+		root      = filepath.Join("testdata", "."+t.Name())
+	)
+	_ = os.RemoveAll(root)
+
+	var (
+		gs   = newTestGroups(t, root)
+		olds = []*osexec.Cmd{
+			osexec.Command("sleep", "10"),
+			osexec.Command("sleep", "11"),
+		}
+		news = []*osexec.Cmd{
+			osexec.Command("sleep", "0.1"),
+			osexec.Command("sleep", "0.2"),
+		}
+	)
+	if err := gs.Create(groupName, olds...); err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = gs.Remove(groupName) }()
+
+	cmdIDs := []string{getCommandID(olds[0], t), getCommandID(olds[1], t)}
+
+	if err := gs.Update(groupName, cmdIDs, news, exec.UpdateOptions{Canary: true, Bake: time.Second}); err == nil {
+		t.Fatal("expected an error, got nil")
+	}
+	cmds, ok := gs.Commands(groupName)
+	if !ok {
+		t.Fatal("group does not exist")
+	}
+	if expected, got := 2, len(cmds); expected != got {
+		t.Fatalf("expected %d commands, got %d", expected, got)
+	}
+	for _, cmd := range cmds {
+		if cid := getCommandID(cmd, t); cid != cmdIDs[0] && cid != cmdIDs[1] {
+			t.Fatalf("unexpected command %v", cmd.Args)
+		}
+	}
+	if news[1].Process != nil {
+		t.Fatal("expected second replica not to be replaced")
+	}
+}
@@ -0,0 +1,95 @@
+package exec
+
+import (
+	"context"
+	"os/exec"
+	"syscall"
+
+	"github.com/pkg/errors"
+)
+
+var updateProcessID = newQuery("updating process ID", `
+UPDATE	processes
+SET	process_id = ?
+WHERE	group_name = ? AND instance_id = ?`)
+
+// restart gracefully stops the running instance of a command
+// and starts a fresh copy of it in its place.
+func (g *Groups) restart(groupName, commandID string) error {
+	if g.handingOff() {
+		return nil // The new image of the manager watches the command's files again.
+	}
+	grp := g.getGroup(groupName)
+	if grp == nil {
+		return errors.Errorf("group %s not found", groupName)
+	}
+	old := grp.lookup(commandID)
+	if old == nil {
+		return errors.Errorf("command %s not found in group %s", commandID, groupName)
+	}
+	instanceID, _ := grp.ID(old)
+	grp.replace(old)
+
+	if err := grp.stop(old, grp.stopSignalOf(old, syscall.SIGTERM), g.timeouts().Stop); err != nil {
+		return errors.Wrap(err, "stopping command")
+	}
+	cmd := cloneCmd(old)
+
+	if err := g.start(cmd, groupName, grp, old, ""); err != nil {
+		return errors.Wrap(err, "starting command")
+	}
+	if grp.ephemeral {
+		return nil
+	}
+	_, err := g.exec(nil, updateProcessID, grp.pid(cmd), groupName, instanceID)
+	return err
+}
+
+// cloneCmd returns a new, unstarted command with the same definition as cmd.
+func cloneCmd(cmd *exec.Cmd) *exec.Cmd {
+	return &exec.Cmd{
+		Path:        cmd.Path,
+		Args:        append([]string{}, cmd.Args...),
+		Env:         append([]string(nil), cmd.Env...),
+		Dir:         cmd.Dir,
+		SysProcAttr: cmd.SysProcAttr,
+	}
+}
+
+// Restart restarts the running commands of a group one at a time, so that a
+// service made of several processes is never down entirely. Each command is
+// gracefully stopped and a fresh copy of it started, and the next command is
+// only restarted once the copy is running and has passed its readiness probe,
+// if it has one, see SetReadinessProbe. Commands that are not running are
+// left alone. Restart stops at the first command that fails to restart or
+// to become ready within Timeouts.Ready, and returns the error. Paused groups,
+// see Pause, can not be restarted, since their commands would never be ready.
+func (g *Groups) Restart(groupName string) error {
+	grp := g.getGroup(groupName)
+	if grp == nil {
+		return errors.Errorf("group %s not found", groupName)
+	}
+	if grp.isPaused() {
+		return errors.Errorf("group %s is paused", groupName)
+	}
+	for _, cmd := range grp.Commands() {
+		if grp.State(cmd) != StateRunning {
+			continue
+		}
+		commandID, ok := grp.ID(cmd)
+		if !ok {
+			continue // Removed in the meantime.
+		}
+		if err := g.restart(groupName, commandID); err != nil {
+			return errors.Wrapf(err, "restarting %s", commandID)
+		}
+		next := grp.lookup(commandID)
+		if next == nil {
+			return errors.Errorf("command %s was removed while it was restarted", commandID)
+		}
+		if err := g.startReady(context.Background(), groupName, grp, next); err != nil {
+			return errors.Wrapf(err, "restarting %s", commandID)
+		}
+	}
+	return nil
+}
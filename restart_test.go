@@ -0,0 +1,69 @@
+package exec_test
+
+import (
+	"os"
+	osexec "os/exec"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/scgolang/exec"
+)
+
+func TestGroupsRestart(t *testing.T) {
+	var (
+		groupName = "service"
+		root      = filepath.Join("testdata", "."+t.Name())
+	)
+	_ = os.RemoveAll(root)
+
+	var (
+		gs   = newTestGroups(t, root)
+		cmds = []*osexec.Cmd{
+			osexec.Command("sleep", "10"),
+			osexec.Command("sleep", "11"),
+			osexec.Command("true"),
+		}
+	)
+	if err := gs.Create(groupName, cmds...); err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = gs.Remove(groupName) }()
+
+	exitedID, _ := gs.CmdID(groupName, cmds[2])
+	for {
+		statuses, err := gs.Statuses(groupName)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if statuses[exitedID].State == exec.StateExited {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	before, err := gs.Statuses(groupName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := gs.Restart(groupName); err != nil {
+		t.Fatal(err)
+	}
+	after, err := gs.Statuses(groupName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for id, status := range after {
+		if id == exitedID {
+			if status.Restarts != 0 {
+				t.Fatalf("expected a command that is not running to be left alone, got %+v", status)
+			}
+			continue
+		}
+		if status.State != exec.StateRunning || status.Restarts != 1 || status.PID == before[id].PID {
+			t.Fatalf("expected %s to be running a new process after one restart, got %+v", id, status)
+		}
+	}
+	if err := gs.Restart("nope"); err == nil {
+		t.Fatal("expected an error, got nil")
+	}
+}
@@ -0,0 +1,379 @@
+package exec
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"math/rand"
+	"os/exec"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// RestartMode decides which exits of a command restart it, see RestartPolicy.
+type RestartMode int
+
+// Restart modes.
+const (
+	// RestartNever leaves a command that exits out of the group. It is the default.
+	RestartNever RestartMode = iota
+
+	// RestartOnFailure restarts a command that fails.
+	RestartOnFailure
+
+	// RestartAlways restarts a command whenever it exits.
+	RestartAlways
+)
+
+// RestartPolicy restarts a command that exits, see SetRestartPolicy.
+type RestartPolicy struct {
+	Mode RestartMode `json:"mode"`
+
+	// Backoff is how long to wait before the first restart. It doubles
+	// with every restart after that, up to MaxBackoff if it is not zero.
+	Backoff    time.Duration `json:"backoff,omitempty"`
+	MaxBackoff time.Duration `json:"max_backoff,omitempty"`
+
+	// Jitter, between 0 and 1, is the largest fraction of the backoff that
+	// is randomly added to or taken from it, so that commands which exit
+	// together are not all restarted at the same time.
+	Jitter float64 `json:"jitter,omitempty"`
+
+	// ResetAfter, if not zero, is how long a command has to run for the
+	// backoff to start over from Backoff when it exits.
+	ResetAfter time.Duration `json:"reset_after,omitempty"`
+
+	// MaxRestarts, if not zero, is how many times the command is restarted
+	// before the policy gives up on it.
+	MaxRestarts int `json:"max_restarts,omitempty"`
+
+	// FailureLimit and FailureWindow, if not zero, break crash loops: once
+	// the command has failed FailureLimit times within FailureWindow the
+	// policy gives up on it.
+	FailureLimit  int           `json:"failure_limit,omitempty"`
+	FailureWindow time.Duration `json:"failure_window,omitempty"`
+}
+
+// validate returns an error if the policy can not be applied.
+func (p RestartPolicy) validate() error {
+	if p.Mode < RestartNever || p.Mode > RestartAlways {
+		return errors.Errorf("invalid restart mode %d", p.Mode)
+	}
+	if p.Backoff < 0 || p.MaxBackoff < 0 || p.ResetAfter < 0 {
+		return errors.New("backoff must not be negative")
+	}
+	if p.Jitter < 0 || p.Jitter > 1 {
+		return errors.Errorf("jitter must be between 0 and 1, got %g", p.Jitter)
+	}
+	if p.MaxRestarts < 0 || p.FailureLimit < 0 || p.FailureWindow < 0 {
+		return errors.New("restart limits must not be negative")
+	}
+	if (p.FailureLimit == 0) != (p.FailureWindow == 0) {
+		return errors.New("failure limit and failure window must be set together")
+	}
+	return nil
+}
+
+// restarts returns true if a command that exited with err is restarted.
+func (p RestartPolicy) restarts(err error) bool {
+	switch p.Mode {
+	case RestartAlways:
+		return true
+	case RestartOnFailure:
+		return err != nil
+	}
+	return false
+}
+
+// backoff returns how long to wait before a restart, given the number of
+// restarts before it since the backoff was last reset. r is a random number
+// in [0, 1) that the jitter is taken from.
+func (p RestartPolicy) backoff(restarts int, r float64) time.Duration {
+	backoff := p.Backoff
+	for i := 0; i < restarts && (p.MaxBackoff == 0 || backoff < p.MaxBackoff); i++ {
+		backoff *= 2
+	}
+	if p.MaxBackoff > 0 && backoff > p.MaxBackoff {
+		backoff = p.MaxBackoff
+	}
+	return backoff + time.Duration(float64(backoff)*p.Jitter*(2*r-1))
+}
+
+// giveUp returns why the policy gives up on a command that has been
+// restarted total times and has failed at the provided times within the
+// failure window, or an empty string if it does not.
+func (p RestartPolicy) giveUp(total int, failures []time.Time) string {
+	if p.MaxRestarts > 0 && total >= p.MaxRestarts {
+		return fmt.Sprintf("restarted %d times", total)
+	}
+	if p.FailureLimit > 0 && len(failures) >= p.FailureLimit {
+		return fmt.Sprintf("failed %d times within %s", len(failures), p.FailureWindow)
+	}
+	return ""
+}
+
+// relaunch is the restart state of a command with a restart policy.
+type relaunch struct {
+	// restarts is the number of restarts since the backoff was last reset,
+	// and total is the number of restarts since the command was started.
+	restarts int
+	total    int
+
+	// failures are the times of the failures of the command within the failure window.
+	failures []time.Time
+
+	// gaveUp is why the policy gave up on the command, if it did.
+	gaveUp string
+
+	// pending, if not nil, is closed to cancel a restart that is waiting out its backoff.
+	pending chan struct{}
+}
+
+// SetRestartPolicy sets the policy that restarts a command when it exits,
+// which applies to the commands started after it is set, such as by Create.
+// A command that is restarted keeps its instance ID, the restart is counted
+// in its status, and every run is recorded in the run history of the group.
+// While it waits out its backoff the command is restarting, and its exit is
+// not reported to Wait. Commands are not restarted after Close, Remove, or
+// StopCommand. Once the policy gives up on a command, because of MaxRestarts
+// or because it crash loops, its last exit is reported and it stays exited or
+// failed, with the reason in its status, until it is started again.
+// Restart policies are persisted with the command, so they apply again when
+// its group is opened.
+func (g *Groups) SetRestartPolicy(groupName string, cmd *exec.Cmd, policy RestartPolicy) error {
+	if err := policy.validate(); err != nil {
+		return err
+	}
+	commandID, err := GetCmdID(cmd)
+	if err != nil {
+		return errors.Wrap(err, "getting command ID")
+	}
+	g.setRestartPolicy(groupName, commandID, policy)
+
+	// Commands that have not been created yet store it when they are.
+	instanceID, ok := g.CmdID(groupName, cmd)
+	if !ok {
+		return nil
+	}
+	tx, err := g.db.Begin()
+	if err != nil {
+		return errors.Wrap(err, "starting transaction")
+	}
+	if err := g.setCmdRestartPolicyTx(tx, groupName, instanceID, policy); err != nil {
+		_ = tx.Rollback()
+		return err
+	}
+	return errors.Wrap(tx.Commit(), "committing transaction")
+}
+
+// setCmdRestartPolicyTx stores the restart policy of a command, or deletes it if its mode is RestartNever.
+func (g *Groups) setCmdRestartPolicyTx(tx *sql.Tx, groupName, commandID string, policy RestartPolicy) error {
+	if policy.Mode == RestartNever {
+		_, err := g.exec(tx, deleteCommandSetting, groupName, commandID, settingRestartPolicy)
+		return errors.Wrap(err, settingRestartPolicy)
+	}
+	value, err := json.Marshal(policy)
+	if err != nil {
+		return errors.Wrap(err, "encoding restart policy")
+	}
+	return g.setCmdSettingTx(tx, groupName, commandID, settingRestartPolicy, string(value))
+}
+
+// setRestartPolicy sets the restart policy of the commands with the provided
+// content hash, removing it if its mode is RestartNever.
+func (g *Groups) setRestartPolicy(groupName, commandID string, policy RestartPolicy) {
+	g.probesMu.Lock()
+	defer g.probesMu.Unlock()
+
+	if g.restartPolicies[groupName] == nil {
+		g.restartPolicies[groupName] = map[string]RestartPolicy{}
+	}
+	if policy.Mode == RestartNever {
+		delete(g.restartPolicies[groupName], commandID)
+	} else {
+		g.restartPolicies[groupName][commandID] = policy
+	}
+}
+
+// restoreRestartPolicy sets the restart policy of a command of an opened group from its settings.
+func (g *Groups) restoreRestartPolicy(groupName string, cmd *exec.Cmd, settings map[string]string) error {
+	value, ok := settings[settingRestartPolicy]
+	if !ok {
+		return nil
+	}
+	var policy RestartPolicy
+	if err := json.Unmarshal([]byte(value), &policy); err != nil {
+		return errors.Wrap(err, "parsing restart policy")
+	}
+	commandID, err := GetCmdID(cmd)
+	if err != nil {
+		return errors.Wrap(err, "getting command ID")
+	}
+	g.setRestartPolicy(groupName, commandID, policy)
+	return nil
+}
+
+// restartPolicy returns the restart policy of cmd.
+func (g *Groups) restartPolicy(groupName string, cmd *exec.Cmd) RestartPolicy {
+	hash, err := GetCmdID(cmd)
+	if err != nil {
+		return RestartPolicy{}
+	}
+	g.probesMu.Lock()
+	defer g.probesMu.Unlock()
+	return g.restartPolicies[groupName][hash]
+}
+
+// relaunch decides whether cmd, which exited with err, is restarted according
+// to its restart policy, and if it is, restarts it once its backoff is over.
+func (g *Groups) relaunch(groupName string, grp *Group, cmd *exec.Cmd, err error) bool {
+	if g.handingOff() {
+		return false // The new image of the manager reports the command as failed.
+	}
+	policy := g.restartPolicy(groupName, cmd)
+	if !policy.restarts(err) {
+		return false
+	}
+	commandID, ok := grp.ID(cmd)
+	if !ok {
+		return false
+	}
+	g.relaunchesMu.Lock()
+	if g.relaunches[groupName] == nil {
+		g.relaunches[groupName] = map[string]*relaunch{}
+	}
+	r := g.relaunches[groupName][commandID]
+	if r == nil {
+		r = &relaunch{}
+		g.relaunches[groupName][commandID] = r
+	}
+	now := g.clock.Now()
+	if policy.ResetAfter > 0 && now.Sub(grp.startedAt(commandID)) >= policy.ResetAfter {
+		r.restarts = 0
+	}
+	if err != nil && policy.FailureLimit > 0 {
+		r.failures = append(r.failures, now)
+		for len(r.failures) > 0 && now.Sub(r.failures[0]) > policy.FailureWindow {
+			r.failures = r.failures[1:]
+		}
+	}
+	if r.gaveUp = policy.giveUp(r.total, r.failures); r.gaveUp != "" {
+		g.relaunchesMu.Unlock()
+		g.logf("not restarting %s in group %s: %s", commandID, groupName, r.gaveUp)
+		return false
+	}
+	var (
+		backoff = policy.backoff(r.restarts, rand.Float64())
+		pending = make(chan struct{})
+	)
+	r.restarts++
+	r.total++
+	r.pending = pending
+	g.relaunchesMu.Unlock()
+
+	grp.setState(cmd, StateRestarting, nil)
+
+	go func() {
+		select {
+		case <-pending:
+		case <-g.clock.After(backoff):
+		}
+		if !g.takeRelaunch(groupName, commandID, pending) {
+			// Cancelled, so the exit is reported after all.
+			if grp.lookup(commandID) == cmd {
+				grp.report(cmd, err)
+			}
+			return
+		}
+		if grp.lookup(commandID) != cmd {
+			return // Restarted some other way in the meantime.
+		}
+		next := cloneCmd(cmd)
+
+		if serr := g.start(next, groupName, grp, cmd, ""); serr != nil {
+			g.logf("restarting %s in group %s: %s", commandID, groupName, serr)
+			grp.setState(cmd, StateFailed, serr)
+			grp.report(cmd, serr)
+			return
+		}
+		if grp.ephemeral {
+			return
+		}
+		if _, uerr := g.exec(nil, updateProcessID, grp.pid(next), groupName, commandID); uerr != nil {
+			g.logf("restarting %s in group %s: %s", commandID, groupName, uerr)
+		}
+	}()
+	return true
+}
+
+// gaveUp returns why the restart policy of a command gave up on it,
+// or an empty string if it did not.
+func (g *Groups) gaveUp(groupName, commandID string) string {
+	g.relaunchesMu.Lock()
+	defer g.relaunchesMu.Unlock()
+
+	if r := g.relaunches[groupName][commandID]; r != nil {
+		return r.gaveUp
+	}
+	return ""
+}
+
+// forgiveRelaunch forgets the restart state of a command that the restart
+// policy gave up on, since it has been started again some other way.
+func (g *Groups) forgiveRelaunch(groupName, commandID string) {
+	g.relaunchesMu.Lock()
+	defer g.relaunchesMu.Unlock()
+
+	if r := g.relaunches[groupName][commandID]; r != nil && r.gaveUp != "" {
+		delete(g.relaunches[groupName], commandID)
+	}
+}
+
+// takeRelaunch returns true if the restart of a command is still pending,
+// in which case it is not any more.
+func (g *Groups) takeRelaunch(groupName, commandID string, pending chan struct{}) bool {
+	g.relaunchesMu.Lock()
+	defer g.relaunchesMu.Unlock()
+
+	r := g.relaunches[groupName][commandID]
+	if r == nil || r.pending != pending {
+		return false
+	}
+	r.pending = nil
+	return true
+}
+
+// cancelRelaunches cancels the pending restarts of commands in a group,
+// or of every command in the group if no command IDs are provided,
+// and forgets their restart state.
+func (g *Groups) cancelRelaunches(groupName string, commandIDs ...string) {
+	g.relaunchesMu.Lock()
+	defer g.relaunchesMu.Unlock()
+
+	relaunches := g.relaunches[groupName]
+	if len(commandIDs) == 0 {
+		delete(g.relaunches, groupName)
+	} else {
+		m := map[string]*relaunch{}
+		for _, commandID := range commandIDs {
+			if r, ok := relaunches[commandID]; ok {
+				m[commandID] = r
+				delete(relaunches, commandID)
+			}
+		}
+		relaunches = m
+	}
+	for _, r := range relaunches {
+		if r.pending != nil {
+			close(r.pending)
+		}
+	}
+}
+
+// startedAt returns when the command with the provided instance ID was last started.
+func (g *Group) startedAt(commandID string) time.Time {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	return g.started[commandID]
+}
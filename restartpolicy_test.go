@@ -0,0 +1,151 @@
+package exec_test
+
+import (
+	"os"
+	osexec "os/exec"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/scgolang/exec"
+)
+
+func TestGroupsRestartPolicy(t *testing.T) {
+	var (
+		groupName = "crashy"
+		root      = filepath.Join("testdata", "."+t.Name())
+	)
+	_ = os.RemoveAll(root)
+
+	var (
+		gs      = newTestGroups(t, root)
+		crashes = osexec.Command("false")
+		exits   = osexec.Command("true")
+		policy  = exec.RestartPolicy{Mode: exec.RestartOnFailure, Backoff: 10 * time.Millisecond, Jitter: 0.5}
+	)
+	if err := gs.SetRestartPolicy(groupName, crashes, policy); err != nil {
+		t.Fatal(err)
+	}
+	if err := gs.SetRestartPolicy(groupName, exits, policy); err != nil {
+		t.Fatal(err)
+	}
+	if err := gs.Create(groupName, crashes, exits); err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = gs.Remove(groupName) }()
+
+	var (
+		crashesID, _ = gs.CmdID(groupName, crashes)
+		exitsID, _   = gs.CmdID(groupName, exits)
+		deadline     = time.Now().Add(5 * time.Second)
+	)
+	for {
+		statuses, err := gs.Statuses(groupName)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if statuses[crashesID].Restarts >= 2 {
+			if statuses[exitsID].Restarts != 0 || statuses[exitsID].State != exec.StateExited {
+				t.Fatalf("expected a command that exited successfully not to be restarted, got %+v", statuses[exitsID])
+			}
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("timeout waiting for restarts, got %+v", statuses[crashesID])
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if err := gs.SetRestartPolicy(groupName, crashes, exec.RestartPolicy{Mode: exec.RestartAlways, Jitter: 2}); err == nil {
+		t.Fatal("expected an error, got nil")
+	}
+}
+
+func TestGroupsRestartPolicyGivesUp(t *testing.T) {
+	var (
+		groupName = "crashloop"
+		root      = filepath.Join("testdata", "."+t.Name())
+	)
+	_ = os.RemoveAll(root)
+
+	var (
+		gs      = newTestGroups(t, root)
+		limited = osexec.Command("false")
+		looping = osexec.Command("sh", "-c", "exit 3")
+	)
+	if err := gs.SetRestartPolicy(groupName, limited, exec.RestartPolicy{Mode: exec.RestartOnFailure, MaxRestarts: 3}); err != nil {
+		t.Fatal(err)
+	}
+	if err := gs.SetRestartPolicy(groupName, looping, exec.RestartPolicy{Mode: exec.RestartOnFailure, FailureLimit: 2, FailureWindow: time.Minute}); err != nil {
+		t.Fatal(err)
+	}
+	if err := gs.Create(groupName, limited, looping); err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = gs.Remove(groupName) }()
+
+	for range []*osexec.Cmd{limited, looping} {
+		if err := gs.Wait(groupName); err == nil {
+			t.Fatal("expected an error, got nil")
+		}
+	}
+	statuses, err := gs.Statuses(groupName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var (
+		limitedID, _ = gs.CmdID(groupName, limited)
+		loopingID, _ = gs.CmdID(groupName, looping)
+	)
+	for id, restarts := range map[string]int{limitedID: 3, loopingID: 1} {
+		status := statuses[id]
+		if status.State != exec.StateFailed || status.Restarts != restarts || status.GaveUp == "" {
+			t.Fatalf("expected a failed command restarted %d times that was given up on, got %+v", restarts, status)
+		}
+	}
+	if err := gs.SetRestartPolicy(groupName, looping, exec.RestartPolicy{Mode: exec.RestartOnFailure, FailureLimit: 2}); err == nil {
+		t.Fatal("expected an error, got nil")
+	}
+}
+
+func TestGroupsRestartPolicyPersisted(t *testing.T) {
+	var (
+		groupName = "crashy"
+		root      = filepath.Join("testdata", "."+t.Name())
+	)
+	_ = os.RemoveAll(root)
+
+	var (
+		gs     = newTestGroups(t, root)
+		cmd    = osexec.Command("false")
+		policy = exec.RestartPolicy{Mode: exec.RestartOnFailure, Backoff: 10 * time.Millisecond, MaxRestarts: 2}
+	)
+	if err := gs.SetRestartPolicy(groupName, cmd, policy); err != nil {
+		t.Fatal(err)
+	}
+	if err := gs.Create(groupName, cmd); err != nil {
+		t.Fatal(err)
+	}
+	if err := gs.Wait(groupName); err == nil {
+		t.Fatal("expected an error, got nil")
+	}
+	_ = gs.Close(groupName)
+
+	// The policy is restored when the group is opened by another Groups.
+	reopened := newTestGroups(t, root)
+	if _, err := reopened.Open(groupName); err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = reopened.Remove(groupName) }()
+
+	if err := reopened.Wait(groupName); err == nil {
+		t.Fatal("expected an error, got nil")
+	}
+	statuses, err := reopened.Statuses(groupName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cmdID, _ := reopened.CmdID(groupName, cmd)
+	if status := statuses[cmdID]; status.Restarts != 2 || status.GaveUp == "" {
+		t.Fatalf("expected the opened command to be restarted 2 times, got %+v", status)
+	}
+}
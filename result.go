@@ -0,0 +1,95 @@
+package exec
+
+import (
+	"os"
+	"os/exec"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// ExitResult describes how a command exited.
+type ExitResult struct {
+	// ExitCode is the exit code of the process,
+	// or -1 if it was terminated by a signal.
+	ExitCode int
+
+	// ProcessState is the state of the exited process.
+	// Its SysUsage method returns the resource usage of the process.
+	ProcessState *os.ProcessState
+
+	Started  time.Time
+	Exited   time.Time
+	Duration time.Duration
+
+	// Err is the error returned by waiting for the command, if any.
+	Err error
+}
+
+// recordExit records the exit result of cmd, and returns it with the
+// instance ID of cmd. It returns false if cmd is not in the group.
+func (g *Group) recordExit(cmd *exec.Cmd, err error) (string, ExitResult, bool) {
+	now := g.clock.Now()
+
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	id, ok := g.ids[cmd]
+	if !ok {
+		return "", ExitResult{}, false
+	}
+	result := exitResult(cmd, err, g.started[id], now)
+	g.results[id] = result
+	return id, result, true
+}
+
+// exitResult returns how cmd exited, given the error returned by waiting for it.
+func exitResult(cmd *exec.Cmd, err error, started, exited time.Time) ExitResult {
+	result := ExitResult{
+		ExitCode:     -1,
+		ProcessState: cmd.ProcessState,
+		Started:      started,
+		Exited:       exited,
+		Duration:     exited.Sub(started),
+		Err:          err,
+	}
+	if cmd.ProcessState != nil {
+		result.ExitCode = cmd.ProcessState.ExitCode()
+	} else if err == nil {
+		result.ExitCode = 0
+	} else if ec, ok := err.(interface{ ExitCode() int }); ok {
+		result.ExitCode = ec.ExitCode()
+	}
+	return result
+}
+
+// ExitResult returns how the provided command last exited.
+// It returns false if the command has not exited.
+func (g *Group) ExitResult(cmd *exec.Cmd) (ExitResult, bool) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	id, ok := g.idLocked(cmd)
+	if !ok {
+		return ExitResult{}, false
+	}
+	result, ok := g.results[id]
+	return result, ok
+}
+
+// ExitResults returns how the commands in an open group last exited, keyed by instance ID.
+// Commands that have not exited are left out.
+func (g *Groups) ExitResults(groupName string) (map[string]ExitResult, error) {
+	grp := g.getGroup(groupName)
+	if grp == nil {
+		return nil, errors.Errorf("group %s not found", groupName)
+	}
+	grp.mu.Lock()
+	defer grp.mu.Unlock()
+
+	results := make(map[string]ExitResult, len(grp.results))
+	for id, result := range grp.results {
+		results[id] = result
+	}
+	return results, nil
+}
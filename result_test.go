@@ -0,0 +1,48 @@
+package exec_test
+
+import (
+	"os"
+	osexec "os/exec"
+	"path/filepath"
+	"testing"
+)
+
+func TestGroupsExitResults(t *testing.T) {
+	var (
+		groupName = "exiters"
+		root      = filepath.Join("testdata", "."+t.Name())
+	)
+	_ = os.RemoveAll(root)
+
+	var (
+		gs  = newTestGroups(t, root)
+		cmd = osexec.Command("sh", "-c", "exit 3")
+	)
+	if err := gs.Create(groupName, cmd); err != nil {
+		t.Fatal(err)
+	}
+	if err := gs.Wait(groupName); err == nil {
+		t.Fatal("expected an error, got nil")
+	}
+	results, err := gs.ExitResults(groupName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	id, _ := gs.CmdID(groupName, cmd)
+	result, ok := results[id]
+	if !ok {
+		t.Fatalf("expected an exit result for %s, got %v", id, results)
+	}
+	if expected, got := 3, result.ExitCode; expected != got {
+		t.Fatalf("expected exit code %d, got %d", expected, got)
+	}
+	if result.ProcessState == nil {
+		t.Fatal("expected a process state")
+	}
+	if result.Err == nil {
+		t.Fatal("expected an error, got nil")
+	}
+	if result.Duration <= 0 {
+		t.Fatalf("expected a positive duration, got %s", result.Duration)
+	}
+}
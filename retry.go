@@ -0,0 +1,68 @@
+package exec
+
+import (
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// RetryPolicy decides whether a job that failed is run again, see WithRetry.
+type RetryPolicy struct {
+	// MaxAttempts is how many times the job runs at most, including the first time.
+	// Zero or one means the job is not retried.
+	MaxAttempts int
+
+	// Backoff is how long to wait before the second attempt. It doubles with
+	// every attempt after that, up to MaxBackoff if it is not zero.
+	Backoff    time.Duration
+	MaxBackoff time.Duration
+
+	// RetryOn has the exit codes that are retried.
+	// If it is empty every failure is retried, including failures to start.
+	RetryOn []int
+}
+
+// WithRetry runs a job again if it fails, as decided by policy.
+// Every attempt is recorded in the run history of the group.
+func WithRetry(policy RetryPolicy) JobOption {
+	return func(job *Job) error {
+		if policy.MaxAttempts < 0 {
+			return errors.Errorf("max attempts must not be negative, got %d", policy.MaxAttempts)
+		}
+		if policy.Backoff < 0 || policy.MaxBackoff < 0 {
+			return errors.New("backoff must not be negative")
+		}
+		job.retry = policy
+		return nil
+	}
+}
+
+// next returns how long to wait before the next attempt of a job, given
+// the number of attempts so far and how the last one exited.
+// It returns false if the job should not be retried.
+func (p RetryPolicy) next(attempts int, result ExitResult) (time.Duration, bool) {
+	if result.Err == nil || attempts >= p.MaxAttempts || !p.retries(result.ExitCode) {
+		return 0, false
+	}
+	backoff := p.Backoff
+	for i := 1; i < attempts && (p.MaxBackoff == 0 || backoff < p.MaxBackoff); i++ {
+		backoff *= 2
+	}
+	if p.MaxBackoff > 0 && backoff > p.MaxBackoff {
+		backoff = p.MaxBackoff
+	}
+	return backoff, true
+}
+
+// retries returns true if a failure with the provided exit code is retried.
+func (p RetryPolicy) retries(exitCode int) bool {
+	if len(p.RetryOn) == 0 {
+		return true
+	}
+	for _, code := range p.RetryOn {
+		if code == exitCode {
+			return true
+		}
+	}
+	return false
+}
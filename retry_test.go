@@ -0,0 +1,87 @@
+package exec_test
+
+import (
+	"os"
+	osexec "os/exec"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/scgolang/exec"
+)
+
+func TestGroupsEnqueueRetry(t *testing.T) {
+	root := filepath.Join("testdata", "."+t.Name())
+	_ = os.RemoveAll(root)
+
+	gs := newTestGroups(t, root)
+
+	count, err := filepath.Abs(filepath.Join(root, "count"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Fails with exit code 3 twice, then succeeds.
+	script := "n=$(cat " + count + " 2>/dev/null || echo 0); n=$((n+1)); echo $n > " + count + "; [ $n -ge 3 ] || exit 3"
+
+	job, err := gs.Enqueue("jobs", osexec.Command("sh", "-c", script), exec.WithRetry(exec.RetryPolicy{
+		MaxAttempts: 5,
+		Backoff:     10 * time.Millisecond,
+		RetryOn:     []int{3},
+	}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := job.Wait(); err != nil {
+		t.Fatal(err)
+	}
+	if expected, got := 3, job.Attempts(); expected != got {
+		t.Fatalf("expected %d attempts, got %d", expected, got)
+	}
+	runs, err := gs.Runs("jobs")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected, got := 3, len(runs); expected != got {
+		t.Fatalf("expected %d runs, got %d", expected, got)
+	}
+	for i, expected := range []exec.State{exec.StateFailed, exec.StateFailed, exec.StateExited} {
+		if got := runs[i].State; expected != got {
+			t.Fatalf("expected run %d to be %s, got %s", i, expected, got)
+		}
+		if expected, got := job.ID, runs[i].CommandID; expected != got {
+			t.Fatalf("expected command ID %s, got %s", expected, got)
+		}
+	}
+}
+
+func TestGroupsEnqueueRetryBudget(t *testing.T) {
+	root := filepath.Join("testdata", "."+t.Name())
+	_ = os.RemoveAll(root)
+
+	gs := newTestGroups(t, root)
+
+	for _, c := range []struct {
+		script   string
+		attempts int
+	}{
+		{script: "exit 3", attempts: 2},
+		{script: "exit 1", attempts: 1}, // Not in RetryOn.
+	} {
+		job, err := gs.Enqueue("jobs", osexec.Command("sh", "-c", c.script), exec.WithRetry(exec.RetryPolicy{
+			MaxAttempts: 2,
+			RetryOn:     []int{3},
+		}))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := job.Wait(); err == nil {
+			t.Fatal("expected an error, got nil")
+		}
+		if expected, got := c.attempts, job.Attempts(); expected != got {
+			t.Fatalf("%s: expected %d attempts, got %d", c.script, expected, got)
+		}
+	}
+	if _, err := gs.Enqueue("jobs", osexec.Command("true"), exec.WithRetry(exec.RetryPolicy{MaxAttempts: -1})); err == nil {
+		t.Fatal("expected an error, got nil")
+	}
+}
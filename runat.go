@@ -0,0 +1,157 @@
+package exec
+
+import (
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// ScheduledRun is a single future run of a stored command, see RunAt.
+type ScheduledRun struct {
+	ID    int64
+	Group string
+
+	// CommandID is the instance ID of the command.
+	CommandID string
+
+	// At is when the command runs.
+	At time.Time
+}
+
+var insertScheduledRun = newQuery("inserting scheduled run", `
+INSERT INTO	scheduled_runs (group_name, command_id, run_at)
+VALUES		(?, ?, ?)`)
+
+var deleteScheduledRun = newQuery("deleting scheduled run", `
+DELETE FROM	scheduled_runs
+WHERE		schedule_id = ?`)
+
+var getScheduledRuns = newQuery("getting scheduled runs", `
+SELECT		schedule_id, group_name, command_id, run_at
+FROM		scheduled_runs
+ORDER BY	run_at`)
+
+// RunAt schedules a stored command to run once at t, as a job of its group,
+// see Enqueue. cmdID is the instance ID of the command, its content hash, or
+// its name, see FindCommand. The group does not have to be open.
+// Schedules are persisted and rearmed when Groups is created, and runs that
+// were due while no Groups was running happen as soon as one is created.
+func (g *Groups) RunAt(groupName, cmdID string, t time.Time) (ScheduledRun, error) {
+	info, err := g.FindCommand(groupName, cmdID)
+	if err != nil {
+		return ScheduledRun{}, err
+	}
+	result, err := g.exec(nil, insertScheduledRun, groupName, info.ID, t.UnixNano())
+	if err != nil {
+		return ScheduledRun{}, err
+	}
+	id, err := result.LastInsertId()
+	if err != nil {
+		return ScheduledRun{}, errors.Wrap(err, "getting schedule ID")
+	}
+	run := ScheduledRun{ID: id, Group: groupName, CommandID: info.ID, At: t}
+	g.armRun(run)
+
+	return run, nil
+}
+
+// CancelRun cancels a run that was scheduled with RunAt.
+// It returns an error if the run is not scheduled, for example because it has happened.
+func (g *Groups) CancelRun(id int64) error {
+	g.scheduledMu.Lock()
+	cancel, ok := g.scheduled[id]
+	delete(g.scheduled, id)
+	g.scheduledMu.Unlock()
+
+	if !ok {
+		return errors.Errorf("run %d is not scheduled", id)
+	}
+	close(cancel)
+
+	_, err := g.exec(nil, deleteScheduledRun, id)
+	return err
+}
+
+// ScheduledRuns returns the runs that are scheduled, soonest first.
+func (g *Groups) ScheduledRuns() ([]ScheduledRun, error) {
+	rows, err := g.queryRows(nil, getScheduledRuns)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = rows.Close() }() // Best effort.
+
+	runs := []ScheduledRun{}
+	for rows.Next() {
+		var (
+			run ScheduledRun
+			at  int64
+		)
+		if err := rows.Scan(&run.ID, &run.Group, &run.CommandID, &at); err != nil {
+			return nil, err
+		}
+		run.At = time.Unix(0, at)
+		runs = append(runs, run)
+	}
+	return runs, rows.Err()
+}
+
+// armScheduledRuns arms the runs that are stored in the database.
+func (g *Groups) armScheduledRuns() error {
+	runs, err := g.ScheduledRuns()
+	if err != nil {
+		return err
+	}
+	for _, run := range runs {
+		g.armRun(run)
+	}
+	return nil
+}
+
+// armRun starts a goroutine that enqueues the command of run when it is due,
+// unless it is cancelled first.
+func (g *Groups) armRun(run ScheduledRun) {
+	cancel := make(chan struct{})
+
+	g.scheduledMu.Lock()
+	g.scheduled[run.ID] = cancel
+	g.scheduledMu.Unlock()
+
+	go func() {
+		select {
+		case <-cancel:
+			return
+		case <-g.clock.After(run.At.Sub(g.clock.Now())):
+		}
+		g.scheduledMu.Lock()
+		_, ok := g.scheduled[run.ID]
+		delete(g.scheduled, run.ID)
+		g.scheduledMu.Unlock()
+
+		if !ok {
+			return // Cancelled while it became due.
+		}
+		if err := g.startScheduledRun(run); err != nil {
+			g.logf("running command %s of group %s scheduled for %s: %s", run.CommandID, run.Group, run.At, err)
+		}
+	}()
+}
+
+// startScheduledRun removes a run from the database and enqueues its command.
+// The run is removed even if its command no longer exists.
+func (g *Groups) startScheduledRun(run ScheduledRun) error {
+	if _, err := g.exec(nil, deleteScheduledRun, run.ID); err != nil {
+		return err
+	}
+	tx, err := g.db.Begin()
+	if err != nil {
+		return errors.Wrap(err, "starting transaction")
+	}
+	cmd, _, err := g.getStoredCmdTx(tx, run.Group, run.CommandID)
+	_ = tx.Rollback() // Read only.
+
+	if err != nil {
+		return err
+	}
+	_, err = g.Enqueue(run.Group, cmd)
+	return err
+}
@@ -0,0 +1,89 @@
+package exec_test
+
+import (
+	"os"
+	osexec "os/exec"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/scgolang/exec"
+	"github.com/scgolang/exec/exectest"
+)
+
+func TestGroupsRunAt(t *testing.T) {
+	var (
+		groupName = "nightly"
+		root      = filepath.Join("testdata", "."+t.Name())
+		now       = time.Unix(0, 0)
+	)
+	_ = os.RemoveAll(root)
+
+	gs, err := exec.New(root, exec.WithClock(exectest.NewClock(now)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	cmd := osexec.Command("true")
+	if err := gs.Create(groupName, cmd); err != nil {
+		t.Fatal(err)
+	}
+	if err := gs.Wait(groupName); err != nil {
+		t.Fatal(err)
+	}
+	commandID, ok := gs.CmdID(groupName, cmd)
+	if !ok {
+		t.Fatal("command not found")
+	}
+	if _, err := gs.RunAt(groupName, commandID, now.Add(time.Hour)); err != nil {
+		t.Fatal(err)
+	}
+	cancelled, err := gs.RunAt(groupName, commandID, now.Add(2*time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := gs.CancelRun(cancelled.ID); err != nil {
+		t.Fatal(err)
+	}
+	if err := gs.CancelRun(cancelled.ID); err == nil {
+		t.Fatal("expected an error cancelling a run twice")
+	}
+	if _, err := gs.RunAt(groupName, "nope", now); err == nil {
+		t.Fatal("expected an error for a command that does not exist")
+	}
+	// The schedule survives the manager being restarted.
+	clock := exectest.NewClock(now)
+	restarted, err := exec.New(root, exec.WithClock(clock))
+	if err != nil {
+		t.Fatal(err)
+	}
+	scheduled, err := restarted.ScheduledRuns()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected, got := 1, len(scheduled); expected != got {
+		t.Fatalf("expected %d scheduled run, got %d", expected, got)
+	}
+	if expected, got := commandID, scheduled[0].CommandID; expected != got {
+		t.Fatalf("expected command %s, got %s", expected, got)
+	}
+	clock.Advance(time.Hour)
+
+	for deadline := time.Now().Add(5 * time.Second); ; time.Sleep(10 * time.Millisecond) {
+		runs, err := restarted.Runs(groupName)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(runs) == 2 && runs[1].State == exec.StateExited {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("timeout waiting for the scheduled run, got %+v", runs)
+		}
+	}
+	if scheduled, err = restarted.ScheduledRuns(); err != nil {
+		t.Fatal(err)
+	}
+	if expected, got := 0, len(scheduled); expected != got {
+		t.Fatalf("expected %d scheduled runs, got %d", expected, got)
+	}
+}
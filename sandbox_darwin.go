@@ -0,0 +1,31 @@
+//go:build darwin
+// +build darwin
+
+package exec
+
+import "os/exec"
+
+// SandboxExecPath is the path of the sandbox-exec program, see WithSandboxProfile.
+const SandboxExecPath = "/usr/bin/sandbox-exec"
+
+// sandboxExecer is an Execer that starts processes under sandbox-exec.
+type sandboxExecer struct {
+	execer  Execer
+	profile string
+}
+
+// Start starts cmd under sandbox-exec. The path and arguments of cmd are
+// only changed while it is started, so that restarts and the database see
+// the command as it was defined.
+func (e sandboxExecer) Start(cmd *exec.Cmd) (Process, error) {
+	path, args := cmd.Path, cmd.Args
+	defer func() { cmd.Path, cmd.Args = path, args }()
+
+	sandboxArgs := []string{"sandbox-exec", "-p", e.profile, path}
+	if len(args) > 1 {
+		sandboxArgs = append(sandboxArgs, args[1:]...)
+	}
+	cmd.Path, cmd.Args = SandboxExecPath, sandboxArgs
+
+	return e.execer.Start(cmd)
+}
@@ -0,0 +1,47 @@
+//go:build darwin
+// +build darwin
+
+package exec_test
+
+import (
+	"os"
+	osexec "os/exec"
+	"path/filepath"
+	"testing"
+
+	"github.com/scgolang/exec"
+)
+
+func TestGroupsSandboxProfile(t *testing.T) {
+	var (
+		groupName = "sandboxed"
+		root      = filepath.Join("testdata", "."+t.Name())
+	)
+	_ = os.RemoveAll(root)
+
+	gs, err := exec.New(root, exec.WithGroupOptions(exec.WithSandboxProfile(`(version 1) (allow default) (deny file-write* (subpath "/private/tmp"))`)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = gs.Remove(groupName) }() // Best effort.
+
+	echo := osexec.Command("echo", "foo")
+
+	if err := gs.Create(groupName, echo); err != nil {
+		t.Fatal(err)
+	}
+	verifyEchoFoo(gs, groupName, echo, t)
+
+	if expected, got := "echo", echo.Args[0]; expected != got {
+		t.Fatalf("expected the command to keep its arguments, got %s", got)
+	}
+	deniedName := "denied"
+	defer func() { _ = gs.Remove(deniedName) }() // Best effort.
+
+	if err := gs.Create(deniedName, osexec.Command("touch", filepath.Join("/private/tmp", t.Name()))); err != nil {
+		t.Fatal(err)
+	}
+	if err := gs.Wait(deniedName); err == nil {
+		t.Fatal("expected the sandbox to deny writing to /private/tmp")
+	}
+}
@@ -0,0 +1,22 @@
+//go:build !darwin
+// +build !darwin
+
+package exec
+
+import (
+	"os/exec"
+
+	"github.com/pkg/errors"
+)
+
+// sandboxExecer is an Execer that refuses to start processes,
+// since sandbox-exec is only available on macOS.
+type sandboxExecer struct {
+	execer  Execer
+	profile string
+}
+
+// Start returns an error.
+func (e sandboxExecer) Start(cmd *exec.Cmd) (Process, error) {
+	return nil, errors.New("sandbox profiles are only supported on darwin")
+}
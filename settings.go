@@ -0,0 +1,152 @@
+package exec
+
+import (
+	"database/sql"
+	"os/exec"
+	"strconv"
+	"syscall"
+
+	"github.com/pkg/errors"
+)
+
+// Names of per-command settings.
+const (
+	settingReloadSignal  = "reload_signal"
+	settingStopped       = "stopped"
+	settingName          = "name"
+	settingJail          = "jail"
+	settingDeathSignal   = "death_signal"
+	settingStopSignal    = "stop_signal"
+	settingDumpSignal    = "dump_signal"
+	settingStuckAfter    = "stuck_after"
+	settingStuckAction   = "stuck_action"
+	settingBinaryAction  = "binary_action"
+	settingRestartPolicy = "restart_policy"
+)
+
+var getCommandSetting = newQuery("getting command setting", `
+SELECT	value
+FROM	command_settings
+WHERE	group_name = ? AND command_id = ? AND name = ?`)
+
+var insertCommandSetting = newQuery("inserting command setting", `
+INSERT INTO	command_settings (command_id, group_name, name, value)
+VALUES		(?, ?, ?, ?)`)
+
+var deleteCommandSetting = newQuery("deleting command setting", `
+DELETE FROM	command_settings
+WHERE		group_name = ? AND command_id = ? AND name = ?`)
+
+var deleteCommandSettings = newQuery("deleting command settings", `
+DELETE FROM	command_settings
+WHERE		group_name = ? AND command_id = ?`)
+
+var deleteGroupSettings = newQuery("deleting group settings", `
+DELETE FROM	command_settings
+WHERE		group_name = ?`)
+
+// getCmdSetting gets a per-command setting.
+// It returns false if the setting has not been set.
+func (g *Groups) getCmdSetting(groupName, commandID, name string) (string, bool, error) {
+	var value string
+	if err := g.queryRow(nil, getCommandSetting, []interface{}{groupName, commandID, name}, &value); err != nil {
+		if err == sql.ErrNoRows {
+			return "", false, nil
+		}
+		return "", false, errors.Wrap(err, name)
+	}
+	return value, true, nil
+}
+
+// setCmdSetting sets a per-command setting.
+func (g *Groups) setCmdSetting(groupName, commandID, name, value string) error {
+	tx, err := g.db.Begin()
+	if err != nil {
+		return errors.Wrap(err, "starting transaction")
+	}
+	if err := g.setCmdSettingTx(tx, groupName, commandID, name, value); err != nil {
+		_ = tx.Rollback()
+		return err
+	}
+	return errors.Wrap(tx.Commit(), "committing transaction")
+}
+
+// setCmdSettingTx sets a per-command setting using the provided transaction.
+func (g *Groups) setCmdSettingTx(tx *sql.Tx, groupName, commandID, name, value string) error {
+	if _, err := g.exec(tx, deleteCommandSetting, groupName, commandID, name); err != nil {
+		return errors.Wrap(err, name)
+	}
+	if _, err := g.exec(tx, insertCommandSetting, commandID, groupName, name, value); err != nil {
+		return errors.Wrap(err, name)
+	}
+	return nil
+}
+
+// setCmdAttrsTx stores the attributes of cmd that are not part of its
+// definition: its jail, its death signal, and its restart policy.
+func (g *Groups) setCmdAttrsTx(tx *sql.Tx, groupName, commandID string, cmd *exec.Cmd) error {
+	if err := g.setCmdJailTx(tx, groupName, commandID, cmdJail(cmd)); err != nil {
+		return err
+	}
+	if err := g.setCmdDeathSignalTx(tx, groupName, commandID, cmdDeathSignal(cmd)); err != nil {
+		return err
+	}
+	return g.setCmdRestartPolicyTx(tx, groupName, commandID, g.restartPolicy(groupName, cmd))
+}
+
+// setCmdDeathSignalTx sets the death signal of a command, or deletes it if sig is zero.
+func (g *Groups) setCmdDeathSignalTx(tx *sql.Tx, groupName, commandID string, sig syscall.Signal) error {
+	if sig == 0 {
+		_, err := g.exec(tx, deleteCommandSetting, groupName, commandID, settingDeathSignal)
+		return errors.Wrap(err, settingDeathSignal)
+	}
+	return g.setCmdSettingTx(tx, groupName, commandID, settingDeathSignal, strconv.Itoa(int(sig)))
+}
+
+// setCmdJailTx sets the jail of a command, or deletes it if jid is zero.
+func (g *Groups) setCmdJailTx(tx *sql.Tx, groupName, commandID string, jid int) error {
+	if jid == 0 {
+		_, err := g.exec(tx, deleteCommandSetting, groupName, commandID, settingJail)
+		return errors.Wrap(err, settingJail)
+	}
+	return g.setCmdSettingTx(tx, groupName, commandID, settingJail, strconv.Itoa(jid))
+}
+
+// removeSettingsTx deletes the settings of the commands with the provided IDs.
+// If no command IDs are provided the settings of every command in the group are deleted.
+func (g *Groups) removeSettingsTx(tx *sql.Tx, groupName string, commandIDs ...string) error {
+	if len(commandIDs) == 0 {
+		_, err := g.exec(tx, deleteGroupSettings, groupName)
+		return err
+	}
+	for _, commandID := range commandIDs {
+		if _, err := g.exec(tx, deleteCommandSettings, groupName, commandID); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+var getCommandSettings = newQuery("getting command settings", `
+SELECT	name, value
+FROM	command_settings
+WHERE	group_name = ? AND command_id = ?`)
+
+// getCmdSettingsTx gets all the settings of a command.
+func (g *Groups) getCmdSettingsTx(tx *sql.Tx, groupName, commandID string) (map[string]string, error) {
+	rows, err := g.queryRows(tx, getCommandSettings, groupName, commandID)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = rows.Close() }() // Best effort.
+
+	settings := map[string]string{}
+	for rows.Next() {
+		var name, value string
+		if err := rows.Scan(&name, &value); err != nil {
+			return nil, err
+		}
+		settings[name] = value
+	}
+	return settings, rows.Err()
+}
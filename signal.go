@@ -0,0 +1,151 @@
+package exec
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"sort"
+	"strconv"
+	"strings"
+	"syscall"
+
+	"github.com/pkg/errors"
+)
+
+// ParseSignal parses the name of a signal, such as SIGUSR1, which may also
+// be written without the SIG prefix or in lower case, or the number of a signal.
+// Only the signals of the platform the program runs on can be parsed.
+func ParseSignal(name string) (syscall.Signal, error) {
+	s := strings.ToUpper(strings.TrimSpace(name))
+
+	if n, err := strconv.Atoi(s); err == nil {
+		if n <= 0 {
+			return 0, errors.Errorf("invalid signal number %d", n)
+		}
+		return syscall.Signal(n), nil
+	}
+	if sig, ok := signalNames[strings.TrimPrefix(s, "SIG")]; ok {
+		return sig, nil
+	}
+	return 0, errors.Errorf("unknown signal %s", name)
+}
+
+// SignalName returns the name of a signal with the SIG prefix, such as
+// SIGUSR1, or its number if it has no name on the platform the program runs on.
+// Signals with more than one name get the first of them in alphabetical order.
+func SignalName(sig syscall.Signal) string {
+	names := make([]string, 0, len(signalNames))
+	for name := range signalNames {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		if signalNames[name] == sig {
+			return "SIG" + name
+		}
+	}
+	return strconv.Itoa(int(sig))
+}
+
+// SignalByName sends the signal with the provided name, see ParseSignal,
+// to every command of a group.
+func (g *Groups) SignalByName(groupName, name string) error {
+	sig, err := ParseSignal(name)
+	if err != nil {
+		return err
+	}
+	grp := g.getGroup(groupName)
+	if grp == nil {
+		return errors.Errorf("group %s not found", groupName)
+	}
+	return grp.Signal(sig)
+}
+
+// SignalCommandByName sends the signal with the provided name, see ParseSignal,
+// to a command of a group.
+// cmdID is the instance ID of the command or its content hash.
+func (g *Groups) SignalCommandByName(groupName, cmdID, name string) error {
+	sig, err := ParseSignal(name)
+	if err != nil {
+		return err
+	}
+	grp := g.getGroup(groupName)
+	if grp == nil {
+		return errors.Errorf("group %s not found", groupName)
+	}
+	cmd := grp.lookup(cmdID)
+	if cmd == nil {
+		return errors.Errorf("command %s not found in group %s", cmdID, groupName)
+	}
+	return errors.Wrap(grp.signal(cmd, sig), "sending "+name)
+}
+
+// SignalFailure is a command that SignalAll could not send a signal to,
+// or that Reload could not reload.
+type SignalFailure struct {
+	Group     string
+	CommandID string
+	Err       error
+}
+
+// SignalAllError reports the commands that SignalAll could not send a signal to.
+type SignalAllError struct {
+	Signal   os.Signal
+	Failures []SignalFailure
+}
+
+// Error returns a description of the error.
+func (e *SignalAllError) Error() string {
+	msgs := make([]string, len(e.Failures))
+	for i, f := range e.Failures {
+		msgs[i] = fmt.Sprintf("command %s in group %s: %s", f.CommandID, f.Group, f.Err)
+	}
+	return fmt.Sprintf("sending %s to %d commands failed: %s", e.Signal, len(e.Failures), strings.Join(msgs, "; "))
+}
+
+// SignalAll sends a signal to every running command of every open group,
+// for example to warn them of an imminent shutdown.
+// It carries on when a command can not be signaled, and returns how many
+// commands were signaled and, if any could not be, a *SignalAllError.
+func (g *Groups) SignalAll(sig os.Signal) (int, error) {
+	var (
+		signaled = 0
+		failures = []SignalFailure{}
+	)
+	names := g.groupNames()
+	sort.Strings(names)
+
+	for _, groupName := range names {
+		grp := g.getGroup(groupName)
+		if grp == nil {
+			continue // Removed since.
+		}
+		for _, cmd := range grp.alive() {
+			if err := grp.signal(cmd, sig); err != nil {
+				id, _ := grp.ID(cmd)
+				failures = append(failures, SignalFailure{Group: groupName, CommandID: id, Err: err})
+				continue
+			}
+			signaled++
+		}
+	}
+	if len(failures) > 0 {
+		return signaled, &SignalAllError{Signal: sig, Failures: failures}
+	}
+	return signaled, nil
+}
+
+// alive returns the commands of the group that have not exited.
+func (g *Group) alive() []*exec.Cmd {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	cmds := []*exec.Cmd{}
+	for _, cmd := range g.cmds {
+		if g.aliveLocked(cmd) {
+			cmds = append(cmds, cmd)
+		}
+	}
+	return cmds
+}
@@ -0,0 +1,130 @@
+//go:build !windows
+// +build !windows
+
+package exec_test
+
+import (
+	"context"
+	"os"
+	osexec "os/exec"
+	"path/filepath"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/scgolang/exec"
+)
+
+func TestParseSignal(t *testing.T) {
+	for _, tc := range []struct {
+		name     string
+		expected syscall.Signal
+	}{
+		{name: "SIGUSR1", expected: syscall.SIGUSR1},
+		{name: "usr2", expected: syscall.SIGUSR2},
+		{name: " Term ", expected: syscall.SIGTERM},
+		{name: "9", expected: syscall.SIGKILL},
+	} {
+		sig, err := exec.ParseSignal(tc.name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if expected, got := tc.expected, sig; expected != got {
+			t.Fatalf("%s: expected %s, got %s", tc.name, expected, got)
+		}
+	}
+	for _, name := range []string{"", "SIGNOPE", "0", "-1"} {
+		if _, err := exec.ParseSignal(name); err == nil {
+			t.Fatalf("%q: expected an error, got nil", name)
+		}
+	}
+}
+
+func TestGroupsSignalByName(t *testing.T) {
+	var (
+		groupName = "trappers"
+		root      = filepath.Join("testdata", "."+t.Name())
+	)
+	_ = os.RemoveAll(root)
+
+	var (
+		gs          = newTestGroups(t, root)
+		cmd         = osexec.Command("sh", "-c", `trap "exit 3" USR1; sleep 10 & wait`)
+		ctx, cancel = context.WithCancel(context.Background())
+	)
+	defer cancel()
+	defer func() { _ = gs.Remove(groupName) }() // Best effort.
+
+	if err := gs.Create(groupName, cmd); err != nil {
+		t.Fatal(err)
+	}
+	changes, err := gs.Watch(ctx, groupName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(100 * time.Millisecond) // Give the shell time to install the trap.
+
+	id, _ := gs.CmdID(groupName, cmd)
+	if err := gs.SignalCommandByName(groupName, id, "SIGBOGUS"); err == nil {
+		t.Fatal("expected an error, got nil")
+	}
+	if err := gs.SignalCommandByName(groupName, id, "usr1"); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case <-time.After(5 * time.Second):
+		t.Fatal("timeout waiting for command to handle signal")
+	case change := <-changes:
+		if expected, got := "exit status 3", change.Err.Error(); expected != got {
+			t.Fatalf("expected %s, got %s", expected, got)
+		}
+	}
+	if err := gs.SignalByName("nope", "SIGUSR1"); err == nil {
+		t.Fatal("expected an error, got nil")
+	}
+}
+
+func TestGroupsSignalAll(t *testing.T) {
+	var (
+		groupNames = []string{"trappers", "sleepers"}
+		root       = filepath.Join("testdata", "."+t.Name())
+	)
+	_ = os.RemoveAll(root)
+
+	gs := newTestGroups(t, root)
+
+	for _, groupName := range groupNames {
+		groupName := groupName
+		defer func() { _ = gs.Remove(groupName) }() // Best effort.
+	}
+	var (
+		trapper = osexec.Command("sh", "-c", `trap "exit 3" USR1; sleep 10 & wait`)
+		sleeper = osexec.Command("sh", "-c", `trap "exit 4" USR1; sleep 10 & wait`)
+	)
+	if err := gs.Create(groupNames[0], trapper); err != nil {
+		t.Fatal(err)
+	}
+	if err := gs.Create(groupNames[1], sleeper); err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(100 * time.Millisecond) // Give the shells time to install the traps.
+
+	n, err := gs.SignalAll(syscall.SIGUSR1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected, got := 2, n; expected != got {
+		t.Fatalf("expected %d commands to be signaled, got %d", expected, got)
+	}
+	for _, groupName := range groupNames {
+		if err := gs.Wait(groupName); err == nil {
+			t.Fatalf("expected %s to exit with an error, got nil", groupName)
+		}
+	}
+	if n, err = gs.SignalAll(syscall.SIGUSR1); err != nil {
+		t.Fatal(err)
+	}
+	if expected, got := 0, n; expected != got {
+		t.Fatalf("expected %d commands to be signaled after they exited, got %d", expected, got)
+	}
+}
@@ -0,0 +1,24 @@
+//go:build windows
+// +build windows
+
+package exec
+
+import "syscall"
+
+// signalNames maps the names of signals, without the SIG prefix, to their numbers.
+// Windows only has the signals that the syscall package emulates.
+var signalNames = map[string]syscall.Signal{
+	"ABRT": syscall.SIGABRT,
+	"ALRM": syscall.SIGALRM,
+	"BUS":  syscall.SIGBUS,
+	"FPE":  syscall.SIGFPE,
+	"HUP":  syscall.SIGHUP,
+	"ILL":  syscall.SIGILL,
+	"INT":  syscall.SIGINT,
+	"KILL": syscall.SIGKILL,
+	"PIPE": syscall.SIGPIPE,
+	"QUIT": syscall.SIGQUIT,
+	"SEGV": syscall.SIGSEGV,
+	"TERM": syscall.SIGTERM,
+	"TRAP": syscall.SIGTRAP,
+}
@@ -0,0 +1,301 @@
+package exec
+
+import (
+	"database/sql"
+	"encoding/json"
+	"os/exec"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// SnapshotVersion is the version of the snapshot format written by Snapshot.
+const SnapshotVersion = 2
+
+// Snapshot is a versioned record of the configuration of a group.
+type Snapshot struct {
+	ID       int64             `json:"-"`
+	Version  int               `json:"version"`
+	Group    string            `json:"group"`
+	Created  time.Time         `json:"created"`
+	Commands []SnapshotCommand `json:"commands"`
+}
+
+// SnapshotCommand is the definition and desired state of a command in a Snapshot.
+type SnapshotCommand struct {
+	// ID is the instance ID of the command.
+	// Snapshots before version 2 identify commands by their content hash.
+	ID string `json:"id"`
+
+	Path     string            `json:"path"`
+	Args     []string          `json:"args"`
+	Env      []string          `json:"env,omitempty"`
+	Dir      string            `json:"dir,omitempty"`
+	Settings map[string]string `json:"settings,omitempty"`
+	Watch    []string          `json:"watch,omitempty"`
+
+	// Running is true if the command should be running.
+	Running bool `json:"running"`
+}
+
+// Cmd returns a new, unstarted command with the definition in the snapshot.
+func (sc SnapshotCommand) Cmd() *exec.Cmd {
+	return &exec.Cmd{
+		Path: sc.Path,
+		Args: append([]string{}, sc.Args...),
+		Env:  append([]string(nil), sc.Env...),
+		Dir:  sc.Dir,
+	}
+}
+
+// Snapshot records the current configuration of a group so that it can
+// be returned to later with Rollback.
+func (g *Groups) Snapshot(groupName string) (Snapshot, error) {
+	grp := g.getGroup(groupName)
+	if grp == nil {
+		return Snapshot{}, errors.Errorf("group %s not found", groupName)
+	}
+	tx, err := g.db.Begin()
+	if err != nil {
+		return Snapshot{}, errors.Wrap(err, "starting transaction")
+	}
+	snap, err := g.snapshotTx(tx, groupName, grp)
+	if err != nil {
+		_ = tx.Rollback()
+		return Snapshot{}, err
+	}
+	return snap, errors.Wrap(tx.Commit(), "committing transaction")
+}
+
+var insertSnapshot = newQuery("inserting snapshot", `
+INSERT INTO	snapshots (group_name, created, data)
+VALUES		(?, ?, ?)`)
+
+// snapshotTx records a snapshot of a group using the provided transaction.
+func (g *Groups) snapshotTx(tx *sql.Tx, groupName string, grp *Group) (Snapshot, error) {
+	snap, err := g.buildSnapshotTx(tx, groupName, grp)
+	if err != nil {
+		return Snapshot{}, err
+	}
+	stored := snap
+	stored.Commands = make([]SnapshotCommand, len(snap.Commands))
+
+	for i, sc := range snap.Commands {
+		if sc.Env, err = g.sealEnvs(sc.Env); err != nil {
+			return Snapshot{}, errors.Wrap(err, "encrypting command environment")
+		}
+		stored.Commands[i] = sc
+	}
+	data, err := json.Marshal(stored)
+	if err != nil {
+		return Snapshot{}, errors.Wrap(err, "encoding snapshot")
+	}
+	result, err := g.exec(tx, insertSnapshot, groupName, snap.Created.Unix(), string(data))
+	if err != nil {
+		return Snapshot{}, err
+	}
+	if snap.ID, err = result.LastInsertId(); err != nil {
+		return Snapshot{}, errors.Wrap(err, "getting snapshot ID")
+	}
+	return snap, nil
+}
+
+// buildSnapshotTx describes the current configuration of a group.
+func (g *Groups) buildSnapshotTx(tx *sql.Tx, groupName string, grp *Group) (Snapshot, error) {
+	snap := Snapshot{
+		Version: SnapshotVersion,
+		Group:   groupName,
+		Created: grp.clock.Now(),
+	}
+	for _, cmd := range grp.Commands() {
+		commandID, ok := grp.ID(cmd)
+		if !ok {
+			continue // Removed while the snapshot was being taken.
+		}
+		settings, err := g.getCmdSettingsTx(tx, groupName, commandID)
+		if err != nil {
+			return Snapshot{}, err
+		}
+		watch, err := g.getCmdWatchTx(tx, groupName, commandID)
+		if err != nil {
+			return Snapshot{}, err
+		}
+		snap.Commands = append(snap.Commands, SnapshotCommand{
+			ID:       commandID,
+			Path:     cmd.Path,
+			Args:     cmd.Args,
+			Env:      cmd.Env,
+			Dir:      cmd.Dir,
+			Settings: settings,
+			Watch:    watch,
+			Running:  grp.State(cmd) == StateRunning,
+		})
+	}
+	return snap, nil
+}
+
+var getSnapshots = newQuery("querying snapshots", `
+SELECT		snapshot_id, data
+FROM		snapshots
+WHERE		group_name = ?
+ORDER BY	snapshot_id`)
+
+var getSnapshot = newQuery("getting snapshot", `
+SELECT	data
+FROM	snapshots
+WHERE	group_name = ? AND snapshot_id = ?`)
+
+// Snapshots returns the snapshots of a group, oldest first.
+// Use EachSnapshot for groups with many snapshots.
+func (g *Groups) Snapshots(groupName string) ([]Snapshot, error) {
+	snaps := []Snapshot{}
+	err := g.EachSnapshot(groupName, func(snap Snapshot) error {
+		snaps = append(snaps, snap)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return snaps, nil
+}
+
+// EachSnapshot calls fn with each snapshot of a group, oldest first,
+// without reading all of them into memory. It stops like EachRun.
+func (g *Groups) EachSnapshot(groupName string, fn func(Snapshot) error) error {
+	rows, err := g.queryRows(nil, getSnapshots, groupName)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = rows.Close() }() // Best effort.
+
+	for rows.Next() {
+		var (
+			id   int64
+			data string
+		)
+		if err := rows.Scan(&id, &data); err != nil {
+			return errors.Wrap(err, "scanning snapshot row")
+		}
+		snap, err := g.decodeSnapshot(id, data)
+		if err != nil {
+			return err
+		}
+		if err := fn(snap); err != nil {
+			return stopIteration(err)
+		}
+	}
+	return errors.Wrap(rows.Err(), "scanning snapshot rows")
+}
+
+// decodeSnapshot decodes a stored snapshot.
+func (g *Groups) decodeSnapshot(id int64, data string) (Snapshot, error) {
+	snap := Snapshot{}
+	if err := json.Unmarshal([]byte(data), &snap); err != nil {
+		return Snapshot{}, errors.Wrap(err, "decoding snapshot")
+	}
+	if snap.Version > SnapshotVersion {
+		return Snapshot{}, errors.Errorf("snapshot %d has unsupported version %d", id, snap.Version)
+	}
+	for i, sc := range snap.Commands {
+		env, err := g.openEnvs(sc.Env)
+		if err != nil {
+			return Snapshot{}, errors.Wrap(err, "decrypting command environment")
+		}
+		snap.Commands[i].Env = env
+
+		if snap.Version < 2 {
+			if snap.Commands[i].ID, err = GetCmdID(snap.Commands[i].Cmd()); err != nil {
+				return Snapshot{}, errors.Wrap(err, "getting command ID")
+			}
+		}
+	}
+	snap.ID = id
+	return snap, nil
+}
+
+// Rollback returns a group to the configuration recorded in a snapshot.
+// Commands that are not in the snapshot are removed, commands that were running
+// when the snapshot was taken are started if they are not running, and the
+// settings and watch lists of the commands are restored.
+func (g *Groups) Rollback(groupName string, snapshotID int64) error {
+	grp := g.getGroup(groupName)
+	if grp == nil {
+		return errors.Errorf("group %s not found", groupName)
+	}
+	var data string
+	if err := g.queryRow(nil, getSnapshot, []interface{}{groupName, snapshotID}, &data); err != nil {
+		if err == sql.ErrNoRows {
+			return errors.Errorf("snapshot %d of group %s not found", snapshotID, groupName)
+		}
+		return err
+	}
+	snap, err := g.decodeSnapshot(snapshotID, data)
+	if err != nil {
+		return err
+	}
+	var (
+		want   = map[string]SnapshotCommand{}
+		remove = []*exec.Cmd{}
+	)
+	for _, sc := range snap.Commands {
+		want[sc.ID] = sc
+	}
+	for _, cmd := range grp.Commands() {
+		commandID, _ := grp.ID(cmd)
+		if _, ok := want[commandID]; !ok {
+			remove = append(remove, cmd)
+		}
+	}
+	if len(remove) > 0 {
+		if err := g.Remove(groupName, remove...); err != nil {
+			return errors.Wrap(err, "removing commands")
+		}
+	}
+	tx, err := g.db.Begin()
+	if err != nil {
+		return errors.Wrap(err, "starting transaction")
+	}
+	if err := g.rollbackTx(tx, groupName, grp, want); err != nil {
+		_ = tx.Rollback()
+		return err
+	}
+	return errors.Wrap(tx.Commit(), "committing transaction")
+}
+
+// rollbackTx restores the commands in want using the provided transaction.
+func (g *Groups) rollbackTx(tx *sql.Tx, groupName string, grp *Group, want map[string]SnapshotCommand) error {
+	for commandID, sc := range want {
+		if err := g.removeSettingsTx(tx, groupName, commandID); err != nil {
+			return err
+		}
+		for name, value := range sc.Settings {
+			if err := g.setCmdSettingTx(tx, groupName, commandID, name, value); err != nil {
+				return err
+			}
+		}
+		if err := g.setCmdWatchTx(tx, groupName, commandID, sc.Watch); err != nil {
+			return err
+		}
+		cmd := grp.lookup(commandID)
+		if cmd == nil || grp.State(cmd) != StateRunning {
+			if !sc.Running {
+				continue
+			}
+			if cmd != nil {
+				grp.retire(cmd)
+				grp.drop(cmd)
+				if err := g.deleteCmdsTx(tx, groupName, commandID); err != nil {
+					return errors.Wrap(err, "deleting exited command")
+				}
+			}
+			cmd = sc.Cmd()
+			if err := g.addCmdTx(tx, groupName, grp, commandID, cmd); err != nil {
+				return err
+			}
+		}
+		if err := g.watchFiles(groupName, cmd, sc.Watch); err != nil {
+			return errors.Wrap(err, "watching command files")
+		}
+	}
+	return nil
+}
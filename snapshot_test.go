@@ -0,0 +1,65 @@
+package exec_test
+
+import (
+	"os"
+	osexec "os/exec"
+	"path/filepath"
+	"syscall"
+	"testing"
+)
+
+func TestGroupsSnapshotRollback(t *testing.T) {
+	var (
+		groupName = "sleepers"
+		root      = filepath.Join("testdata", "."+t.Name())
+	)
+	_ = os.RemoveAll(root)
+
+	var (
+		gs      = newTestGroups(t, root)
+		sleep10 = osexec.Command("sleep", "10")
+		sleep20 = osexec.Command("sleep", "20")
+	)
+	if err := gs.Create(groupName, sleep10, sleep20); err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = gs.Remove(groupName) }()
+
+	if err := gs.SetReloadSignal(groupName, sleep10, syscall.SIGQUIT); err != nil {
+		t.Fatal(err)
+	}
+	snap, err := gs.Snapshot(groupName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected, got := 2, len(snap.Commands); expected != got {
+		t.Fatalf("expected %d commands, got %d", expected, got)
+	}
+	if err := gs.Remove(groupName, sleep10); err != nil {
+		t.Fatal(err)
+	}
+	if err := gs.Rollback(groupName, snap.ID); err != nil {
+		t.Fatal(err)
+	}
+	cmds, ok := gs.Commands(groupName)
+	if !ok {
+		t.Fatal("group does not exist")
+	}
+	if expected, got := 2, len(cmds); expected != got {
+		t.Fatalf("expected %d commands, got %d", expected, got)
+	}
+	sig, err := gs.ReloadSignal(groupName, sleep10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected, got := syscall.SIGQUIT, sig; expected != got {
+		t.Fatalf("expected %s, got %s", expected, got)
+	}
+	snaps, err := gs.Snapshots(groupName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected, got := 1, len(snaps); expected != got {
+		t.Fatalf("expected %d snapshots, got %d", expected, got)
+	}
+}
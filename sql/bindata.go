@@ -89,7 +89,7 @@ func bindataGo() (*asset, error) {
 	return a, nil
 }
 
-var _createtablesSql = []byte("\x1f\x8b\x08\x00\x00\x00\x00\x00\x00\xff\x72\x0e\x72\x75\x0c\x71\x55\x08\x71\x74\xf2\x71\x55\xf0\x74\x53\xf0\xf3\x0f\x51\x70\x8d\xf0\x0c\x0e\x09\x56\x48\xce\xcf\xcd\x4d\xcc\x4b\x89\x4f\x2c\x4a\x2f\x56\xd0\xe0\xe2\x84\xf1\x33\x53\x38\x39\x43\x5c\x23\x42\x74\xb8\x38\x33\x53\x2a\x38\x39\x39\x3d\xfd\x42\x5c\xdd\x5d\x83\x74\xb8\x38\x13\x8b\xd2\x39\x21\x92\x5c\x9a\xd6\x5c\x5c\x44\x18\x9e\x9a\x57\x46\xa4\xd9\xa9\x79\x65\xf1\x65\x89\x45\x44\x9a\x5f\x50\x94\x9f\x9c\x5a\x5c\x9c\x8a\xcb\xe5\xe9\x45\xf9\xa5\x05\xf1\x79\x89\xb9\xa9\x70\x21\xa8\x16\xb0\x2a\xa8\xb5\x20\x5b\x00\x01\x00\x00\xff\xff\x7d\xdd\xf4\xb1\x22\x01\x00\x00")
+var _createtablesSql = []byte("\x1f\x8b\x08\x00\x00\x00\x00\x00\x02\xff\xa5\x55\xc1\x72\x9b\x30\x10\x3d\x8b\xaf\xd0\xb1\x9d\xf1\x29\x33\xe9\xa5\x27\x37\x51\x32\x4c\x1b\xdc\x71\xc8\x8c\x73\x62\x36\xb0\x35\x4c\x41\x72\x25\xe1\x38\x7f\x1f\x21\x07\x04\x18\x12\xc5\x3d\xd9\xbb\xab\x79\x6f\xf5\xb4\x6f\xb9\x5a\xb3\x65\xcc\x68\xbc\xfc\xf1\x8b\xd1\xf0\x86\x46\xab\x98\xb2\x4d\x78\x1f\xdf\xd3\x54\x54\x15\xf0\x2c\x01\xb9\x55\xf4\x4b\x40\xda\xb8\xc8\x08\x89\xd9\x26\x5e\x04\xa4\xc8\x0e\x84\x90\x30\x8a\xd9\x2d\x5b\x9b\xd8\x1c\x25\xc7\x62\xf0\xf5\x7b\x10\x5c\x7d\x0c\x8e\x7c\xef\x89\x6d\x4e\x26\x7b\x90\x9e\xf8\x3b\x29\x52\x54\x0a\x6d\xe7\x05\x57\x1a\x78\x8a\x7d\xf8\x09\xc6\xad\x14\xf5\x2e\xe1\x50\x61\x97\x7a\x83\xb1\xa7\xde\x5a\xf1\xbd\xd9\x33\xe8\x34\x9f\xb9\xdb\x14\x13\x68\x8d\x92\x7f\x52\x3e\x85\x5a\x17\x7c\xf6\x7d\x26\x78\x8e\x41\x1b\xed\xa1\xac\xd1\x93\x53\x71\xd8\xa9\x5c\x68\x4b\xd6\x06\x7d\x65\xe8\xef\x75\x78\xb7\x5c\x3f\xd2\x9f\xec\x91\x2e\x1f\xe2\x55\x18\x19\xb8\x3b\x16\xcd\xb4\x92\x4a\x04\x8d\xd9\xe0\x95\x33\xd0\xe0\xd9\x8f\xac\xb9\x6d\xc5\xfc\xda\x2e\xce\x6e\xe3\x54\xb7\x89\x67\x37\x59\x33\x44\x72\xdc\x2f\x1e\x8a\x71\xca\x1c\xd3\x3d\x89\x51\x4a\x21\x5d\x68\xa8\x60\x8b\x32\xd9\xa3\x54\x85\xe0\x5d\x3e\x17\x4a\x0f\x07\xa2\x04\xfd\x47\xc8\xaa\x4b\x3c\x15\x1c\xe4\x4b\x62\x06\x25\x1f\xe7\x54\x0e\x17\x97\xdf\x4e\x65\x0b\xa3\x6b\xb6\x99\x73\x46\xe2\xb4\xa0\xab\xa8\xef\x18\x57\x30\x58\xef\x40\xf5\x37\x44\xe2\x64\x6c\xd0\x86\xcb\xc3\xd5\x16\xd4\xf8\xda\x0f\xb5\x31\xfc\x34\xa8\x5d\x1a\x67\x61\x5a\x53\x8e\x2e\x3e\x32\xac\x2b\x2e\xa8\xe3\xf0\x83\x6f\xed\x38\xc3\xe0\xdc\x7a\x0e\x49\x33\xef\x23\xe0\xa3\x05\x66\xc1\xde\x73\x4f\xa3\xee\x53\x29\xd2\xbf\xd6\x43\xf6\x5f\xe7\x80\xbe\x83\x3e\xe7\xc9\xfe\xdb\x39\xf4\x09\x87\x0d\x09\x3f\x9a\xd9\x53\xd8\xf9\xc9\xe8\x78\xbd\xa5\x38\xea\xf7\xaf\x16\x1a\x6c\xbb\xe3\x1d\x31\x92\xa3\x82\x43\xcb\xae\xfa\xbe\x6f\xf2\x12\x77\x65\x91\x82\xf2\xfe\x5a\xa8\x34\xc7\xac\x2e\x31\x4b\xda\x75\xd6\x66\xfe\x6b\xb3\x9e\x0a\xde\x6c\x49\xd0\x64\xd0\xd8\x2b\xca\x8a\x17\x25\xfd\x07\x00\x00")
 
 func createtablesSqlBytes() ([]byte, error) {
 	return bindataRead(
@@ -104,7 +104,7 @@ func createtablesSql() (*asset, error) {
 		return nil, err
 	}
 
-	info := bindataFileInfo{name: "createTables.sql", size: 290, mode: os.FileMode(420), modTime: time.Unix(1493478388, 0)}
+	info := bindataFileInfo{name: "createTables.sql", size: 2045, mode: os.FileMode(420), modTime: time.Unix(1792028507, 0)}
 	a := &asset{bytes: bytes, info: info}
 	return a, nil
 }
@@ -11,7 +11,76 @@ CREATE TABLE IF NOT EXISTS command_env (
 );
 
 CREATE TABLE IF NOT EXISTS processes (
+	instance_id		TEXT,
 	command_id		TEXT,
 	group_name		TEXT,
 	process_id		INTEGER
 );
+
+CREATE TABLE IF NOT EXISTS command_watch (
+	command_id		TEXT,
+	group_name		TEXT,
+	pattern			TEXT
+);
+
+CREATE TABLE IF NOT EXISTS command_settings (
+	command_id		TEXT,
+	group_name		TEXT,
+	name			TEXT,
+	value			TEXT
+);
+
+CREATE TABLE IF NOT EXISTS snapshots (
+	snapshot_id		INTEGER PRIMARY KEY AUTOINCREMENT,
+	group_name		TEXT,
+	created			INTEGER,
+	data			TEXT
+);
+
+CREATE TABLE IF NOT EXISTS runs (
+	run_id			INTEGER PRIMARY KEY AUTOINCREMENT,
+	group_name		TEXT,
+	command_id		TEXT,
+	process_id		INTEGER,
+	started			INTEGER,
+	exited			INTEGER,
+	state			TEXT,
+	error			TEXT,
+	manager_version		TEXT,
+	hostname		TEXT,
+	platform		TEXT,
+	binary_path		TEXT,
+	binary_sha256		TEXT
+);
+
+CREATE INDEX IF NOT EXISTS processes_group_name ON processes (group_name);
+CREATE INDEX IF NOT EXISTS command_args_command_id ON command_args (command_id, idx);
+CREATE INDEX IF NOT EXISTS command_env_command_id ON command_env (command_id, idx);
+CREATE INDEX IF NOT EXISTS command_watch_group_name ON command_watch (group_name, command_id);
+CREATE INDEX IF NOT EXISTS command_settings_group_name ON command_settings (group_name, command_id);
+CREATE INDEX IF NOT EXISTS runs_group_name ON runs (group_name, command_id);
+
+CREATE TABLE IF NOT EXISTS env_blocks (
+	block_id		TEXT PRIMARY KEY,
+	data			TEXT
+);
+
+CREATE TABLE IF NOT EXISTS command_env_blocks (
+	command_id		TEXT,
+	block_id		TEXT
+);
+
+CREATE INDEX IF NOT EXISTS command_env_blocks_command_id ON command_env_blocks (command_id);
+
+CREATE TABLE IF NOT EXISTS group_quotas (
+	group_name		TEXT PRIMARY KEY,
+	max_commands		INTEGER,
+	max_replicas		INTEGER
+);
+
+CREATE TABLE IF NOT EXISTS scheduled_runs (
+	schedule_id		INTEGER PRIMARY KEY AUTOINCREMENT,
+	group_name		TEXT,
+	command_id		TEXT,
+	run_at			INTEGER
+);
@@ -0,0 +1,75 @@
+package exec
+
+import (
+	"os/exec"
+	"time"
+)
+
+// State is the state of a command in a Group.
+type State int
+
+// Command states.
+const (
+	StateUnknown State = iota
+	StateRunning
+	StateExited
+	StateFailed
+	StateStopped
+	StateRestarting
+)
+
+// stateNames maps states to their names.
+var stateNames = map[State]string{
+	StateUnknown:    "unknown",
+	StateRunning:    "running",
+	StateExited:     "exited",
+	StateFailed:     "failed",
+	StateStopped:    "stopped",
+	StateRestarting: "restarting",
+}
+
+// String returns a human-readable name for the state.
+func (s State) String() string {
+	if name, ok := stateNames[s]; ok {
+		return name
+	}
+	return stateNames[StateUnknown]
+}
+
+// parseState returns the state with the provided name.
+func parseState(name string) State {
+	for s, n := range stateNames {
+		if n == name {
+			return s
+		}
+	}
+	return StateUnknown
+}
+
+// MarshalText encodes the state as its name.
+func (s State) MarshalText() ([]byte, error) {
+	return []byte(s.String()), nil
+}
+
+// UnmarshalText decodes a state from its name.
+func (s *State) UnmarshalText(text []byte) error {
+	*s = parseState(string(text))
+	return nil
+}
+
+// StateChange is a notification that a command in a group changed state.
+type StateChange struct {
+	Group string
+
+	// CommandID is the instance ID of the command.
+	CommandID string
+
+	Cmd  *exec.Cmd
+	PID  int
+	From State
+	To   State
+	Time time.Time
+
+	// Err is the error the command exited with, if any.
+	Err error
+}
@@ -0,0 +1,82 @@
+package exec
+
+import (
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// Status is a summary of a command in a group.
+type Status struct {
+	State State `json:"state"`
+	PID   int   `json:"pid,omitempty"`
+
+	// Uptime is how long the current instance of the command has been running.
+	// It is zero if the command is not running.
+	Uptime time.Duration `json:"uptime,omitempty"`
+
+	// Restarts is the number of times the command has been restarted.
+	Restarts int `json:"restarts,omitempty"`
+
+	// GaveUp is why the restart policy of the command gave up on it,
+	// see RestartPolicy. It is empty if the policy has not given up.
+	GaveUp string `json:"gave_up,omitempty"`
+
+	// Unhealthy is the error of the health probe of the command if the
+	// command is unhealthy, see SetHealthProbe. It is empty if it is healthy.
+	Unhealthy string `json:"unhealthy,omitempty"`
+
+	// Paused is true if the command is running but paused, see Groups.Pause.
+	Paused bool `json:"paused,omitempty"`
+
+	// Output is how much output the command has written,
+	// if the groups were created with WithOutputMetrics.
+	Output *Throughput `json:"output,omitempty"`
+}
+
+// Statuses returns the status of every command in the group, keyed by instance ID.
+func (g *Group) Statuses() map[string]Status {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	var (
+		now      = g.clock.Now()
+		statuses = make(map[string]Status, len(g.cmds))
+	)
+	for _, cmd := range g.cmds {
+		id := g.ids[cmd]
+		status := Status{
+			State:    g.states[id],
+			Restarts: g.restarts[id],
+		}
+		status.PID = pidOf(g.procs[cmd])
+		if status.State == StateRunning {
+			status.Uptime = now.Sub(g.started[id])
+			status.Paused = g.paused
+		}
+		statuses[id] = status
+	}
+	return statuses
+}
+
+// Statuses returns the status of every command in an open group, keyed by instance ID.
+func (g *Groups) Statuses(groupName string) (map[string]Status, error) {
+	grp := g.getGroup(groupName)
+	if grp == nil {
+		return nil, errors.Errorf("group %s not found", groupName)
+	}
+	var (
+		statuses = grp.Statuses()
+		now      = g.clock.Now()
+	)
+	for id, status := range statuses {
+		status.GaveUp = g.gaveUp(groupName, id)
+		status.Unhealthy = g.unhealthy(groupName, id)
+		if g.metrics {
+			t := g.meter(groupName, id).throughput(now)
+			status.Output = &t
+		}
+		statuses[id] = status
+	}
+	return statuses, nil
+}
@@ -0,0 +1,52 @@
+package exec_test
+
+import (
+	"os"
+	osexec "os/exec"
+	"path/filepath"
+	"testing"
+
+	"github.com/scgolang/exec"
+)
+
+func TestGroupsStatuses(t *testing.T) {
+	var (
+		groupName = "sleepers"
+		root      = filepath.Join("testdata", "."+t.Name())
+	)
+	_ = os.RemoveAll(root)
+
+	var (
+		gs  = newTestGroups(t, root)
+		cmd = osexec.Command("sleep", "10")
+	)
+	defer func() { _ = gs.Remove(groupName) }() // Best effort.
+
+	if err := gs.Create(groupName, cmd); err != nil {
+		t.Fatal(err)
+	}
+	statuses, err := gs.Statuses(groupName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	id, _ := gs.CmdID(groupName, cmd)
+	status, ok := statuses[id]
+	if !ok {
+		t.Fatalf("expected a status for %s, got %v", id, statuses)
+	}
+	if expected, got := exec.StateRunning, status.State; expected != got {
+		t.Fatalf("expected state %s, got %s", expected, got)
+	}
+	if expected, got := cmd.Process.Pid, status.PID; expected != got {
+		t.Fatalf("expected pid %d, got %d", expected, got)
+	}
+	if expected, got := 0, status.Restarts; expected != got {
+		t.Fatalf("expected %d restarts, got %d", expected, got)
+	}
+	if status.Uptime <= 0 {
+		t.Fatalf("expected a positive uptime, got %s", status.Uptime)
+	}
+	if _, err := gs.Statuses("nope"); err == nil {
+		t.Fatal("expected an error, got nil")
+	}
+}
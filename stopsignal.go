@@ -0,0 +1,75 @@
+package exec
+
+import (
+	"os/exec"
+	"strconv"
+	"syscall"
+
+	"github.com/pkg/errors"
+)
+
+// SetStopSignal sets the signal that a command is stopped with by Close,
+// Remove, StopCommand, and restarts, such as SIGINT, or SIGQUIT for
+// nginx-style daemons. Commands that have not exited once the timeout of
+// the operation has passed are killed.
+// Without a stop signal of its own, Close and Remove send a command the stop
+// signal of its group, which is SIGKILL unless it is changed with
+// WithStopSignal or WithGracefulStop, and the other operations send it SIGTERM.
+// Stop signals are persisted, and zero removes the stop signal of a command.
+func (g *Groups) SetStopSignal(groupName string, cmd *exec.Cmd, sig syscall.Signal) error {
+	commandID, err := g.cmdID(groupName, cmd)
+	if err != nil {
+		return errors.Wrap(err, "getting command ID")
+	}
+	if sig == 0 {
+		if _, err := g.exec(nil, deleteCommandSetting, groupName, commandID, settingStopSignal); err != nil {
+			return errors.Wrap(err, settingStopSignal)
+		}
+	} else if err := g.setCmdSetting(groupName, commandID, settingStopSignal, strconv.Itoa(int(sig))); err != nil {
+		return err
+	}
+	if grp := g.getGroup(groupName); grp != nil {
+		setGroupStopSignal(grp, commandID, sig)
+	}
+	return nil
+}
+
+// StopSignal returns the stop signal of a command, or zero if it does not have one.
+func (g *Groups) StopSignal(groupName string, cmd *exec.Cmd) (syscall.Signal, error) {
+	commandID, err := g.cmdID(groupName, cmd)
+	if err != nil {
+		return 0, errors.Wrap(err, "getting command ID")
+	}
+	value, ok, err := g.getCmdSetting(groupName, commandID, settingStopSignal)
+	if err != nil || !ok {
+		return 0, err
+	}
+	sig, err := strconv.Atoi(value)
+	if err != nil {
+		return 0, errors.Wrap(err, "parsing stop signal")
+	}
+	return syscall.Signal(sig), nil
+}
+
+// restoreStopSignal sets the stop signal of a command of an opened group from its settings.
+func (g *Groups) restoreStopSignal(grp *Group, commandID string, settings map[string]string) error {
+	value, ok := settings[settingStopSignal]
+	if !ok {
+		return nil
+	}
+	sig, err := strconv.Atoi(value)
+	if err != nil {
+		return errors.Wrap(err, "parsing stop signal")
+	}
+	setGroupStopSignal(grp, commandID, syscall.Signal(sig))
+	return nil
+}
+
+// setGroupStopSignal sets the stop signal of a command in grp, removing it if sig is zero.
+func setGroupStopSignal(grp *Group, commandID string, sig syscall.Signal) {
+	if sig == 0 {
+		grp.setStopSignal(commandID, nil)
+		return
+	}
+	grp.setStopSignal(commandID, sig)
+}
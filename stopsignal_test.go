@@ -0,0 +1,54 @@
+package exec_test
+
+import (
+	"os"
+	osexec "os/exec"
+	"path/filepath"
+	"syscall"
+	"testing"
+	"time"
+)
+
+func TestGroupsStopSignal(t *testing.T) {
+	var (
+		groupName = "interruptible"
+		root      = filepath.Join("testdata", "."+t.Name())
+	)
+	_ = os.RemoveAll(root)
+
+	gs := newTestGroups(t, root)
+	absRoot, err := filepath.Abs(root)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var (
+		marker = filepath.Join(absRoot, "interrupted")
+		cmd    = osexec.Command("sh", "-c", "trap 'touch "+marker+"; exit 0' INT; sleep 10 & wait")
+	)
+	if err := gs.Create(groupName, cmd); err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = gs.Remove(groupName) }()
+
+	if err := gs.SetStopSignal(groupName, cmd, syscall.SIGINT); err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(200 * time.Millisecond) // Let the shell set its trap.
+
+	if err := gs.Close(groupName); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(marker); err != nil {
+		t.Fatalf("expected the command to have been interrupted rather than killed: %s", err)
+	}
+	if _, err := gs.Open(groupName); err != nil {
+		t.Fatal(err)
+	}
+	sig, err := gs.StopSignal(groupName, cmd)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if sig != syscall.SIGINT {
+		t.Fatalf("expected the stop signal to be persisted, got %s", sig)
+	}
+}
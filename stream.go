@@ -0,0 +1,356 @@
+package exec
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	"github.com/pkg/errors"
+)
+
+// DefaultSubscribeBuffer is the number of lines that can be waiting for a
+// subscriber if SubscribeOptions.Buffer is zero.
+const DefaultSubscribeBuffer = 64
+
+// Backpressure decides what happens to the output of a command when a
+// subscriber to it does not keep up, see Subscribe.
+type Backpressure int
+
+// Backpressure policies.
+const (
+	// BackpressureBlock stops reading the output of the command until the
+	// subscriber catches up. A command that writes more than its pipe holds
+	// blocks, and its log files fall behind.
+	BackpressureBlock Backpressure = iota
+
+	// BackpressureDrop drops the lines that the subscriber is not ready for
+	// and counts them, see Subscription.Dropped.
+	BackpressureDrop
+
+	// BackpressureSpill writes the lines that the subscriber is not ready for
+	// to a file in the group's directory and delivers them from there, in order.
+	BackpressureSpill
+)
+
+// LogLine is a line of output of a command, without its line terminator.
+type LogLine struct {
+	// Fd is 1 for stdout and 2 for stderr.
+	Fd   int
+	Text string
+}
+
+// SubscribeOptions configure a subscription to the output of a command.
+type SubscribeOptions struct {
+	// Buffer is how many lines can be waiting for the subscriber
+	// before Backpressure applies. Zero means DefaultSubscribeBuffer.
+	Buffer int
+
+	// Backpressure decides what happens when Buffer lines are waiting.
+	Backpressure Backpressure
+}
+
+// Subscription streams the output of a command, across restarts,
+// until it is closed.
+type Subscription struct {
+	// Lines receives the output of the command.
+	// It is closed when the subscription is closed.
+	Lines <-chan LogLine
+
+	lines     chan LogLine
+	policy    Backpressure
+	dropped   int64
+	spill     *spill
+	done      chan struct{}
+	closeOnce sync.Once
+	tee       *tee
+}
+
+// Dropped returns how many lines have been dropped because the subscriber
+// did not keep up. It is always zero unless the policy is BackpressureDrop.
+func (s *Subscription) Dropped() int64 {
+	return atomic.LoadInt64(&s.dropped)
+}
+
+// Close stops the subscription and closes Lines.
+func (s *Subscription) Close() error {
+	var err error
+	s.closeOnce.Do(func() {
+		close(s.done)
+		s.tee.unsubscribe(s)
+
+		if s.spill != nil {
+			err = s.spill.close() // The spill pump closes lines.
+			return
+		}
+		close(s.lines)
+	})
+	return err
+}
+
+// send delivers a line to the subscriber according to its backpressure policy.
+func (s *Subscription) send(line LogLine) {
+	switch s.policy {
+	case BackpressureDrop:
+		select {
+		case s.lines <- line:
+		case <-s.done:
+		default:
+			atomic.AddInt64(&s.dropped, 1)
+		}
+	case BackpressureSpill:
+		s.spill.push(line)
+	default:
+		select {
+		case s.lines <- line:
+		case <-s.done:
+		}
+	}
+}
+
+// Subscribe streams the output of a command in an open group.
+// The groups must have been created with WithOutputStreaming.
+// Output is delivered a line at a time, from when Subscribe is called,
+// and includes the output of later runs of the command.
+func (g *Groups) Subscribe(groupName string, cmd *exec.Cmd, opts SubscribeOptions) (*Subscription, error) {
+	if !g.streaming {
+		return nil, errors.New("output streaming is not enabled, see WithOutputStreaming")
+	}
+	if g.getGroup(groupName) == nil {
+		return nil, errors.Errorf("group %s not found", groupName)
+	}
+	commandID, err := g.cmdID(groupName, cmd)
+	if err != nil {
+		return nil, errors.Wrap(err, "getting command ID")
+	}
+	switch opts.Backpressure {
+	default:
+		return nil, errors.Errorf("unknown backpressure policy %d", opts.Backpressure)
+	case BackpressureBlock, BackpressureDrop, BackpressureSpill:
+	}
+	if opts.Buffer < 0 {
+		return nil, errors.Errorf("buffer must not be negative, got %d", opts.Buffer)
+	}
+	if opts.Buffer == 0 {
+		opts.Buffer = DefaultSubscribeBuffer
+	}
+	lines := make(chan LogLine, opts.Buffer)
+
+	s := &Subscription{
+		Lines:  lines,
+		lines:  lines,
+		policy: opts.Backpressure,
+		done:   make(chan struct{}),
+		tee:    g.tee(groupName, commandID),
+	}
+	if opts.Backpressure == BackpressureSpill {
+		sp, err := newSpill(filepath.Join(g.root, groupName), commandID, lines, s.done)
+		if err != nil {
+			return nil, errors.Wrap(err, "creating spill file")
+		}
+		s.spill = sp
+		go sp.pump()
+	}
+	s.tee.subscribe(s)
+
+	return s, nil
+}
+
+// tee returns the tee of the command with the provided instance ID, creating it
+// if it does not exist.
+func (g *Groups) tee(groupName, commandID string) *tee {
+	g.teesMu.Lock()
+	defer g.teesMu.Unlock()
+
+	key := groupName + "/" + commandID
+	t, ok := g.tees[key]
+	if !ok {
+		t = &tee{subs: map[*Subscription]struct{}{}}
+		g.tees[key] = t
+	}
+	return t
+}
+
+// tee splits the output of a command into lines and delivers them to its subscribers.
+type tee struct {
+	subs    map[*Subscription]struct{}
+	partial [3][]byte // Indexed by fd.
+	mu      sync.Mutex
+}
+
+// subscribe adds a subscriber.
+func (t *tee) subscribe(s *Subscription) {
+	t.mu.Lock()
+	t.subs[s] = struct{}{}
+	t.mu.Unlock()
+}
+
+// unsubscribe removes a subscriber. No lines are sent to it once this returns.
+func (t *tee) unsubscribe(s *Subscription) {
+	t.mu.Lock()
+	delete(t.subs, s)
+	t.mu.Unlock()
+}
+
+// write delivers the complete lines in p, which was written to fd.
+// An incomplete line at the end of p is kept until the rest of it is written.
+func (t *tee) write(fd int, p []byte) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if len(t.subs) == 0 {
+		t.partial[fd] = t.partial[fd][:0]
+		return
+	}
+	for {
+		i := bytes.IndexByte(p, '\n')
+		if i < 0 {
+			t.partial[fd] = append(t.partial[fd], p...)
+			return
+		}
+		line := string(append(t.partial[fd], p[:i]...))
+		t.partial[fd] = t.partial[fd][:0]
+		p = p[i+1:]
+
+		t.send(LogLine{Fd: fd, Text: strings.TrimSuffix(line, "\r")})
+	}
+}
+
+// flush delivers an incomplete line that was written to fd, if there is one.
+// It is called when the output of a run ends.
+func (t *tee) flush(fd int) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if len(t.partial[fd]) == 0 {
+		return
+	}
+	line := string(t.partial[fd])
+	t.partial[fd] = t.partial[fd][:0]
+
+	t.send(LogLine{Fd: fd, Text: line})
+}
+
+// send sends a line to every subscriber. t.mu must be held.
+func (t *tee) send(line LogLine) {
+	for s := range t.subs {
+		s.send(line)
+	}
+}
+
+// spill queues the lines that a subscriber is not ready for in a file.
+type spill struct {
+	path    string
+	w       *os.File
+	r       *bufio.Reader
+	rf      *os.File
+	pending int
+	err     error
+	lines   chan LogLine
+	done    chan struct{}
+	notify  chan struct{}
+	mu      sync.Mutex
+}
+
+// newSpill creates a spill file in dir that delivers lines to lines until done is closed.
+func newSpill(dir, commandID string, lines chan LogLine, done chan struct{}) (*spill, error) {
+	w, err := ioutil.TempFile(dir, "."+commandID+".spill-")
+	if err != nil {
+		return nil, err
+	}
+	rf, err := os.Open(w.Name())
+	if err != nil {
+		_ = w.Close()
+		_ = os.Remove(w.Name())
+		return nil, err
+	}
+	return &spill{
+		path:   w.Name(),
+		w:      w,
+		r:      bufio.NewReader(rf),
+		rf:     rf,
+		lines:  lines,
+		done:   done,
+		notify: make(chan struct{}, 1),
+	}, nil
+}
+
+// push delivers a line, or writes it to the spill file if the subscriber is
+// not ready or earlier lines are still waiting in the file.
+func (sp *spill) push(line LogLine) {
+	sp.mu.Lock()
+	defer sp.mu.Unlock()
+
+	if sp.pending == 0 {
+		select {
+		case sp.lines <- line:
+			return
+		default:
+		}
+	}
+	if sp.err != nil {
+		return
+	}
+	if _, err := fmt.Fprintf(sp.w, "%d %s\n", line.Fd, strings.Replace(line.Text, "\n", " ", -1)); err != nil {
+		sp.err = err
+		return
+	}
+	sp.pending++
+
+	select {
+	case sp.notify <- struct{}{}:
+	default:
+	}
+}
+
+// pump delivers the lines in the spill file, in order, and closes lines when
+// the subscription is closed.
+func (sp *spill) pump() {
+	defer close(sp.lines)
+
+	for {
+		sp.mu.Lock()
+		pending := sp.pending
+		sp.mu.Unlock()
+
+		if pending == 0 {
+			select {
+			case <-sp.notify:
+				continue
+			case <-sp.done:
+				return
+			}
+		}
+		text, err := sp.r.ReadString('\n')
+		if err != nil {
+			return // The file was closed, or the subscription failed.
+		}
+		var line LogLine
+		line.Fd = int(text[0] - '0')
+		line.Text = strings.TrimSuffix(text[2:], "\n")
+
+		select {
+		case sp.lines <- line:
+		case <-sp.done:
+			return
+		}
+		sp.mu.Lock()
+		sp.pending--
+		sp.mu.Unlock()
+	}
+}
+
+// close removes the spill file.
+func (sp *spill) close() error {
+	sp.mu.Lock()
+	defer sp.mu.Unlock()
+
+	_, _ = sp.w.Close(), sp.rf.Close()
+	return os.Remove(sp.path)
+}
@@ -0,0 +1,85 @@
+package exec_test
+
+import (
+	"os"
+	osexec "os/exec"
+	"path/filepath"
+	"strconv"
+	"testing"
+
+	"github.com/scgolang/exec"
+)
+
+func TestGroupsSubscribe(t *testing.T) {
+	const lines = 1000
+
+	for _, tc := range []struct {
+		backpressure exec.Backpressure
+		buffer       int
+	}{
+		{backpressure: exec.BackpressureBlock, buffer: 1},
+		{backpressure: exec.BackpressureDrop, buffer: 1},
+		{backpressure: exec.BackpressureSpill, buffer: 1},
+	} {
+		var (
+			groupName = "counter"
+			root      = filepath.Join("testdata", "."+t.Name()+strconv.Itoa(int(tc.backpressure)))
+		)
+		_ = os.RemoveAll(root)
+
+		gs, err := exec.New(root, exec.WithOutputStreaming())
+		if err != nil {
+			t.Fatal(err)
+		}
+		cmd := osexec.Command("sh", "-c", "sleep 0.2; seq 1 "+strconv.Itoa(lines))
+
+		if err := gs.Create(groupName, cmd); err != nil {
+			t.Fatal(err)
+		}
+		sub, err := gs.Subscribe(groupName, cmd, exec.SubscribeOptions{
+			Buffer:       tc.buffer,
+			Backpressure: tc.backpressure,
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if tc.backpressure == exec.BackpressureBlock {
+			// Reading is what lets the command finish.
+			verifyLines(sub, lines, t)
+		}
+		if err := gs.Wait(groupName); err != nil {
+			t.Fatal(err)
+		}
+		if tc.backpressure == exec.BackpressureSpill {
+			verifyLines(sub, lines, t)
+		}
+		if err := sub.Close(); err != nil {
+			t.Fatal(err)
+		}
+		received := int64(0)
+		for range sub.Lines {
+			received++
+		}
+		if tc.backpressure == exec.BackpressureDrop {
+			if sub.Dropped() == 0 {
+				t.Fatal("expected lines to be dropped")
+			}
+			if expected, got := int64(lines), received+sub.Dropped(); expected != got {
+				t.Fatalf("expected %d lines to be received or dropped, got %d", expected, got)
+			}
+		}
+		_ = gs.Remove(groupName)
+	}
+}
+
+func verifyLines(sub *exec.Subscription, lines int, t *testing.T) {
+	for i := 1; i <= lines; i++ {
+		line := <-sub.Lines
+		if expected, got := strconv.Itoa(i), line.Text; expected != got {
+			t.Fatalf("expected line %s, got %s", expected, got)
+		}
+		if expected, got := 1, line.Fd; expected != got {
+			t.Fatalf("expected fd %d, got %d", expected, got)
+		}
+	}
+}
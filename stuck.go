@@ -0,0 +1,276 @@
+package exec
+
+import (
+	"context"
+	"database/sql"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// StuckAction is what happens when a command is found to be stuck, see DetectStuck.
+type StuckAction int
+
+// Stuck actions.
+const (
+	// StuckNotify only sends an EventStuck event to WatchStuck.
+	StuckNotify StuckAction = iota
+
+	// StuckRestart also gracefully restarts the command.
+	StuckRestart
+)
+
+// minStuckInterval is the shortest time between two samples of a stuck detector.
+const minStuckInterval = 100 * time.Millisecond
+
+// DetectStuck makes a command count as stuck when it has neither used CPU time
+// nor written output for the provided duration. A stuck command is reported
+// to WatchStuck and, if action is StuckRestart, gracefully restarted like
+// RestartOnChange does. It is reported again if it stays stuck for another
+// period. CPU time is only sampled on Linux; on other platforms a command is
+// stuck when it has not written output.
+// A zero duration stops the detection. The setting is persisted with the group.
+func (g *Groups) DetectStuck(groupName string, cmd *exec.Cmd, after time.Duration, action StuckAction) error {
+	if g.getGroup(groupName) == nil {
+		return errors.Errorf("group %s not found", groupName)
+	}
+	if after < 0 {
+		return errors.New("stuck duration must not be negative")
+	}
+	commandID, err := g.cmdID(groupName, cmd)
+	if err != nil {
+		return errors.Wrap(err, "getting command ID")
+	}
+	tx, err := g.db.Begin()
+	if err != nil {
+		return errors.Wrap(err, "starting transaction")
+	}
+	if err := g.setCmdStuckTx(tx, groupName, commandID, after, action); err != nil {
+		_ = tx.Rollback()
+		return err
+	}
+	if err := tx.Commit(); err != nil {
+		return errors.Wrap(err, "committing transaction")
+	}
+	g.detectStuck(groupName, commandID, after, action)
+	return nil
+}
+
+// WatchStuck returns a channel that receives an EventStuck event every time a
+// command of any group is found to be stuck, see DetectStuck.
+// The channel is closed when ctx is done.
+// Events are dropped for receivers that fall too far behind.
+func (g *Groups) WatchStuck(ctx context.Context) <-chan Event {
+	ch := make(chan Event, watchBufferSize)
+
+	g.stuckMu.Lock()
+	g.stuckWatchers[ch] = struct{}{}
+	g.stuckMu.Unlock()
+
+	go func() {
+		<-ctx.Done()
+		g.stuckMu.Lock()
+		delete(g.stuckWatchers, ch)
+		close(ch)
+		g.stuckMu.Unlock()
+	}()
+	return ch
+}
+
+// stuckDetector samples the CPU time and output of a command
+// and calls stuck when neither has changed for a while.
+type stuckDetector struct {
+	after  time.Duration
+	clock  Clock
+	sample func() (stuckSample, bool)
+	stuck  func(idle time.Duration)
+	done   chan struct{}
+}
+
+// stuckSample is what a stuck detector compares to tell if a command made progress.
+type stuckSample struct {
+	pid      int
+	cpuTicks uint64
+	outSize  int64
+	outTime  time.Time
+}
+
+// run samples the command until the detector is closed.
+func (sd *stuckDetector) run() {
+	interval := sd.after / 4
+	if interval < minStuckInterval {
+		interval = minStuckInterval
+	}
+	var (
+		last     stuckSample
+		progress time.Time
+	)
+	for {
+		select {
+		case <-sd.done:
+			return
+		case <-sd.clock.After(interval):
+		}
+		now := sd.clock.Now()
+
+		s, ok := sd.sample()
+		if !ok || s != last {
+			last, progress = s, now
+			continue
+		}
+		if idle := now.Sub(progress); idle >= sd.after {
+			progress = now // Report again only after another period.
+			sd.stuck(idle)
+		}
+	}
+}
+
+// Close stops the stuck detector.
+func (sd *stuckDetector) Close() {
+	close(sd.done)
+}
+
+// detectStuck replaces the stuck detector of a command.
+func (g *Groups) detectStuck(groupName, commandID string, after time.Duration, action StuckAction) {
+	g.unwatchStuck(groupName, commandID)
+
+	if after == 0 {
+		return
+	}
+	sd := &stuckDetector{
+		after:  after,
+		clock:  g.clock,
+		sample: func() (stuckSample, bool) { return g.sampleStuck(groupName, commandID) },
+		stuck:  func(idle time.Duration) { g.reportStuck(groupName, commandID, idle, action) },
+		done:   make(chan struct{}),
+	}
+	g.stuckMu.Lock()
+	if g.stuckDetectors[groupName] == nil {
+		g.stuckDetectors[groupName] = map[string]*stuckDetector{}
+	}
+	g.stuckDetectors[groupName][commandID] = sd
+	g.stuckMu.Unlock()
+
+	go sd.run()
+}
+
+// unwatchStuck closes the stuck detectors of the commands with the provided IDs.
+// If no command IDs are provided then all the stuck detectors in the group are closed.
+func (g *Groups) unwatchStuck(groupName string, commandIDs ...string) {
+	g.stuckMu.Lock()
+	defer g.stuckMu.Unlock()
+
+	detectors := g.stuckDetectors[groupName]
+	if len(commandIDs) == 0 {
+		delete(g.stuckDetectors, groupName)
+	} else {
+		m := map[string]*stuckDetector{}
+		for _, commandID := range commandIDs {
+			if sd, ok := detectors[commandID]; ok {
+				m[commandID] = sd
+				delete(detectors, commandID)
+			}
+		}
+		detectors = m
+	}
+	for _, sd := range detectors {
+		sd.Close()
+	}
+}
+
+// sampleStuck samples the CPU time and the log files of a command.
+// It returns false if the command is not running.
+func (g *Groups) sampleStuck(groupName, commandID string) (stuckSample, bool) {
+	grp := g.getGroup(groupName)
+	if grp == nil {
+		return stuckSample{}, false
+	}
+	cmd := grp.lookup(commandID)
+	if cmd == nil || grp.State(cmd) != StateRunning || grp.isPaused() {
+		return stuckSample{}, false
+	}
+	s := stuckSample{pid: grp.pid(cmd)}
+	s.cpuTicks, _ = processCPUTicks(s.pid)
+
+	for fd := 1; fd <= 2; fd++ {
+		filename, err := logFilename(commandID, fd)
+		if err != nil {
+			continue
+		}
+		info, err := os.Stat(filepath.Join(g.root, groupName, filename))
+		if err != nil {
+			continue
+		}
+		s.outSize += info.Size()
+		if info.ModTime().After(s.outTime) {
+			s.outTime = info.ModTime()
+		}
+	}
+	return s, true
+}
+
+// reportStuck notifies the stuck watchers that a command is stuck
+// and restarts it if the action says so.
+func (g *Groups) reportStuck(groupName, commandID string, idle time.Duration, action StuckAction) {
+	var pid int
+	if grp := g.getGroup(groupName); grp != nil {
+		if cmd := grp.lookup(commandID); cmd != nil {
+			pid = grp.pid(cmd)
+		}
+	}
+	event := NewStuckEvent(groupName, commandID, pid, idle, action == StuckRestart, g.clock.Now())
+
+	g.stuckMu.Lock()
+	for ch := range g.stuckWatchers {
+		select {
+		case ch <- event:
+		default:
+		}
+	}
+	g.stuckMu.Unlock()
+
+	if action != StuckRestart {
+		return
+	}
+	if err := g.restart(groupName, commandID); err != nil {
+		g.logf("restarting stuck command %s in group %s: %s", commandID, groupName, err)
+	}
+}
+
+// setCmdStuckTx sets the stuck detection of a command, or deletes it if after is zero.
+func (g *Groups) setCmdStuckTx(tx *sql.Tx, groupName, commandID string, after time.Duration, action StuckAction) error {
+	if after == 0 {
+		for _, name := range []string{settingStuckAfter, settingStuckAction} {
+			if _, err := g.exec(tx, deleteCommandSetting, groupName, commandID, name); err != nil {
+				return errors.Wrap(err, name)
+			}
+		}
+		return nil
+	}
+	if err := g.setCmdSettingTx(tx, groupName, commandID, settingStuckAfter, after.String()); err != nil {
+		return err
+	}
+	return g.setCmdSettingTx(tx, groupName, commandID, settingStuckAction, strconv.Itoa(int(action)))
+}
+
+// restoreStuck starts the stuck detector of a command from its settings, if it has one.
+func (g *Groups) restoreStuck(groupName, commandID string, settings map[string]string) error {
+	value, ok := settings[settingStuckAfter]
+	if !ok {
+		return nil
+	}
+	after, err := time.ParseDuration(value)
+	if err != nil {
+		return errors.Wrap(err, "parsing stuck duration")
+	}
+	action, err := strconv.Atoi(settings[settingStuckAction])
+	if err != nil {
+		return errors.Wrap(err, "parsing stuck action")
+	}
+	g.detectStuck(groupName, commandID, after, StuckAction(action))
+	return nil
+}
@@ -0,0 +1,73 @@
+package exec_test
+
+import (
+	"context"
+	"os"
+	osexec "os/exec"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/scgolang/exec"
+)
+
+func TestGroupsDetectStuck(t *testing.T) {
+	var (
+		groupName = "sleeper"
+		root      = filepath.Join("testdata", "."+t.Name())
+	)
+	_ = os.RemoveAll(root)
+
+	var (
+		gs          = newTestGroups(t, root)
+		cmd         = osexec.Command("sleep", "10")
+		ctx, cancel = context.WithCancel(context.Background())
+	)
+	defer cancel()
+
+	if err := gs.Create(groupName, cmd); err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = gs.Remove(groupName) }()
+
+	commandID, ok := gs.CmdID(groupName, cmd)
+	if !ok {
+		t.Fatal("command not found")
+	}
+	stuck := gs.WatchStuck(ctx)
+
+	changes, err := gs.Watch(ctx, groupName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := gs.DetectStuck(groupName, cmd, 300*time.Millisecond, exec.StuckRestart); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case <-time.After(5 * time.Second):
+		t.Fatal("timeout waiting for the command to be stuck")
+	case e := <-stuck:
+		if expected, got := exec.EventStuck, e.Kind; expected != got {
+			t.Fatalf("expected kind %s, got %s", expected, got)
+		}
+		if expected, got := commandID, e.CommandID; expected != got {
+			t.Fatalf("expected command %s, got %s", expected, got)
+		}
+		if e.Stuck == nil || !e.Stuck.Restarted || e.Stuck.Idle < 0.3 {
+			t.Fatalf("unexpected payload %+v", e.Stuck)
+		}
+	}
+	for _, expected := range []exec.State{exec.StateRestarting, exec.StateRunning} {
+		select {
+		case <-time.After(5 * time.Second):
+			t.Fatalf("timeout waiting for %s", expected)
+		case change := <-changes:
+			if got := change.To; expected != got {
+				t.Fatalf("expected state %s, got %s", expected, got)
+			}
+		}
+	}
+	if err := gs.DetectStuck(groupName, cmd, -time.Second, exec.StuckNotify); err == nil {
+		t.Fatal("expected a negative duration to be rejected")
+	}
+}
@@ -0,0 +1,114 @@
+package exec
+
+import (
+	"context"
+	"database/sql"
+	"os/exec"
+	"strings"
+	"syscall"
+
+	"github.com/pkg/errors"
+)
+
+// Swap replaces every command in a group with newCmds without a gap in service.
+// It starts newCmds alongside the running commands and waits for each of them
+// to pass its readiness probe, then records the new set in one transaction
+// and gracefully stops the old commands. If any of newCmds fails to start or
+// to become ready, the new commands are stopped and the old ones keep running.
+// Unlike Replace, the settings and watch lists of the old commands are not
+// carried over, since the new set can differ from the old one.
+func (g *Groups) Swap(groupName string, newCmds ...*exec.Cmd) error {
+	grp := g.getGroup(groupName)
+	if grp == nil {
+		return errors.Errorf("group %s not found", groupName)
+	}
+	var (
+		timeouts  = g.timeouts()
+		oldCmds   = grp.Commands()
+		oldIDs    = make([]string, len(oldCmds))
+		oldHashes = make([]string, len(oldCmds))
+		newIDs    = make([]string, len(newCmds))
+		newHashes = make([]string, len(newCmds))
+	)
+	for i, cmd := range oldCmds {
+		hash, err := GetCmdID(cmd)
+		if err != nil {
+			return errors.Wrap(err, "getting command ID")
+		}
+		oldIDs[i], _ = grp.ID(cmd)
+		oldHashes[i] = hash
+	}
+	for i, cmd := range newCmds {
+		hash, err := GetCmdID(cmd)
+		if err != nil {
+			return errors.Wrap(err, "getting command ID")
+		}
+		newIDs[i], newHashes[i] = newInstanceID(), hash
+	}
+	if err := g.checkQuotaTx(nil, groupName, newHashes, oldHashes); err != nil {
+		return err
+	}
+	started := []*exec.Cmd{}
+	for i, cmd := range newCmds {
+		// The old commands keep running, so the new ones would never get capacity if the limit has been reached.
+		allowed := g.capacity.allowSurge(cmd)
+		err := g.start(cmd, groupName, grp, nil, newIDs[i])
+		allowed()
+
+		if err != nil {
+			return g.abortStart(groupName, grp, started, errors.Wrap(err, "starting new command"))
+		}
+		started = append(started, cmd)
+	}
+	for i, cmd := range newCmds {
+		if err := grp.waitReady(context.Background(), g.readinessProbe(groupName, newHashes[i]), cmd, timeouts.Ready); err != nil {
+			return g.abortStart(groupName, grp, newCmds, errors.Wrap(err, "waiting for new command to be ready"))
+		}
+	}
+	tx, err := g.db.Begin()
+	if err != nil {
+		return g.abortStart(groupName, grp, newCmds, errors.Wrap(err, "starting transaction"))
+	}
+	if err := g.swapTx(tx, groupName, grp, oldIDs, newIDs, newCmds); err != nil {
+		_ = tx.Rollback()
+		return g.abortStart(groupName, grp, newCmds, err)
+	}
+	if err := tx.Commit(); err != nil {
+		return g.abortStart(groupName, grp, newCmds, errors.Wrap(err, "committing transaction"))
+	}
+	errs := []string{}
+	for _, cmd := range oldCmds {
+		grp.retire(cmd)
+
+		if err := grp.stop(cmd, grp.stopSignalOf(cmd, syscall.SIGTERM), timeouts.Stop); err != nil {
+			errs = append(errs, err.Error())
+			continue
+		}
+		grp.drop(cmd)
+	}
+	if len(errs) > 0 {
+		return errors.Errorf("stopping old commands: %s", strings.Join(errs, ", and "))
+	}
+	return nil
+}
+
+// swapTx swaps the commands with instance IDs oldIDs for newCmds, with instance IDs newIDs, in the database.
+func (g *Groups) swapTx(tx *sql.Tx, groupName string, grp *Group, oldIDs, newIDs []string, newCmds []*exec.Cmd) error {
+	if err := g.deleteCmdsTx(tx, groupName, oldIDs...); err != nil {
+		return errors.Wrap(err, "deleting old commands")
+	}
+	if len(oldIDs) > 0 {
+		if err := g.removeWatchTx(tx, groupName, oldIDs...); err != nil {
+			return err
+		}
+		if err := g.removeSettingsTx(tx, groupName, oldIDs...); err != nil {
+			return err
+		}
+	}
+	for i, cmd := range newCmds {
+		if err := g.insertCmd(tx, groupName, newIDs[i], grp.pid(cmd), cmd); err != nil {
+			return errors.Wrap(err, "inserting new command")
+		}
+	}
+	return nil
+}
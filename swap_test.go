@@ -0,0 +1,72 @@
+package exec_test
+
+import (
+	"context"
+	"os"
+	osexec "os/exec"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/scgolang/exec"
+)
+
+func TestGroupsSwap(t *testing.T) {
+	var (
+		groupName = "sleepers"
+		root      = filepath.Join("testdata", "."+t.Name())
+	)
+	_ = os.RemoveAll(root)
+
+	gs := newTestGroups(t, root)
+	defer func() { _ = gs.Remove(groupName) }() // Best effort.
+
+	old := []*osexec.Cmd{osexec.Command("sleep", "10"), osexec.Command("sleep", "10")}
+	if err := gs.Create(groupName, old...); err != nil {
+		t.Fatal(err)
+	}
+	// A new command that fails to start leaves the old set running.
+	if err := gs.Swap(groupName, osexec.Command("sleep", "11"), osexec.Command(filepath.Join(root, "missing"))); err == nil {
+		t.Fatal("expected an error, got nil")
+	}
+	cmds, _ := gs.Commands(groupName)
+	if len(cmds) != 2 || cmds[0] != old[0] || cmds[1] != old[1] {
+		t.Fatalf("expected the old commands to keep running, got %v", cmds)
+	}
+	if expected, got := 2, gs.CapacityStats().Running; expected != got {
+		t.Fatalf("expected %d running, got %d", expected, got)
+	}
+	// So does a new command that does not become ready.
+	gs.SetTimeouts(exec.Timeouts{Ready: 300 * time.Millisecond})
+
+	unready := osexec.Command("sleep", "12")
+	if err := gs.SetReadinessProbe(groupName, unready, exec.ProbeFunc(func(ctx context.Context, cmd *osexec.Cmd) error {
+		return errors.New("not ready")
+	})); err != nil {
+		t.Fatal(err)
+	}
+	if err := gs.Swap(groupName, unready); err == nil {
+		t.Fatal("expected an error, got nil")
+	}
+	if cmds, _ = gs.Commands(groupName); len(cmds) != 2 {
+		t.Fatalf("expected %d commands, got %d", 2, len(cmds))
+	}
+	newCmds := []*osexec.Cmd{osexec.Command("sleep", "11"), osexec.Command("sleep", "12"), osexec.Command("sleep", "13")}
+	if err := gs.SetReadinessProbe(groupName, unready, nil); err != nil {
+		t.Fatal(err)
+	}
+	if err := gs.Swap(groupName, newCmds...); err != nil {
+		t.Fatal(err)
+	}
+	cmds, _ = gs.Commands(groupName)
+	verifyCmdHashes(cmds, newCmds, t)
+
+	_ = gs.Close(groupName)
+
+	cmds, err := gs.Open(groupName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	verifyCmdHashes(cmds, newCmds, t)
+}
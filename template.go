@@ -0,0 +1,183 @@
+package exec
+
+import (
+	"bytes"
+	"sort"
+	"text/template"
+
+	"github.com/pkg/errors"
+)
+
+// GroupTemplate is a set of commands with parameters that groups can be
+// created from, see RegisterTemplate and Instantiate.
+// The strings of the commands, including their policies, are Go templates,
+// see text/template, whose data is the map of parameters, like
+// "--port={{.port}}".
+type GroupTemplate struct {
+	// Params are the names of the parameters of the template, and Defaults
+	// are the values of parameters that do not have to be provided.
+	Params   []string          `json:"params"`
+	Defaults map[string]string `json:"defaults,omitempty"`
+
+	// Quota is the quota of the groups, nil for none.
+	Quota *Quota `json:"quota,omitempty"`
+
+	Commands []CommandSpec `json:"commands"`
+}
+
+// RegisterTemplate registers a group template with the provided name,
+// replacing the template with that name if there is one.
+// Templates are kept in memory.
+func (g *Groups) RegisterTemplate(name string, tmpl GroupTemplate) error {
+	if name == "" {
+		return errors.New("template name must not be empty")
+	}
+	params := map[string]struct{}{}
+	for _, p := range tmpl.Params {
+		params[p] = struct{}{}
+	}
+	for p := range tmpl.Defaults {
+		if _, ok := params[p]; !ok {
+			return errors.Errorf("default of unknown parameter %s", p)
+		}
+	}
+	// Rendering with the defaults checks the syntax of the templates.
+	values := map[string]string{}
+	for _, p := range tmpl.Params {
+		values[p] = tmpl.Defaults[p]
+	}
+	if _, err := tmpl.render(values); err != nil {
+		return errors.Wrapf(err, "template %s", name)
+	}
+	g.templatesMu.Lock()
+	g.templates[name] = tmpl
+	g.templatesMu.Unlock()
+	return nil
+}
+
+// Templates returns the names of the registered templates, sorted.
+func (g *Groups) Templates() []string {
+	g.templatesMu.Lock()
+	defer g.templatesMu.Unlock()
+
+	names := make([]string, 0, len(g.templates))
+	for name := range g.templates {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Instantiate makes a group match the template with the provided name and
+// parameters: the commands of the template are built, see CommandSpec.Build,
+// and applied to the group, see Apply. Every parameter of the template
+// has to be provided unless it has a default, and no other parameters can be.
+// Instantiating a template again with the same parameters is safe.
+func (g *Groups) Instantiate(templateName string, params map[string]string, groupName string) error {
+	g.templatesMu.Lock()
+	tmpl, ok := g.templates[templateName]
+	g.templatesMu.Unlock()
+
+	if !ok {
+		return errors.Errorf("template %s not found", templateName)
+	}
+	values := map[string]string{}
+	for _, p := range tmpl.Params {
+		v, ok := params[p]
+		if !ok {
+			if v, ok = tmpl.Defaults[p]; !ok {
+				return errors.Errorf("parameter %s of template %s is missing", p, templateName)
+			}
+		}
+		values[p] = v
+	}
+	for p := range params {
+		if _, ok := values[p]; !ok {
+			return errors.Errorf("template %s has no parameter %s", templateName, p)
+		}
+	}
+	cmds, err := tmpl.render(values)
+	if err != nil {
+		return errors.Wrapf(err, "rendering template %s", templateName)
+	}
+	for _, cs := range cmds {
+		if _, err := cs.Build(g, groupName); err != nil {
+			return err
+		}
+	}
+	return g.Apply(GroupSpec{
+		Version:  DefinitionVersion,
+		Group:    groupName,
+		Quota:    tmpl.Quota,
+		Commands: cmds,
+	})
+}
+
+// render returns the commands of the template with the provided parameters.
+func (tmpl GroupTemplate) render(values map[string]string) ([]CommandSpec, error) {
+	var (
+		cmds = make([]CommandSpec, len(tmpl.Commands))
+		err  error
+	)
+	render := func(s string) string {
+		if err != nil {
+			return s
+		}
+		var t *template.Template
+		if t, err = template.New("").Option("missingkey=error").Parse(s); err != nil {
+			return s
+		}
+		var buf bytes.Buffer
+		if err = t.Execute(&buf, values); err != nil {
+			return s
+		}
+		return buf.String()
+	}
+	renderAll := func(ss []string) []string {
+		if ss == nil {
+			return nil
+		}
+		out := make([]string, len(ss))
+		for i, s := range ss {
+			out[i] = render(s)
+		}
+		return out
+	}
+	for i, cs := range tmpl.Commands {
+		cs.Name = render(cs.Name)
+		cs.Path = render(cs.Path)
+		cs.Args = renderAll(cs.Args)
+		cs.Env = renderAll(cs.Env)
+		cs.Dir = render(cs.Dir)
+		cs.Watch = renderAll(cs.Watch)
+
+		if cs.Labels != nil {
+			labels := make(map[string]string, len(cs.Labels))
+			for k, v := range cs.Labels {
+				labels[k] = render(v)
+			}
+			cs.Labels = labels
+		}
+		if cs.Policies != nil {
+			p := *cs.Policies
+			p.Setup = renderAll(p.Setup)
+			p.Teardown = renderAll(p.Teardown)
+
+			if p.Conditions != nil {
+				conds := make([]Condition, len(p.Conditions))
+				for j, c := range p.Conditions {
+					conds[j] = Condition{
+						FileExists:   render(c.FileExists),
+						TCPAddr:      render(c.TCPAddr),
+						HTTPGet:      render(c.HTTPGet),
+						GroupRunning: render(c.GroupRunning),
+					}
+				}
+				p.Conditions = conds
+			}
+			cs.Policies = &p
+		}
+		cmds[i] = cs
+	}
+	return cmds, err
+}
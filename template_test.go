@@ -0,0 +1,67 @@
+package exec_test
+
+import (
+	"os"
+	osexec "os/exec"
+	"path/filepath"
+	"testing"
+
+	"github.com/scgolang/exec"
+)
+
+func TestGroupsInstantiate(t *testing.T) {
+	root := filepath.Join("testdata", "."+t.Name())
+	_ = os.RemoveAll(root)
+
+	gs := newTestGroups(t, root)
+	path, err := osexec.LookPath("sleep")
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl := exec.GroupTemplate{
+		Params:   []string{"customer", "secs"},
+		Defaults: map[string]string{"secs": "10"},
+		Commands: []exec.CommandSpec{{
+			Name: "worker-{{.customer}}",
+			Path: path,
+			Args: []string{"sleep", "{{.secs}}"},
+			Env:  []string{"CUSTOMER={{.customer}}"},
+		}},
+	}
+	if err := gs.RegisterTemplate("worker", tmpl); err != nil {
+		t.Fatal(err)
+	}
+	if err := gs.Instantiate("worker", map[string]string{"customer": "acme"}, "acme"); err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = gs.Remove("acme") }()
+
+	cmds, ok := gs.Commands("acme")
+	if !ok || len(cmds) != 1 {
+		t.Fatalf("expected one command, got %+v", cmds)
+	}
+	if expected, got := "CUSTOMER=acme", cmds[0].Env[0]; expected != got {
+		t.Fatalf("expected %s, got %s", expected, got)
+	}
+	if expected, got := "10", cmds[0].Args[1]; expected != got {
+		t.Fatalf("expected the default %s, got %s", expected, got)
+	}
+	if _, err := gs.FindCommand("acme", "worker-acme"); err != nil {
+		t.Fatal(err)
+	}
+	for _, params := range []map[string]string{
+		{},
+		{"customer": "acme", "other": "x"},
+	} {
+		if err := gs.Instantiate("worker", params, "broken"); err == nil {
+			t.Fatalf("expected an error for %v, got nil", params)
+		}
+	}
+	tmpl.Commands[0].Args = []string{"sleep", "{{.secs"}
+	if err := gs.RegisterTemplate("broken", tmpl); err == nil {
+		t.Fatal("expected an error, got nil")
+	}
+	if expected, got := []string{"worker"}, gs.Templates(); len(got) != 1 || got[0] != expected[0] {
+		t.Fatalf("expected %v, got %v", expected, got)
+	}
+}
@@ -0,0 +1,101 @@
+package exec
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// Tenant is the configuration of a namespace of a Registry that is used by
+// a user or application of its own, see SetTenant.
+type Tenant struct {
+	Quota TenantQuota
+
+	// Auth authenticates the clients of the namespace, see Registry.Handler.
+	Auth *Authenticator
+}
+
+// TenantQuota limits the commands of a namespace. Zero values mean there is no limit.
+type TenantQuota struct {
+	// MaxCommands is how many commands the groups of the namespace can have together, see SetTotalQuota.
+	MaxCommands int
+
+	// MaxRunning is how many processes the namespace can run at the same time, see SetMaxRunning.
+	MaxRunning int
+}
+
+// SetTenant configures a namespace for a tenant: it applies the quota of
+// the tenant to the Groups of the namespace, and uses its authenticator for
+// the requests that Handler serves for the namespace.
+// The root and database of the namespace are already its own, see Add.
+func (r *Registry) SetTenant(namespace string, tenant Tenant) error {
+	g, err := r.Get(namespace)
+	if err != nil {
+		return err
+	}
+	if err := g.SetTotalQuota(tenant.Quota.MaxCommands); err != nil {
+		return err
+	}
+	if err := g.SetMaxRunning(tenant.Quota.MaxRunning); err != nil {
+		return err
+	}
+	r.mu.Lock()
+	r.tenants[namespace] = tenant
+	r.mu.Unlock()
+	return nil
+}
+
+// Handler returns an HTTP handler that serves /<namespace>/healthz with the
+// HealthHandler and /<namespace>/debug/exec with the DebugHandler of a
+// namespace, to clients that the authenticator of its tenant knows, with at
+// least RoleReadOnly. Requests for namespaces that do not have a tenant with
+// an authenticator are refused, so that one tenant can not see another.
+// Runtime profiles are not served, since they are not specific to a namespace.
+func (r *Registry) Handler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		parts := strings.SplitN(strings.TrimPrefix(req.URL.Path, "/"), "/", 2)
+		if len(parts) < 2 {
+			http.NotFound(w, req)
+			return
+		}
+		namespace, rest := parts[0], "/"+parts[1]
+
+		h, err := r.tenantHandler(namespace, rest)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusNotFound)
+			return
+		}
+		http.StripPrefix("/"+namespace, h).ServeHTTP(w, req)
+	})
+}
+
+// tenantHandler returns the handler of a namespace for a path within it.
+func (r *Registry) tenantHandler(namespace, path string) (http.Handler, error) {
+	r.mu.RLock()
+	var (
+		g, ok  = r.groups[namespace]
+		tenant = r.tenants[namespace]
+	)
+	r.mu.RUnlock()
+
+	if !ok {
+		return nil, errors.Errorf("namespace %s not found", namespace)
+	}
+	var h http.Handler
+
+	switch path {
+	default:
+		return nil, errors.Errorf("%s not found", path)
+	case "/healthz":
+		h = g.HealthHandler()
+	case "/debug/exec":
+		h = g.DebugHandler(DebugOptions{})
+	}
+	if tenant.Auth == nil {
+		return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+			http.Error(w, "namespace does not accept requests", http.StatusForbidden)
+		}), nil
+	}
+	return tenant.Auth.Require(RoleReadOnly, h), nil
+}
@@ -0,0 +1,85 @@
+package exec_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	osexec "os/exec"
+	"path/filepath"
+	"testing"
+
+	"github.com/scgolang/exec"
+)
+
+func TestRegistryTenants(t *testing.T) {
+	var (
+		root = filepath.Join("testdata", "."+t.Name())
+		reg  = exec.NewRegistry()
+	)
+	_ = os.RemoveAll(root)
+
+	if err := os.MkdirAll(root, exec.DirPerms); err != nil {
+		t.Fatal(err)
+	}
+	a, err := reg.Add("a", filepath.Join(root, "a"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := reg.Add("b", filepath.Join(root, "b")); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := reg.Add("c", filepath.Join(root, "c")); err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _, _ = a.Remove("sleepers"), a.Remove("others") }() // Best effort.
+
+	for _, ns := range []string{"a", "b"} {
+		auth, err := exec.NewAuthenticator()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := auth.AddToken("token-"+ns, exec.Client{Name: ns, Role: exec.RoleReadOnly}); err != nil {
+			t.Fatal(err)
+		}
+		if err := reg.SetTenant(ns, exec.Tenant{Quota: exec.TenantQuota{MaxCommands: 2}, Auth: auth}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := reg.SetTenant("nope", exec.Tenant{}); err == nil {
+		t.Fatal("expected an error for an unknown namespace, got nil")
+	}
+	// The quota of a tenant applies to all its groups together.
+	if err := a.Create("sleepers", osexec.Command("sleep", "10")); err != nil {
+		t.Fatal(err)
+	}
+	if err := a.Create("others", osexec.Command("sleep", "11")); err != nil {
+		t.Fatal(err)
+	}
+	verifyQuotaError(a.Create("others", osexec.Command("sleep", "12")), exec.QuotaTotal, t)
+
+	handler := reg.Handler()
+
+	for _, tc := range []struct {
+		path   string
+		token  string
+		status int
+	}{
+		{path: "/a/healthz", token: "token-a", status: http.StatusOK},
+		{path: "/a/debug/exec", token: "token-a", status: http.StatusOK},
+		{path: "/a/healthz", token: "token-b", status: http.StatusUnauthorized},
+		{path: "/b/healthz", token: "token-b", status: http.StatusOK},
+		{path: "/c/healthz", token: "token-a", status: http.StatusForbidden},
+		{path: "/d/healthz", token: "token-a", status: http.StatusNotFound},
+		{path: "/a/debug/pprof/heap", token: "token-a", status: http.StatusNotFound},
+	} {
+		req := httptest.NewRequest("GET", tc.path, nil)
+		req.Header.Set("Authorization", "Bearer "+tc.token)
+
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+
+		if expected, got := tc.status, rec.Code; expected != got {
+			t.Fatalf("%s with %s: expected status %d, got %d", tc.path, tc.token, expected, got)
+		}
+	}
+}
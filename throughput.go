@@ -0,0 +1,114 @@
+package exec
+
+import (
+	"bytes"
+	"os/exec"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// throughputWindow is the number of seconds that output rates are averaged over.
+const throughputWindow = 10
+
+// Throughput is how much output a command has written, see WithOutputMetrics.
+type Throughput struct {
+	// Bytes and Lines are how much output has been captured
+	// from every run of the command, on stdout and stderr.
+	Bytes int64 `json:"bytes"`
+	Lines int64 `json:"lines"`
+
+	// BytesPerSec and LinesPerSec are the average rates of the output
+	// over the last throughputWindow seconds.
+	BytesPerSec float64 `json:"bytes_per_sec"`
+	LinesPerSec float64 `json:"lines_per_sec"`
+
+	// LastOutput is when output was last captured.
+	// It is zero if the command has not written any.
+	LastOutput time.Time `json:"last_output,omitempty"`
+}
+
+// meter counts the output of a command in one-second buckets.
+type meter struct {
+	bytes, lines int64
+	last         time.Time
+
+	// buckets holds the bytes and lines captured in each of the last
+	// throughputWindow seconds, indexed by the Unix time modulo the window.
+	buckets [throughputWindow]struct {
+		sec          int64
+		bytes, lines int64
+	}
+	mu sync.Mutex
+}
+
+// add counts p, which was captured at now.
+func (m *meter) add(p []byte, now time.Time) {
+	lines := int64(bytes.Count(p, []byte{'\n'}))
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.bytes += int64(len(p))
+	m.lines += lines
+	m.last = now
+
+	sec := now.Unix()
+	b := &m.buckets[sec%throughputWindow]
+	if b.sec != sec {
+		b.sec, b.bytes, b.lines = sec, 0, 0
+	}
+	b.bytes += int64(len(p))
+	b.lines += lines
+}
+
+// throughput returns the totals and the rates of the output as of now.
+func (m *meter) throughput(now time.Time) Throughput {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	t := Throughput{Bytes: m.bytes, Lines: m.lines, LastOutput: m.last}
+
+	sec := now.Unix()
+	for _, b := range m.buckets {
+		if b.sec > sec-throughputWindow && b.sec <= sec {
+			t.BytesPerSec += float64(b.bytes)
+			t.LinesPerSec += float64(b.lines)
+		}
+	}
+	t.BytesPerSec /= throughputWindow
+	t.LinesPerSec /= throughputWindow
+	return t
+}
+
+// meter returns the meter of the command with the provided instance ID,
+// creating it if it does not exist.
+func (g *Groups) meter(groupName, commandID string) *meter {
+	g.metersMu.Lock()
+	defer g.metersMu.Unlock()
+
+	key := groupName + "/" + commandID
+	m, ok := g.meters[key]
+	if !ok {
+		m = &meter{}
+		g.meters[key] = m
+	}
+	return m
+}
+
+// Throughput returns how much output a command in an open group has written.
+// The groups must have been created with WithOutputMetrics.
+func (g *Groups) Throughput(groupName string, cmd *exec.Cmd) (Throughput, error) {
+	if !g.metrics {
+		return Throughput{}, errors.New("output metrics are not enabled, see WithOutputMetrics")
+	}
+	if g.getGroup(groupName) == nil {
+		return Throughput{}, errors.Errorf("group %s not found", groupName)
+	}
+	commandID, err := g.cmdID(groupName, cmd)
+	if err != nil {
+		return Throughput{}, errors.Wrap(err, "getting command ID")
+	}
+	return g.meter(groupName, commandID).throughput(g.clock.Now()), nil
+}
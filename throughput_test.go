@@ -0,0 +1,58 @@
+package exec_test
+
+import (
+	"os"
+	osexec "os/exec"
+	"path/filepath"
+	"testing"
+
+	"github.com/scgolang/exec"
+)
+
+func TestGroupsThroughput(t *testing.T) {
+	var (
+		groupName = "printer"
+		root      = filepath.Join("testdata", "."+t.Name())
+	)
+	_ = os.RemoveAll(root)
+
+	gs, err := exec.New(root, exec.WithOutputMetrics())
+	if err != nil {
+		t.Fatal(err)
+	}
+	cmd := osexec.Command("sh", "-c", "echo foo; echo bar >&2")
+
+	if err := gs.Create(groupName, cmd); err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = gs.Remove(groupName) }()
+
+	if err := gs.Wait(groupName); err != nil {
+		t.Fatal(err)
+	}
+	tp, err := gs.Throughput(groupName, cmd)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected, got := int64(8), tp.Bytes; expected != got {
+		t.Fatalf("expected %d bytes, got %d", expected, got)
+	}
+	if expected, got := int64(2), tp.Lines; expected != got {
+		t.Fatalf("expected %d lines, got %d", expected, got)
+	}
+	if tp.BytesPerSec <= 0 || tp.LastOutput.IsZero() {
+		t.Fatalf("expected a rate and a last output time, got %+v", tp)
+	}
+	statuses, err := gs.Statuses(groupName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for id, status := range statuses {
+		if status.Output == nil || status.Output.Lines != 2 {
+			t.Fatalf("expected the status of %s to have the output, got %+v", id, status.Output)
+		}
+	}
+	if _, err := newTestGroups(t, filepath.Join(root, "off")).Throughput(groupName, cmd); err == nil {
+		t.Fatal("expected an error without output metrics")
+	}
+}
@@ -0,0 +1,102 @@
+package exec
+
+import (
+	"context"
+	"os/exec"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// Timeouts configures how long operations on groups wait.
+// Zero values mean the value in DefaultTimeouts is used.
+type Timeouts struct {
+	// Close is how long Close waits for the commands of a group to exit
+	// after they have been sent their stop signal, before they are killed,
+	// and then how long it waits for them to have been killed.
+	Close time.Duration
+
+	// Remove is how long Remove waits for a command to exit after it has
+	// been sent its stop signal, before it is killed.
+	Remove time.Duration
+
+	// Stop is how long a command that is being stopped gracefully,
+	// restarted, or replaced has to exit after it has been sent SIGTERM,
+	// before it is killed.
+	Stop time.Duration
+
+	// Wait is how long Wait waits for the commands of a group to finish.
+	Wait time.Duration
+
+	// Ready is how long a command has to pass its readiness probe.
+	Ready time.Duration
+
+	// Conditions is how long a command waits for its start conditions to hold.
+	Conditions time.Duration
+}
+
+// DefaultTimeouts are the timeouts used by Groups unless they are changed with SetTimeouts.
+var DefaultTimeouts = Timeouts{
+	Close:      2 * time.Second,
+	Remove:     2 * time.Second,
+	Stop:       2 * time.Second,
+	Wait:       10 * time.Second,
+	Ready:      30 * time.Second,
+	Conditions: 30 * time.Second,
+}
+
+// withDefaults returns t with its zero values replaced by the defaults.
+func (t Timeouts) withDefaults() Timeouts {
+	if t.Close == 0 {
+		t.Close = DefaultTimeouts.Close
+	}
+	if t.Remove == 0 {
+		t.Remove = DefaultTimeouts.Remove
+	}
+	if t.Stop == 0 {
+		t.Stop = DefaultTimeouts.Stop
+	}
+	if t.Wait == 0 {
+		t.Wait = DefaultTimeouts.Wait
+	}
+	if t.Ready == 0 {
+		t.Ready = DefaultTimeouts.Ready
+	}
+	if t.Conditions == 0 {
+		t.Conditions = DefaultTimeouts.Conditions
+	}
+	return t
+}
+
+// SetTimeouts sets the timeouts used by operations on the groups.
+func (g *Groups) SetTimeouts(t Timeouts) {
+	g.timeoutsMu.Lock()
+	g.timeoutsCfg = t
+	g.timeoutsMu.Unlock()
+}
+
+// timeouts returns the timeouts used by operations on the groups.
+func (g *Groups) timeouts() Timeouts {
+	g.timeoutsMu.Lock()
+	defer g.timeoutsMu.Unlock()
+	return g.timeoutsCfg.withDefaults()
+}
+
+// CloseTimeout is Close with a timeout that overrides Timeouts.Close.
+func (g *Groups) CloseTimeout(groupName string, timeout time.Duration) error {
+	return g.close(context.Background(), groupName, timeout)
+}
+
+// RemoveTimeout is Remove with a timeout that overrides Timeouts.Remove.
+func (g *Groups) RemoveTimeout(groupName string, timeout time.Duration, cmds ...*exec.Cmd) error {
+	return g.remove(groupName, timeout, cmds...)
+}
+
+// WaitTimeout is Wait with a timeout that overrides Timeouts.Wait.
+func (g *Groups) WaitTimeout(groupName string, timeout time.Duration) error {
+	grp := g.getGroup(groupName)
+	if grp == nil {
+		return errors.Errorf("group %s not found", groupName)
+	}
+	return grp.Wait(timeout)
+}
@@ -0,0 +1,42 @@
+package exec_test
+
+import (
+	"os"
+	osexec "os/exec"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/scgolang/exec"
+)
+
+func TestGroupsTimeouts(t *testing.T) {
+	var (
+		groupName = "sleepers"
+		root      = filepath.Join("testdata", "."+t.Name())
+	)
+	_ = os.RemoveAll(root)
+
+	gs := newTestGroups(t, root)
+	defer func() { _ = gs.Remove(groupName) }() // Best effort.
+
+	gs.SetTimeouts(exec.Timeouts{Wait: 100 * time.Millisecond})
+
+	if err := gs.Create(groupName, osexec.Command("sleep", "10")); err != nil {
+		t.Fatal(err)
+	}
+	start := time.Now()
+
+	if err := gs.Wait(groupName); err == nil {
+		t.Fatal("expected an error, got nil")
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Fatalf("expected Wait to time out after 100ms, took %s", elapsed)
+	}
+	if err := gs.WaitTimeout(groupName, 50*time.Millisecond); err == nil {
+		t.Fatal("expected an error, got nil")
+	}
+	if err := gs.WaitTimeout("nope", time.Second); err == nil {
+		t.Fatal("expected an error, got nil")
+	}
+}
@@ -0,0 +1,111 @@
+package exec
+
+import (
+	"context"
+	"os/exec"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// bakeProbeInterval is the time between health checks of a canary.
+const bakeProbeInterval = time.Second
+
+// UpdateOptions configures how Update replaces commands.
+type UpdateOptions struct {
+	// Canary replaces the first command on its own and watches it for
+	// Bake before replacing the rest. If the canary exits or fails its
+	// readiness probe during that time it is rolled back and the update
+	// is abandoned.
+	Canary bool
+
+	// Bake is how long the canary has to stay healthy.
+	Bake time.Duration
+}
+
+// Update replaces each of the commands with the IDs in cmdIDs with the
+// command at the same index in newCmds, one at a time, using Replace.
+// This is meant for replicas of a command, for example the same server
+// listening on different ports.
+func (g *Groups) Update(groupName string, cmdIDs []string, newCmds []*exec.Cmd, opts UpdateOptions) error {
+	if len(cmdIDs) != len(newCmds) {
+		return errors.Errorf("got %d command IDs and %d new commands", len(cmdIDs), len(newCmds))
+	}
+	if len(cmdIDs) == 0 {
+		return nil
+	}
+	if opts.Canary {
+		if err := g.canary(groupName, cmdIDs[0], newCmds[0], opts.Bake); err != nil {
+			return errors.Wrap(err, "canary")
+		}
+		cmdIDs, newCmds = cmdIDs[1:], newCmds[1:]
+	}
+	for i, cmdID := range cmdIDs {
+		if err := g.Replace(groupName, cmdID, newCmds[i]); err != nil {
+			return errors.Wrapf(err, "replacing %s", cmdID)
+		}
+	}
+	return nil
+}
+
+// canary replaces a single command and watches it for bake.
+// If it does not stay healthy the old command is restored.
+func (g *Groups) canary(groupName, cmdID string, newCmd *exec.Cmd, bake time.Duration) error {
+	grp := g.getGroup(groupName)
+	if grp == nil {
+		return errors.Errorf("group %s not found", groupName)
+	}
+	old := grp.lookup(cmdID)
+	if old == nil {
+		return errors.Errorf("command %s not found in group %s", cmdID, groupName)
+	}
+	newHash, err := GetCmdID(newCmd)
+	if err != nil {
+		return errors.Wrap(err, "getting command ID")
+	}
+	oldHash, err := GetCmdID(old)
+	if err != nil {
+		return errors.Wrap(err, "getting command ID")
+	}
+	if err := g.Replace(groupName, cmdID, newCmd); err != nil {
+		return err
+	}
+	newID, _ := grp.ID(newCmd)
+
+	bakeErr := grp.bake(g.readinessProbe(groupName, newHash, oldHash), newCmd, bake)
+	if bakeErr == nil {
+		return nil
+	}
+	if err := g.Replace(groupName, newID, cloneCmd(old)); err != nil {
+		return errors.Wrapf(err, "rolling back after %s", bakeErr)
+	}
+	return errors.Wrap(bakeErr, "rolled back")
+}
+
+// bake returns an error if cmd exits or fails probe within d.
+func (grp *Group) bake(probe Probe, cmd *exec.Cmd, d time.Duration) error {
+	exited, ok := grp.exitedChan(cmd)
+	if !ok {
+		return errors.New("command exited")
+	}
+	deadline := grp.clock.After(d)
+
+	for {
+		select {
+		case <-deadline:
+			return nil
+		case <-exited:
+			return errors.New("command exited")
+		case <-grp.clock.After(bakeProbeInterval):
+			if probe == nil {
+				continue
+			}
+			ctx, cancel := context.WithTimeout(context.Background(), bakeProbeInterval)
+			err := probe.Probe(ctx, cmd)
+			cancel()
+			if err != nil {
+				return errors.Wrap(err, "probe failed")
+			}
+		}
+	}
+}
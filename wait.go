@@ -0,0 +1,230 @@
+package exec
+
+import (
+	"context"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// stateCheckInterval is how often state waits re-check the state of a command,
+// in case they miss a state change notification.
+const stateCheckInterval = 100 * time.Millisecond
+
+// waitProgressInterval is how often WaitAll reports progress while nothing finishes.
+const waitProgressInterval = time.Second
+
+// WaitForState blocks until the command with the provided ID is in state.
+// cmdID is the instance ID of the command or its content hash.
+// It returns an error if ctx is done first, or if the command ends up exited,
+// failed, or stopped without ever reaching state.
+func (g *Groups) WaitForState(ctx context.Context, groupName, cmdID string, state State) error {
+	grp := g.getGroup(groupName)
+	if grp == nil {
+		return errors.Errorf("group %s not found", groupName)
+	}
+	return grp.waitFor(ctx, func() (bool, error) {
+		cmd := grp.lookup(cmdID)
+		if cmd == nil {
+			return false, errors.Errorf("command %s not found in group %s", cmdID, groupName)
+		}
+		return reached(cmdID, grp.State(cmd), state)
+	})
+}
+
+// WaitForGroupState blocks until every command in the group is in state.
+// It returns an error if ctx is done first, or if any command ends up exited,
+// failed, or stopped without ever reaching state.
+func (g *Groups) WaitForGroupState(ctx context.Context, groupName string, state State) error {
+	grp := g.getGroup(groupName)
+	if grp == nil {
+		return errors.Errorf("group %s not found", groupName)
+	}
+	return grp.waitFor(ctx, func() (bool, error) {
+		for id, status := range grp.Statuses() {
+			ok, err := reached(id, status.State, state)
+			if !ok || err != nil {
+				return false, err
+			}
+		}
+		return true, nil
+	})
+}
+
+// WaitUntilRunning blocks until the command with the provided ID is running.
+func (g *Groups) WaitUntilRunning(ctx context.Context, groupName, cmdID string) error {
+	return g.WaitForState(ctx, groupName, cmdID, StateRunning)
+}
+
+// WaitUntilReady blocks until the command with the provided ID is running
+// and passes its readiness probe, see SetReadinessProbe.
+func (g *Groups) WaitUntilReady(ctx context.Context, groupName, cmdID string) error {
+	if err := g.WaitUntilRunning(ctx, groupName, cmdID); err != nil {
+		return err
+	}
+	grp := g.getGroup(groupName)
+	if grp == nil {
+		return errors.Errorf("group %s not found", groupName)
+	}
+	cmd := grp.lookup(cmdID)
+	if cmd == nil {
+		return errors.Errorf("command %s not found in group %s", cmdID, groupName)
+	}
+	hash, err := GetCmdID(cmd)
+	if err != nil {
+		return errors.Wrap(err, "getting command ID")
+	}
+	return grp.waitReadyContext(ctx, g.readinessProbe(groupName, hash), cmd)
+}
+
+// WaitUntilExited blocks until the command with the provided ID has exited successfully.
+func (g *Groups) WaitUntilExited(ctx context.Context, groupName, cmdID string) error {
+	return g.WaitForState(ctx, groupName, cmdID, StateExited)
+}
+
+// WaitProgress is how far WaitAll has got.
+type WaitProgress struct {
+	// Total is the number of commands that WaitAll is waiting for.
+	Total int
+
+	// Remaining are the instance IDs of the commands that have not
+	// finished, keyed by group.
+	Remaining map[string][]string
+}
+
+// Count returns the number of commands that have not finished.
+func (p WaitProgress) Count() int {
+	n := 0
+	for _, ids := range p.Remaining {
+		n += len(ids)
+	}
+	return n
+}
+
+// WaitAll blocks until every command of every open group has exited,
+// failed, or been stopped, or ctx is done. Commands that are restarting
+// have not finished. Groups that are closed or removed while WaitAll is
+// waiting are not waited for, and neither are groups opened after it was called.
+// If progress is not nil it is called with the commands that remain as soon as
+// WaitAll is called, every time a command finishes, and periodically in between.
+// It returns an error naming the commands that failed, if any did.
+func (g *Groups) WaitAll(ctx context.Context, progress func(WaitProgress)) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	g.groupsMu.RLock()
+	var (
+		names   = make([]string, 0, len(g.groups))
+		changes = make(chan struct{}, 1)
+	)
+	for name, grp := range g.groups {
+		names = append(names, name)
+
+		go func(ch <-chan StateChange) {
+			for range ch {
+				select {
+				case changes <- struct{}{}:
+				default:
+				}
+			}
+		}(grp.Watch(ctx))
+	}
+	g.groupsMu.RUnlock()
+
+	var (
+		reported = -1
+		lastSent time.Time
+	)
+	for {
+		p, failed := g.waitProgress(names)
+
+		if progress != nil && (p.Count() != reported || g.clock.Now().Sub(lastSent) >= waitProgressInterval) {
+			progress(p)
+			reported, lastSent = p.Count(), g.clock.Now()
+		}
+		if p.Count() == 0 {
+			if len(failed) > 0 {
+				return errors.Errorf("commands failed: %s", strings.Join(failed, ", "))
+			}
+			return nil
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-changes:
+		case <-g.clock.After(stateCheckInterval):
+		}
+	}
+}
+
+// waitProgress returns the commands of the named groups that have not
+// finished, and the commands that failed, as group/instance ID.
+func (g *Groups) waitProgress(names []string) (WaitProgress, []string) {
+	var (
+		p      = WaitProgress{Remaining: map[string][]string{}}
+		failed = []string{}
+	)
+	for _, name := range names {
+		grp := g.getGroup(name)
+		if grp == nil {
+			continue
+		}
+		for id, status := range grp.Statuses() {
+			p.Total++
+
+			switch status.State {
+			case StateExited, StateStopped:
+			case StateFailed:
+				failed = append(failed, name+"/"+id)
+			default:
+				p.Remaining[name] = append(p.Remaining[name], id)
+			}
+		}
+		sort.Strings(p.Remaining[name])
+	}
+	sort.Strings(failed)
+	return p, failed
+}
+
+// waitFor blocks until check returns true or an error, or ctx is done.
+// check is called every time a command in the group changes state.
+func (grp *Group) waitFor(ctx context.Context, check func() (bool, error)) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	changes := grp.Watch(ctx)
+
+	for {
+		ok, err := check()
+		if err != nil {
+			return err
+		}
+		if ok {
+			return nil
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case _, ok := <-changes:
+			if !ok {
+				return ctx.Err()
+			}
+		case <-grp.clock.After(stateCheckInterval):
+		}
+	}
+}
+
+// reached reports whether a command in state from has reached state to.
+// It returns an error if the command is in a final state other than to.
+func reached(commandID string, from, to State) (bool, error) {
+	if from == to {
+		return true, nil
+	}
+	switch from {
+	case StateExited, StateFailed, StateStopped:
+		return false, errors.Errorf("command %s is %s", commandID, from)
+	}
+	return false, nil
+}
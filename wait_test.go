@@ -0,0 +1,91 @@
+package exec_test
+
+import (
+	"context"
+	"os"
+	osexec "os/exec"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/scgolang/exec"
+)
+
+func TestGroupsWaitForState(t *testing.T) {
+	var (
+		groupName = "sleepers"
+		root      = filepath.Join("testdata", "."+t.Name())
+	)
+	_ = os.RemoveAll(root)
+
+	var (
+		gs          = newTestGroups(t, root)
+		short       = osexec.Command("sleep", "0.2")
+		long        = osexec.Command("sleep", "10")
+		ctx, cancel = context.WithTimeout(context.Background(), 5*time.Second)
+	)
+	defer cancel()
+	defer func() { _ = gs.Remove(groupName) }() // Best effort.
+
+	if err := gs.Create(groupName, short, long); err != nil {
+		t.Fatal(err)
+	}
+	shortID, _ := gs.CmdID(groupName, short)
+	longID, _ := gs.CmdID(groupName, long)
+
+	if err := gs.WaitUntilRunning(ctx, groupName, longID); err != nil {
+		t.Fatal(err)
+	}
+	if err := gs.WaitUntilReady(ctx, groupName, longID); err != nil {
+		t.Fatal(err)
+	}
+	if err := gs.WaitUntilExited(ctx, groupName, shortID); err != nil {
+		t.Fatal(err)
+	}
+	if err := gs.WaitForState(ctx, groupName, shortID, exec.StateRunning); err == nil {
+		t.Fatal("expected an error waiting for an exited command to run, got nil")
+	}
+	shortCtx, cancelShort := context.WithTimeout(ctx, 100*time.Millisecond)
+	defer cancelShort()
+
+	if err := gs.WaitForGroupState(shortCtx, groupName, exec.StateRunning); err == nil {
+		t.Fatal("expected an error, got nil")
+	}
+}
+
+func TestGroupsWaitAll(t *testing.T) {
+	root := filepath.Join("testdata", "."+t.Name())
+	_ = os.RemoveAll(root)
+
+	var (
+		gs          = newTestGroups(t, root)
+		ctx, cancel = context.WithTimeout(context.Background(), 5*time.Second)
+	)
+	defer cancel()
+
+	if err := gs.Create("quick", osexec.Command("sleep", "0.1")); err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = gs.Remove("quick") }() // Best effort.
+
+	if err := gs.Create("slow", osexec.Command("sleep", "0.5"), osexec.Command("false")); err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = gs.Remove("slow") }() // Best effort.
+
+	var reports []exec.WaitProgress
+
+	err := gs.WaitAll(ctx, func(p exec.WaitProgress) { reports = append(reports, p) })
+	if err == nil {
+		t.Fatal("expected an error for the command that failed, got nil")
+	}
+	if len(reports) < 2 {
+		t.Fatalf("expected progress to be reported more than once, got %+v", reports)
+	}
+	if first := reports[0]; first.Total != 3 || first.Count() == 0 {
+		t.Fatalf("expected the first report to have remaining commands, got %+v", first)
+	}
+	if last := reports[len(reports)-1]; last.Count() != 0 {
+		t.Fatalf("expected no commands to remain, got %+v", last)
+	}
+}
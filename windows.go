@@ -0,0 +1,204 @@
+package exec
+
+import (
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// TimeWindow is a range of the time of day, like 09:00-17:00.
+type TimeWindow struct {
+	// Start and End are times of day, as offsets from midnight.
+	// A window whose End is not after its Start spans midnight.
+	Start time.Duration `json:"start"`
+	End   time.Duration `json:"end"`
+
+	// Weekdays, if not empty, are the days that the window starts on.
+	Weekdays []time.Weekday `json:"weekdays,omitempty"`
+}
+
+// ParseTimeWindow parses a window like "09:00-17:00" or "22:30-06:00".
+func ParseTimeWindow(s string) (TimeWindow, error) {
+	parts := strings.Split(s, "-")
+	if len(parts) != 2 {
+		return TimeWindow{}, errors.Errorf("time window %q is not like 09:00-17:00", s)
+	}
+	var (
+		w   TimeWindow
+		tod = []*time.Duration{&w.Start, &w.End}
+	)
+	for i, part := range parts {
+		t, err := time.Parse("15:04", strings.TrimSpace(part))
+		if err != nil {
+			return TimeWindow{}, errors.Wrapf(err, "parsing time window %q", s)
+		}
+		*tod[i] = time.Duration(t.Hour())*time.Hour + time.Duration(t.Minute())*time.Minute
+	}
+	return w, nil
+}
+
+// contains returns true if t is within the window.
+func (w TimeWindow) contains(t time.Time) bool {
+	var (
+		tod = timeOfDay(t)
+		day = t.Weekday()
+	)
+	switch {
+	case w.End > w.Start:
+		if tod < w.Start || tod >= w.End {
+			return false
+		}
+	case tod >= w.Start:
+	case tod < w.End:
+		day = (day + 6) % 7 // The window started the day before.
+	default:
+		return false
+	}
+	if len(w.Weekdays) == 0 {
+		return true
+	}
+	for _, wd := range w.Weekdays {
+		if wd == day {
+			return true
+		}
+	}
+	return false
+}
+
+// RunWindows decide when a command can be started, see WithRunWindows.
+type RunWindows struct {
+	// Allowed, if not empty, are the windows that the command can start in.
+	Allowed []TimeWindow `json:"allowed,omitempty"`
+
+	// Blocked are windows that the command can not start in,
+	// even if they overlap with an allowed window.
+	Blocked []TimeWindow `json:"blocked,omitempty"`
+
+	// TimeZone, if not empty, is the IANA name of the time zone that the
+	// windows are in, like "Europe/Berlin". Otherwise they are in the time
+	// zone of the clock of the groups. Windows follow the clock of the zone
+	// across daylight saving time transitions: a window that starts at a
+	// time that is skipped, like 02:30 when clocks go from 02:00 to 03:00,
+	// starts as much later as the clocks went forward.
+	TimeZone string `json:"time_zone,omitempty"`
+}
+
+// location returns the time zone of the windows, or loc if they do not have one.
+func (rw RunWindows) location(loc *time.Location) *time.Location {
+	if rw.TimeZone == "" {
+		return loc
+	}
+	if l, err := time.LoadLocation(rw.TimeZone); err == nil {
+		return l
+	}
+	return loc // The time zone was checked by validate.
+}
+
+// validate returns an error if any of the windows is out of range
+// or the time zone is not known.
+func (rw RunWindows) validate() error {
+	if rw.TimeZone != "" {
+		if _, err := time.LoadLocation(rw.TimeZone); err != nil {
+			return errors.Wrap(err, "loading time zone")
+		}
+	}
+	for _, w := range append(append([]TimeWindow{}, rw.Allowed...), rw.Blocked...) {
+		if w.Start < 0 || w.Start >= 24*time.Hour || w.End < 0 || w.End >= 24*time.Hour {
+			return errors.Errorf("time window %s-%s is not within a day", w.Start, w.End)
+		}
+	}
+	return nil
+}
+
+// allows returns true if a command can start at t.
+func (rw RunWindows) allows(t time.Time) bool {
+	t = t.In(rw.location(t.Location()))
+
+	for _, w := range rw.Blocked {
+		if w.contains(t) {
+			return false
+		}
+	}
+	if len(rw.Allowed) == 0 {
+		return true
+	}
+	for _, w := range rw.Allowed {
+		if w.contains(t) {
+			return true
+		}
+	}
+	return false
+}
+
+// next returns the first time from t on that a command can start.
+// It returns false if there is no such time within a week.
+func (rw RunWindows) next(t time.Time) (time.Time, bool) {
+	t = t.In(rw.location(t.Location()))
+
+	if rw.allows(t) {
+		return t, true
+	}
+	// A command can only become able to start when an allowed window opens
+	// or a blocked one closes.
+	var opens []time.Duration
+	for _, w := range rw.Allowed {
+		opens = append(opens, w.Start)
+	}
+	for _, w := range rw.Blocked {
+		opens = append(opens, w.End)
+	}
+	candidates := []time.Time{}
+
+	for day := 0; day <= 7; day++ {
+		for _, tod := range opens {
+			if c := atTimeOfDay(t, day, tod); c.After(t) {
+				candidates = append(candidates, c)
+			}
+		}
+	}
+	sort.Slice(candidates, func(i, j int) bool { return candidates[i].Before(candidates[j]) })
+
+	for _, c := range candidates {
+		if rw.allows(c) {
+			return c, true
+		}
+	}
+	return time.Time{}, false
+}
+
+// timeOfDay returns the time of day of t as an offset from midnight,
+// as shown on a clock rather than as time elapsed, which differs on days
+// that daylight saving time starts or ends.
+func timeOfDay(t time.Time) time.Duration {
+	return time.Duration(t.Hour())*time.Hour +
+		time.Duration(t.Minute())*time.Minute +
+		time.Duration(t.Second())*time.Second +
+		time.Duration(t.Nanosecond())
+}
+
+// atTimeOfDay returns the time tod on the clock, days after the day of t.
+func atTimeOfDay(t time.Time, days int, tod time.Duration) time.Time {
+	var (
+		y, m, d = t.Date()
+		h       = int(tod / time.Hour)
+		min     = int(tod % time.Hour / time.Minute)
+		sec     = int(tod % time.Minute / time.Second)
+	)
+	return time.Date(y, m, d+days, h, min, sec, int(tod%time.Second), t.Location())
+}
+
+// WithRunWindows only lets a job start within the allowed windows and
+// outside of the blocked ones, see RunWindows.TimeZone.
+// A job that is due to start outside of them waits for the next time it can
+// start, without holding up other jobs in the meantime. Retries wait too.
+func WithRunWindows(windows RunWindows) JobOption {
+	return func(job *Job) error {
+		if err := windows.validate(); err != nil {
+			return err
+		}
+		job.windows = windows
+		return nil
+	}
+}
@@ -0,0 +1,111 @@
+package exec_test
+
+import (
+	"os"
+	osexec "os/exec"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/scgolang/exec"
+	"github.com/scgolang/exec/exectest"
+)
+
+func TestGroupsEnqueueRunWindows(t *testing.T) {
+	root := filepath.Join("testdata", "."+t.Name())
+	_ = os.RemoveAll(root)
+
+	// A Monday during office hours.
+	clock := exectest.NewClock(time.Date(2006, 1, 2, 10, 0, 0, 0, time.UTC))
+	gs, err := exec.New(root, exec.WithClock(clock))
+	if err != nil {
+		t.Fatal(err)
+	}
+	office, err := exec.ParseTimeWindow("09:00-17:00")
+	if err != nil {
+		t.Fatal(err)
+	}
+	job, err := gs.Enqueue("batch", osexec.Command("true"), exec.WithRunWindows(exec.RunWindows{
+		Blocked: []exec.TimeWindow{office},
+	}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for deadline := time.Now().Add(5 * time.Second); clock.Waiters() == 0; time.Sleep(10 * time.Millisecond) {
+		if time.Now().After(deadline) {
+			t.Fatal("timeout waiting for the job to be deferred")
+		}
+	}
+	if _, ok := job.Result(); ok {
+		t.Fatal("expected the job to wait for the window to close")
+	}
+	clock.Advance(7 * time.Hour)
+
+	if err := job.Wait(); err != nil {
+		t.Fatal(err)
+	}
+	result, _ := job.Result()
+	if expected, got := time.Date(2006, 1, 2, 17, 0, 0, 0, time.UTC), result.Started; got.Before(expected) {
+		t.Fatalf("expected the job to start at %s or later, got %s", expected, got)
+	}
+	// A job that is always blocked never starts.
+	never, err := gs.Enqueue("batch", osexec.Command("true"), exec.WithRunWindows(exec.RunWindows{
+		Allowed: []exec.TimeWindow{office},
+		Blocked: []exec.TimeWindow{{}},
+	}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := never.Wait(); err == nil {
+		t.Fatal("expected an error, got nil")
+	}
+	if _, err := exec.ParseTimeWindow("9 to 5"); err == nil {
+		t.Fatal("expected an error, got nil")
+	}
+	if _, err := gs.Enqueue("batch", osexec.Command("true"), exec.WithRunWindows(exec.RunWindows{
+		Allowed: []exec.TimeWindow{{Start: 25 * time.Hour}},
+	})); err == nil {
+		t.Fatal("expected an error, got nil")
+	}
+}
+
+func TestGroupsEnqueueRunWindowsTimeZone(t *testing.T) {
+	root := filepath.Join("testdata", "."+t.Name())
+	_ = os.RemoveAll(root)
+
+	// 10:00 in New York, where office hours end at 22:00 UTC.
+	clock := exectest.NewClock(time.Date(2006, 1, 2, 15, 0, 0, 0, time.UTC))
+	gs, err := exec.New(root, exec.WithClock(clock))
+	if err != nil {
+		t.Fatal(err)
+	}
+	office, err := exec.ParseTimeWindow("09:00-17:00")
+	if err != nil {
+		t.Fatal(err)
+	}
+	job, err := gs.Enqueue("batch", osexec.Command("true"), exec.WithRunWindows(exec.RunWindows{
+		Blocked:  []exec.TimeWindow{office},
+		TimeZone: "America/New_York",
+	}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for deadline := time.Now().Add(5 * time.Second); clock.Waiters() == 0; time.Sleep(10 * time.Millisecond) {
+		if time.Now().After(deadline) {
+			t.Fatal("timeout waiting for the job to be deferred")
+		}
+	}
+	clock.Advance(6 * time.Hour)
+
+	if _, ok := job.Result(); ok {
+		t.Fatal("expected the job to wait for the window to close in New York")
+	}
+	clock.Advance(time.Hour)
+
+	if err := job.Wait(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := gs.Enqueue("batch", osexec.Command("true"), exec.WithRunWindows(exec.RunWindows{TimeZone: "Nowhere/Special"})); err == nil {
+		t.Fatal("expected an error, got nil")
+	}
+}
@@ -0,0 +1,398 @@
+package exec
+
+import (
+	"bytes"
+	"encoding/json"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// The group definitions are written and read as YAML without a YAML library.
+// They only need the block style subset of YAML: mappings, sequences, and
+// single line scalars, so values are converted from and to JSON, which
+// decides their types.
+
+// yamlField is an entry of a YAML mapping.
+type yamlField struct {
+	key   string
+	value interface{}
+}
+
+// yamlMap is a YAML mapping that keeps the order of its keys.
+type yamlMap []yamlField
+
+// encodeYAML encodes v, which must be encodable as JSON, as block style YAML.
+func encodeYAML(v interface{}) ([]byte, error) {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+
+	node, err := decodeOrdered(dec)
+	if err != nil {
+		return nil, err
+	}
+	var b bytes.Buffer
+	if isYAMLBlock(node) {
+		writeYAMLBlock(&b, node, 0, false)
+	} else {
+		b.WriteString(yamlScalar(node) + "\n")
+	}
+	return b.Bytes(), nil
+}
+
+// decodeOrdered decodes the next JSON value from dec, keeping objects in order as yamlMaps.
+func decodeOrdered(dec *json.Decoder) (interface{}, error) {
+	tok, err := dec.Token()
+	if err != nil {
+		return nil, err
+	}
+	switch tok {
+	case json.Delim('{'):
+		m := yamlMap{}
+		for dec.More() {
+			key, err := dec.Token()
+			if err != nil {
+				return nil, err
+			}
+			value, err := decodeOrdered(dec)
+			if err != nil {
+				return nil, err
+			}
+			m = append(m, yamlField{key: key.(string), value: value})
+		}
+		_, err := dec.Token()
+		return m, err
+	case json.Delim('['):
+		list := []interface{}{}
+		for dec.More() {
+			value, err := decodeOrdered(dec)
+			if err != nil {
+				return nil, err
+			}
+			list = append(list, value)
+		}
+		_, err := dec.Token()
+		return list, err
+	}
+	return tok, nil
+}
+
+// writeYAMLBlock writes a non-empty mapping or sequence indented by indent spaces.
+// If inline is true the indentation of the first line has already been written.
+func writeYAMLBlock(b *bytes.Buffer, v interface{}, indent int, inline bool) {
+	pad := strings.Repeat(" ", indent)
+
+	switch v := v.(type) {
+	case yamlMap:
+		for i, f := range v {
+			if i > 0 || !inline {
+				b.WriteString(pad)
+			}
+			b.WriteString(yamlKey(f.key) + ":")
+
+			if isYAMLBlock(f.value) {
+				b.WriteString("\n")
+				writeYAMLBlock(b, f.value, indent+2, false)
+			} else {
+				b.WriteString(" " + yamlScalar(f.value) + "\n")
+			}
+		}
+	case []interface{}:
+		for i, item := range v {
+			if i > 0 || !inline {
+				b.WriteString(pad)
+			}
+			b.WriteString("- ")
+
+			if isYAMLBlock(item) {
+				writeYAMLBlock(b, item, indent+2, true)
+			} else {
+				b.WriteString(yamlScalar(item) + "\n")
+			}
+		}
+	}
+}
+
+// isYAMLBlock returns true if v is written on lines of its own.
+func isYAMLBlock(v interface{}) bool {
+	switch v := v.(type) {
+	case yamlMap:
+		return len(v) > 0
+	case []interface{}:
+		return len(v) > 0
+	}
+	return false
+}
+
+// yamlKey returns a mapping key, quoted unless it is plain.
+func yamlKey(key string) string {
+	switch strings.ToLower(key) {
+	case "", "true", "false", "null", "yes", "no", "on", "off":
+		return strconv.Quote(key)
+	}
+	for _, r := range key {
+		if !(r == '_' || r == '-' || r == '.' || r >= '0' && r <= '9' || r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z') {
+			return strconv.Quote(key)
+		}
+	}
+	return key
+}
+
+// yamlScalar returns a value that is written on the line of its key or sequence item.
+// Strings are always quoted, so they are never mistaken for values of another type.
+func yamlScalar(v interface{}) string {
+	switch v := v.(type) {
+	case yamlMap:
+		return "{}"
+	case []interface{}:
+		return "[]"
+	case string:
+		return strconv.Quote(v)
+	case json.Number:
+		return v.String()
+	case bool:
+		return strconv.FormatBool(v)
+	}
+	return "null"
+}
+
+// yamlLine is a line of YAML that is not blank or a comment.
+type yamlLine struct {
+	num    int
+	indent int
+	text   string
+}
+
+// yamlParser parses the block style subset of YAML that encodeYAML writes.
+type yamlParser struct {
+	lines []yamlLine
+	pos   int
+}
+
+// yamlToJSON converts a YAML document to JSON.
+func yamlToJSON(data []byte) ([]byte, error) {
+	p := &yamlParser{}
+
+	for i, line := range strings.Split(string(data), "\n") {
+		line = strings.TrimRight(line, " \t\r")
+		text := strings.TrimLeft(line, " ")
+
+		if text == "" || text[0] == '#' || text == "---" || text == "..." {
+			continue
+		}
+		if text[0] == '\t' {
+			return nil, errors.Errorf("line %d: tabs must not be used for indentation", i+1)
+		}
+		p.lines = append(p.lines, yamlLine{num: i + 1, indent: len(line) - len(text), text: text})
+	}
+	if len(p.lines) == 0 {
+		return []byte("null"), nil
+	}
+	v, err := p.parseBlock()
+	if err != nil {
+		return nil, err
+	}
+	if p.pos < len(p.lines) {
+		return nil, p.errorf("unexpected indentation")
+	}
+	return json.Marshal(v)
+}
+
+// errorf returns an error about the current line.
+func (p *yamlParser) errorf(format string, args ...interface{}) error {
+	num := p.lines[len(p.lines)-1].num
+	if p.pos < len(p.lines) {
+		num = p.lines[p.pos].num
+	}
+	return errors.Errorf("line %d: "+format, append([]interface{}{num}, args...)...)
+}
+
+// parseBlock parses the node that starts at the current line.
+func (p *yamlParser) parseBlock() (interface{}, error) {
+	line := p.lines[p.pos]
+
+	if isYAMLItem(line.text) {
+		return p.parseSequence(line.indent)
+	}
+	if _, _, ok, err := splitYAMLKey(line.text); err != nil {
+		return nil, p.errorf("%s", err)
+	} else if ok {
+		return p.parseMapping(line.indent)
+	}
+	p.pos++
+	v, err := parseYAMLScalar(line.text)
+	if err != nil {
+		p.pos--
+		return nil, p.errorf("%s", err)
+	}
+	return v, nil
+}
+
+// parseMapping parses the entries of a mapping that are indented by indent spaces.
+func (p *yamlParser) parseMapping(indent int) (map[string]interface{}, error) {
+	m := map[string]interface{}{}
+
+	for p.pos < len(p.lines) && p.lines[p.pos].indent == indent && !isYAMLItem(p.lines[p.pos].text) {
+		key, rest, ok, err := splitYAMLKey(p.lines[p.pos].text)
+		if err != nil {
+			return nil, p.errorf("%s", err)
+		}
+		if !ok {
+			return nil, p.errorf("expected a mapping key")
+		}
+		if _, ok := m[key]; ok {
+			return nil, p.errorf("duplicate key %s", key)
+		}
+		if rest != "" && rest[0] != '#' {
+			if m[key], err = parseYAMLScalar(rest); err != nil {
+				return nil, p.errorf("%s", err)
+			}
+			p.pos++
+			continue
+		}
+		p.pos++
+
+		// Sequences may be indented as much as their key.
+		if p.pos < len(p.lines) {
+			if next := p.lines[p.pos]; next.indent > indent || (next.indent == indent && isYAMLItem(next.text)) {
+				if m[key], err = p.parseBlock(); err != nil {
+					return nil, err
+				}
+				continue
+			}
+		}
+		m[key] = nil
+	}
+	return m, nil
+}
+
+// parseSequence parses the items of a sequence that are indented by indent spaces.
+func (p *yamlParser) parseSequence(indent int) ([]interface{}, error) {
+	list := []interface{}{}
+
+	for p.pos < len(p.lines) && p.lines[p.pos].indent == indent && isYAMLItem(p.lines[p.pos].text) {
+		var (
+			line = p.lines[p.pos]
+			rest = strings.TrimLeft(line.text[1:], " ")
+		)
+		if rest == "" || rest[0] == '#' {
+			p.pos++
+			if p.pos < len(p.lines) && p.lines[p.pos].indent > indent {
+				item, err := p.parseBlock()
+				if err != nil {
+					return nil, err
+				}
+				list = append(list, item)
+			} else {
+				list = append(list, nil)
+			}
+			continue
+		}
+		// The item starts a node of its own, indented to where its text starts.
+		p.lines[p.pos] = yamlLine{num: line.num, indent: indent + len(line.text) - len(rest), text: rest}
+
+		item, err := p.parseBlock()
+		if err != nil {
+			return nil, err
+		}
+		list = append(list, item)
+	}
+	return list, nil
+}
+
+// isYAMLItem returns true if text is a sequence item.
+func isYAMLItem(text string) bool {
+	return text == "-" || strings.HasPrefix(text, "- ")
+}
+
+// splitYAMLKey splits a mapping entry into its key and the rest of the line.
+// It returns false if text is not a mapping entry.
+func splitYAMLKey(text string) (string, string, bool, error) {
+	if text[0] == '"' || text[0] == '\'' {
+		key, n, err := unquoteYAML(text)
+		if err != nil {
+			return "", "", false, err
+		}
+		if rest := text[n:]; rest == ":" || strings.HasPrefix(rest, ": ") {
+			return key, strings.TrimSpace(rest[1:]), true, nil
+		}
+		return "", "", false, nil
+	}
+	for i := 0; i < len(text); i++ {
+		if text[i] == ':' && (i+1 == len(text) || text[i+1] == ' ') {
+			return strings.TrimRight(text[:i], " "), strings.TrimSpace(text[i+1:]), true, nil
+		}
+		if text[i] == '#' && i > 0 && text[i-1] == ' ' {
+			break
+		}
+	}
+	return "", "", false, nil
+}
+
+// parseYAMLScalar parses a value that is written on a single line.
+func parseYAMLScalar(text string) (interface{}, error) {
+	if text[0] == '"' || text[0] == '\'' {
+		s, n, err := unquoteYAML(text)
+		if err != nil {
+			return nil, err
+		}
+		if rest := strings.TrimLeft(text[n:], " "); rest != "" && rest[0] != '#' {
+			return nil, errors.Errorf("unexpected %q after quoted string", rest)
+		}
+		return s, nil
+	}
+	if i := strings.Index(text, " #"); i >= 0 {
+		text = strings.TrimRight(text[:i], " ")
+	}
+	switch text {
+	case "", "~", "null", "Null", "NULL":
+		return nil, nil
+	case "true", "True", "TRUE":
+		return true, nil
+	case "false", "False", "FALSE":
+		return false, nil
+	case "[]":
+		return []interface{}{}, nil
+	case "{}":
+		return map[string]interface{}{}, nil
+	}
+	switch text[0] {
+	case '[', '{':
+		return nil, errors.New("flow collections are not supported")
+	case '|', '>':
+		return nil, errors.New("block scalars are not supported")
+	case '&', '*', '!':
+		return nil, errors.New("anchors, aliases, and tags are not supported")
+	}
+	if (text[0] == '-' || text[0] >= '0' && text[0] <= '9') && json.Valid([]byte(text)) {
+		return json.Number(text), nil
+	}
+	return text, nil
+}
+
+// unquoteYAML unquotes the quoted string that text starts with,
+// and returns it and the length of its quoted form.
+func unquoteYAML(text string) (string, int, error) {
+	quote := text[0]
+
+	for i := 1; i < len(text); i++ {
+		switch {
+		case quote == '"' && text[i] == '\\':
+			i++
+		case quote == '\'' && text[i] == '\'' && i+1 < len(text) && text[i+1] == '\'':
+			i++
+		case text[i] == quote:
+			if quote == '\'' {
+				return strings.Replace(text[1:i], "''", "'", -1), i + 1, nil
+			}
+			s, err := strconv.Unquote(text[:i+1])
+			return s, i + 1, errors.Wrap(err, "unquoting string")
+		}
+	}
+	return "", 0, errors.New("unterminated quoted string")
+}